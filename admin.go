@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/syslog"
+)
+
+// serveAdmin starts the HTTP server exposing the admin endpoints on addr.
+func serveAdmin(addr string, dests []destination, drainchan chan<- destination, loglevel *logLevel, taps *tapSet) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deliveries", deliveriesHandler(dests))
+	mux.HandleFunc("/destinations", destinationsHandler(dests))
+	mux.HandleFunc("/costs", costsHandler(dests))
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/drain", drainHandler(dests, drainchan))
+	mux.HandleFunc("/resume", resumeHandler(dests))
+	mux.HandleFunc("/log-level", logLevelHandler(loglevel))
+	mux.HandleFunc("/taps", tapsHandler(taps))
+	mux.HandleFunc("/syslog/endpoints", syslogEndpointsHandler)
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("admin: %v", err)
+		}
+	}()
+}
+
+// deliveriesHandler responds with the delivery ledger of each destination,
+// the results can be filtered with the destination, group and stream query
+// parameters.
+func deliveriesHandler(dests []destination) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		group := q.Get("group")
+		stream := q.Get("stream")
+		report := make(map[string][]lib.Delivery, len(dests))
+
+		for _, dest := range dests {
+			if name := q.Get("destination"); len(name) != 0 && name != dest.name {
+				continue
+			}
+
+			list := make([]lib.Delivery, 0, 100)
+
+			for _, d := range dest.ledger.Deliveries() {
+				if (len(group) == 0 || group == d.Group) && (len(stream) == 0 || stream == d.Stream) {
+					list = append(list, d)
+				}
+			}
+
+			report[dest.name] = list
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(report)
+	}
+}
+
+// destinationsHandler responds with the state of each destination.
+func destinationsHandler(dests []destination) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		report := make(map[string]string, len(dests))
+
+		for _, dest := range dests {
+			report[dest.name] = dest.status()
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(report)
+	}
+}
+
+// costsHandler responds with the estimated ingestion cost of each group on the
+// destinations with a price, since the last cost report.
+func costsHandler(dests []destination) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		report := make(map[string][]lib.Cost, len(dests))
+
+		for _, dest := range dests {
+			if dest.cost != nil {
+				report[dest.name] = dest.cost.Costs()
+			}
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(report)
+	}
+}
+
+// metricsHandler responds with the metrics reported by the destinations, in
+// the Prometheus text format.
+func metricsHandler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	lib.Metrics.WriteTo(res)
+}
+
+// syslogEndpointsHandler responds with the health of the endpoints the syslog
+// destination fans messages out to.
+func syslogEndpointsHandler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(syslog.Health())
+}
+
+// drainHandler puts the destination set by the query parameter in draining
+// mode, the state of the destination can then be polled on /destinations.
+func drainHandler(dests []destination, drainchan chan<- destination) http.HandlerFunc {
+	return destinationCommand(dests, func(dest destination) {
+		drainchan <- dest
+	})
+}
+
+// resumeHandler sends batches to a drained destination again.
+func resumeHandler(dests []destination) http.HandlerFunc {
+	return destinationCommand(dests, func(dest destination) {
+		dest.resume()
+		log.WithField("destination", dest.name).Info("destination resumed")
+	})
+}
+
+// logLevelHandler responds with the current level of the program's logs, or
+// changes it to the one set by the level query parameter on POST requests.
+func logLevelHandler(loglevel *logLevel) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+		case "POST":
+			lvl, err := log.ParseLevel(req.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			loglevel.set(lvl)
+			log.WithField("level", lvl.String()).Info("log level changed")
+		default:
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]string{"level": loglevel.get().String()})
+	}
+}
+
+// tapsHandler responds with the list of open taps. POST requests open a tap on
+// the group and stream set by the query parameters, for the duration set by
+// the duration parameter, and DELETE requests close the taps on the group and
+// stream.
+func tapsHandler(taps *tapSet) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		group := q.Get("group")
+		stream := q.Get("stream")
+
+		switch req.Method {
+		case "GET":
+		case "POST":
+			duration := defaultTapDuration
+
+			if s := q.Get("duration"); len(s) != 0 {
+				var err error
+				if duration, err = time.ParseDuration(s); err != nil {
+					http.Error(res, "invalid duration: "+s, http.StatusBadRequest)
+					return
+				}
+			}
+
+			t, err := taps.open(group, stream, duration, false, time.Now())
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusCreated)
+			json.NewEncoder(res).Encode(t)
+			return
+		case "DELETE":
+			if taps.closeMatching(group, stream) == 0 {
+				http.Error(res, "no tap on "+group+"/"+stream, http.StatusNotFound)
+				return
+			}
+		default:
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(taps.list())
+	}
+}
+
+func destinationCommand(dests []destination, cmd func(destination)) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("destination")
+
+		for _, dest := range dests {
+			if dest.name == name {
+				cmd(dest)
+				res.WriteHeader(http.StatusAccepted)
+				return
+			}
+		}
+
+		http.Error(res, "unknown destination: "+name, http.StatusNotFound)
+	}
+}
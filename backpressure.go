@@ -0,0 +1,109 @@
+package main
+
+import "sync/atomic"
+
+// backpressure counts the messages that were flushed but not yet written to
+// the destinations. The sources stop being read when there are more than
+// limit of them, and are read again once half of them were written, so slow
+// destinations don't make the pending batches grow unbounded. The journald
+// reader blocks until then, leaving the entries in the journal.
+//
+// A nil backpressure never pauses the sources.
+type backpressure struct {
+	limit   int64
+	pending int64
+
+	// Signaled when the pending messages go back under the low watermark, to
+	// wake up the main loop.
+	resume chan struct{}
+}
+
+func newBackpressure(limit int) *backpressure {
+	if limit <= 0 {
+		return nil
+	}
+	return &backpressure{
+		limit:  int64(limit),
+		resume: make(chan struct{}, 1),
+	}
+}
+
+func (b *backpressure) add(n int) {
+	if b != nil {
+		atomic.AddInt64(&b.pending, int64(n))
+	}
+}
+
+func (b *backpressure) done(n int) {
+	if b == nil {
+		return
+	}
+
+	low := b.limit / 2
+	now := atomic.AddInt64(&b.pending, -int64(n))
+
+	if now <= low && now+int64(n) > low {
+		select {
+		case b.resume <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// paused returns whether the sources shouldn't be read, resumed is whether
+// they were being read before the call.
+func (b *backpressure) paused(resumed bool) bool {
+	if b == nil {
+		return false
+	}
+
+	pending := atomic.LoadInt64(&b.pending)
+
+	if resumed {
+		return pending > b.limit
+	}
+	return pending > b.limit/2
+}
+
+// batch counts the n messages of a flushed batch as pending until all the
+// copies written to the destinations are done, so the messages are counted
+// once however many destinations they are written to. The caller holds a
+// reference it releases with done once it started the writes.
+func (b *backpressure) batch(n int) *pendingBatch {
+	if b == nil {
+		return nil
+	}
+	b.add(n)
+	return &pendingBatch{backpressure: b, count: n, refs: 1}
+}
+
+// wake returns the channel signaled when the sources may be read again.
+func (b *backpressure) wake() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	return b.resume
+}
+
+// pendingBatch is a batch of messages counted by a backpressure, shared by the
+// writes of its copies.
+type pendingBatch struct {
+	*backpressure
+	count int
+	refs  int32
+}
+
+// hold adds a reference to the batch, for a copy being written.
+func (p *pendingBatch) hold() {
+	if p != nil {
+		atomic.AddInt32(&p.refs, 1)
+	}
+}
+
+// done releases a reference to the batch, its messages stop being pending
+// when the last one is released.
+func (p *pendingBatch) done() {
+	if p != nil && atomic.AddInt32(&p.refs, -1) == 0 {
+		p.backpressure.done(p.count)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// canaryGroup is the group canary events are written to, their stream is the
+// hostname.
+const canaryGroup = "ecs-logs-canary"
+
+// runCanaries sends canaries to the destinations at each interval, ticks are
+// skipped while the previous canaries are still being sent or verified.
+func runCanaries(dests []destination, hostname string, interval time.Duration) {
+	ids, _ := lib.NewIDGenerator(lib.IDUUIDv7, 0)
+	pending := make(map[string]lib.Message, len(dests))
+	ticker := time.NewTicker(interval)
+
+	for now := range ticker.C {
+		sendCanaries(dests, hostname, ids, pending, now)
+	}
+}
+
+// sendCanaries writes a synthetic event to each of the active destinations,
+// bypassing the streams and the retries, and records whether the destinations
+// accepted them. Failing canaries catch errors that don't show up in the
+// normal traffic, like a destination that stopped receiving any messages.
+//
+// The canaries accepted by destinations that can be read back are kept in
+// pending and searched for on the next call, which catches destinations that
+// accept events without storing them. The ecs_logs_canary_healthy gauge of a
+// destination is 1 when its last canary was delivered, 0 otherwise.
+func sendCanaries(dests []destination, hostname string, ids lib.IDGenerator, pending map[string]lib.Message, now time.Time) {
+	for _, dest := range dests {
+		if !dest.active() {
+			continue
+		}
+
+		healthy := lib.Metrics.Gauge("ecs_logs_canary_healthy", "destination", dest.name)
+		verify := lib.CanaryVerifier(dest.name)
+
+		if msg, ok := pending[dest.name]; ok {
+			delete(pending, dest.name)
+
+			if err := verify(msg); err != nil {
+				healthy.Set(0)
+				lib.Metrics.Counter("ecs_logs_canary_failures_total", "destination", dest.name).Add(1)
+				log.WithFields(log.Fields{
+					"destination": dest.name,
+					"id":          msg.Event.Info.ID,
+					"error":       err,
+				}).Error("canary event was accepted but could not be read back")
+			} else {
+				healthy.Set(1)
+			}
+		}
+
+		id := ids.NewID(now)
+		event := ecslogs.MakeEvent(ecslogs.INFO, "canary "+id)
+		event.Time = now
+		event.Info.Host = hostname
+		event.Info.ID = id
+		event.Data = ecslogs.EventData{
+			"destination": dest.name,
+			"canary":      true,
+		}
+
+		msg := lib.Message{
+			Group:  canaryGroup,
+			Stream: hostname,
+			Event:  event,
+		}
+
+		start := time.Now()
+		err := writeOnce(dest, canaryGroup, hostname, lib.MessageBatch{msg})
+
+		lib.Metrics.Timer("ecs_logs_canary_seconds", "destination", dest.name).Observe(time.Now().Sub(start))
+		lib.Metrics.Counter("ecs_logs_canaries_total", "destination", dest.name).Add(1)
+
+		switch {
+		case err != nil:
+			healthy.Set(0)
+			lib.Metrics.Counter("ecs_logs_canary_failures_total", "destination", dest.name).Add(1)
+			log.WithFields(log.Fields{
+				"destination": dest.name,
+				"error":       err,
+			}).Error("canary event was not delivered")
+
+		case verify != nil:
+			pending[dest.name] = msg
+
+		default:
+			healthy.Set(1)
+		}
+	}
+}
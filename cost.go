@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// parseCosts parses a comma separated list of destination:price pairs.
+func parseCosts(s string, dests []destination) (prices map[string]float64, err error) {
+	prices = make(map[string]float64)
+
+	if len(s) == 0 {
+		return
+	}
+
+	err = parsePairs(s, "price", dests, func(dest string, value string) error {
+		price, err := strconv.ParseFloat(value, 64)
+		if err == nil && price < 0 {
+			err = errInvalidValue
+		}
+		prices[dest] = price
+		return err
+	})
+	return
+}
+
+// reportCosts queues a summary event for each group with the estimated cost of
+// the events delivered to each destination since the last report.
+func reportCosts(dests []destination, queue *lib.MessageQueue, hostname string, now time.Time) {
+	for _, dest := range dests {
+		if dest.cost == nil {
+			continue
+		}
+
+		for _, c := range dest.cost.Reset() {
+			event := ecslogs.MakeEvent(ecslogs.INFO, "cost report")
+			event.Time = now
+			event.Info.Host = hostname
+			event.Data = ecslogs.EventData{
+				"destination": dest.name,
+				"group":       c.Group,
+				"bytes":       c.Bytes,
+				"cost":        c.Cost,
+			}
+
+			queue.Push(lib.Message{
+				Group:  "ecs-logs",
+				Stream: hostname,
+				Event:  event,
+			})
+		}
+	}
+
+	queue.Notify()
+}
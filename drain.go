@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// States of a destination, draining destinations don't receive new batches
+// and become drained once all their in-flight batches have been written.
+const (
+	destinationActive int32 = iota
+	destinationDraining
+	destinationDrained
+)
+
+var destinationStates = [...]string{
+	destinationActive:   "active",
+	destinationDraining: "draining",
+	destinationDrained:  "drained",
+}
+
+type destinationState struct {
+	// Number of batches being written, first in the struct so it's aligned
+	// for atomic operations.
+	inflight int64
+
+	state int32
+
+	// Number of messages dropped because they couldn't be written, or not
+	// sent because the destination was drained, and
+	// whether the last write failed because the destination was throttled or
+	// unreachable.
+	dropped int64
+	skipped int64
+	failed  int32
+
+	// Counts the messages not sent because the destination was drained in
+	// the ecs_logs_drained_messages_total metric.
+	skippedTotal *lib.Counter
+
+	// Last error returned by the destination and the time it occurred.
+	mutex       sync.Mutex
+	lastError   error
+	lastErrorOn time.Time
+}
+
+func newDestinationState(name string) *destinationState {
+	return &destinationState{
+		skippedTotal: lib.Metrics.Counter("ecs_logs_drained_messages_total", "destination", name),
+	}
+}
+
+func (d destination) active() bool {
+	return atomic.LoadInt32(&d.state.state) == destinationActive
+}
+
+func (d destination) status() string {
+	return destinationStates[atomic.LoadInt32(&d.state.state)]
+}
+
+// failed records the error returned by a write, the destination is only
+// considered down when it was throttled or unreachable, other errors are
+// caused by the batch and don't say anything about the destination.
+func (d destination) failed(err error, now time.Time) {
+	switch lib.ErrorKindOf(err) {
+	case lib.ThrottledError, lib.UnreachableError:
+		atomic.StoreInt32(&d.state.failed, 1)
+	}
+	d.state.mutex.Lock()
+	d.state.lastError, d.state.lastErrorOn = err, now
+	d.state.mutex.Unlock()
+}
+
+func (d destination) succeeded() {
+	atomic.StoreInt32(&d.state.failed, 0)
+}
+
+func (d destination) failing() bool {
+	return atomic.LoadInt32(&d.state.failed) != 0
+}
+
+func (d destination) drop(batch lib.MessageBatch) {
+	atomic.AddInt64(&d.state.dropped, int64(len(batch)))
+}
+
+func (d destination) droppedCount() int64 {
+	return atomic.LoadInt64(&d.state.dropped)
+}
+
+func (d destination) lastError() (err error, on time.Time) {
+	d.state.mutex.Lock()
+	err, on = d.state.lastError, d.state.lastErrorOn
+	d.state.mutex.Unlock()
+	return
+}
+
+// started is called when a batch is sent to the destination.
+func (d destination) started() {
+	atomic.AddInt64(&d.state.inflight, 1)
+}
+
+// finished is called once a batch sent to the destination was written or
+// dropped, the destination becomes drained after its last in-flight batch.
+func (d destination) finished() {
+	if atomic.AddInt64(&d.state.inflight, -1) == 0 {
+		d.drained()
+	}
+}
+
+func (d destination) drained() {
+	if atomic.CompareAndSwapInt32(&d.state.state, destinationDraining, destinationDrained) {
+		log.WithField("destination", d.name).Info("destination drained")
+	}
+}
+
+// skip counts the messages of a batch that aren't sent to the destination
+// because it's drained or draining.
+func (d destination) skip(batch lib.MessageBatch) {
+	atomic.AddInt64(&d.state.skipped, int64(len(batch)))
+	d.state.skippedTotal.Add(int64(len(batch)))
+}
+
+func (d destination) skippedCount() int64 {
+	return atomic.LoadInt64(&d.state.skipped)
+}
+
+func (d destination) resume() {
+	atomic.StoreInt32(&d.state.state, destinationActive)
+}
+
+// drain stops sending batches to the destination, all streams are flushed
+// first so no messages received before the drain was requested are lost.
+// It must be called from the goroutine that owns the store.
+func drain(dests []destination, dest destination, store *lib.Store, limits lib.StreamLimits, now time.Time, join *sync.WaitGroup) {
+	if !dest.active() {
+		return
+	}
+
+	limits.Force = true
+	flushAll(dests, store, limits, now, join)
+
+	atomic.StoreInt32(&dest.state.state, destinationDraining)
+	log.WithField("destination", dest.name).Info("draining destination")
+
+	if atomic.LoadInt64(&dest.state.inflight) == 0 {
+		dest.drained()
+	}
+}
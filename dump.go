@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/syslog"
+)
+
+// writeStateDump appends the state report to the file at path, or writes it
+// to stderr if path is empty.
+// It must be called from the goroutine that owns the store.
+func writeStateDump(path string, dests []destination, store *lib.Store, now time.Time) {
+	var w io.Writer = os.Stderr
+
+	if len(path) != 0 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.WithError(err).Error("failed to open state dump file")
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	dumpState(w, dests, store, now)
+}
+
+// dumpState writes a human readable report of the streams buffered in the
+// store, of the state and queues of each destination, and of the syslog
+// connections to w, for debugging agents that seem to be stuck.
+func dumpState(w io.Writer, dests []destination, store *lib.Store, now time.Time) {
+	fmt.Fprintf(w, "ecs-logs state at %s\n", now.Format(time.RFC3339))
+
+	fmt.Fprintf(w, "\nstreams:\n")
+	store.ForEach(func(group *lib.Group) {
+		group.ForEach(func(stream *lib.Stream) {
+			messages, bytes := stream.Pending()
+			fmt.Fprintf(w, "  %s/%s: %d messages, %d bytes pending\n", stream.Group(), stream.Name(), messages, bytes)
+		})
+	})
+
+	if len(dests) != 0 && dests[0].pending != nil {
+		// The count of messages being written is shared by the destinations.
+		p := dests[0].pending
+		fmt.Fprintf(w, "\n%d messages being written, sources paused above %d\n", atomic.LoadInt64(&p.pending), p.limit)
+	}
+
+	fmt.Fprintf(w, "\ndestinations:\n")
+	for _, dest := range dests {
+		fmt.Fprintf(w, "  %s: %s\n", dest.name, dest.status())
+		fmt.Fprintf(w, "    %d batches in flight", atomic.LoadInt64(&dest.state.inflight))
+
+		if dest.window != nil {
+			fmt.Fprintf(w, ", %d of %d write slots taken", len(dest.window), cap(dest.window))
+		}
+
+		fmt.Fprintf(w, "\n")
+
+		if n := dest.skippedCount(); n != 0 {
+			fmt.Fprintf(w, "    %d messages not sent while drained\n", n)
+		}
+
+		if err, on := dest.lastError(); err != nil {
+			fmt.Fprintf(w, "    last error at %s: %s\n", on.Format(time.RFC3339), err)
+		}
+
+		for _, d := range dest.ledger.Deliveries() {
+			fmt.Fprintf(w, "    %s/%s: %d messages delivered at %s", d.Group, d.Stream, d.Count, d.DeliveredOn.Format(time.RFC3339))
+
+			if len(d.Cursor) != 0 {
+				fmt.Fprintf(w, ", cursor %s", d.Cursor)
+			}
+
+			if d.Expired {
+				fmt.Fprintf(w, ", expired")
+			}
+
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	if conns := syslog.Connections(); len(conns) != 0 {
+		fmt.Fprintf(w, "\nsyslog connections:\n")
+		for _, c := range conns {
+			fmt.Fprintf(w, "  %s://%s: %d live, %d idle, %d max\n", c.Network, c.Address, c.Live, c.Idle, c.Size)
+		}
+	}
+
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,13 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func setupDumpSignal(dumpchan chan<- os.Signal) {
+	signal.Notify(dumpchan, syscall.SIGUSR1)
+}
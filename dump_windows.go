@@ -0,0 +1,8 @@
+// +build windows
+
+package main
+
+import "os"
+
+// There is no SIGUSR1 on windows, the state report isn't available.
+func setupDumpSignal(dumpchan chan<- os.Signal) {}
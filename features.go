@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// features are the settings read from the file set by -features-file, which
+// can be changed while the program is running, for example by a configuration
+// management tool updating the file on all the hosts of a fleet.
+type features struct {
+	// Level of the program's logs, the one it was started with when empty.
+	LogLevel string `json:"log_level,omitempty"`
+
+	// Destinations to drain.
+	Drain []string `json:"drain,omitempty"`
+
+	// Events to discard, and to keep only a fraction of.
+	Filters []featureFilter `json:"filters,omitempty"`
+	Samples []featureSample `json:"samples,omitempty"`
+
+	// Debugging taps to keep open.
+	Taps []featureTap `json:"taps,omitempty"`
+}
+
+// featureFilter discards the events of a group, or of a single stream when it
+// is set, that have a level in Levels, or all of them when it is empty.
+type featureFilter struct {
+	Group  string `json:"group"`
+	Stream string `json:"stream,omitempty"`
+	Levels string `json:"levels,omitempty"`
+
+	levels *lib.LevelRange
+}
+
+// featureSample keeps a random fraction of the events of a group, or of a
+// single stream when it is set, and discards the others.
+type featureSample struct {
+	Group  string  `json:"group"`
+	Stream string  `json:"stream,omitempty"`
+	Rate   float64 `json:"rate"`
+}
+
+type featureTap struct {
+	Group    string `json:"group"`
+	Stream   string `json:"stream,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// parseFeatures parses the content of a features file, the drained
+// destinations must be one of dests.
+func parseFeatures(b []byte, dests []destination) (f features, err error) {
+	if err = json.Unmarshal(b, &f); err != nil {
+		return
+	}
+
+	if len(f.LogLevel) != 0 {
+		if _, err = log.ParseLevel(f.LogLevel); err != nil {
+			return
+		}
+	}
+
+	for _, name := range f.Drain {
+		if !hasDestination(dests, name) {
+			err = fmt.Errorf("unknown destination: %s", name)
+			return
+		}
+	}
+
+	for i, x := range f.Filters {
+		if len(x.Group) == 0 {
+			err = fmt.Errorf("missing filter group")
+			return
+		}
+		if len(x.Levels) != 0 {
+			var r lib.LevelRange
+			if r, err = lib.ParseLevelRange(x.Levels); err != nil {
+				return
+			}
+			f.Filters[i].levels = &r
+		}
+	}
+
+	for _, s := range f.Samples {
+		if len(s.Group) == 0 {
+			err = fmt.Errorf("missing sample group")
+			return
+		}
+		if s.Rate < 0 || s.Rate > 1 {
+			err = fmt.Errorf("invalid sample rate, must be between 0 and 1: %g", s.Rate)
+			return
+		}
+	}
+
+	for _, t := range f.Taps {
+		if len(t.Group) == 0 {
+			err = fmt.Errorf("missing tap group")
+			return
+		}
+		if _, err = t.duration(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// keep returns false if msg is discarded by the filters, or by the sample of
+// its group or stream.
+func (f features) keep(msg lib.Message) bool {
+	for _, x := range f.Filters {
+		if matchStream(x.Group, x.Stream, msg) && (x.levels == nil || x.levels.Contains(msg.Event.Level)) {
+			return false
+		}
+	}
+
+	for _, s := range f.Samples {
+		if matchStream(s.Group, s.Stream, msg) {
+			return rand.Float64() < s.Rate
+		}
+	}
+
+	return true
+}
+
+// matchStream returns true if msg belongs to group, and to stream if it isn't
+// empty.
+func matchStream(group string, stream string, msg lib.Message) bool {
+	return msg.Group == group && (len(stream) == 0 || msg.Stream == stream)
+}
+
+func (t featureTap) duration() (time.Duration, error) {
+	if len(t.Duration) == 0 {
+		return defaultTapDuration, nil
+	}
+
+	d, err := time.ParseDuration(t.Duration)
+	if err != nil || d <= 0 || d > maxTapDuration {
+		return 0, fmt.Errorf("invalid tap duration, must be positive and at most %s: %s", maxTapDuration, t.Duration)
+	}
+
+	return d, nil
+}
+
+// featureFile polls a features file and applies the changes made to it.
+type featureFile struct {
+	path    string
+	modTime time.Time
+	current features
+}
+
+// load returns the features of the file if it was modified since the last
+// call.
+func (f *featureFile) load(dests []destination) (next features, changed bool, err error) {
+	var info os.FileInfo
+	var b []byte
+
+	if info, err = os.Stat(f.path); err != nil {
+		if os.IsNotExist(err) {
+			// Removing the file resets the features.
+			err, changed = nil, !f.modTime.IsZero()
+			f.modTime = time.Time{}
+		}
+		return
+	}
+
+	if info.ModTime().Equal(f.modTime) {
+		return
+	}
+
+	if b, err = ioutil.ReadFile(f.path); err != nil {
+		return
+	}
+
+	// An invalid file is reported once, the features are unchanged until it
+	// is fixed.
+	f.modTime = info.ModTime()
+
+	if next, err = parseFeatures(b, dests); err != nil {
+		return
+	}
+
+	changed = true
+	return
+}
+
+// keep returns false if msg is discarded by the current features, f may be
+// nil when there is no features file.
+func (f *featureFile) keep(msg lib.Message) bool {
+	return f == nil || f.current.keep(msg)
+}
+
+// update applies the changes made to the file since the last call. Drained
+// destinations are only changed when they are added to or removed from the
+// file, so they can still be controlled by the admin endpoints. The taps of
+// the file are opened again when they expire, until they are removed from it,
+// and only the taps opened from the file are closed then.
+// It must be called from the goroutine that owns the store since destinations
+// may be drained.
+func (f *featureFile) update(dests []destination, loglevel *logLevel, taps *tapSet, drain func(destination), now time.Time) {
+	next, changed, err := f.load(dests)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  f.path,
+			"error": err,
+		}).Error("failed to load the features file")
+	}
+
+	if changed {
+		f.apply(next, dests, loglevel, taps, drain)
+	}
+
+	for _, t := range f.current.Taps {
+		if taps.hasManaged(t.Group, t.Stream) {
+			continue
+		}
+
+		duration, _ := t.duration()
+
+		if _, err := taps.open(t.Group, t.Stream, duration, true, now); err != nil {
+			log.WithFields(log.Fields{
+				"group":  t.Group,
+				"stream": t.Stream,
+				"error":  err,
+			}).Error("failed to open tap")
+		}
+	}
+}
+
+func (f *featureFile) apply(next features, dests []destination, loglevel *logLevel, taps *tapSet, drain func(destination)) {
+	prev := f.current
+	f.current = next
+	log.WithField("path", f.path).Info("features changed")
+
+	if next.LogLevel != prev.LogLevel {
+		lvl := loglevel.initial
+
+		if len(next.LogLevel) != 0 {
+			lvl, _ = log.ParseLevel(next.LogLevel)
+		}
+
+		loglevel.set(lvl)
+		log.WithField("level", lvl.String()).Info("log level changed")
+	}
+
+	for _, dest := range dests {
+		was, is := containsString(prev.Drain, dest.name), containsString(next.Drain, dest.name)
+
+		switch {
+		case is && !was:
+			drain(dest)
+		case was && !is:
+			dest.resume()
+			log.WithField("destination", dest.name).Info("destination resumed")
+		}
+	}
+
+	for _, t := range prev.Taps {
+		if !containsTap(next.Taps, t) {
+			taps.closeManaged(t.Group, t.Stream)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTap(list []featureTap, t featureTap) bool {
+	for _, x := range list {
+		if x.Group == t.Group && x.Stream == t.Stream {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseFeatures(t *testing.T) {
+	dests := []destination{{name: "syslog"}}
+
+	f, err := parseFeatures([]byte(`{"drain":["syslog"],"taps":[{"group":"api","duration":"1m"}]}`), dests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.Drain) != 1 || len(f.Taps) != 1 {
+		t.Errorf("invalid features: %+v", f)
+	}
+
+	for _, s := range []string{
+		`{"drain":["file"]}`,
+		`{"taps":[{"group":"api","duration":"-1m"}]}`,
+		`{"taps":[{"group":"api","duration":"0s"}]}`,
+		`{"taps":[{"group":"api","duration":"1000h"}]}`,
+	} {
+		if _, err := parseFeatures([]byte(s), dests); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
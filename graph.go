@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// pipelineGraph is the topology of the pipeline configured on the command
+// line, messages flow from the sources through the transforms to the routes
+// of each destination.
+type pipelineGraph struct {
+	Sources    []string     `json:"sources"`
+	Transforms []string     `json:"transforms"`
+	Routes     []graphRoute `json:"routes"`
+	Quarantine string       `json:"quarantine,omitempty"`
+}
+
+// graphRoute describes how messages are sent to a destination.
+type graphRoute struct {
+	Destination string   `json:"destination"`
+	Levels      string   `json:"levels,omitempty"`
+	Oversize    string   `json:"oversize,omitempty"`
+	Divert      string   `json:"divert,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+func makeGraph(sources []source, transforms []string, dests []destination, quarantine string, divert string) pipelineGraph {
+	g := pipelineGraph{
+		Sources:    make([]string, 0, len(sources)),
+		Transforms: transforms,
+		Routes:     make([]graphRoute, 0, len(dests)),
+		Quarantine: quarantine,
+	}
+
+	if g.Transforms == nil {
+		g.Transforms = []string{}
+	}
+
+	for _, src := range sources {
+		g.Sources = append(g.Sources, src.name)
+	}
+
+	for _, dest := range dests {
+		r := graphRoute{Destination: dest.name}
+
+		if dest.levels != nil {
+			r.Levels = dest.levels.String()
+		}
+
+		if dest.oversize != nil {
+			r.Oversize = dest.oversize.Action + ":" + strconv.Itoa(dest.oversize.Limit)
+
+			if dest.divert != nil {
+				r.Divert = divert
+			}
+		}
+
+		if dest.latency {
+			r.Annotations = append(r.Annotations, "latency")
+		}
+
+		if dest.marks != nil {
+			r.Annotations = append(r.Annotations, "batch-integrity")
+		}
+
+		if dest.cost != nil {
+			r.Annotations = append(r.Annotations, "cost")
+		}
+
+		if dest.window != nil {
+			r.Annotations = append(r.Annotations, "max-inflight="+strconv.Itoa(cap(dest.window)))
+		}
+
+		if dest.limit != nil {
+			r.Annotations = append(r.Annotations, "bandwidth-limit")
+		}
+
+		g.Routes = append(g.Routes, r)
+	}
+
+	return g
+}
+
+// writeGraph writes the graph to w in the given format, either a DOT digraph
+// that can be rendered with graphviz or JSON.
+func writeGraph(w io.Writer, format string, g pipelineGraph) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case "dot":
+		_, err := io.WriteString(w, g.dot())
+		return err
+
+	default:
+		return fmt.Errorf("invalid graph format: %s", format)
+	}
+}
+
+func (g pipelineGraph) dot() string {
+	var b bytes.Buffer
+
+	node := func(kind string, name string) string {
+		return strconv.Quote(kind + ":" + name)
+	}
+
+	b.WriteString("digraph ecs_logs {\n")
+	b.WriteString("\trankdir=LR;\n")
+
+	// The transforms are chained and end in the router, which dispatches the
+	// messages to the destinations.
+	chain := make([]string, 0, len(g.Transforms)+1)
+
+	for _, t := range g.Transforms {
+		chain = append(chain, node("transform", t))
+	}
+	chain = append(chain, strconv.Quote("router"))
+
+	for _, src := range g.Sources {
+		fmt.Fprintf(&b, "\t%s [shape=box];\n", node("source", src))
+		fmt.Fprintf(&b, "\t%s -> %s;\n", node("source", src), chain[0])
+
+		if len(g.Quarantine) != 0 {
+			fmt.Fprintf(&b, "\t%s -> %s [style=dashed, label=\"unparsable\"];\n", node("source", src), node("destination", g.Quarantine))
+		}
+	}
+
+	for i := 1; i < len(chain); i++ {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", chain[i-1], chain[i])
+	}
+
+	for _, r := range g.Routes {
+		var labels []string
+
+		if len(r.Levels) != 0 {
+			labels = append(labels, "levels="+r.Levels)
+		}
+
+		if len(r.Oversize) != 0 {
+			labels = append(labels, "oversize="+r.Oversize)
+		}
+
+		labels = append(labels, r.Annotations...)
+
+		fmt.Fprintf(&b, "\t%s [shape=box];\n", node("destination", r.Destination))
+		fmt.Fprintf(&b, "\t\"router\" -> %s [label=%s];\n", node("destination", r.Destination), strconv.Quote(strings.Join(labels, "\n")))
+
+		if len(r.Divert) != 0 {
+			fmt.Fprintf(&b, "\t\"router\" -> %s [style=dashed, label=\"oversized\"];\n", node("destination", r.Divert))
+		}
+	}
+
+	if len(g.Quarantine) != 0 {
+		fmt.Fprintf(&b, "\t%s [shape=box];\n", node("destination", g.Quarantine))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package lib
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// An AckReader is a reader that saves its position in the source, Ack is
+// called with the cursor of a message once it and all the messages read
+// before it were delivered, so the reader resumes after it when reopened.
+type AckReader interface {
+	Reader
+
+	Ack(cursor string)
+}
+
+// An AckTracker numbers the messages read from an AckReader in order, and
+// acknowledges their cursors to the reader as they are delivered. Since the
+// messages of different streams are delivered out of order, a cursor is only
+// acknowledged once all the messages read before it were delivered as well.
+// Once a message is dropped, the cursors of the messages read after it are
+// never acknowledged, so they are read again when the reader is reopened.
+type AckTracker struct {
+	mutex  sync.Mutex
+	reader AckReader
+	next   uint64
+	done   uint64
+
+	// Sequence number of the first message that was dropped.
+	stall   uint64
+	stalled bool
+
+	// Cursors of the delivered messages that were read after a message which
+	// wasn't delivered yet, indexed by sequence number.
+	acked map[uint64]string
+}
+
+func NewAckTracker(r AckReader) *AckTracker {
+	return &AckTracker{
+		reader: r,
+		acked:  make(map[uint64]string),
+	}
+}
+
+// Track returns the Ack of the next message read, which is delivered once it
+// was released as many times as it was held, plus one.
+func (t *AckTracker) Track(cursor string) *Ack {
+	t.mutex.Lock()
+	a := &Ack{tracker: t, seq: t.next, cursor: cursor, refs: 1}
+	t.next++
+	t.mutex.Unlock()
+	return a
+}
+
+func (t *AckTracker) dropped(a *Ack) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stalled && t.stall <= a.seq {
+		return
+	}
+
+	t.stall, t.stalled = a.seq, true
+
+	for seq := range t.acked {
+		if seq >= a.seq {
+			delete(t.acked, seq)
+		}
+	}
+}
+
+func (t *AckTracker) delivered(a *Ack) {
+	var cursor string
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stalled && a.seq >= t.stall {
+		return
+	}
+
+	t.acked[a.seq] = a.cursor
+
+	for {
+		c, ok := t.acked[t.done]
+		if !ok {
+			break
+		}
+		delete(t.acked, t.done)
+		t.done++
+
+		if len(c) != 0 {
+			cursor = c
+		}
+	}
+
+	// The reader is called with the lock held so cursors are acknowledged in
+	// order.
+	if len(cursor) != 0 {
+		t.reader.Ack(cursor)
+	}
+}
+
+// Ack counts the references held on a message by the batches being written,
+// the message is delivered once there are none left. The methods of a nil Ack
+// do nothing.
+type Ack struct {
+	refs    int32
+	failed  int32
+	tracker *AckTracker
+	seq     uint64
+	cursor  string
+}
+
+// Hold adds n references to the message.
+func (a *Ack) Hold(n int) {
+	if a != nil {
+		atomic.AddInt32(&a.refs, int32(n))
+	}
+}
+
+// Release removes a reference to the message.
+func (a *Ack) Release() {
+	if a != nil && atomic.AddInt32(&a.refs, -1) == 0 {
+		if atomic.LoadInt32(&a.failed) != 0 {
+			a.tracker.dropped(a)
+		} else {
+			a.tracker.delivered(a)
+		}
+	}
+}
+
+// Drop removes a reference to the message and records that it wasn't
+// delivered.
+func (a *Ack) Drop() {
+	if a != nil {
+		atomic.StoreInt32(&a.failed, 1)
+		a.Release()
+	}
+}
+
+// Hold adds a reference to each message of the batch.
+func (list MessageBatch) Hold() {
+	for _, msg := range list {
+		msg.Ack.Hold(1)
+	}
+}
+
+// Release removes a reference from each message of the batch, once it was
+// delivered.
+func (list MessageBatch) Release() {
+	for _, msg := range list {
+		msg.Ack.Release()
+	}
+}
+
+// Drop removes a reference from each message of the batch, which couldn't be
+// delivered.
+func (list MessageBatch) Drop() {
+	for _, msg := range list {
+		msg.Ack.Drop()
+	}
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+type ackRecorder struct {
+	Reader
+	cursors []string
+}
+
+func (r *ackRecorder) Ack(cursor string) {
+	r.cursors = append(r.cursors, cursor)
+}
+
+func TestAckTracker(t *testing.T) {
+	r := &ackRecorder{}
+	tracker := NewAckTracker(r)
+
+	a := tracker.Track("a")
+	b := tracker.Track("b")
+	c := tracker.Track("")
+	d := tracker.Track("d")
+
+	// b is written to two destinations.
+	b.Hold(2)
+	b.Release()
+
+	a.Hold(1)
+	c.Release()
+	d.Release()
+
+	if len(r.cursors) != 0 {
+		t.Fatalf("no cursor should be acknowledged before a is delivered: %q", r.cursors)
+	}
+
+	a.Release()
+	a.Release()
+
+	if !reflect.DeepEqual(r.cursors, []string{"a"}) {
+		t.Fatalf("invalid cursors after a was delivered: %q", r.cursors)
+	}
+
+	b.Release()
+	b.Release()
+
+	if !reflect.DeepEqual(r.cursors, []string{"a", "d"}) {
+		t.Errorf("invalid cursors after b was delivered: %q", r.cursors)
+	}
+}
+
+func TestAckTrackerDrop(t *testing.T) {
+	r := &ackRecorder{}
+	tracker := NewAckTracker(r)
+
+	a := tracker.Track("a")
+	b := tracker.Track("b")
+	c := tracker.Track("c")
+	d := tracker.Track("d")
+
+	// b is written to two destinations, one of which drops it.
+	b.Hold(1)
+	b.Drop()
+	c.Release()
+	b.Release()
+	a.Release()
+	d.Release()
+
+	if !reflect.DeepEqual(r.cursors, []string{"a"}) {
+		t.Errorf("the cursors read after a dropped message must not be acknowledged: %q", r.cursors)
+	}
+
+	if len(tracker.acked) != 0 {
+		t.Errorf("the deliveries following a dropped message must not be retained: %v", tracker.acked)
+	}
+}
+
+func TestAckNil(t *testing.T) {
+	batch := MessageBatch{{Group: "a"}, {Group: "b"}}
+	batch.Hold()
+	batch.Release()
+	batch.Drop()
+}
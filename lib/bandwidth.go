@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// A BandwidthLimiter caps the rate at which bytes are sent across all
+// destinations. When several destinations compete for bandwidth it is shared
+// according to their weights using start-time fair queuing.
+type BandwidthLimiter struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	rate    float64
+	tokens  float64
+	last    time.Time
+	weights map[string]int
+	finish  map[string]float64
+	vclock  float64
+	waiters []*bandwidthWaiter
+}
+
+type bandwidthWaiter struct {
+	tag float64
+}
+
+// NewBandwidthLimiter returns a limiter allowing rate bytes per second, the
+// weights default to 1 for destinations that are not listed.
+func NewBandwidthLimiter(rate int, weights map[string]int) *BandwidthLimiter {
+	l := &BandwidthLimiter{
+		rate:    float64(rate),
+		tokens:  float64(rate),
+		last:    time.Now(),
+		weights: weights,
+		finish:  make(map[string]float64),
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// Wait blocks until n bytes can be sent to the named destination. Requests
+// larger than the available bandwidth are let through and paid back by the
+// following ones, so the limit is respected on average.
+func (l *BandwidthLimiter) Wait(name string, n int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	weight := l.weights[name]
+	if weight <= 0 {
+		weight = 1
+	}
+
+	start := l.vclock
+	if f := l.finish[name]; f > start {
+		start = f
+	}
+
+	w := &bandwidthWaiter{tag: start}
+	l.finish[name] = start + float64(n)/float64(weight)
+	l.waiters = append(l.waiters, w)
+
+	for {
+		if l.next() != w {
+			l.cond.Wait()
+			continue
+		}
+
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		l.last = now
+
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+
+		if l.tokens >= 0 {
+			l.tokens -= float64(n)
+			l.vclock = w.tag
+			l.remove(w)
+
+			if len(l.waiters) == 0 {
+				// Nobody is competing for bandwidth anymore, reset the virtual time
+				// so destinations are not penalized for having used bandwidth that
+				// nobody else needed.
+				l.vclock = 0
+				l.finish = make(map[string]float64)
+			}
+
+			l.cond.Broadcast()
+			return
+		}
+
+		delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.mutex.Unlock()
+		time.Sleep(delay)
+		l.mutex.Lock()
+	}
+}
+
+// next returns the waiter with the smallest start tag.
+func (l *BandwidthLimiter) next() (w *bandwidthWaiter) {
+	for _, x := range l.waiters {
+		if w == nil || x.tag < w.tag {
+			w = x
+		}
+	}
+	return
+}
+
+func (l *BandwidthLimiter) remove(w *bandwidthWaiter) {
+	for i, x := range l.waiters {
+		if x == w {
+			copy(l.waiters[i:], l.waiters[i+1:])
+			l.waiters = l.waiters[:len(l.waiters)-1]
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterRate(t *testing.T) {
+	l := NewBandwidthLimiter(1000, nil)
+	t0 := time.Now()
+
+	// The first 1000 bytes are available immediately, then the limiter goes
+	// into debt and the following requests have to wait for it to be paid.
+	for i := 0; i != 4; i++ {
+		l.Wait("A", 500)
+	}
+
+	if d := time.Since(t0); d < 400*time.Millisecond || d > 1*time.Second {
+		t.Errorf("invalid time spent waiting for bandwidth: %s", d)
+	}
+}
+
+func TestBandwidthLimiterWeights(t *testing.T) {
+	l := NewBandwidthLimiter(10000, map[string]int{"A": 3})
+	l.Wait("A", 10000) // drain the bucket so the next requests compete
+
+	var mutex sync.Mutex
+	var order []string
+	var join sync.WaitGroup
+
+	for _, name := range []string{"A", "B"} {
+		join.Add(1)
+		go func(name string) {
+			defer join.Done()
+			for i := 0; i != 4; i++ {
+				l.Wait(name, 100)
+				mutex.Lock()
+				order = append(order, name)
+				mutex.Unlock()
+			}
+		}(name)
+	}
+
+	join.Wait()
+
+	// A has three times the weight of B, it should get three times as many
+	// requests through while both are competing.
+	countA := 0
+	for _, name := range order[:4] {
+		if name == "A" {
+			countA++
+		}
+	}
+
+	if countA < 2 {
+		t.Errorf("invalid order of requests: %v", order)
+	}
+}
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrCanaryNotFound is returned by canary verifiers when the destination
+// accepted a canary event but didn't store it.
+var ErrCanaryNotFound = errors.New("canary event not found")
+
+// RegisterCanaryVerifier sets the function called to check that the named
+// destination stored a canary message it accepted, by reading it back. It
+// catches silent failures like a destination that accepts events with an
+// invalid API key.
+func RegisterCanaryVerifier(name string, verify func(msg Message) error) {
+	cvmtx.Lock()
+	cvmap[name] = verify
+	cvmtx.Unlock()
+}
+
+func DeregisterCanaryVerifier(name string) {
+	cvmtx.Lock()
+	delete(cvmap, name)
+	cvmtx.Unlock()
+}
+
+// CanaryVerifier returns the function registered to verify the canary messages
+// of the named destination, or nil if there is none.
+func CanaryVerifier(name string) func(msg Message) error {
+	cvmtx.RLock()
+	verify := cvmap[name]
+	cvmtx.RUnlock()
+	return verify
+}
+
+var (
+	cvmtx sync.RWMutex
+	cvmap = map[string]func(Message) error{}
+)
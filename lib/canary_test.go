@@ -0,0 +1,18 @@
+package lib
+
+import "testing"
+
+func TestCanaryVerifier(t *testing.T) {
+	RegisterCanaryVerifier("test", func(msg Message) error {
+		return ErrCanaryNotFound
+	})
+	defer DeregisterCanaryVerifier("test")
+
+	if verify := CanaryVerifier("test"); verify == nil || verify(Message{}) != ErrCanaryNotFound {
+		t.Error("the registered canary verifier should have been returned")
+	}
+
+	if verify := CanaryVerifier("other"); verify != nil {
+		t.Error("destinations without verifier should not be verified")
+	}
+}
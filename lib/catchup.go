@@ -0,0 +1,51 @@
+package lib
+
+import "time"
+
+// CatchUpKey is the reserved key of the event data marking messages that were
+// read while catching up with a backlog.
+const CatchUpKey = "_ecs_logs_catch_up"
+
+// A CatchUpLimiter throttles the messages read late, for example when a source
+// resumes from an old position, so the flood of historical messages doesn't
+// compete with live traffic. It is not safe for concurrent use, each reader
+// should have its own.
+type CatchUpLimiter struct {
+	threshold time.Duration
+	interval  time.Duration
+	next      time.Time
+}
+
+// NewCatchUpLimiter returns a limiter of the messages older than threshold to
+// rate messages per second, they are only detected when rate is zero.
+func NewCatchUpLimiter(threshold time.Duration, rate int) *CatchUpLimiter {
+	l := &CatchUpLimiter{threshold: threshold}
+
+	if rate > 0 {
+		l.interval = time.Second / time.Duration(rate)
+	}
+
+	return l
+}
+
+// Delay returns whether msg is older than the threshold at the given time, and
+// how long the reader must wait before handling it to respect the rate.
+func (l *CatchUpLimiter) Delay(msg Message, now time.Time) (late bool, delay time.Duration) {
+	if now.Sub(msg.Event.Time) <= l.threshold {
+		return
+	}
+
+	late = true
+
+	if l.interval == 0 {
+		return
+	}
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	delay = l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestCatchUpLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewCatchUpLimiter(time.Minute, 10)
+
+	live := Message{Event: ecslogs.Event{Time: now.Add(-time.Second)}}
+	old := Message{Event: ecslogs.Event{Time: now.Add(-time.Hour)}}
+
+	if late, delay := l.Delay(live, now); late || delay != 0 {
+		t.Errorf("live messages must not be throttled: %t %s", late, delay)
+	}
+
+	for i := 0; i != 3; i++ {
+		late, delay := l.Delay(old, now)
+
+		if !late {
+			t.Error("old messages must be detected")
+		}
+
+		if want := time.Duration(i) * 100 * time.Millisecond; delay != want {
+			t.Errorf("invalid delay of message %d: %s != %s", i, delay, want)
+		}
+	}
+
+	// The rate isn't exceeded after a pause.
+	if _, delay := l.Delay(old, now.Add(time.Second)); delay != 0 {
+		t.Errorf("invalid delay after a pause: %s", delay)
+	}
+}
+
+func TestCatchUpLimiterUnlimited(t *testing.T) {
+	now := time.Now()
+	l := NewCatchUpLimiter(time.Minute, 0)
+	old := Message{Event: ecslogs.Event{Time: now.Add(-time.Hour)}}
+
+	for i := 0; i != 3; i++ {
+		if late, delay := l.Delay(old, now); !late || delay != 0 {
+			t.Errorf("old messages must only be detected: %t %s", late, delay)
+		}
+	}
+}
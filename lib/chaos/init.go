@@ -0,0 +1,7 @@
+package chaos
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterDestination("chaos", destination{})
+}
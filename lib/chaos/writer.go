@@ -0,0 +1,163 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// WriterConfig sets the failures injected by a chaos writer around the writer
+// of another destination.
+type WriterConfig struct {
+	// Latency added before each write.
+	Latency time.Duration
+
+	// Probability that a write fails without reaching the destination.
+	ErrorRate float64
+
+	// Probability that only part of a batch is written before failing.
+	PartialRate float64
+
+	// Kind of the injected errors.
+	ErrorKind lib.ErrorKind
+}
+
+// destination wraps the destination set by CHAOS_DESTINATION, it is looked up
+// when writers are opened so it doesn't depend on the order in which
+// destinations are registered.
+type destination struct{}
+
+func (destination) Open(group string, stream string) (lib.Writer, error) {
+	return NewWriter(group, stream)
+}
+
+func (destination) Close(group string, stream string) {
+	if dest, err := getDestination(); err == nil {
+		dest.Close(group, stream)
+	}
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+	var dest lib.Destination
+	var base lib.Writer
+	var s string
+
+	if dest, err = getDestination(); err != nil {
+		return
+	}
+
+	if s = os.Getenv("CHAOS_LATENCY"); len(s) != 0 {
+		if c.Latency, err = time.ParseDuration(s); err != nil {
+			err = fmt.Errorf("invalid CHAOS_LATENCY value: %s", s)
+			return
+		}
+	}
+
+	if c.ErrorRate, err = getRate("CHAOS_ERROR_RATE"); err != nil {
+		return
+	}
+
+	if c.PartialRate, err = getRate("CHAOS_PARTIAL_RATE"); err != nil {
+		return
+	}
+
+	if s = os.Getenv("CHAOS_ERROR_KIND"); len(s) != 0 {
+		if c.ErrorKind, err = parseErrorKind(s); err != nil {
+			return
+		}
+	}
+
+	if base, err = dest.Open(group, stream); err != nil {
+		return
+	}
+
+	w = NewWriterWith(base, c)
+	return
+}
+
+// NewWriterWith returns a writer injecting the failures described by config
+// around w.
+func NewWriterWith(w lib.Writer, config WriterConfig) lib.Writer {
+	return &writer{
+		Writer: w,
+		config: config,
+	}
+}
+
+type writer struct {
+	lib.Writer
+	config WriterConfig
+}
+
+func (w *writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+func (w *writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	if w.config.Latency != 0 {
+		time.Sleep(w.config.Latency)
+	}
+
+	if rand.Float64() < w.config.ErrorRate {
+		return lib.NewWriterError(w.config.ErrorKind, errInjected)
+	}
+
+	if len(batch) > 1 && rand.Float64() < w.config.PartialRate {
+		// Write at least one message and reject at least one.
+		n := 1 + rand.Intn(len(batch)-1)
+
+		if err = w.Writer.WriteMessageBatch(batch[:n]); err != nil {
+			return
+		}
+
+		return lib.NewWriterError(w.config.ErrorKind, fmt.Errorf("chaos: %d of %d messages rejected", len(batch)-n, len(batch)))
+	}
+
+	return w.Writer.WriteMessageBatch(batch)
+}
+
+func getDestination() (dest lib.Destination, err error) {
+	name := os.Getenv("CHAOS_DESTINATION")
+
+	switch name {
+	case "":
+		err = fmt.Errorf("missing CHAOS_DESTINATION environment variable")
+	case "chaos":
+		err = fmt.Errorf("invalid CHAOS_DESTINATION value: the chaos destination cannot wrap itself")
+	default:
+		if dest = lib.GetDestination(name); dest == nil {
+			err = fmt.Errorf("invalid CHAOS_DESTINATION value: unknown destination %s", name)
+		}
+	}
+
+	return
+}
+
+func getRate(env string) (rate float64, err error) {
+	if s := os.Getenv(env); len(s) != 0 {
+		if rate, err = strconv.ParseFloat(s, 64); err != nil || rate < 0 || rate > 1 {
+			err = fmt.Errorf("invalid %s value, must be between 0 and 1: %s", env, s)
+		}
+	}
+	return
+}
+
+func parseErrorKind(s string) (lib.ErrorKind, error) {
+	for k := lib.UnknownError; k <= lib.FatalError; k++ {
+		if strings.EqualFold(s, k.String()) {
+			return k, nil
+		}
+	}
+	return lib.UnknownError, fmt.Errorf("invalid CHAOS_ERROR_KIND value: %s", s)
+}
+
+var (
+	errInjected = errors.New("chaos: injected error")
+)
@@ -0,0 +1,60 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestWriter(t *testing.T) {
+	batch := lib.MessageBatch{{Group: "a"}, {Group: "b"}, {Group: "c"}}
+
+	tests := []struct {
+		config WriterConfig
+		min    int
+		max    int
+		kind   lib.ErrorKind
+	}{
+		{WriterConfig{}, 3, 3, lib.UnknownError},
+		{WriterConfig{ErrorRate: 1, ErrorKind: lib.ThrottledError}, 0, 0, lib.ThrottledError},
+		{WriterConfig{PartialRate: 1, ErrorKind: lib.UnreachableError}, 1, 2, lib.UnreachableError},
+	}
+
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := NewWriterWith(lib.NewMessageEncoder(b), test.config)
+		err := w.WriteMessageBatch(batch)
+
+		if (err != nil) != (test.max != len(batch)) {
+			t.Errorf("%+v: unexpected error: %v", test.config, err)
+		}
+
+		if kind := lib.ErrorKindOf(err); kind != test.kind {
+			t.Errorf("%+v: invalid error kind: %s != %s", test.config, test.kind, kind)
+		}
+
+		n := 0
+		for d := json.NewDecoder(b); d.More(); n++ {
+			var msg lib.Message
+			if err := d.Decode(&msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n < test.min || n > test.max {
+			t.Errorf("%+v: invalid number of messages written: %d", test.config, n)
+		}
+	}
+}
+
+func TestParseErrorKind(t *testing.T) {
+	if k, err := parseErrorKind("Auth-Failure"); err != nil || k != lib.AuthFailureError {
+		t.Errorf("invalid error kind: %s (%v)", k, err)
+	}
+
+	if _, err := parseErrorKind("whatever"); err == nil {
+		t.Error("parsing an unknown error kind should fail")
+	}
+}
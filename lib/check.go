@@ -0,0 +1,36 @@
+package lib
+
+import "sync"
+
+// RegisterCheck sets the function called when the program starts with the
+// named destination, to validate its configuration and report insecure
+// settings before messages are written to it.
+func RegisterCheck(name string, check func() error) {
+	ckmtx.Lock()
+	ckmap[name] = check
+	ckmtx.Unlock()
+}
+
+func DeregisterCheck(name string) {
+	ckmtx.Lock()
+	delete(ckmap, name)
+	ckmtx.Unlock()
+}
+
+// Check calls the function registered to check the named destination, if any.
+func Check(name string) (err error) {
+	ckmtx.RLock()
+	check := ckmap[name]
+	ckmtx.RUnlock()
+
+	if check != nil {
+		err = check()
+	}
+
+	return
+}
+
+var (
+	ckmtx sync.RWMutex
+	ckmap = map[string]func() error{}
+)
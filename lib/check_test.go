@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var calls int
+
+	RegisterCheck("test", func() error {
+		calls++
+		return errors.New("oops")
+	})
+	defer DeregisterCheck("test")
+
+	if err := Check("test"); err == nil || calls != 1 {
+		t.Errorf("check should have failed: err = %v, calls = %d", err, calls)
+	}
+
+	if err := Check("other"); err != nil {
+		t.Errorf("destinations without check should succeed: %v", err)
+	}
+}
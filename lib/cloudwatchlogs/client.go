@@ -2,7 +2,11 @@ package cloudwatchlogs
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -12,6 +16,12 @@ import (
 )
 
 type client struct {
+	format string
+	region string
+
+	// set when the configuration is invalid, writers can't be opened then
+	err error
+
 	cmtx   sync.Mutex
 	client *cloudwatchlogs.CloudWatchLogs
 
@@ -20,14 +30,66 @@ type client struct {
 }
 
 func newClient() *client {
-	return &client{
-		writers: make(map[string]*writer, 100),
+	c := &client{writers: make(map[string]*writer, 100)}
+	c.format, c.region, c.err = configFromEnvironment()
+	return c
+}
+
+// configFromEnvironment returns the format of the events set by
+// CLOUDWATCHLOGS_FORMAT, and the options passed as query parameters of
+// CLOUDWATCHLOGS_URL, which take precedence over the environment variables,
+// with the region as host, for example cloudwatchlogs://us-west-2?format=insights
+func configFromEnvironment() (format string, region string, err error) {
+	var u *url.URL
+
+	format = os.Getenv("CLOUDWATCHLOGS_FORMAT")
+
+	if s := os.Getenv("CLOUDWATCHLOGS_URL"); len(s) != 0 {
+		if u, err = url.Parse(s); err != nil {
+			err = fmt.Errorf("invalid cloudwatchlogs URL: %s", err)
+			return
+		}
+
+		if u.Scheme != "cloudwatchlogs" {
+			err = fmt.Errorf("invalid cloudwatchlogs URL: the scheme must be cloudwatchlogs but %s was found", u.Scheme)
+			return
+		}
+
+		region = u.Host
+
+		for name, values := range u.Query() {
+			switch name {
+			case "format":
+				format = values[len(values)-1]
+			default:
+				err = fmt.Errorf("unsupported cloudwatchlogs URL parameter: %s", name)
+				return
+			}
+		}
+	}
+
+	switch format {
+	case "", FormatEvent, FormatInsights:
+	default:
+		err = fmt.Errorf("invalid cloudwatchlogs format value: %s", format)
 	}
+
+	return
+}
+
+// check reports an invalid configuration when the program starts.
+func (c *client) check() error {
+	return c.err
 }
 
 func (c *client) Open(group string, stream string) (w lib.Writer, err error) {
 	var client *cloudwatchlogs.CloudWatchLogs
 	var token string
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
 	var writer = c.get(group, stream)
 
 	w = writer
@@ -59,6 +121,21 @@ func (c *client) Close(group string, stream string) {
 	c.remove(group, stream)
 }
 
+// refreshCredentials replaces the AWS client with a new one, which reloads the
+// credentials from the environment, shared files or instance role.
+func (c *client) refreshCredentials() (err error) {
+	var client *cloudwatchlogs.CloudWatchLogs
+
+	if client, err = openAwsClient(c.region); err != nil {
+		return
+	}
+
+	c.cmtx.Lock()
+	c.client = client
+	c.cmtx.Unlock()
+	return
+}
+
 func (c *client) get(group string, stream string) (w *writer) {
 	key := joinGroupStream(group, stream)
 	c.wmtx.Lock()
@@ -67,6 +144,7 @@ func (c *client) get(group string, stream string) (w *writer) {
 		w = &writer{
 			group:  group,
 			stream: stream,
+			format: c.format,
 			parent: c,
 		}
 		c.writers[key] = w
@@ -83,12 +161,59 @@ func (c *client) remove(group string, stream string) {
 	c.wmtx.Unlock()
 }
 
+// warmUp creates the AWS client, which looks up the region the first time,
+// and makes a request so the credentials are loaded and the connection to the
+// service is established. Being denied the permission to list log groups is
+// fine since it means the credentials were accepted.
+func (c *client) warmUp() (err error) {
+	var client *cloudwatchlogs.CloudWatchLogs
+
+	if client, err = c.getAwsClient(); err != nil {
+		return
+	}
+
+	if _, err = client.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+		Limit: aws.Int64(1),
+	}); isAccessDenied(err) {
+		err = nil
+	}
+
+	return
+}
+
+// verifyCanary searches the stream of the canary message for its ID, events
+// are searchable a few seconds after they were accepted.
+func (c *client) verifyCanary(msg lib.Message) (err error) {
+	var client *cloudwatchlogs.CloudWatchLogs
+	var result *cloudwatchlogs.FilterLogEventsOutput
+
+	if client, err = c.getAwsClient(); err != nil {
+		return
+	}
+
+	if result, err = client.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(msg.Group),
+		LogStreamNames: []*string{aws.String(msg.Stream)},
+		FilterPattern:  aws.String(strconv.Quote(msg.Event.Info.ID)),
+		StartTime:      aws.Int64(aws.TimeUnixMilli(msg.Event.Time.Add(-time.Minute))),
+		Limit:          aws.Int64(1),
+	}); err != nil {
+		return
+	}
+
+	if len(result.Events) == 0 {
+		err = lib.ErrCanaryNotFound
+	}
+
+	return
+}
+
 func (c *client) getAwsClient() (client *cloudwatchlogs.CloudWatchLogs, err error) {
 	c.cmtx.Lock()
 	defer c.cmtx.Unlock()
 
 	if client = c.client; client == nil {
-		if client, err = openAwsClient(); err != nil {
+		if client, err = openAwsClient(c.region); err != nil {
 			return
 		}
 		c.client = client
@@ -97,11 +222,12 @@ func (c *client) getAwsClient() (client *cloudwatchlogs.CloudWatchLogs, err erro
 	return
 }
 
-func openAwsClient() (client *cloudwatchlogs.CloudWatchLogs, err error) {
-	var region string
-
-	if region, err = getAwsRegion(); err != nil {
-		return
+// openAwsClient returns a client of the region, which is looked up if empty.
+func openAwsClient(region string) (client *cloudwatchlogs.CloudWatchLogs, err error) {
+	if len(region) == 0 {
+		if region, err = getAwsRegion(); err != nil {
+			return
+		}
 	}
 
 	client = cloudwatchlogs.New(session.New(&aws.Config{
@@ -179,6 +305,10 @@ func isAlreadyExists(err error) bool {
 	return isAwsErrorCode(err, "ResourceAlreadyExistsException")
 }
 
+func isAccessDenied(err error) bool {
+	return isAwsErrorCode(err, "AccessDeniedException")
+}
+
 func isThrottled(err error) bool {
 	return isAwsErrorCode(err, "ThrottlingException")
 }
@@ -0,0 +1,36 @@
+package cloudwatchlogs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigFromEnvironment(t *testing.T) {
+	defer os.Unsetenv("CLOUDWATCHLOGS_FORMAT")
+	defer os.Unsetenv("CLOUDWATCHLOGS_URL")
+
+	os.Setenv("CLOUDWATCHLOGS_FORMAT", FormatEvent)
+	os.Setenv("CLOUDWATCHLOGS_URL", "cloudwatchlogs://us-west-2?format=insights")
+
+	if format, region, err := configFromEnvironment(); err != nil || format != FormatInsights || region != "us-west-2" {
+		t.Errorf("invalid configuration: format = %q, region = %q, err = %v", format, region, err)
+	}
+
+	for _, s := range []string{
+		"https://logs.us-west-2.amazonaws.com",
+		"cloudwatchlogs://us-west-2?retention=180",
+	} {
+		os.Setenv("CLOUDWATCHLOGS_URL", s)
+
+		if _, _, err := configFromEnvironment(); err == nil {
+			t.Errorf("%s: invalid URLs should be rejected", s)
+		}
+	}
+
+	os.Unsetenv("CLOUDWATCHLOGS_URL")
+	os.Setenv("CLOUDWATCHLOGS_FORMAT", "json")
+
+	if _, _, err := configFromEnvironment(); err == nil {
+		t.Error("unknown formats should be rejected")
+	}
+}
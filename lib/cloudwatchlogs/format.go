@@ -0,0 +1,91 @@
+package cloudwatchlogs
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// Formats of the events sent to CloudWatch Logs, FormatEvent is the default
+// and sends the ecs-logs events as-is, FormatInsights flattens them so the
+// fields have consistent names at the top level which makes them easier to
+// query with CloudWatch Logs Insights.
+const (
+	FormatEvent    = "event"
+	FormatInsights = "insights"
+)
+
+// requestIdKeys is the list of event data keys recognized as request IDs, in
+// order of precedence.
+var requestIdKeys = []string{"requestId", "request_id", "requestID", "RequestId", "req_id"}
+
+// insightsKeys is the list of reserved top-level keys of events formatted for
+// CloudWatch Logs Insights.
+var insightsKeys = map[string]bool{
+	"level":     true,
+	"time":      true,
+	"msg":       true,
+	"service":   true,
+	"stream":    true,
+	"host":      true,
+	"requestId": true,
+	"errors":    true,
+	"data":      true,
+}
+
+func formatMessage(format string, msg lib.Message) string {
+	if format == FormatInsights {
+		return formatInsights(msg)
+	}
+	return msg.Event.String()
+}
+
+func formatInsights(msg lib.Message) string {
+	event := make(map[string]interface{}, len(msg.Event.Data)+8)
+	event["level"] = msg.Event.Level.String()
+	event["time"] = msg.Event.Time.Format(time.RFC3339Nano)
+	event["msg"] = msg.Event.Message
+	event["service"] = msg.Group
+	event["stream"] = msg.Stream
+
+	if len(msg.Event.Info.Host) != 0 {
+		event["host"] = msg.Event.Info.Host
+	}
+
+	if len(msg.Event.Info.Errors) != 0 {
+		event["errors"] = msg.Event.Info.Errors
+	}
+
+	var requestId string
+	var data map[string]interface{}
+
+	for _, k := range requestIdKeys {
+		if v, ok := msg.Event.Data[k]; ok {
+			event["requestId"] = v
+			requestId = k
+			break
+		}
+	}
+
+	for k, v := range msg.Event.Data {
+		switch {
+		case k == requestId:
+		case insightsKeys[k]:
+			// Fields that would collide with the top-level keys are kept nested.
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			data[k] = v
+		default:
+			event[k] = v
+		}
+	}
+
+	if data != nil {
+		event["data"] = data
+	}
+
+	b, _ := json.Marshal(event)
+	return string(b)
+}
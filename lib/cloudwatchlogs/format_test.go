@@ -0,0 +1,51 @@
+package cloudwatchlogs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestFormatInsights(t *testing.T) {
+	msg := lib.Message{
+		Group:  "my-service",
+		Stream: "0123456789",
+		Event: ecslogs.Event{
+			Level:   ecslogs.WARN,
+			Time:    time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC),
+			Info:    ecslogs.EventInfo{Host: "localhost"},
+			Message: "Hello World!",
+			Data: ecslogs.EventData{
+				"request_id": "1234",
+				"user":       "bob",
+				"level":      "custom",
+			},
+		},
+	}
+
+	var event map[string]interface{}
+
+	if err := json.Unmarshal([]byte(formatMessage(FormatInsights, msg)), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := map[string]interface{}{
+		"level":     "WARN",
+		"time":      "2016-06-13T12:23:42Z",
+		"msg":       "Hello World!",
+		"service":   "my-service",
+		"stream":    "0123456789",
+		"host":      "localhost",
+		"requestId": "1234",
+		"user":      "bob",
+		"data":      map[string]interface{}{"level": "custom"},
+	}
+
+	if !reflect.DeepEqual(event, ref) {
+		t.Errorf("invalid insights event:\n- expected: %v\n- found:    %v", ref, event)
+	}
+}
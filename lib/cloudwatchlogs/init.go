@@ -3,5 +3,10 @@ package cloudwatchlogs
 import "github.com/kapralVV/ecs-logs/lib"
 
 func init() {
-	lib.RegisterDestination("cloudwatchlogs", newClient())
+	c := newClient()
+	lib.RegisterDestination("cloudwatchlogs", c)
+	lib.RegisterCredentialsRefresher("cloudwatchlogs", c.refreshCredentials)
+	lib.RegisterWarmUp("cloudwatchlogs", c.warmUp)
+	lib.RegisterCheck("cloudwatchlogs", c.check)
+	lib.RegisterCanaryVerifier("cloudwatchlogs", c.verifyCanary)
 }
@@ -1,20 +1,13 @@
 package cloudwatchlogs
 
 import (
-	"encoding/json"
-	"net/http"
 	"os"
 	"sync"
-)
 
-type document struct {
-	Region string `json:"region"`
-}
+	"github.com/kapralVV/ecs-logs/lib"
+)
 
 func getAwsRegion() (region string, err error) {
-	var res *http.Response
-	var doc document
-
 	if region = __getAwsRegion(); len(region) != 0 {
 		return
 	}
@@ -34,16 +27,15 @@ func getAwsRegion() (region string, err error) {
 		goto saveRegion
 	}
 
-	if res, err = http.Get("http://169.254.169.254/latest/dynamic/instance-identity/document"); err != nil {
-		return
-	}
-	defer res.Body.Close()
+	{
+		var id lib.EC2InstanceIdentity
 
-	if err = json.NewDecoder(res.Body).Decode(&doc); err != nil {
-		return
-	}
+		if id, err = lib.GetEC2InstanceIdentity(); err != nil {
+			return
+		}
 
-	region = doc.Region
+		region = id.Region
+	}
 saveRegion:
 	regvar = region
 	return
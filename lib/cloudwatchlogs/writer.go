@@ -15,6 +15,7 @@ type writer struct {
 	group  string
 	stream string
 	token  string
+	format string
 	parent *client
 }
 
@@ -37,7 +38,7 @@ func (w *writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
 
 	for i, msg := range batch {
 		events[i] = &cloudwatchlogs.InputLogEvent{
-			Message:   aws.String(msg.Event.String()),
+			Message:   aws.String(formatMessage(w.format, msg)),
 			Timestamp: aws.Int64(aws.TimeUnixMilli(msg.Event.Time)),
 		}
 	}
@@ -93,6 +94,7 @@ func (w *writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
 		// be created.
 		w.parent.remove(w.group, w.stream)
 		w.parent = nil
+		err = lib.NewWriterError(errorKind(err), lib.HTTPErrorFrom("cloudwatchlogs PutLogEvents", err))
 		return
 	}
 
@@ -136,6 +138,33 @@ func parseDataAlreadyAcceptedException(err error) (token *string) {
 	return getRetryTokenFromMessage(msg)
 }
 
+// errorKind classifies errors returned by the CloudWatchLogs API, the SDK
+// doesn't expose the error type so we rely on the error code prefixing the
+// message.
+func errorKind(err error) lib.ErrorKind {
+	msg := err.Error()
+
+	switch {
+	case strings.HasPrefix(msg, "ThrottlingException:"),
+		strings.HasPrefix(msg, "ServiceUnavailableException:"):
+		return lib.ThrottledError
+
+	case strings.HasPrefix(msg, "InvalidParameterException:") && strings.Contains(msg, "too large"):
+		return lib.OversizedError
+
+	case strings.HasPrefix(msg, "AccessDeniedException:"),
+		strings.HasPrefix(msg, "UnrecognizedClientException:"),
+		strings.HasPrefix(msg, "ExpiredTokenException:"),
+		strings.HasPrefix(msg, "InvalidSignatureException:"):
+		return lib.AuthFailureError
+
+	case strings.HasPrefix(msg, "RequestError:"):
+		return lib.UnreachableError
+	}
+
+	return lib.UnknownError
+}
+
 var (
 	errInvalidWriter = errors.New("the writer was invalidated by another goroutine")
 )
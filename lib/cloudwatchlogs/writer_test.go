@@ -0,0 +1,28 @@
+package cloudwatchlogs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		msg  string
+		kind lib.ErrorKind
+	}{
+		{"ThrottlingException: Rate exceeded", lib.ThrottledError},
+		{"InvalidParameterException: Upload too large: 1048577 bytes exceeds limit of 1048576", lib.OversizedError},
+		{"InvalidParameterException: Log event too old", lib.UnknownError},
+		{"ExpiredTokenException: The security token included in the request is expired", lib.AuthFailureError},
+		{"RequestError: send request failed", lib.UnreachableError},
+		{"ResourceNotFoundException: The specified log stream does not exist.", lib.UnknownError},
+	}
+
+	for _, test := range tests {
+		if kind := errorKind(errors.New(test.msg)); kind != test.kind {
+			t.Errorf("%s: invalid error kind: %s != %s", test.msg, test.kind, kind)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+)
+
+// A CostMeter estimates the ingestion cost of the messages delivered to a
+// destination, from the size of their events and the price per gigabyte
+// charged by the provider.
+type CostMeter struct {
+	price   float64
+	mutex   sync.Mutex
+	entries map[string]*Cost
+}
+
+// Cost is the volume of events delivered for a group and its estimated cost.
+type Cost struct {
+	Group string  `json:"group"`
+	Bytes int64   `json:"bytes"`
+	Cost  float64 `json:"cost"`
+}
+
+// NewCostMeter returns a CostMeter for a destination charging pricePerGB for
+// each gigabyte of events.
+func NewCostMeter(pricePerGB float64) *CostMeter {
+	return &CostMeter{
+		price:   pricePerGB,
+		entries: make(map[string]*Cost, 100),
+	}
+}
+
+// Record adds the size of the events of batch to the cost of the group.
+func (m *CostMeter) Record(group string, batch MessageBatch) {
+	n := int64(batch.ContentLength())
+
+	m.mutex.Lock()
+
+	c := m.entries[group]
+	if c == nil {
+		c = &Cost{Group: group}
+		m.entries[group] = c
+	}
+
+	c.Bytes += n
+	c.Cost = float64(c.Bytes) * m.price / 1e9
+
+	m.mutex.Unlock()
+}
+
+// Costs returns the costs recorded since the meter was created or last reset,
+// sorted by group.
+func (m *CostMeter) Costs() []Cost {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.costs()
+}
+
+// Reset returns the costs recorded so far and starts over.
+func (m *CostMeter) Reset() (list []Cost) {
+	m.mutex.Lock()
+	list = m.costs()
+	m.entries = make(map[string]*Cost, len(m.entries))
+	m.mutex.Unlock()
+	return
+}
+
+func (m *CostMeter) costs() (list []Cost) {
+	list = make([]Cost, 0, len(m.entries))
+
+	for _, c := range m.entries {
+		list = append(list, *c)
+	}
+
+	sort.Slice(list, func(i int, j int) bool { return list[i].Group < list[j].Group })
+	return
+}
@@ -0,0 +1,38 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestCostMeter(t *testing.T) {
+	m := NewCostMeter(0.5)
+	batch := MessageBatch{
+		Message{Event: ecslogs.Event{Message: "hello"}},
+		Message{Event: ecslogs.Event{Message: "world"}},
+	}
+	size := int64(batch.ContentLength())
+
+	m.Record("B", batch)
+	m.Record("A", batch)
+	m.Record("B", batch)
+
+	expected := []Cost{
+		{Group: "A", Bytes: size, Cost: float64(size) * 0.5 / 1e9},
+		{Group: "B", Bytes: 2 * size, Cost: float64(2*size) * 0.5 / 1e9},
+	}
+
+	if costs := m.Costs(); !reflect.DeepEqual(costs, expected) {
+		t.Errorf("invalid costs:\n- expected: %+v\n- found:    %+v", expected, costs)
+	}
+
+	if costs := m.Reset(); !reflect.DeepEqual(costs, expected) {
+		t.Errorf("invalid costs returned by reset: %+v", costs)
+	}
+
+	if costs := m.Costs(); len(costs) != 0 {
+		t.Errorf("costs must be empty after a reset: %+v", costs)
+	}
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// CredentialsRefreshDelay is the minimum amount of time between two refreshes
+// of the credentials of a destination. Writers sharing the same credentials
+// tend to fail at the same time, this prevents each of them from triggering a
+// refresh.
+const CredentialsRefreshDelay = 10 * time.Second
+
+// RegisterCredentialsRefresher sets the function called to refresh the
+// credentials used by the writers of the named destination, for example to
+// reload rotated tokens or request new temporary credentials.
+func RegisterCredentialsRefresher(name string, refresh func() error) {
+	crmtx.Lock()
+	crmap[name] = &credentialsRefresher{refresh: refresh}
+	crmtx.Unlock()
+}
+
+func DeregisterCredentialsRefresher(name string) {
+	crmtx.Lock()
+	delete(crmap, name)
+	crmtx.Unlock()
+}
+
+// RefreshCredentials calls the refresher registered for the named destination,
+// if any. The call does nothing if the credentials were already refreshed less
+// than CredentialsRefreshDelay ago.
+func RefreshCredentials(name string, now time.Time) (err error) {
+	crmtx.RLock()
+	r := crmap[name]
+	crmtx.RUnlock()
+
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.time.IsZero() && now.Sub(r.time) < CredentialsRefreshDelay {
+		return
+	}
+
+	if err = r.refresh(); err == nil {
+		r.time = now
+	}
+
+	return
+}
+
+type credentialsRefresher struct {
+	mutex   sync.Mutex
+	refresh func() error
+	time    time.Time
+}
+
+var (
+	crmtx sync.RWMutex
+	crmap = map[string]*credentialsRefresher{}
+)
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshCredentials(t *testing.T) {
+	var calls int
+	var fail bool
+
+	RegisterCredentialsRefresher("test", func() error {
+		calls++
+		if fail {
+			return errors.New("oops")
+		}
+		return nil
+	})
+	defer DeregisterCredentialsRefresher("test")
+
+	now := time.Now()
+
+	if err := RefreshCredentials("test", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RefreshCredentials("test", now.Add(time.Second)); err != nil || calls != 1 {
+		t.Errorf("credentials refreshed too early: err = %v, calls = %d", err, calls)
+	}
+
+	fail = true
+
+	if err := RefreshCredentials("test", now.Add(CredentialsRefreshDelay)); err == nil || calls != 2 {
+		t.Errorf("credentials refresh should have failed: err = %v, calls = %d", err, calls)
+	}
+
+	fail = false
+
+	if err := RefreshCredentials("test", now.Add(CredentialsRefreshDelay+time.Second)); err != nil || calls != 3 {
+		t.Errorf("failed refreshes must not be throttled: err = %v, calls = %d", err, calls)
+	}
+
+	if err := RefreshCredentials("unknown", now); err != nil {
+		t.Error(err)
+	}
+}
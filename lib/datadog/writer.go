@@ -1,9 +1,12 @@
 package datadog
 
 import (
+	"bytes"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/kapralVV/ecs-logs-go"
@@ -16,6 +19,14 @@ func NewWriter(group string, stream string) (w lib.Writer, err error) {
 	var c statsd.WriterConfig
 	var s string
 	var u *url.URL
+	var origin bool
+
+	if s = os.Getenv("DATADOG_ORIGIN_DETECTION"); len(s) != 0 {
+		if origin, err = strconv.ParseBool(s); err != nil {
+			err = fmt.Errorf("invalid DATADOG_ORIGIN_DETECTION value: %s", s)
+			return
+		}
+	}
 
 	if s = os.Getenv("DATADOG_URL"); len(s) != 0 {
 		if u, err = url.Parse(s); err != nil {
@@ -28,6 +39,10 @@ func NewWriter(group string, stream string) (w lib.Writer, err error) {
 			return
 		}
 
+		if err = applyURLOptions(&origin, u.Query()); err != nil {
+			return
+		}
+
 		c.Address = u.Host
 	}
 
@@ -35,9 +50,35 @@ func NewWriter(group string, stream string) (w lib.Writer, err error) {
 	c.Stream = stream
 	c.Dial = dialUdpClient
 
+	if origin {
+		c.Dial = dialOriginClient
+	}
+
 	return statsd.DialWriter(c)
 }
 
+// applyURLOptions sets the options passed as query parameters of the datadog
+// URL, which take precedence over the environment variables, for example
+// udp://localhost:8125?origin_detection=true
+func applyURLOptions(origin *bool, query url.Values) (err error) {
+	for name, values := range query {
+		value := values[len(values)-1]
+
+		switch name {
+		case "origin_detection":
+			*origin, err = strconv.ParseBool(value)
+		default:
+			return fmt.Errorf("unsupported datadog URL parameter: %s", name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid %s value in datadog URL: %s", name, value)
+		}
+	}
+
+	return
+}
+
 type client struct {
 	*datadog.Client
 }
@@ -55,3 +96,73 @@ func dialUdpClient(addr string, group string, stream string) (statsd.Client, err
 func (c client) IncrEvents(level ecslogs.Level, value int) error {
 	return c.Client.IncrBy("events.count", value, "level:"+strings.ToLower(level.String()))
 }
+
+// originClient sends metrics with the container field of the DogStatsD
+// protocol (|c:) set to the ID of the container the stream was read from, so
+// the Datadog agent tags them with the container and the ECS task it belongs
+// to. The field isn't supported by the datadog client so the metrics are
+// formatted directly.
+type originClient struct {
+	conn      net.Conn
+	tags      string
+	container string
+	buf       bytes.Buffer
+}
+
+func dialOriginClient(addr string, group string, stream string) (statsd.Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &originClient{
+		conn: conn,
+		tags: "group:" + group + ",stream:" + stream,
+	}
+
+	if isContainerID(stream) {
+		c.container = stream
+	}
+
+	return c, nil
+}
+
+func (c *originClient) IncrEvents(level ecslogs.Level, value int) error {
+	fmt.Fprintf(&c.buf, "ecs-logs.events.count:%d|c|#%s,level:%s", value, c.tags, strings.ToLower(level.String()))
+
+	if len(c.container) != 0 {
+		c.buf.WriteString("|c:")
+		c.buf.WriteString(c.container)
+	}
+
+	c.buf.WriteByte('\n')
+	return nil
+}
+
+func (c *originClient) Flush() (err error) {
+	if c.buf.Len() != 0 {
+		_, err = c.conn.Write(c.buf.Bytes())
+		c.buf.Reset()
+	}
+	return
+}
+
+func (c *originClient) Close() error {
+	return c.conn.Close()
+}
+
+// isContainerID returns whether s is a full docker container ID, which is the
+// default stream name of the journald source.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
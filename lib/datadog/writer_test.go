@@ -0,0 +1,77 @@
+package datadog
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestOriginClient(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	id := strings.Repeat("0123456789abcdef", 4)
+
+	c, err := dialOriginClient(conn.LocalAddr().String(), "api", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.IncrEvents(ecslogs.INFO, 2)
+	c.IncrEvents(ecslogs.ERROR, 1)
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := string(b[:n]); s != ""+
+		"ecs-logs.events.count:2|c|#group:api,stream:"+id+",level:info|c:"+id+"\n"+
+		"ecs-logs.events.count:1|c|#group:api,stream:"+id+",level:error|c:"+id+"\n" {
+		t.Errorf("invalid metrics: %q", s)
+	}
+}
+
+func TestIsContainerID(t *testing.T) {
+	tests := map[string]bool{
+		strings.Repeat("0123456789abcdef", 4): true,
+		strings.Repeat("0123456789ABCDEF", 4): false,
+		"0123456789ab":                        false,
+		"web-1":                               false,
+	}
+
+	for s, ok := range tests {
+		if isContainerID(s) != ok {
+			t.Errorf("%s: expected %t", s, ok)
+		}
+	}
+}
+
+func TestApplyURLOptions(t *testing.T) {
+	var origin bool
+
+	if err := applyURLOptions(&origin, url.Values{"origin_detection": {"true"}}); err != nil || !origin {
+		t.Errorf("origin detection should be enabled: %t (%v)", origin, err)
+	}
+
+	for _, query := range []url.Values{
+		{"origin_detection": {"maybe"}},
+		{"prefix": {"ecs-logs."}},
+	} {
+		if err := applyURLOptions(&origin, query); err == nil {
+			t.Errorf("%v: invalid parameters should be rejected", query)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// DefaultHost is the address of the docker daemon used when DOCKER_HOST isn't
+// set.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// client sends requests to the Engine API of a docker daemon.
+type client struct {
+	http *http.Client
+	base string
+}
+
+// newClient returns a client of the daemon at host, either a unix socket
+// (unix:///path) or a TCP address (tcp://host:port). Connections to TCP
+// addresses use TLS when config isn't nil.
+func newClient(host string, config *tls.Config) (*client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	c := &client{http: &http.Client{Transport: transport}}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		c.base = "http://docker"
+
+	case "tcp", "http":
+		if len(u.Host) == 0 {
+			return nil, fmt.Errorf("missing address")
+		}
+		c.base = "http://" + u.Host
+
+		if config != nil {
+			transport.TLSClientConfig = config
+			c.base = "https://" + u.Host
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	return c, nil
+}
+
+// loadTLSConfig returns the configuration of TLS connections verifying the
+// daemon with the certificates found in dir, named like the docker CLI
+// expects them: ca.pem for the authority, and cert.pem and key.pem for the
+// optional client certificate.
+func loadTLSConfig(dir string) (config *tls.Config, err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadFile(filepath.Join(dir, "ca.pem")); err != nil {
+		return
+	}
+
+	config = &tls.Config{RootCAs: x509.NewCertPool()}
+
+	if !config.RootCAs.AppendCertsFromPEM(b) {
+		err = fmt.Errorf("no certificates found in %s", filepath.Join(dir, "ca.pem"))
+		return
+	}
+
+	cert, key := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err = os.Stat(cert); os.IsNotExist(err) {
+		err = nil
+		return
+	}
+
+	var crt tls.Certificate
+
+	if crt, err = tls.LoadX509KeyPair(cert, key); err != nil {
+		return
+	}
+
+	config.Certificates = []tls.Certificate{crt}
+	return
+}
+
+// get sends a GET request to the API, the caller must close the body of the
+// response.
+func (c *client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.base + path
+
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err = lib.NewHTTPError("docker "+path, res)
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	res, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// container is the part of the description of a container returned by the
+// inspect endpoint used by the reader.
+type container struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+		Tty    bool              `json:"Tty"`
+	} `json:"Config"`
+}
+
+// running returns the IDs of the running containers.
+func (c *client) running(ctx context.Context) (ids []string, err error) {
+	var list []struct {
+		ID string `json:"Id"`
+	}
+
+	if err = c.getJSON(ctx, "/containers/json", nil, &list); err != nil {
+		return
+	}
+
+	for _, x := range list {
+		ids = append(ids, x.ID)
+	}
+	return
+}
+
+func (c *client) inspect(ctx context.Context, id string) (ct container, err error) {
+	err = c.getJSON(ctx, "/containers/"+id+"/json", nil, &ct)
+	ct.Name = strings.TrimPrefix(ct.Name, "/")
+	return
+}
+
+// starts returns the stream of the events of containers being started, the
+// caller must close the body of the response.
+func (c *client) starts(ctx context.Context) (*http.Response, error) {
+	return c.get(ctx, "/events", url.Values{
+		"filters": {`{"type":["container"],"event":["start"]}`},
+	})
+}
+
+// logs returns the stream of the outputs of a container written since the
+// given time, the caller must close the body of the response.
+func (c *client) logs(ctx context.Context, id string, since time.Time) (*http.Response, error) {
+	query := url.Values{
+		"follow":     {"1"},
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"timestamps": {"1"},
+	}
+
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+
+	return c.get(ctx, "/containers/"+id+"/logs", query)
+}
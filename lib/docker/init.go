@@ -0,0 +1,7 @@
+package docker
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("docker", lib.SourceFunc(NewReader))
+}
@@ -0,0 +1,417 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+const (
+	defaultGroup  = "{name}"
+	defaultStream = "{id}"
+
+	// How long to wait before connecting to the daemon again when the stream
+	// of events was interrupted.
+	retryDelay = 5 * time.Second
+)
+
+// Config is the configuration of a reader of the logs of docker containers.
+type Config struct {
+	// Address of the docker daemon, see newClient.
+	Host string
+
+	// Templates of the groups and streams of the messages, see expand.
+	Group  string
+	Stream string
+
+	// Comma separated list of the container labels copied to the events, or
+	// "*" to copy all of them.
+	Labels string
+
+	// Whether connections to TCP addresses use TLS and verify the daemon,
+	// and the directory holding the certificates (~/.docker by default).
+	TLSVerify bool
+	CertPath  string
+}
+
+// NewReader returns a reader of the logs of the containers run by the docker
+// daemon configured by the DOCKER_* environment variables.
+func NewReader() (lib.Reader, error) {
+	return NewReaderWith(Config{
+		Host:   os.Getenv("DOCKER_HOST"),
+		Group:  os.Getenv("DOCKER_GROUP"),
+		Stream: os.Getenv("DOCKER_STREAM"),
+		Labels: os.Getenv("DOCKER_LABELS"),
+
+		// Like with the docker CLI, any value enables TLS.
+		TLSVerify: len(os.Getenv("DOCKER_TLS_VERIFY")) != 0,
+		CertPath:  os.Getenv("DOCKER_CERT_PATH"),
+	})
+}
+
+// NewReaderWith returns a reader of the logs of the containers run by the
+// docker daemon configured by config. The containers already running are
+// read from the time the reader is opened, the ones started later from their
+// start.
+func NewReaderWith(config Config) (lib.Reader, error) {
+	if len(config.Host) == 0 {
+		config.Host = DefaultHost
+	}
+
+	if len(config.Group) == 0 {
+		config.Group = defaultGroup
+	}
+
+	if len(config.Stream) == 0 {
+		config.Stream = defaultStream
+	}
+
+	var tlsConfig *tls.Config
+
+	if config.TLSVerify {
+		if len(config.CertPath) == 0 {
+			config.CertPath = filepath.Join(os.Getenv("HOME"), ".docker")
+		}
+
+		var err error
+		if tlsConfig, err = loadTLSConfig(config.CertPath); err != nil {
+			return nil, fmt.Errorf("invalid docker TLS certificates: %s", err)
+		}
+	}
+
+	c, err := newClient(config.Host, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST value: %s: %s", config.Host, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	since := time.Now()
+
+	// The events are watched before listing the running containers so the
+	// ones started in between aren't missed.
+	events, err := c.starts(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &reader{
+		client:   c,
+		group:    config.Group,
+		stream:   config.Stream,
+		ctx:      ctx,
+		cancel:   cancel,
+		results:  make(chan lib.Message),
+		done:     make(chan struct{}),
+		attached: make(map[string]bool),
+	}
+	r.labels, r.allLabels = parseLabels(config.Labels)
+
+	go r.watch(events, since)
+	return r, nil
+}
+
+type reader struct {
+	client    *client
+	group     string
+	stream    string
+	labels    []string
+	allLabels bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results chan lib.Message
+	done    chan struct{}
+	once    sync.Once
+
+	// IDs of the containers whose logs are being read.
+	mutex    sync.Mutex
+	attached map[string]bool
+}
+
+func (r *reader) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+		r.cancel()
+	})
+	return nil
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	select {
+	case msg = <-r.results:
+	case <-r.done:
+		err = io.EOF
+	}
+	return
+}
+
+func (r *reader) closed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// watch attaches to the running containers and to the ones started later.
+// When the connection to the daemon is lost, for example because it was
+// restarted, the containers are read again from that time once it is back.
+func (r *reader) watch(events *http.Response, since time.Time) {
+	for {
+		r.attachRunning(since)
+		err := r.follow(events)
+		events.Body.Close()
+		since = time.Now()
+
+		for {
+			if r.closed() {
+				return
+			}
+
+			log.WithField("error", err).Error("lost the stream of docker events, connecting again")
+
+			select {
+			case <-time.After(retryDelay):
+			case <-r.done:
+				return
+			}
+
+			if events, err = r.client.starts(r.ctx); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// follow attaches to the containers started until the stream of events ends.
+// Their logs are read from the time they were started, so the lines written
+// before they were inspected aren't missed, nor the ones written by previous
+// runs of restarted containers read again.
+func (r *reader) follow(events *http.Response) (err error) {
+	d := json.NewDecoder(events.Body)
+
+	for {
+		var e struct {
+			ID    string `json:"id"`
+			Actor struct {
+				ID string `json:"ID"`
+			} `json:"Actor"`
+			Time     int64 `json:"time"`
+			TimeNano int64 `json:"timeNano"`
+		}
+
+		if err = d.Decode(&e); err != nil {
+			return
+		}
+
+		if len(e.Actor.ID) != 0 {
+			e.ID = e.Actor.ID
+		}
+
+		var since time.Time
+
+		switch {
+		case e.TimeNano != 0:
+			since = time.Unix(0, e.TimeNano)
+		case e.Time != 0:
+			since = time.Unix(e.Time, 0)
+		}
+
+		r.attach(e.ID, since)
+	}
+}
+
+func (r *reader) attachRunning(since time.Time) {
+	ids, err := r.client.running(r.ctx)
+
+	if err != nil {
+		if !r.closed() {
+			log.WithField("error", err).Error("failed to list the running docker containers")
+		}
+		return
+	}
+
+	for _, id := range ids {
+		r.attach(id, since)
+	}
+}
+
+// attach starts reading the logs written by a container since the given time
+// if they aren't read already.
+func (r *reader) attach(id string, since time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.attached[id] {
+		r.attached[id] = true
+		go r.read(id, since)
+	}
+}
+
+// read sends the messages of the logs of a container until it stops.
+func (r *reader) read(id string, since time.Time) {
+	defer func() {
+		r.mutex.Lock()
+		delete(r.attached, id)
+		r.mutex.Unlock()
+	}()
+
+	ct, err := r.client.inspect(r.ctx, id)
+
+	if err != nil {
+		if !r.closed() {
+			log.WithFields(log.Fields{
+				"container": id,
+				"error":     err,
+			}).Warn("failed to inspect docker container")
+		}
+		return
+	}
+
+	res, err := r.client.logs(r.ctx, id, since)
+
+	if err != nil {
+		if !r.closed() {
+			log.WithFields(log.Fields{
+				"container": ct.Name,
+				"error":     err,
+			}).Warn("failed to read the logs of docker container")
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	group, stream := expand(r.group, ct), expand(r.stream, ct)
+
+	if len(group) == 0 {
+		group = ct.Name
+	}
+
+	if len(stream) == 0 {
+		stream = ct.ID
+	}
+
+	s := newLogStream(res.Body, ct.Config.Tty)
+
+	for {
+		output, t, line, err := s.next()
+
+		if err != nil {
+			if err != io.EOF && !r.closed() {
+				log.WithFields(log.Fields{
+					"container": ct.Name,
+					"error":     err,
+				}).Warn("the logs of docker container were interrupted")
+			}
+			return
+		}
+
+		level := ecslogs.INFO
+		if output == stderr {
+			level = ecslogs.ERROR
+		}
+
+		msg := lib.Message{
+			Group:  group,
+			Stream: stream,
+			Event:  ecslogs.MakeEvent(level, line),
+		}
+
+		if !t.IsZero() {
+			msg.Event.Time = t
+		}
+
+		if labels, ok := containerLabels(ct, r.labels, r.allLabels); ok {
+			if msg.Event.Data == nil {
+				msg.Event.Data = ecslogs.EventData{}
+			}
+			msg.Event.Data[lib.LabelsKey] = labels
+		}
+
+		select {
+		case r.results <- msg:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+var labelVariable = regexp.MustCompile(`\{label:([^}]*)\}`)
+
+// expand replaces the variables of a group or stream template: {name} is the
+// name of the container, {id} its ID, {image} the image it runs and
+// {label:key} the value of one of its labels, empty if it isn't set.
+func expand(template string, ct container) string {
+	if strings.IndexByte(template, '{') < 0 {
+		return template
+	}
+
+	template = labelVariable.ReplaceAllStringFunc(template, func(v string) string {
+		return ct.Config.Labels[labelVariable.FindStringSubmatch(v)[1]]
+	})
+
+	return strings.NewReplacer(
+		"{name}", ct.Name,
+		"{id}", ct.ID,
+		"{image}", ct.Config.Image,
+	).Replace(template)
+}
+
+// parseLabels parses a comma separated list of container labels, all is set
+// when the list is "*".
+func parseLabels(s string) (labels []string, all bool) {
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+
+		if name == "*" {
+			all = true
+			continue
+		}
+
+		labels = append(labels, name)
+	}
+	return
+}
+
+// containerLabels returns the labels of ct, either the ones listed in labels
+// or all of them.
+func containerLabels(ct container, labels []string, all bool) (data ecslogs.EventData, ok bool) {
+	for name, v := range ct.Config.Labels {
+		if !all && !containsString(labels, name) {
+			continue
+		}
+
+		if data == nil {
+			data = ecslogs.EventData{}
+		}
+
+		data[name], ok = v, true
+	}
+	return
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
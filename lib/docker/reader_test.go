@@ -0,0 +1,179 @@
+package docker
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// frame returns a frame of a multiplexed log stream.
+func frame(output byte, s string) []byte {
+	b := make([]byte, 8, 8+len(s))
+	b[0] = output
+	binary.BigEndian.PutUint32(b[4:], uint32(len(s)))
+	return append(b, s...)
+}
+
+func newDaemon(t *testing.T, started chan string) *httptest.Server {
+	return httptest.NewServer(newDaemonHandler(t, started))
+}
+
+func newDaemonHandler(t *testing.T, started chan string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case id := <-started:
+				fmt.Fprintf(w, `{"status":"start","id":%q,"Type":"container","Action":"start","Actor":{"ID":%q},"time":1496318402,"timeNano":1496318402250000000}`+"\n", id, id)
+				w.(http.Flusher).Flush()
+			case <-req.Context().Done():
+				return
+			}
+		}
+	})
+
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `[{"Id":"0123abcd"}]`)
+	})
+
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/containers/0123abcd/json":
+			fmt.Fprint(w, `{"Id":"0123abcd","Name":"/api","Config":{"Image":"api:1","Labels":{"service":"api","team":"core"}}}`)
+
+		case "/containers/4567efgh/json":
+			fmt.Fprint(w, `{"Id":"4567efgh","Name":"/worker","Config":{"Image":"worker:1","Tty":true}}`)
+
+		case "/containers/0123abcd/logs":
+			if len(req.URL.Query().Get("since")) == 0 {
+				t.Error("the logs of running containers must be read from the time the reader was opened")
+			}
+			w.Write(frame(stdout, "2017-06-01T12:00:00.5Z hello\n"))
+			w.Write(frame(stderr, "2017-06-01T12:00:01Z long "))
+			w.Write(frame(stdout, "2017-06-01T12:00:01Z world\n"))
+			w.Write(frame(stderr, "2017-06-01T12:00:01Z line\n"))
+
+		case "/containers/4567efgh/logs":
+			if since := req.URL.Query().Get("since"); since != "1496318402.250000000" {
+				t.Errorf("the logs of started containers must be read from their start: %s", since)
+			}
+			fmt.Fprint(w, "2017-06-01T12:00:02Z started\r\n")
+
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	return mux
+}
+
+func TestReader(t *testing.T) {
+	started := make(chan string, 1)
+	daemon := newDaemon(t, started)
+	defer daemon.Close()
+
+	r, err := NewReaderWith(Config{
+		Host:   strings.Replace(daemon.URL, "http://", "tcp://", 1),
+		Group:  "{label:service}",
+		Labels: "team",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	read := func() lib.Message {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	for _, expected := range []struct {
+		level   ecslogs.Level
+		message string
+		time    time.Time
+	}{
+		{ecslogs.INFO, "hello", time.Date(2017, 6, 1, 12, 0, 0, 5e8, time.UTC)},
+		{ecslogs.INFO, "world", time.Date(2017, 6, 1, 12, 0, 1, 0, time.UTC)},
+		{ecslogs.ERROR, "long line", time.Date(2017, 6, 1, 12, 0, 1, 0, time.UTC)},
+	} {
+		msg := read()
+
+		if msg.Group != "api" || msg.Stream != "0123abcd" {
+			t.Errorf("invalid group and stream: %s/%s", msg.Group, msg.Stream)
+		}
+
+		if msg.Event.Level != expected.level || msg.Event.Message != expected.message || !msg.Event.Time.Equal(expected.time) {
+			t.Errorf("invalid event: %s %s %s", msg.Event.Time, msg.Event.Level, msg.Event.Message)
+		}
+
+		if labels, _ := msg.Event.Data[lib.LabelsKey].(ecslogs.EventData); len(labels) != 1 || labels["team"] != "core" {
+			t.Errorf("invalid labels: %v", msg.Event.Data[lib.LabelsKey])
+		}
+	}
+
+	// The group falls back to the name of containers without the label.
+	started <- "4567efgh"
+
+	if msg := read(); msg.Group != "worker" || msg.Stream != "4567efgh" || msg.Event.Message != "started" {
+		t.Errorf("invalid message of the started container: %s/%s %s", msg.Group, msg.Stream, msg.Event.Message)
+	}
+}
+
+func TestNewReaderInvalidHost(t *testing.T) {
+	for _, host := range []string{"ftp://docker", "tcp://", "%zz"} {
+		if _, err := NewReaderWith(Config{Host: host}); err == nil {
+			t.Errorf("%s: opening a reader must fail", host)
+		}
+	}
+}
+
+func TestReaderTLS(t *testing.T) {
+	daemon := httptest.NewTLSServer(newDaemonHandler(t, nil))
+	defer daemon.Close()
+
+	dir, err := ioutil.TempDir("", "ecs-logs-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: daemon.Certificate().Raw})
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.Replace(daemon.URL, "https://", "tcp://", 1)
+
+	if _, err := NewReaderWith(Config{Host: host, TLSVerify: true, CertPath: os.TempDir()}); err == nil {
+		t.Error("opening a reader without the certificate authority must fail")
+	}
+
+	r, err := NewReaderWith(Config{Host: host, TLSVerify: true, CertPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if msg, err := r.ReadMessage(); err != nil || msg.Event.Message != "hello" {
+		t.Errorf("invalid message: %v %s", err, msg.Event.Message)
+	}
+}
@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	// Identifiers of the outputs of containers in multiplexed log streams.
+	stdout = 1
+	stderr = 2
+
+	// Maximum size of the lines read from the log streams and of the lines
+	// reassembled from fragments.
+	maxLineSize = 1024 * 1024
+)
+
+// logStream reads the lines of a container's log stream. The outputs of
+// containers without a TTY are multiplexed in frames each holding a line or
+// a fragment of it, the output of containers with a TTY is sent as is.
+type logStream struct {
+	r   *bufio.Reader
+	tty bool
+
+	// Fragments of lines of each output, docker splits lines longer than
+	// 16KB in multiple frames.
+	partials [3]string
+}
+
+func newLogStream(r io.Reader, tty bool) *logStream {
+	return &logStream{r: bufio.NewReader(r), tty: tty}
+}
+
+// next returns the next complete line of the stream, the output it was
+// written to and the time at which docker received it.
+func (s *logStream) next() (output int, t time.Time, line string, err error) {
+	for {
+		var chunk string
+
+		if output, chunk, err = s.chunk(); err != nil {
+			return
+		}
+
+		// Logs are requested with timestamps, each chunk starts with the
+		// time at which it was written.
+		if i := strings.IndexByte(chunk, ' '); i > 0 {
+			if ts, e := time.Parse(time.RFC3339Nano, chunk[:i]); e == nil {
+				t, chunk = ts, chunk[i+1:]
+			}
+		}
+
+		line = s.partials[output] + chunk
+
+		if !strings.HasSuffix(chunk, "\n") && len(line) < maxLineSize {
+			s.partials[output] = line
+			continue
+		}
+
+		s.partials[output] = ""
+		line = strings.TrimRight(line, "\r\n")
+		return
+	}
+}
+
+// chunk returns the next frame of a multiplexed stream, or the next line of a
+// raw stream.
+func (s *logStream) chunk() (output int, chunk string, err error) {
+	if s.tty {
+		var b []byte
+		b, err = readLine(s.r)
+		return stdout, string(b), err
+	}
+
+	var header [8]byte
+
+	if _, err = io.ReadFull(s.r, header[:]); err != nil {
+		return
+	}
+
+	output = int(header[0])
+	size := binary.BigEndian.Uint32(header[4:])
+
+	if output != stdout && output != stderr {
+		output = stdout
+	}
+
+	if size > maxLineSize {
+		// Frames larger than the maximum line size are truncated.
+		b := make([]byte, maxLineSize)
+		if _, err = io.ReadFull(s.r, b); err == nil {
+			_, err = io.CopyN(ioutil.Discard, s.r, int64(size-maxLineSize))
+		}
+		return output, string(b), noEOF(err)
+	}
+
+	b := make([]byte, size)
+	_, err = io.ReadFull(s.r, b)
+	return output, string(b), noEOF(err)
+}
+
+// readLine reads up to the end of the next line, or maxLineSize bytes of it.
+func readLine(r *bufio.Reader) (line []byte, err error) {
+	for {
+		var b []byte
+
+		b, err = r.ReadSlice('\n')
+		line = append(line, b...)
+
+		if err != bufio.ErrBufferFull || len(line) >= maxLineSize {
+			break
+		}
+	}
+
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+
+	if err == io.EOF && len(line) != 0 {
+		err = nil
+	}
+
+	return
+}
+
+// noEOF reports frames cut short by the end of the stream as unexpected.
+func noEOF(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
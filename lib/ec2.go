@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EC2MetadataURL is the address of the EC2 instance metadata service.
+var EC2MetadataURL = "http://169.254.169.254"
+
+// ec2MetadataTimeout is how long fetching the instance identity may take, it
+// fails quickly outside of EC2.
+const ec2MetadataTimeout = 2 * time.Second
+
+// EC2InstanceIdentity is the part of the identity document of an EC2 instance
+// used by the program.
+type EC2InstanceIdentity struct {
+	InstanceID string `json:"instanceId"`
+	Region     string `json:"region"`
+}
+
+// GetEC2InstanceIdentity returns the identity of the EC2 instance the program
+// runs on. The instance doesn't change while the program runs, the identity is
+// fetched from the metadata service until it succeeds and shared by all the
+// callers after that.
+func GetEC2InstanceIdentity() (id EC2InstanceIdentity, err error) {
+	ec2Instance.mutex.Lock()
+	defer ec2Instance.mutex.Unlock()
+
+	if !ec2Instance.ok {
+		if ec2Instance.id, err = FetchEC2InstanceIdentity(EC2MetadataURL); err != nil {
+			return
+		}
+		ec2Instance.ok = true
+	}
+
+	id = ec2Instance.id
+	return
+}
+
+var ec2Instance struct {
+	mutex sync.Mutex
+	id    EC2InstanceIdentity
+	ok    bool
+}
+
+// FetchEC2InstanceIdentity reads the instance identity document from the
+// metadata service at url, with a session token when the instance requires
+// IMDSv2.
+func FetchEC2InstanceIdentity(url string) (id EC2InstanceIdentity, err error) {
+	var req *http.Request
+	var res *http.Response
+
+	client := http.Client{Timeout: ec2MetadataTimeout}
+
+	if req, err = http.NewRequest("PUT", url+"/latest/api/token", nil); err != nil {
+		return
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	var token string
+	if res, err = client.Do(req); err == nil {
+		if res.StatusCode == http.StatusOK {
+			b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 256))
+			token = string(b)
+		}
+		res.Body.Close()
+	}
+
+	if req, err = http.NewRequest("GET", url+"/latest/dynamic/instance-identity/document", nil); err != nil {
+		return
+	}
+	if len(token) != 0 {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	if res, err = client.Do(req); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = NewHTTPError("EC2 instance identity", res)
+		return
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&id); err != nil {
+		err = fmt.Errorf("invalid EC2 instance identity: %s", err)
+	}
+
+	return
+}
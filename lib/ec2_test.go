@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchEC2InstanceIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "PUT" && req.URL.Path == "/latest/api/token":
+			res.Write([]byte("token"))
+		case req.URL.Path == "/latest/dynamic/instance-identity/document":
+			if req.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				res.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			res.Write([]byte(`{"instanceId":"i-0123456789abcdef0","region":"us-west-2"}`))
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	id, err := FetchEC2InstanceIdentity(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != (EC2InstanceIdentity{InstanceID: "i-0123456789abcdef0", Region: "us-west-2"}) {
+		t.Errorf("invalid instance identity: %+v", id)
+	}
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// EncryptedPrefix starts the values of encrypted fields, it is followed by the
+// base64 encoding of the AES key encrypted with RSA-OAEP (SHA-256), a '.', and
+// the base64 encoding of the AES-GCM nonce and ciphertext of the JSON value.
+const EncryptedPrefix = "enc:v1:"
+
+// FieldEncrypter encrypts fields of the event data with a public key, so
+// sensitive values can be logged without the destinations being able to read
+// them.
+type FieldEncrypter struct {
+	key    *rsa.PublicKey
+	fields [][]string
+}
+
+// NewFieldEncrypter returns a FieldEncrypter for the PEM encoded RSA public
+// key. Fields are paths in the event data, with '.' separating the keys of
+// nested objects.
+func NewFieldEncrypter(key []byte, fields []string) (e *FieldEncrypter, err error) {
+	var block *pem.Block
+	var pub interface{}
+
+	if block, _ = pem.Decode(key); block == nil {
+		err = errors.New("no PEM encoded key found")
+		return
+	}
+
+	if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return
+	}
+
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		err = errors.New("only RSA public keys are supported")
+		return
+	}
+
+	e = &FieldEncrypter{key: rsaKey}
+
+	for _, f := range fields {
+		e.fields = append(e.fields, strings.Split(f, "."))
+	}
+
+	return
+}
+
+// Encrypt replaces the values of the fields found in data with their
+// encrypted form.
+func (e *FieldEncrypter) Encrypt(data ecslogs.EventData) (err error) {
+	for _, path := range e.fields {
+		m := map[string]interface{}(data)
+
+		for _, key := range path[:len(path)-1] {
+			if m, _ = m[key].(map[string]interface{}); m == nil {
+				break
+			}
+		}
+
+		key := path[len(path)-1]
+
+		if v, ok := m[key]; ok {
+			if m[key], err = e.encryptValue(v); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncryptValue returns the encrypted form of v, it is used for values that
+// may hold the fields to encrypt but can't be searched for them, like input
+// that couldn't be parsed.
+func (e *FieldEncrypter) EncryptValue(v interface{}) (string, error) {
+	return e.encryptValue(v)
+}
+
+func (e *FieldEncrypter) encryptValue(v interface{}) (s string, err error) {
+	var plain, wrapped []byte
+	var block cipher.Block
+	var gcm cipher.AEAD
+
+	if plain, err = json.Marshal(v); err != nil {
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return
+	}
+
+	if wrapped, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, e.key, key, nil); err != nil {
+		return
+	}
+
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+
+	if gcm, err = cipher.NewGCM(block); err != nil {
+		return
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	s = EncryptedPrefix +
+		base64.RawURLEncoding.EncodeToString(wrapped) + "." +
+		base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil))
+	return
+}
+
+// DecryptValue decrypts a value encrypted by a FieldEncrypter, returning the
+// JSON representation of the original value.
+func DecryptValue(key *rsa.PrivateKey, s string) (plain []byte, err error) {
+	var wrapped, sealed, aesKey []byte
+	var block cipher.Block
+	var gcm cipher.AEAD
+
+	if !strings.HasPrefix(s, EncryptedPrefix) {
+		err = errors.New("not an encrypted value")
+		return
+	}
+
+	parts := strings.Split(s[len(EncryptedPrefix):], ".")
+	if len(parts) != 2 {
+		err = errors.New("malformed encrypted value")
+		return
+	}
+
+	if wrapped, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return
+	}
+
+	if sealed, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return
+	}
+
+	if aesKey, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, wrapped, nil); err != nil {
+		return
+	}
+
+	if block, err = aes.NewCipher(aesKey); err != nil {
+		return
+	}
+
+	if gcm, err = cipher.NewGCM(block); err != nil {
+		return
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		err = fmt.Errorf("malformed encrypted value")
+		return
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestFieldEncrypter(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewFieldEncrypter(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), []string{"ssn", "user.email", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := ecslogs.EventData{
+		"ssn":  "123-45-6789",
+		"user": map[string]interface{}{"email": "bob@example.com", "id": 42},
+	}
+
+	if err := e.Encrypt(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := data["missing"]; ok {
+		t.Error("fields missing from the event must not be added")
+	}
+
+	tests := []struct {
+		value interface{}
+		plain string
+	}{
+		{data["ssn"], `"123-45-6789"`},
+		{data["user"].(map[string]interface{})["email"], `"bob@example.com"`},
+	}
+
+	for _, test := range tests {
+		s, _ := test.value.(string)
+
+		if !strings.HasPrefix(s, EncryptedPrefix) {
+			t.Errorf("the field wasn't encrypted: %v", test.value)
+			continue
+		}
+
+		if plain, err := DecryptValue(priv, s); err != nil {
+			t.Error(err)
+		} else if string(plain) != test.plain {
+			t.Errorf("invalid decrypted value: %s != %s", test.plain, plain)
+		}
+	}
+
+	if id := data["user"].(map[string]interface{})["id"]; id != 42 {
+		t.Errorf("other fields must be left unchanged: %v", id)
+	}
+
+	s, err := e.EncryptValue(`{"ssn":"123-45-6789"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plain, err := DecryptValue(priv, s); err != nil {
+		t.Error(err)
+	} else if string(plain) != `"{\"ssn\":\"123-45-6789\""` {
+		t.Errorf("invalid decrypted value: %s", plain)
+	}
+}
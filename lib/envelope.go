@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// cloudwatchEnvelope is the payload delivered by CloudWatch Logs subscriptions.
+type cloudwatchEnvelope struct {
+	MessageType string `json:"messageType"`
+	LogGroup    string `json:"logGroup"`
+	LogStream   string `json:"logStream"`
+	LogEvents   []struct {
+		ID        string `json:"id"`
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	} `json:"logEvents"`
+}
+
+// s3Envelope is the payload of S3 event notifications.
+type s3Envelope struct {
+	Event   string `json:"Event"`
+	Records []struct {
+		EventSource string    `json:"eventSource"`
+		EventName   string    `json:"eventName"`
+		EventTime   time.Time `json:"eventTime"`
+		AWSRegion   string    `json:"awsRegion"`
+		S3          struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// unwrapEnvelope returns the messages held by raw if it's an envelope, the
+// events of CloudWatch Logs subscriptions keep their log group and stream.
+// Control messages, sent to check that the destination is reachable, hold no
+// messages.
+func unwrapEnvelope(raw []byte) (msgs []Message, ok bool) {
+	if bytes.Contains(raw, []byte(`"aws:s3"`)) || bytes.Contains(raw, []byte(`"s3:TestEvent"`)) {
+		return unwrapS3Envelope(raw)
+	}
+
+	if !bytes.Contains(raw, []byte(`"logEvents"`)) {
+		return
+	}
+
+	var env cloudwatchEnvelope
+
+	if json.Unmarshal(raw, &env) != nil || len(env.MessageType) == 0 {
+		return
+	}
+
+	ok = true
+
+	if env.MessageType != "DATA_MESSAGE" {
+		return
+	}
+
+	for _, e := range env.LogEvents {
+		msgs = append(msgs, Message{
+			Group:  env.LogGroup,
+			Stream: env.LogStream,
+			Event: ecslogs.Event{
+				Info:    ecslogs.EventInfo{ID: e.ID},
+				Data:    ecslogs.EventData{},
+				Time:    time.Unix(0, e.Timestamp*int64(time.Millisecond)),
+				Message: e.Message,
+			},
+		})
+	}
+
+	return
+}
+
+// unwrapS3Envelope returns a message for each of the records of an S3 event
+// notification, in the group named after the bucket and the stream named after
+// its region. The test events sent when notifications are configured hold no
+// messages.
+func unwrapS3Envelope(raw []byte) (msgs []Message, ok bool) {
+	var env s3Envelope
+
+	if json.Unmarshal(raw, &env) != nil {
+		return
+	}
+
+	if env.Event == "s3:TestEvent" {
+		ok = true
+		return
+	}
+
+	for _, r := range env.Records {
+		if r.EventSource != "aws:s3" {
+			return nil, false
+		}
+
+		msgs = append(msgs, Message{
+			Group:  r.S3.Bucket.Name,
+			Stream: r.AWSRegion,
+			Event: ecslogs.Event{
+				Level: ecslogs.INFO,
+				Data: ecslogs.EventData{
+					"event":  r.EventName,
+					"bucket": r.S3.Bucket.Name,
+					"key":    r.S3.Object.Key,
+					"size":   r.S3.Object.Size,
+				},
+				Time:    r.EventTime,
+				Message: r.EventName + " s3://" + r.S3.Bucket.Name + "/" + r.S3.Object.Key,
+			},
+		})
+	}
+
+	ok = len(msgs) != 0
+	return
+}
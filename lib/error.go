@@ -25,3 +25,96 @@ func (err ErrorList) Error() string {
 
 	return strings.Join(s, "\n")
 }
+
+// ParseError is returned by readers when some input could not be parsed into
+// a message, the reader can still be used to read the following messages.
+type ParseError struct {
+	Input string
+	Err   error
+}
+
+func (err *ParseError) Error() string {
+	return "parse error: " + err.Err.Error()
+}
+
+// ErrorKind classifies the errors returned by writers so the dispatcher can
+// decide how to react to a failed write.
+type ErrorKind int
+
+const (
+	// UnknownError is the kind of errors that weren't classified by the writer,
+	// the batch is dropped.
+	UnknownError ErrorKind = iota
+
+	// ThrottledError means the destination is rejecting writes because of rate
+	// limits, the batch can be retried after backing off.
+	ThrottledError
+
+	// OversizedError means the batch exceeds a size limit of the destination,
+	// it can be retried in smaller chunks.
+	OversizedError
+
+	// AuthFailureError means the destination rejected the credentials used by
+	// the writer, a new writer should be opened to refresh them.
+	AuthFailureError
+
+	// UnreachableError means the destination couldn't be reached, the batch can
+	// be retried after backing off.
+	UnreachableError
+
+	// FatalError means the program cannot make progress anymore and should
+	// exit.
+	FatalError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ThrottledError:
+		return "throttled"
+	case OversizedError:
+		return "oversized"
+	case AuthFailureError:
+		return "auth-failure"
+	case UnreachableError:
+		return "unreachable"
+	case FatalError:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// WriterError wraps an error returned by a writer with its kind.
+type WriterError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewWriterError returns err wrapped in a WriterError of the given kind, or nil
+// if err is nil.
+func NewWriterError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &WriterError{Kind: kind, Err: err}
+}
+
+func (err *WriterError) Error() string {
+	return err.Err.Error()
+}
+
+// ErrorKindOf returns the kind of err. For error lists the kind of the first
+// classified error is returned.
+func ErrorKindOf(err error) ErrorKind {
+	switch e := err.(type) {
+	case *WriterError:
+		return e.Kind
+	case ErrorList:
+		for _, x := range e {
+			if k := ErrorKindOf(x); k != UnknownError {
+				return k
+			}
+		}
+	}
+	return UnknownError
+}
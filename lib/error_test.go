@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	err := errors.New("oops")
+
+	tests := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{err, UnknownError},
+		{NewWriterError(ThrottledError, err), ThrottledError},
+		{NewWriterError(FatalError, err), FatalError},
+		{ErrorList{err, NewWriterError(OversizedError, err)}, OversizedError},
+	}
+
+	for _, test := range tests {
+		if kind := ErrorKindOf(test.err); kind != test.kind {
+			t.Errorf("%v: invalid error kind: %s != %s", test.err, test.kind, kind)
+		}
+	}
+
+	if NewWriterError(UnreachableError, nil) != nil {
+		t.Error("wrapping a nil error must return nil")
+	}
+}
@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// Fields of the events and of their info defined by ecs-logs-go.
+var (
+	eventFields = map[string]bool{
+		"level":   true,
+		"time":    true,
+		"info":    true,
+		"data":    true,
+		"message": true,
+	}
+
+	infoFields = map[string]bool{
+		"host":   true,
+		"source": true,
+		"id":     true,
+		"pid":    true,
+		"uid":    true,
+		"gid":    true,
+		"errors": true,
+	}
+)
+
+// ParseEvent decodes an event sent by a client, checking that it only has the
+// fields of the ecs-logs-go events and that they have valid values, since the
+// fields that don't match would otherwise be dropped silently.
+func ParseEvent(b []byte) (event ecslogs.Event, err error) {
+	var fields map[string]json.RawMessage
+
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return
+	}
+
+	if err = checkFields(fields, eventFields, ""); err != nil {
+		return
+	}
+
+	if raw, ok := fields["info"]; ok {
+		var info map[string]json.RawMessage
+
+		if err = json.Unmarshal(raw, &info); err != nil {
+			err = fmt.Errorf("invalid event info: %s", raw)
+			return
+		}
+
+		if err = checkFields(info, infoFields, "info."); err != nil {
+			return
+		}
+	}
+
+	if raw, ok := fields["level"]; ok {
+		var s string
+
+		if json.Unmarshal(raw, &s) != nil {
+			err = fmt.Errorf("invalid event level: %s", raw)
+			return
+		}
+
+		if _, e := ecslogs.ParseLevel(s); e != nil {
+			err = fmt.Errorf("invalid event level: %s", raw)
+			return
+		}
+	}
+
+	if raw, ok := fields["time"]; ok {
+		var t time.Time
+
+		if json.Unmarshal(raw, &t) != nil {
+			err = fmt.Errorf("invalid event time: %s", raw)
+			return
+		}
+	}
+
+	if err = json.Unmarshal(b, &event); err != nil {
+		return
+	}
+
+	if len(event.Message) == 0 {
+		err = fmt.Errorf("missing event message")
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if event.Level == ecslogs.NONE {
+		event.Level = ecslogs.INFO
+	}
+
+	return
+}
+
+func checkFields(fields map[string]json.RawMessage, known map[string]bool, prefix string) error {
+	for name := range fields {
+		if !known[name] {
+			return fmt.Errorf("unknown event field: %s%s", prefix, name)
+		}
+	}
+	return nil
+}
+
+// ParseMessage decodes a message sent by a client, which is either a message
+// holding the group, stream and event like the ones read by the stdin source,
+// or an event. The group and stream are used when the message doesn't have
+// them, the event is checked by ParseEvent.
+func ParseMessage(b []byte, group string, stream string) (msg Message, err error) {
+	var m struct {
+		Group  string          `json:"group"`
+		Stream string          `json:"stream"`
+		Event  json.RawMessage `json:"event"`
+	}
+
+	if err = json.Unmarshal(b, &m); err != nil {
+		return
+	}
+
+	if m.Event == nil {
+		msg.Event, err = ParseEvent(b)
+	} else {
+		msg.Group, msg.Stream = m.Group, m.Stream
+		msg.Event, err = ParseEvent(m.Event)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if len(msg.Group) == 0 {
+		msg.Group = group
+	}
+
+	if len(msg.Stream) == 0 {
+		msg.Stream = stream
+	}
+
+	if len(msg.Group) == 0 {
+		err = fmt.Errorf("missing group")
+	} else if len(msg.Stream) == 0 {
+		err = fmt.Errorf("missing stream")
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"level":"ERROR","time":"2017-06-01T12:00:00Z","info":{"pid":1},"message":"hello"}`), "app", "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Group != "app" || msg.Stream != "host" || msg.Event.Level != ecslogs.ERROR || msg.Event.Info.PID != 1 || msg.Event.Message != "hello" {
+		t.Errorf("invalid message: %v", msg)
+	}
+
+	if msg, err = ParseMessage([]byte(`{"group":"api","event":{"message":"world"}}`), "app", "host"); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Group != "api" || msg.Stream != "host" || msg.Event.Level != ecslogs.INFO || msg.Event.Time.IsZero() {
+		t.Errorf("invalid message: %v", msg)
+	}
+
+	for _, input := range []string{
+		`{"message":"hi","extra":true}`,
+		`{"level":"LOUD","message":"hi"}`,
+		`{"time":"yesterday","message":"hi"}`,
+		`{"info":{"hostname":"web-1"},"message":"hi"}`,
+		`{"info":"web-1","message":"hi"}`,
+		`{"level":"INFO"}`,
+		`{"group":"api","event":{"message":"hi","tags":[]}}`,
+		`[{"message":"hi"}]`,
+	} {
+		if _, err := ParseMessage([]byte(input), "app", "host"); err == nil {
+			t.Errorf("%s: parsing an invalid message must fail", input)
+		}
+	}
+
+	if _, err := ParseMessage([]byte(`{"message":"hi"}`), "", "host"); err == nil {
+		t.Error("messages without a group must be rejected")
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent([]byte(`{"level":"WARN","time":"2017-06-01T12:00:00Z","info":{"host":"web-1","errors":[{"type":"E"}]},"data":{"user":42},"message":"hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Level != ecslogs.WARN || event.Info.Host != "web-1" || event.Data["user"] != 42.0 || event.Message != "hello" {
+		t.Errorf("invalid event: %v", event)
+	}
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"message":"hi","extra":true}`, "unknown event field: extra"},
+		{`{"info":{"hostname":"web-1"},"message":"hi"}`, "unknown event field: info.hostname"},
+		{`{"level":42,"message":"hi"}`, "invalid event level: 42"},
+		{`{"time":"yesterday","message":"hi"}`, `invalid event time: "yesterday"`},
+		{`{"level":"INFO"}`, "missing event message"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseEvent([]byte(test.input)); err == nil || err.Error() != test.err {
+			t.Errorf("%s: invalid error: %v", test.input, err)
+		}
+	}
+}
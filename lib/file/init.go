@@ -0,0 +1,7 @@
+package file
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterDestination("file", lib.DestinationFunc(NewWriter))
+}
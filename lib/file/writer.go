@@ -0,0 +1,71 @@
+package file
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+type WriterConfig struct {
+	// Path of the file the messages are appended to, it is created if it
+	// doesn't exist.
+	Path string
+
+	// Framing of the records and batches written to the file.
+	Framing lib.Framing
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+
+	if c.Path = os.Getenv("FILE_PATH"); len(c.Path) == 0 {
+		err = fmt.Errorf("missing FILE_PATH environment variable")
+		return
+	}
+
+	if c.Framing, err = lib.FramingFromEnvironment("FILE_"); err != nil {
+		return
+	}
+
+	return NewWriterWith(c)
+}
+
+// NewWriterWith returns a writer appending messages to the file described by
+// config, one JSON message per record.
+func NewWriterWith(config WriterConfig) (w lib.Writer, err error) {
+	var f *os.File
+
+	if f, err = os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		return
+	}
+
+	w = writer{config: config, file: f}
+	return
+}
+
+type writer struct {
+	config WriterConfig
+	file   *os.File
+}
+
+func (w writer) Close() error {
+	return w.file.Close()
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch appends the batch to the file in a single write, so
+// batches of writers sharing the file aren't interleaved.
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	var b []byte
+
+	if b, err = w.config.Framing.EncodeBatch(batch); err != nil {
+		return
+	}
+
+	_, err = w.file.Write(b)
+	return
+}
@@ -0,0 +1,54 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.log")
+	batch := lib.MessageBatch{
+		{Group: "a", Stream: "1", Event: ecslogs.Event{Message: "hello"}},
+		{Group: "a", Stream: "1", Event: ecslogs.Event{Message: "world"}},
+	}
+
+	for i := 0; i != 2; i++ {
+		w, err := NewWriterWith(WriterConfig{
+			Path:    path,
+			Framing: lib.Framing{RecordPrefix: "{length} ", BatchFooter: "--\n"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMessageBatch(batch); err != nil {
+			t.Error(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := lib.Framing{RecordPrefix: "{length} ", BatchFooter: "--\n"}.EncodeBatch(batch)
+
+	if s := string(b); s != string(expected)+string(expected) {
+		t.Errorf("invalid file content: %q", s)
+	}
+}
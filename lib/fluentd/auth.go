@@ -0,0 +1,93 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// How long clients have to authenticate after connecting.
+const handshakeTimeout = 10 * time.Second
+
+// handshake authenticates a client with the shared key, as described in the
+// handshake phase of the forward protocol: the server sends a HELO message
+// with a nonce, the client answers with a PING message proving it knows the
+// key, and the server answers with a PONG message proving it knows it too.
+// User authentication isn't supported.
+func handshake(conn net.Conn, in *bufio.Reader, config Config) (err error) {
+	var v interface{}
+	var b bytes.Buffer
+
+	nonce := make([]byte, 16)
+
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	encode(&b, []interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      "",
+		"keepalive": true,
+	}})
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err = conn.Write(b.Bytes()); err != nil {
+		return
+	}
+
+	if v, err = decode(in); err != nil {
+		return
+	}
+
+	ping, _ := v.([]interface{})
+
+	if len(ping) < 4 {
+		return fmt.Errorf("invalid PING message")
+	}
+
+	kind, _ := toString(ping[0])
+	hostname, _ := toString(ping[1])
+	salt, _ := toString(ping[2])
+	digest, _ := toString(ping[3])
+
+	if kind != "PING" {
+		return fmt.Errorf("invalid PING message")
+	}
+
+	ok := subtle.ConstantTimeCompare([]byte(digest), []byte(sharedKeyDigest(salt, hostname, nonce, config.SharedKey))) == 1
+	pong := []interface{}{"PONG", true, "", config.Hostname, sharedKeyDigest(salt, config.Hostname, nonce, config.SharedKey)}
+
+	if !ok {
+		pong = []interface{}{"PONG", false, "shared_key mismatch", config.Hostname, ""}
+	}
+
+	b.Reset()
+	encode(&b, pong)
+
+	if _, err = conn.Write(b.Bytes()); err != nil {
+		return
+	}
+
+	if !ok {
+		return fmt.Errorf("shared key mismatch from %s", hostname)
+	}
+
+	return
+}
+
+func sharedKeyDigest(salt string, hostname string, nonce []byte, key string) string {
+	h := sha512.New()
+	h.Write([]byte(salt))
+	h.Write([]byte(hostname))
+	h.Write(nonce)
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
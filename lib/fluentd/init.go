@@ -0,0 +1,7 @@
+package fluentd
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("fluentd", lib.SourceFunc(NewReader))
+}
@@ -0,0 +1,379 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// The forward protocol encodes its messages with msgpack, only the parts of
+// the format used by the protocol are implemented here.
+
+const (
+	// Limits of the sizes of the values decoded, so a malformed or hostile
+	// input doesn't make the reader allocate unbounded amounts of memory.
+	maxStringSize = 64 * 1024 * 1024
+	maxArraySize  = 1024 * 1024
+
+	// Maximum nesting of arrays and maps.
+	maxDepth = 64
+
+	// Binaries and strings are allocated with at most this size, and arrays
+	// and maps with at most this number of elements, they grow as their
+	// content is decoded so the sizes announced by the input aren't
+	// allocated before the input was actually received.
+	maxInitialSize   = 64 * 1024
+	maxInitialLength = 1024
+)
+
+// extension is a msgpack extension value, fluentd uses the type 0 for event
+// times with a nanosecond precision.
+type extension struct {
+	typ  int8
+	data []byte
+}
+
+// decode reads the next msgpack value from r. Maps are decoded with string
+// keys, strings as string and binaries as []byte.
+func decode(r *bufio.Reader) (v interface{}, err error) {
+	return decodeValue(r, 0)
+}
+
+// decodeValue reads the next msgpack value from r, depth is the number of
+// arrays and maps it's nested in.
+func decodeValue(r *bufio.Reader, depth int) (v interface{}, err error) {
+	var c byte
+
+	if c, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return decodeMap(r, int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return decodeArray(r, int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return decodeString(r, int(c&0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xc4, 0xc5, 0xc6:
+		var n int
+		if n, err = readSize(r, c-0xc4); err != nil {
+			return
+		}
+		return readBytes(r, n)
+
+	case 0xc7, 0xc8, 0xc9:
+		var n int
+		if n, err = readSize(r, c-0xc7); err != nil {
+			return
+		}
+		return decodeExtension(r, n)
+
+	case 0xca:
+		var b []byte
+		if b, err = readBytes(r, 4); err != nil {
+			return
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+
+	case 0xcb:
+		var b []byte
+		if b, err = readBytes(r, 8); err != nil {
+			return
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var u uint64
+		if u, err = readUint(r, 1<<(c-0xcc)); err != nil {
+			return
+		}
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		var u uint64
+		size := 1 << (c - 0xd0)
+		if u, err = readUint(r, size); err != nil {
+			return
+		}
+		// Sign extension of the value read.
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, nil
+
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeExtension(r, 1<<(c-0xd4))
+
+	case 0xd9, 0xda, 0xdb:
+		var n int
+		if n, err = readSize(r, c-0xd9); err != nil {
+			return
+		}
+		return decodeString(r, n)
+
+	case 0xdc, 0xdd:
+		var n int
+		if n, err = readSize(r, c-0xdc+1); err != nil {
+			return
+		}
+		return decodeArray(r, n, depth)
+
+	case 0xde, 0xdf:
+		var n int
+		if n, err = readSize(r, c-0xde+1); err != nil {
+			return
+		}
+		return decodeMap(r, n, depth)
+	}
+
+	return nil, fmt.Errorf("invalid msgpack type: 0x%02x", c)
+}
+
+// readSize reads a size encoded on 1, 2 or 4 bytes, for the 0, 1 and 2
+// values of width.
+func readSize(r *bufio.Reader, width byte) (n int, err error) {
+	var u uint64
+
+	if u, err = readUint(r, 1<<width); err != nil {
+		return
+	}
+
+	if u > maxStringSize {
+		err = fmt.Errorf("msgpack value too large: %d bytes", u)
+		return
+	}
+
+	n = int(u)
+	return
+}
+
+func readUint(r *bufio.Reader, size int) (u uint64, err error) {
+	var b []byte
+
+	if b, err = readBytes(r, size); err != nil {
+		return
+	}
+
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return
+}
+
+// readBytes reads n bytes from r, large values are read in a buffer which
+// grows as the bytes are received.
+func readBytes(r *bufio.Reader, n int) (b []byte, err error) {
+	if n <= maxInitialSize {
+		b = make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if _, err = io.CopyN(&buf, r, int64(n)); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+func decodeString(r *bufio.Reader, n int) (interface{}, error) {
+	b, err := readBytes(r, n)
+	return string(b), err
+}
+
+func decodeExtension(r *bufio.Reader, n int) (v interface{}, err error) {
+	var typ byte
+	var data []byte
+
+	if typ, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	if data, err = readBytes(r, n); err != nil {
+		return
+	}
+
+	return extension{typ: int8(typ), data: data}, nil
+}
+
+func decodeArray(r *bufio.Reader, n int, depth int) (v interface{}, err error) {
+	if n > maxArraySize {
+		return nil, fmt.Errorf("msgpack array too large: %d elements", n)
+	}
+
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("msgpack values nested too deep")
+	}
+
+	a := make([]interface{}, 0, initialLength(n))
+
+	for i := 0; i != n; i++ {
+		var e interface{}
+
+		if e, err = decodeValue(r, depth+1); err != nil {
+			return
+		}
+
+		a = append(a, e)
+	}
+
+	return a, nil
+}
+
+func decodeMap(r *bufio.Reader, n int, depth int) (v interface{}, err error) {
+	if n > maxArraySize {
+		return nil, fmt.Errorf("msgpack map too large: %d elements", n)
+	}
+
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("msgpack values nested too deep")
+	}
+
+	m := make(map[string]interface{}, initialLength(n))
+
+	for i := 0; i != n; i++ {
+		var key, value interface{}
+
+		if key, err = decodeValue(r, depth+1); err != nil {
+			return
+		}
+
+		if value, err = decodeValue(r, depth+1); err != nil {
+			return
+		}
+
+		m[mapKey(key)] = value
+	}
+
+	return m, nil
+}
+
+func initialLength(n int) int {
+	if n > maxInitialLength {
+		return maxInitialLength
+	}
+	return n
+}
+
+func mapKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	default:
+		return fmt.Sprint(k)
+	}
+}
+
+// encode appends the msgpack encoding of v to b, v may be a string, []byte,
+// bool, int, int64, extension, a []interface{} or a map[string]interface{} of
+// these types.
+func encode(b *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+
+	case bool:
+		if x {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+
+	case int:
+		encode(b, int64(x))
+
+	case int64:
+		if x >= 0 && x <= 0x7f {
+			b.WriteByte(byte(x))
+		} else {
+			b.WriteByte(0xd3)
+			writeUint(b, uint64(x), 8)
+		}
+
+	case string:
+		writeHeader(b, len(x), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		b.WriteString(x)
+
+	case []byte:
+		writeHeader(b, len(x), 0, -1, 0xc4, 0xc5, 0xc6)
+		b.Write(x)
+
+	case extension:
+		if len(x.data) == 8 {
+			b.WriteByte(0xd7)
+		} else {
+			b.WriteByte(0xc7)
+			writeUint(b, uint64(len(x.data)), 1)
+		}
+		b.WriteByte(byte(x.typ))
+		b.Write(x.data)
+
+	case []interface{}:
+		writeHeader(b, len(x), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, e := range x {
+			encode(b, e)
+		}
+
+	case map[string]interface{}:
+		writeHeader(b, len(x), 0x80, 15, 0, 0xde, 0xdf)
+		for k, e := range x {
+			encode(b, k)
+			encode(b, e)
+		}
+
+	default:
+		panic(fmt.Sprintf("cannot encode %T values with msgpack", v))
+	}
+}
+
+// writeHeader writes the type and size of a value of n elements. Sizes up to
+// max are encoded in the fix type, larger ones after the types of sizes
+// encoded on 1, 2 and 4 bytes, the types that don't exist being zero.
+func writeHeader(b *bytes.Buffer, n int, fix byte, max int, t8, t16, t32 byte) {
+	switch {
+	case n <= max:
+		b.WriteByte(fix | byte(n))
+	case n <= math.MaxUint8 && t8 != 0:
+		b.WriteByte(t8)
+		writeUint(b, uint64(n), 1)
+	case n <= math.MaxUint16:
+		b.WriteByte(t16)
+		writeUint(b, uint64(n), 2)
+	default:
+		b.WriteByte(t32)
+		writeUint(b, uint64(n), 4)
+	}
+}
+
+func writeUint(b *bytes.Buffer, u uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		b.WriteByte(byte(u >> uint(8*i)))
+	}
+}
@@ -0,0 +1,100 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsgpack(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		false,
+		int64(1),
+		int64(-1),
+		int64(300),
+		int64(-70000),
+		"",
+		"hello",
+		strings.Repeat("a", 300),
+		strings.Repeat("b", 70000),
+		[]byte("bytes"),
+		extension{typ: 0, data: []byte{0, 0, 0, 1, 0, 0, 0, 2}},
+		[]interface{}{"a", int64(1), []interface{}{}},
+		map[string]interface{}{"a": map[string]interface{}{"b": true}},
+	}
+
+	for _, v := range values {
+		var b bytes.Buffer
+
+		encode(&b, v)
+		found, err := decode(bufio.NewReader(&b))
+
+		if err != nil {
+			t.Errorf("%#v: %s", v, err)
+		} else if !reflect.DeepEqual(found, v) {
+			t.Errorf("%#v: invalid value decoded: %#v", v, found)
+		}
+	}
+}
+
+func TestMsgpackTypes(t *testing.T) {
+	tests := []struct {
+		input []byte
+		value interface{}
+	}{
+		{[]byte{0xcc, 0xff}, int64(255)},
+		{[]byte{0xd0, 0xff}, int64(-1)},
+		{[]byte{0xd1, 0xff, 0x00}, int64(-256)},
+		{[]byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(1<<64 - 1)},
+		{[]byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, float64(1.5)},
+		{[]byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, float64(1.5)},
+		{[]byte{0xd9, 0x02, 'o', 'k'}, "ok"},
+		{[]byte{0x81, 0x01, 0xa1, 'x'}, map[string]interface{}{"1": "x"}},
+	}
+
+	for _, test := range tests {
+		v, err := decode(bufio.NewReader(bytes.NewReader(test.input)))
+
+		if err != nil {
+			t.Errorf("%x: %s", test.input, err)
+		} else if !reflect.DeepEqual(v, test.value) {
+			t.Errorf("%x: invalid value decoded: %#v", test.input, v)
+		}
+	}
+
+	for _, input := range [][]byte{{0xc1}, {0xdb, 0xff, 0xff, 0xff, 0xff}, {0x92, 0x01}} {
+		if _, err := decode(bufio.NewReader(bytes.NewReader(input))); err == nil {
+			t.Errorf("%x: decoding invalid input must fail", input)
+		}
+	}
+}
+
+func TestMsgpackLimits(t *testing.T) {
+	// The sizes announced by truncated inputs fail to decode without being
+	// allocated.
+	for _, input := range [][]byte{
+		{0xdd, 0x00, 0x0f, 0xff, 0xff, 0x01},
+		{0xdf, 0x00, 0x0f, 0xff, 0xff, 0x01, 0x01},
+		{0xc6, 0x03, 0xff, 0xff, 0xff, 0x01},
+	} {
+		if _, err := decode(bufio.NewReader(bytes.NewReader(input))); err == nil {
+			t.Errorf("%x: decoding truncated input must fail", input)
+		}
+	}
+
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, depth), 0x01)
+	}
+
+	if _, err := decode(bufio.NewReader(bytes.NewReader(nested(maxDepth)))); err != nil {
+		t.Errorf("decoding values nested %d times failed: %s", maxDepth, err)
+	}
+
+	if _, err := decode(bufio.NewReader(bytes.NewReader(nested(maxDepth + 1)))); err == nil {
+		t.Errorf("decoding values nested more than %d times must fail", maxDepth)
+	}
+}
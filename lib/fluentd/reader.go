@@ -0,0 +1,507 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// DefaultAddress is the address on which the fluentd source accepts
+// connections when FLUENTD_LISTEN isn't set, the default port of the forward
+// protocol on the loopback interface so only local clients can reach it.
+const DefaultAddress = "127.0.0.1:24224"
+
+// How long writing an acknowledgement to a client may take.
+const ackTimeout = 10 * time.Second
+
+// Config is the configuration of the fluentd source.
+type Config struct {
+	// Key shared with the clients, they have to authenticate with it when
+	// it's set.
+	SharedKey string
+
+	// Name of the server sent to the clients when they authenticate.
+	Hostname string
+}
+
+// NewReader returns a reader of the events sent with the fluentd forward
+// protocol to the address set by FLUENTD_LISTEN. Clients must authenticate
+// with the key set by FLUENTD_SHARED_KEY when it's set, which is required
+// unless the address is a loopback address.
+func NewReader() (r lib.Reader, err error) {
+	var l net.Listener
+	var address string
+
+	if address = os.Getenv("FLUENTD_LISTEN"); len(address) == 0 {
+		address = DefaultAddress
+	}
+
+	config := Config{
+		SharedKey: os.Getenv("FLUENTD_SHARED_KEY"),
+		Hostname:  os.Getenv("FLUENTD_HOSTNAME"),
+	}
+
+	if len(config.SharedKey) == 0 && !lib.IsLoopbackAddress(address) {
+		err = fmt.Errorf("FLUENTD_SHARED_KEY must be set to listen on a non-loopback address: %s", address)
+		return
+	}
+
+	if len(config.Hostname) == 0 {
+		config.Hostname, _ = os.Hostname()
+	}
+
+	if l, err = net.Listen("tcp", address); err != nil {
+		return
+	}
+
+	r = NewReaderWith(l, config)
+	return
+}
+
+// NewReaderWith returns a reader of the events sent with the fluentd forward
+// protocol to the connections accepted by l.
+func NewReaderWith(l net.Listener, config Config) lib.Reader {
+	r := &reader{
+		config:   config,
+		listener: l,
+		results:  make(chan result),
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go r.accept()
+	return r
+}
+
+type result struct {
+	msg lib.Message
+	err error
+}
+
+type reader struct {
+	config   Config
+	listener net.Listener
+	results  chan result
+	done     chan struct{}
+	once     sync.Once
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+
+	// Chunks waiting for their events to be delivered before they are
+	// acknowledged, in the order they were read. The last message of each
+	// chunk has its sequence number as cursor.
+	seq    uint64
+	chunks []chunk
+
+	// Serializes the acknowledgements written to the clients.
+	wmutex sync.Mutex
+}
+
+// chunk is a chunk of events sent by a client which asked for an
+// acknowledgement.
+type chunk struct {
+	seq  uint64
+	conn net.Conn
+	id   string
+}
+
+func (r *reader) Close() (err error) {
+	r.once.Do(func() {
+		close(r.done)
+		err = r.listener.Close()
+
+		r.mutex.Lock()
+		for conn := range r.conns {
+			conn.Close()
+		}
+		r.mutex.Unlock()
+	})
+	return
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	select {
+	case res := <-r.results:
+		return res.msg, res.err
+	case <-r.done:
+		return msg, io.EOF
+	}
+}
+
+// Ack sends the acknowledgements of the chunks read up to the one with the
+// given cursor, all their events were delivered.
+func (r *reader) Ack(cursor string) {
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	n := 0
+	for n < len(r.chunks) && r.chunks[n].seq <= seq {
+		n++
+	}
+	acked := append([]chunk(nil), r.chunks[:n]...)
+	r.chunks = append(r.chunks[:0], r.chunks[n:]...)
+	r.mutex.Unlock()
+
+	for _, c := range acked {
+		r.ack(c.conn, c.id)
+	}
+}
+
+// ack writes the acknowledgement of a chunk to the client that sent it,
+// errors are ignored since the client sends the chunk again if it doesn't get
+// the acknowledgement.
+func (r *reader) ack(conn net.Conn, id string) {
+	var b bytes.Buffer
+	encode(&b, map[string]interface{}{"ack": id})
+
+	r.wmutex.Lock()
+	defer r.wmutex.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(ackTimeout))
+	conn.Write(b.Bytes())
+}
+
+func (r *reader) accept() {
+	err := lib.Accept(r.listener, r.done, func(conn net.Conn) {
+		r.mutex.Lock()
+		r.conns[conn] = struct{}{}
+		r.mutex.Unlock()
+
+		go r.read(conn)
+	})
+
+	if err != nil {
+		select {
+		case <-r.done:
+		case r.results <- result{err: err}:
+		}
+		// The source is abandoned once it reported the error, the listeners
+		// and the open connections must be closed with it.
+		r.Close()
+	}
+}
+
+func (r *reader) read(conn net.Conn) {
+	defer func() {
+		r.mutex.Lock()
+		delete(r.conns, conn)
+
+		// The client sends the chunks that weren't acknowledged again on a
+		// new connection.
+		chunks := r.chunks[:0]
+		for _, c := range r.chunks {
+			if c.conn != conn {
+				chunks = append(chunks, c)
+			}
+		}
+		r.chunks = chunks
+		r.mutex.Unlock()
+		conn.Close()
+	}()
+
+	in := bufio.NewReader(conn)
+	peer := conn.RemoteAddr().String()
+	host, _, _ := net.SplitHostPort(peer)
+
+	if len(r.config.SharedKey) != 0 {
+		if err := handshake(conn, in, r.config); err != nil {
+			log.WithFields(log.Fields{
+				"client": peer,
+				"error":  err,
+			}).Warn("fluentd client failed to authenticate")
+			return
+		}
+	}
+
+	for {
+		v, err := decode(in)
+
+		if err != nil {
+			// The stream can't be decoded past invalid msgpack values.
+			select {
+			case <-r.done:
+			default:
+				if err != io.EOF {
+					log.WithFields(log.Fields{
+						"client": peer,
+						"error":  err,
+					}).Warn("closing fluentd connection")
+				}
+			}
+			return
+		}
+
+		msgs, id, err := decodeEntries(v, host)
+
+		if err != nil {
+			err = &lib.ParseError{Input: truncate(fmt.Sprint(v)), Err: err}
+
+			select {
+			case r.results <- result{err: err}:
+			case <-r.done:
+				return
+			}
+			continue
+		}
+
+		// Clients that asked for an acknowledgement resend the chunk if
+		// they don't get it, it's sent once all the events of the chunk were
+		// delivered.
+		if len(id) != 0 {
+			if len(msgs) == 0 {
+				r.ack(conn, id)
+				continue
+			}
+
+			r.mutex.Lock()
+			r.seq++
+			r.chunks = append(r.chunks, chunk{seq: r.seq, conn: conn, id: id})
+			msgs[len(msgs)-1].Cursor = strconv.FormatUint(r.seq, 10)
+			r.mutex.Unlock()
+		}
+
+		for _, msg := range msgs {
+			select {
+			case r.results <- result{msg: msg}:
+			case <-r.done:
+				return
+			}
+		}
+	}
+}
+
+// decodeEntries returns the messages of the events of a message of the
+// forward protocol, in any of its modes, and the chunk to acknowledge. The
+// events are forwarded to the group named after their tag, in the stream of
+// the docker container that emitted them or of the host that sent them.
+func decodeEntries(v interface{}, host string) (msgs []lib.Message, chunk string, err error) {
+	var option map[string]interface{}
+
+	a, _ := v.([]interface{})
+
+	if len(a) < 2 {
+		err = fmt.Errorf("invalid forward protocol message")
+		return
+	}
+
+	tag, ok := toString(a[0])
+
+	if !ok || len(tag) == 0 {
+		err = fmt.Errorf("invalid forward protocol tag")
+		return
+	}
+
+	switch x := a[1].(type) {
+	case []interface{}:
+		// Forward mode: [tag, [[time, record], ...], option]
+		for _, e := range x {
+			var msg lib.Message
+
+			if msg, err = decodeEntry(tag, e, host); err != nil {
+				return
+			}
+
+			msgs = append(msgs, msg)
+		}
+		option = optionAt(a, 2)
+
+	case string, []byte:
+		// PackedForward mode: [tag, msgpack stream of [time, record], option]
+		var data []byte
+		var e interface{}
+
+		option = optionAt(a, 2)
+		data, _ = x.([]byte)
+
+		if s, ok := x.(string); ok {
+			data = []byte(s)
+		}
+
+		if c, _ := option["compressed"].(string); c == "gzip" {
+			if data, err = gunzip(data); err != nil {
+				return
+			}
+		}
+
+		for in := bufio.NewReader(bytes.NewReader(data)); ; {
+			if e, err = decode(in); err != nil {
+				if err == io.EOF {
+					err = nil
+					break
+				}
+				return
+			}
+
+			var msg lib.Message
+
+			if msg, err = decodeEntry(tag, e, host); err != nil {
+				return
+			}
+
+			msgs = append(msgs, msg)
+		}
+
+	default:
+		// Message mode: [tag, time, record, option]
+		var msg lib.Message
+
+		if msg, err = decodeEntry(tag, a[1:], host); err != nil {
+			return
+		}
+
+		msgs = append(msgs, msg)
+		option = optionAt(a, 3)
+	}
+
+	chunk, _ = toString(option["chunk"])
+	return
+}
+
+// decodeEntry returns the message of an event given as [time, record].
+func decodeEntry(tag string, v interface{}, host string) (msg lib.Message, err error) {
+	a, _ := v.([]interface{})
+
+	if len(a) < 2 {
+		err = fmt.Errorf("invalid forward protocol entry")
+		return
+	}
+
+	record, ok := a[1].(map[string]interface{})
+
+	if !ok {
+		err = fmt.Errorf("invalid forward protocol record")
+		return
+	}
+
+	msg.Group = tag
+	msg.Event = ecslogs.MakeEvent(ecslogs.INFO, "")
+	msg.Event.Data = ecslogs.EventData{}
+
+	if t, ok := eventTime(a[0]); ok {
+		msg.Event.Time = t
+	}
+
+	for _, key := range []string{"log", "message", "msg"} {
+		if s, ok := toString(record[key]); ok {
+			msg.Event.Message = strings.TrimRight(s, "\r\n")
+			delete(record, key)
+			break
+		}
+	}
+
+	// Records sent by the fluentd logging driver of docker have the name of
+	// the output the line was written to.
+	if s, _ := toString(record["source"]); s == "stderr" {
+		msg.Event.Level = ecslogs.ERROR
+	}
+
+	if s, ok := toString(record["level"]); ok {
+		if lvl, err := ecslogs.ParseLevel(s); err == nil && lvl != ecslogs.NONE {
+			msg.Event.Level = lvl
+			delete(record, "level")
+		}
+	}
+
+	if msg.Stream, _ = toString(record["container_id"]); len(msg.Stream) == 0 {
+		msg.Stream = host
+	}
+
+	for k, v := range record {
+		msg.Event.Data[k] = value(v)
+	}
+
+	return
+}
+
+// eventTime converts the time of an event, sent either as a number of seconds
+// or as an EventTime extension with a nanosecond precision.
+func eventTime(v interface{}) (t time.Time, ok bool) {
+	switch x := v.(type) {
+	case int64:
+		return time.Unix(x, 0), true
+	case uint64:
+		return time.Unix(int64(x), 0), true
+	case float64:
+		return time.Unix(0, int64(x*float64(time.Second))), true
+	case extension:
+		if x.typ == 0 && len(x.data) == 8 {
+			sec := uint32(x.data[0])<<24 | uint32(x.data[1])<<16 | uint32(x.data[2])<<8 | uint32(x.data[3])
+			nsec := uint32(x.data[4])<<24 | uint32(x.data[5])<<16 | uint32(x.data[6])<<8 | uint32(x.data[7])
+			return time.Unix(int64(sec), int64(nsec)), true
+		}
+	}
+	return
+}
+
+// value converts a decoded record value to a value that can be encoded to
+// JSON, binaries are strings in the records sent by most clients.
+func value(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case extension:
+		return nil
+	case []interface{}:
+		for i, e := range x {
+			x[i] = value(e)
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = value(e)
+		}
+	}
+	return v
+}
+
+func toString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case []byte:
+		return string(x), true
+	}
+	return "", false
+}
+
+func optionAt(a []interface{}, i int) map[string]interface{} {
+	if i < len(a) {
+		option, _ := a[i].(map[string]interface{})
+		return option
+	}
+	return nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	z, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ioutil.ReadAll(io.LimitReader(z, maxStringSize))
+}
+
+// truncate shortens the input reported in parse errors.
+func truncate(s string) string {
+	const max = 1024
+
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
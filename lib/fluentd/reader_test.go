@@ -0,0 +1,225 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func listen(t *testing.T, config Config) (lib.Reader, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewReaderWith(l, config), l.Addr().String()
+}
+
+func send(t *testing.T, conn net.Conn, v interface{}) {
+	var b bytes.Buffer
+	encode(&b, v)
+
+	if _, err := conn.Write(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func eventTimeExt(t time.Time) extension {
+	var b bytes.Buffer
+	writeUint(&b, uint64(t.Unix()), 4)
+	writeUint(&b, uint64(t.Nanosecond()), 4)
+	return extension{typ: 0, data: b.Bytes()}
+}
+
+func TestReaderModes(t *testing.T) {
+	r, address := listen(t, Config{})
+	defer r.Close()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	record := func(log string) map[string]interface{} {
+		return map[string]interface{}{
+			"log":          log,
+			"source":       "stdout",
+			"container_id": "0123abcd",
+		}
+	}
+
+	var packed bytes.Buffer
+	encode(&packed, []interface{}{eventTimeExt(now), record("packed 1")})
+	encode(&packed, []interface{}{eventTimeExt(now), record("packed 2")})
+
+	var compressed bytes.Buffer
+	z := gzip.NewWriter(&compressed)
+	z.Write(packed.Bytes())
+	z.Close()
+
+	// Message mode, with a level and an error written to stderr.
+	send(t, conn, []interface{}{"api", int(now.Unix()), map[string]interface{}{"message": "hello", "level": "warn"}})
+	send(t, conn, []interface{}{"api", eventTimeExt(now), map[string]interface{}{"log": "oops\n", "source": "stderr"}})
+
+	// Forward mode.
+	send(t, conn, []interface{}{"api", []interface{}{
+		[]interface{}{eventTimeExt(now), record("forward 1")},
+		[]interface{}{eventTimeExt(now), record("forward 2")},
+	}})
+
+	// PackedForward and CompressedPackedForward modes.
+	send(t, conn, []interface{}{"api", packed.Bytes()})
+	send(t, conn, []interface{}{"api", compressed.Bytes(), map[string]interface{}{"compressed": "gzip"}})
+
+	tests := []struct {
+		stream  string
+		level   ecslogs.Level
+		message string
+		time    time.Time
+	}{
+		{"127.0.0.1", ecslogs.WARN, "hello", now.Truncate(time.Second)},
+		{"127.0.0.1", ecslogs.ERROR, "oops", now},
+		{"0123abcd", ecslogs.INFO, "forward 1", now},
+		{"0123abcd", ecslogs.INFO, "forward 2", now},
+		{"0123abcd", ecslogs.INFO, "packed 1", now},
+		{"0123abcd", ecslogs.INFO, "packed 2", now},
+		{"0123abcd", ecslogs.INFO, "packed 1", now},
+		{"0123abcd", ecslogs.INFO, "packed 2", now},
+	}
+
+	for _, test := range tests {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Group != "api" || msg.Stream != test.stream {
+			t.Errorf("invalid group and stream: %s/%s", msg.Group, msg.Stream)
+		}
+
+		if msg.Event.Level != test.level || msg.Event.Message != test.message || !msg.Event.Time.Equal(test.time) {
+			t.Errorf("invalid event: %s %s %s", msg.Event.Time, msg.Event.Level, msg.Event.Message)
+		}
+
+		if _, ok := msg.Event.Data["level"]; ok {
+			t.Error("the level must be removed from the event data")
+		}
+	}
+}
+
+func TestReaderAck(t *testing.T) {
+	r, address := listen(t, Config{})
+	defer r.Close()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	send(t, conn, []interface{}{"api", 1496318400, map[string]interface{}{"log": "hello"}, map[string]interface{}{"chunk": "abc=="}})
+
+	msg, err := r.ReadMessage()
+	if err != nil || msg.Event.Message != "hello" {
+		t.Fatalf("invalid message: %v (%v)", msg, err)
+	}
+
+	// The chunk is acknowledged once its events were delivered.
+	in := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	if _, err := decode(in); err == nil {
+		t.Fatal("the chunk must not be acknowledged before its events were delivered")
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	r.(lib.AckReader).Ack(msg.Cursor)
+
+	v, err := decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack, _ := v.(map[string]interface{}); ack["ack"] != "abc==" {
+		t.Errorf("invalid ack: %v", v)
+	}
+
+	send(t, conn, []interface{}{"api", 1496318400, "oops"})
+
+	if _, err := r.ReadMessage(); err == nil {
+		t.Error("reading an invalid message must fail")
+	} else if _, ok := err.(*lib.ParseError); !ok {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestReaderSharedKey(t *testing.T) {
+	r, address := listen(t, Config{SharedKey: "secret", Hostname: "server"})
+	defer r.Close()
+
+	for _, key := range []string{"wrong", "secret"} {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		in := bufio.NewReader(conn)
+		v, err := decode(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		helo, _ := v.([]interface{})
+		if len(helo) != 2 || helo[0] != "HELO" {
+			t.Fatalf("invalid HELO message: %v", v)
+		}
+		nonce, _ := helo[1].(map[string]interface{})["nonce"].([]byte)
+
+		send(t, conn, []interface{}{"PING", "client", "salt", sharedKeyDigest("salt", "client", nonce, key), "", ""})
+
+		if v, err = decode(in); err != nil {
+			t.Fatal(err)
+		}
+
+		pong, _ := v.([]interface{})
+		if len(pong) != 5 || pong[0] != "PONG" {
+			t.Fatalf("invalid PONG message: %v", v)
+		}
+
+		if key != "secret" {
+			if pong[1] != false {
+				t.Error("clients with the wrong key must be rejected")
+			}
+			continue
+		}
+
+		if pong[1] != true || pong[4] != sharedKeyDigest("salt", "server", nonce, "secret") {
+			t.Errorf("invalid PONG message: %v", pong)
+		}
+
+		send(t, conn, []interface{}{"api", 1496318400, map[string]interface{}{"log": "hello"}})
+
+		if msg, err := r.ReadMessage(); err != nil || msg.Event.Message != "hello" {
+			t.Errorf("invalid message: %v (%v)", msg, err)
+		}
+	}
+}
+
+func TestNewReaderNonLoopback(t *testing.T) {
+	defer os.Unsetenv("FLUENTD_LISTEN")
+	os.Setenv("FLUENTD_LISTEN", "0.0.0.0:0")
+
+	if r, err := NewReader(); err == nil {
+		r.Close()
+		t.Error("listening on a non-loopback address without a shared key should fail")
+	}
+}
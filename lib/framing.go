@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Framing describes the bytes written around the records and batches of raw
+// stream outputs, so ecs-logs can feed collectors with rigid framing
+// expectations.
+type Framing struct {
+	// Bytes written before each record and instead of its trailing newline
+	// (kept when empty). In the prefix, {length} is replaced with the length
+	// of the record in decimal and {length32} with its length as a 4 bytes
+	// big-endian integer.
+	RecordPrefix string
+	RecordSuffix string
+
+	// Bytes written before and after each batch, where {count} is replaced
+	// with the number of records in the batch.
+	BatchHeader string
+	BatchFooter string
+}
+
+// FramingFromEnvironment returns the framing set by the RECORD_PREFIX,
+// RECORD_SUFFIX, BATCH_HEADER and BATCH_FOOTER environment variables with the
+// given prefix, their values may contain Go escape sequences.
+func FramingFromEnvironment(prefix string) (f Framing, err error) {
+	for _, v := range []struct {
+		name  string
+		value *string
+	}{
+		{prefix + "RECORD_PREFIX", &f.RecordPrefix},
+		{prefix + "RECORD_SUFFIX", &f.RecordSuffix},
+		{prefix + "BATCH_HEADER", &f.BatchHeader},
+		{prefix + "BATCH_FOOTER", &f.BatchFooter},
+	} {
+		if s := os.Getenv(v.name); len(s) != 0 {
+			if *v.value, err = Unescape(s); err != nil {
+				err = fmt.Errorf("invalid %s value: %s", v.name, s)
+				return
+			}
+		}
+	}
+	return
+}
+
+// Unescape interprets the Go escape sequences of s, like \n or \x00, so
+// framing bytes can be set in the environment.
+func Unescape(s string) (string, error) {
+	return strconv.Unquote(`"` + strings.Replace(s, `"`, `\"`, -1) + `"`)
+}
+
+// Wrapped returns whether records are written between a prefix or a suffix.
+func (f Framing) Wrapped() bool {
+	return len(f.RecordPrefix) != 0 || len(f.RecordSuffix) != 0
+}
+
+// AppendRecord appends the record, which ends with a newline, to b between
+// the record prefix and suffix.
+func (f Framing) AppendRecord(b []byte, record []byte) []byte {
+	if n := len(record); n != 0 && record[n-1] == '\n' && len(f.RecordSuffix) != 0 {
+		record = record[:n-1]
+	}
+
+	prefix := f.RecordPrefix
+
+	for len(prefix) != 0 {
+		i := strings.IndexByte(prefix, '{')
+		if i < 0 {
+			b = append(b, prefix...)
+			break
+		}
+
+		b, prefix = append(b, prefix[:i]...), prefix[i:]
+
+		switch {
+		case strings.HasPrefix(prefix, "{length}"):
+			b, prefix = strconv.AppendInt(b, int64(len(record)), 10), prefix[8:]
+		case strings.HasPrefix(prefix, "{length32}"):
+			var n [4]byte
+			binary.BigEndian.PutUint32(n[:], uint32(len(record)))
+			b, prefix = append(b, n[:]...), prefix[10:]
+		default:
+			b, prefix = append(b, '{'), prefix[1:]
+		}
+	}
+
+	b = append(b, record...)
+	return append(b, f.RecordSuffix...)
+}
+
+// Header returns the header of a batch of count records.
+func (f Framing) Header(count int) []byte {
+	return batchFrame(f.BatchHeader, count)
+}
+
+// Footer returns the footer of a batch of count records.
+func (f Framing) Footer(count int) []byte {
+	return batchFrame(f.BatchFooter, count)
+}
+
+func batchFrame(frame string, count int) []byte {
+	if len(frame) == 0 {
+		return nil
+	}
+	return []byte(strings.Replace(frame, "{count}", strconv.Itoa(count), -1))
+}
+
+// EncodeBatch returns the batch encoded as one JSON message per record, framed
+// by f.
+func (f Framing) EncodeBatch(batch MessageBatch) ([]byte, error) {
+	var buf bytes.Buffer
+	var b = f.Header(len(batch))
+
+	enc := NewMessageEncoder(&buf)
+
+	for _, msg := range batch {
+		buf.Reset()
+
+		if err := enc.WriteMessage(msg); err != nil {
+			return nil, err
+		}
+
+		b = f.AppendRecord(b, buf.Bytes())
+	}
+
+	return append(b, f.Footer(len(batch))...), nil
+}
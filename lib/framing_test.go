@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestFramingAppendRecord(t *testing.T) {
+	tests := []struct {
+		framing Framing
+		record  string
+		out     string
+	}{
+		{Framing{}, "hello\n", "hello\n"},
+		{Framing{RecordPrefix: "<"}, "hello\n", "<hello\n"},
+		{Framing{RecordPrefix: "<", RecordSuffix: ">"}, "hello\n", "<hello>"},
+		{Framing{RecordPrefix: "{length} "}, "hello\n", "6 hello\n"},
+		{Framing{RecordPrefix: "{length} ", RecordSuffix: "\x00"}, "hello\n", "5 hello\x00"},
+		{Framing{RecordPrefix: "{length32}", RecordSuffix: "\n"}, "hello\n", "\x00\x00\x00\x05hello\n"},
+		{Framing{RecordPrefix: "{len} {"}, "hello\n", "{len} {hello\n"},
+	}
+
+	for _, test := range tests {
+		if s := string(test.framing.AppendRecord(nil, []byte(test.record))); s != test.out {
+			t.Errorf("%+v: invalid framed record: %q", test.framing, s)
+		}
+	}
+}
+
+func TestFramingEncodeBatch(t *testing.T) {
+	f := Framing{
+		RecordSuffix: "\x1e",
+		BatchHeader:  "BEGIN {count}\n",
+		BatchFooter:  "END\n",
+	}
+
+	b, err := f.EncodeBatch(MessageBatch{
+		{Group: "a", Event: ecslogs.Event{Message: "1"}},
+		{Group: "b", Event: ecslogs.Event{Message: "2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []string{
+		Message{Group: "a", Event: ecslogs.Event{Message: "1"}}.String(),
+		Message{Group: "b", Event: ecslogs.Event{Message: "2"}}.String(),
+	}
+
+	if s := string(b); s != "BEGIN 2\n"+records[0]+"\x1e"+records[1]+"\x1eEND\n" {
+		t.Errorf("invalid framed batch: %q", s)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	if s, err := Unescape(`\x1e"\n`); err != nil || s != "\x1e\"\n" {
+		t.Errorf("invalid unescaped value: %q (%v)", s, err)
+	}
+
+	if _, err := Unescape(`\q`); err == nil {
+		t.Error("unescaping an invalid sequence should fail")
+	}
+}
@@ -29,6 +29,10 @@ func (group *Group) Name() string {
 	return group.name
 }
 
+func (group *Group) Get(name string) *Stream {
+	return group.streams[name]
+}
+
 func (group *Group) Add(msg Message, now time.Time) (stream *Stream) {
 	if stream = group.streams[msg.Stream]; stream == nil {
 		stream = NewStream(group.Name(), msg.Stream, now)
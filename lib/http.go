@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// HTTPErrorBodySize is the maximum number of bytes of a response body kept in
+// an HTTPError.
+const HTTPErrorBodySize = 512
+
+// requestIDHeaders are the headers commonly used by providers to identify a
+// request in their own logs.
+var requestIDHeaders = []string{
+	"X-Request-Id",
+	"X-Amzn-Requestid",
+	"X-Amz-Request-Id",
+	"X-Datadog-Request-Id",
+	"Cf-Ray",
+}
+
+// HTTPError is returned by writers when a destination answers with a non-2xx
+// status, it carries the start of the response body and the request ID to
+// help figure out why the provider rejected a batch.
+type HTTPError struct {
+	Op         string
+	Status     string
+	StatusCode int
+	RequestID  string
+	Body       string
+}
+
+// NewHTTPError builds an HTTPError from res, reading at most HTTPErrorBodySize
+// bytes of the response body.
+func NewHTTPError(op string, res *http.Response) *HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, HTTPErrorBodySize))
+	err := &HTTPError{
+		Op:         op,
+		Status:     res.Status,
+		StatusCode: res.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+
+	for _, h := range requestIDHeaders {
+		if err.RequestID = res.Header.Get(h); len(err.RequestID) != 0 {
+			break
+		}
+	}
+
+	return err
+}
+
+func (err *HTTPError) Error() string {
+	s := fmt.Sprintf("%s failed: %s", err.Op, err.Status)
+
+	if len(err.RequestID) != 0 {
+		s += " (request id: " + err.RequestID + ")"
+	}
+
+	if len(err.Body) != 0 {
+		s += ": " + err.Body
+	}
+
+	return s
+}
+
+// requestFailure is implemented by the errors of SDKs that describe a failed
+// request, like awserr.RequestFailure, without depending on them.
+type requestFailure interface {
+	error
+	Code() string
+	Message() string
+	StatusCode() int
+	RequestID() string
+}
+
+// HTTPErrorFrom returns an HTTPError describing err if it carries the status
+// and ID of the request that failed, or err itself otherwise.
+func HTTPErrorFrom(op string, err error) error {
+	e, ok := err.(requestFailure)
+	if !ok {
+		return err
+	}
+
+	body := e.Code()
+
+	if msg := e.Message(); len(msg) != 0 {
+		body += ": " + msg
+	}
+
+	if len(body) > HTTPErrorBodySize {
+		body = body[:HTTPErrorBodySize]
+	}
+
+	return &HTTPError{
+		Op:         op,
+		Status:     fmt.Sprintf("%d %s", e.StatusCode(), http.StatusText(e.StatusCode())),
+		StatusCode: e.StatusCode(),
+		RequestID:  e.RequestID(),
+		Body:       body,
+	}
+}
+
+// HTTPErrorOf returns the HTTPError wrapped in err, or nil if there is none.
+func HTTPErrorOf(err error) *HTTPError {
+	switch e := err.(type) {
+	case *HTTPError:
+		return e
+	case *WriterError:
+		return HTTPErrorOf(e.Err)
+	case ErrorList:
+		for _, x := range e {
+			if h := HTTPErrorOf(x); h != nil {
+				return h
+			}
+		}
+	}
+	return nil
+}
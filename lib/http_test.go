@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewHTTPError(t *testing.T) {
+	res := &http.Response{
+		Status:     "400 Bad Request",
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"X-Amzn-Requestid": {"1234"}},
+		Body:       ioutil.NopCloser(strings.NewReader("invalid timestamp\n" + strings.Repeat("x", 1000))),
+	}
+
+	err := NewHTTPError("upload", res)
+
+	if err.RequestID != "1234" {
+		t.Errorf("invalid request id: %q", err.RequestID)
+	}
+
+	if len(err.Body) != HTTPErrorBodySize {
+		t.Errorf("the response body wasn't truncated: %d bytes", len(err.Body))
+	}
+
+	if s := err.Error(); !strings.HasPrefix(s, "upload failed: 400 Bad Request (request id: 1234): invalid timestamp") {
+		t.Errorf("invalid error message: %s", s)
+	}
+}
+
+type testRequestFailure struct{}
+
+func (testRequestFailure) Error() string     { return "ThrottlingException: Rate exceeded" }
+func (testRequestFailure) Code() string      { return "ThrottlingException" }
+func (testRequestFailure) Message() string   { return "Rate exceeded" }
+func (testRequestFailure) StatusCode() int   { return http.StatusBadRequest }
+func (testRequestFailure) RequestID() string { return "1234" }
+
+func TestHTTPErrorFrom(t *testing.T) {
+	err := HTTPErrorFrom("put", testRequestFailure{})
+
+	if s := err.Error(); s != "put failed: 400 Bad Request (request id: 1234): ThrottlingException: Rate exceeded" {
+		t.Errorf("invalid error message: %s", s)
+	}
+
+	if h := HTTPErrorOf(err); h == nil || h.StatusCode != http.StatusBadRequest || h.RequestID != "1234" {
+		t.Errorf("invalid HTTP error: %#v", h)
+	}
+
+	other := errors.New("oops")
+
+	if err := HTTPErrorFrom("put", other); err != other {
+		t.Errorf("errors without request must be returned as is: %v", err)
+	}
+}
+
+func TestHTTPErrorOf(t *testing.T) {
+	h := &HTTPError{Op: "upload", Status: "500 Internal Server Error", StatusCode: 500}
+
+	tests := []struct {
+		err error
+		res *HTTPError
+	}{
+		{errors.New("oops"), nil},
+		{h, h},
+		{NewWriterError(UnreachableError, h), h},
+		{ErrorList{errors.New("oops"), NewWriterError(UnreachableError, h)}, h},
+	}
+
+	for _, test := range tests {
+		if res := HTTPErrorOf(test.err); res != test.res {
+			t.Errorf("%v: invalid HTTP error: %v", test.err, res)
+		}
+	}
+}
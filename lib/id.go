@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Kinds of event IDs supported by NewIDGenerator, all of them start with a
+// timestamp and are monotonic, so they sort in the order they were generated
+// by a generator even within the same millisecond.
+const (
+	IDUUIDv7    = "uuidv7"
+	IDULID      = "ulid"
+	IDSnowflake = "snowflake"
+)
+
+// SnowflakeEpoch is the origin of the timestamps of snowflake IDs.
+var SnowflakeEpoch = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// An IDGenerator returns unique IDs for events.
+type IDGenerator interface {
+	NewID(now time.Time) string
+}
+
+// MaxSnowflakeNode is the highest node of snowflake IDs.
+const MaxSnowflakeNode = snowflakeNodeMask
+
+// NewIDGenerator returns a generator of the given kind of IDs, node identifies
+// the host in snowflake IDs and must be unique in the deployment.
+func NewIDGenerator(kind string, node int) (IDGenerator, error) {
+	if kind == IDSnowflake && (node < 0 || node > MaxSnowflakeNode) {
+		return nil, fmt.Errorf("invalid snowflake node: %d", node)
+	}
+
+	switch kind {
+	case IDUUIDv7:
+		return &uuidv7{}, nil
+	case IDULID:
+		return &ulid{}, nil
+	case IDSnowflake:
+		return &snowflake{node: int64(node)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported event ID kind: %s", kind)
+	}
+}
+
+// uuidv7 generates RFC 9562 version 7 UUIDs: a 48 bits millisecond timestamp
+// followed by 74 random bits, split by the version and variant.
+type uuidv7 struct {
+	monotonic
+}
+
+func (g *uuidv7) NewID(now time.Time) string {
+	var u [16]byte
+	var s [36]byte
+
+	ms, r := g.next(now, 74)
+	putMillis(u[:6], ms)
+
+	// The 74 bits are the 12 bits of rand_a followed by the 62 bits of rand_b.
+	hi := uint64(r[0])<<8 | uint64(r[1])
+	lo := binary.BigEndian.Uint64(r[2:])
+	a := hi<<2 | lo>>62
+
+	u[6] = 0x70 | byte(a>>8)&0x0f
+	u[7] = byte(a)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:])
+}
+
+// ulid generates ULIDs: a 48 bits millisecond timestamp followed by 80 random
+// bits, encoded in Crockford's base32.
+type ulid struct {
+	monotonic
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulid) NewID(now time.Time) string {
+	var u [16]byte
+	var s [26]byte
+
+	ms, r := g.next(now, 80)
+	putMillis(u[:6], ms)
+	copy(u[6:], r[:])
+
+	// The 128 bits are encoded 5 bits at a time, the first character only
+	// holds 3 bits.
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+
+	return string(s[:])
+}
+
+// Layout of snowflake IDs: 41 bits of milliseconds since SnowflakeEpoch, 10
+// bits of node and 12 bits of sequence within the millisecond.
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeNodeMask = 1<<snowflakeNodeBits - 1
+	snowflakeSeqMask  = 1<<snowflakeSeqBits - 1
+)
+
+type snowflake struct {
+	mutex sync.Mutex
+	node  int64
+	last  int64
+	seq   int64
+}
+
+func (g *snowflake) NewID(now time.Time) string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	ms := int64(now.Sub(SnowflakeEpoch) / time.Millisecond)
+
+	// The clock going backwards or the sequence overflowing would generate
+	// duplicates, the timestamp of the last ID is reused or advanced instead.
+	if ms <= g.last {
+		ms = g.last
+		if g.seq = (g.seq + 1) & snowflakeSeqMask; g.seq == 0 {
+			ms++
+		}
+	} else {
+		g.seq = 0
+	}
+
+	g.last = ms
+	return fmt.Sprint(ms<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq)
+}
+
+// monotonic holds the timestamp and random bits of the last ID generated, IDs
+// generated during the same millisecond increment the random bits of the
+// previous one instead of drawing new ones so they still sort in order.
+type monotonic struct {
+	mutex sync.Mutex
+	last  uint64
+	rand  [10]byte
+}
+
+// next returns the millisecond timestamp and the random bits of the next ID,
+// bits is the number of random bits, at most 80, held at the end of the array.
+func (g *monotonic) next(now time.Time, bits uint) (ms uint64, r [10]byte) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	mask := byte(0xff)
+	if bits < 80 {
+		mask = byte(1<<(bits-72) - 1)
+	}
+
+	ms = uint64(now.UnixNano() / int64(time.Millisecond))
+
+	// Like snowflake IDs, the clock going backwards or the random bits
+	// overflowing reuse or advance the timestamp of the last ID.
+	if ms <= g.last {
+		ms = g.last
+
+		if !increment(g.rand[:], mask) {
+			ms++
+		}
+	} else {
+		rand.Read(g.rand[:])
+		g.rand[0] &= mask
+	}
+
+	g.last = ms
+	return ms, g.rand
+}
+
+// increment adds one to the big-endian number b, where only the bits of mask
+// are used in the first byte, returning false if it overflowed.
+func increment(b []byte, mask byte) bool {
+	for i := len(b) - 1; i > 0; i-- {
+		if b[i]++; b[i] != 0 {
+			return true
+		}
+	}
+
+	if b[0] = (b[0] + 1) & mask; b[0] != 0 {
+		return true
+	}
+
+	return false
+}
+
+func putMillis(b []byte, ms uint64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIDGenerator(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+	}{
+		{IDUUIDv7, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{IDULID, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{IDSnowflake, `^[0-9]+$`},
+	}
+
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range tests {
+		g, err := NewIDGenerator(test.kind, 42)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		ids := make([]string, 0, 100)
+		seen := make(map[string]bool)
+
+		for i := 0; i != cap(ids); i++ {
+			id := g.NewID(now.Add(time.Duration(i) * time.Millisecond))
+
+			if !regexp.MustCompile(test.pattern).MatchString(id) {
+				t.Errorf("%s: invalid ID: %s", test.kind, id)
+			}
+
+			if seen[id] {
+				t.Errorf("%s: duplicate ID: %s", test.kind, id)
+			}
+
+			seen[id] = true
+			ids = append(ids, id)
+		}
+
+		sorted := sort.StringsAreSorted(ids)
+		if test.kind == IDSnowflake {
+			sorted = sort.SliceIsSorted(ids, func(i, j int) bool {
+				a, _ := strconv.ParseInt(ids[i], 10, 64)
+				b, _ := strconv.ParseInt(ids[j], 10, 64)
+				return a < b
+			})
+		}
+
+		if !sorted {
+			t.Errorf("%s: IDs are not sorted by time: %v", test.kind, ids)
+		}
+	}
+
+	if _, err := NewIDGenerator("uuidv4", 0); err == nil {
+		t.Error("unsupported kinds of IDs should be rejected")
+	}
+
+	if _, err := NewIDGenerator(IDSnowflake, MaxSnowflakeNode+1); err == nil {
+		t.Error("snowflake nodes that don't fit in 10 bits should be rejected")
+	}
+}
+
+func TestSnowflakeSameMillisecond(t *testing.T) {
+	g, _ := NewIDGenerator(IDSnowflake, 1)
+	now := time.Now()
+
+	a, _ := strconv.ParseInt(g.NewID(now), 10, 64)
+	b, _ := strconv.ParseInt(g.NewID(now), 10, 64)
+	c, _ := strconv.ParseInt(g.NewID(now.Add(-time.Second)), 10, 64)
+
+	if !(a < b && b < c) {
+		t.Errorf("snowflake IDs must increase: %d %d %d", a, b, c)
+	}
+}
+
+func TestIDGeneratorSameMillisecond(t *testing.T) {
+	now := time.Now()
+
+	for _, kind := range []string{IDUUIDv7, IDULID} {
+		g, _ := NewIDGenerator(kind, 0)
+		ids := make([]string, 0, 1000)
+
+		for i := 0; i != cap(ids); i++ {
+			// The clock going backwards must not break the order either.
+			ids = append(ids, g.NewID(now.Add(-time.Duration(i%2)*time.Second)))
+		}
+
+		for i := 1; i != len(ids); i++ {
+			if ids[i-1] >= ids[i] {
+				t.Errorf("%s: IDs must increase: %s %s", kind, ids[i-1], ids[i])
+				break
+			}
+		}
+	}
+}
+
+func TestMonotonicOverflow(t *testing.T) {
+	now := time.Now()
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+
+	g := &monotonic{last: ms}
+	g.rand = [10]byte{0x03, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	if next, r := g.next(now, 74); next != ms+1 || r != ([10]byte{}) {
+		t.Errorf("the timestamp should be advanced when the random bits overflow: %d %v", next-ms, r)
+	}
+
+	if next, r := g.next(now, 74); next != ms+1 || r != ([10]byte{9: 1}) {
+		t.Errorf("the random bits should be incremented: %d %v", next-ms, r)
+	}
+}
@@ -0,0 +1,7 @@
+package ingest
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("http", lib.SourceFunc(NewReader))
+}
@@ -0,0 +1,298 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+const (
+	// DefaultAddress is the address on which the http source accepts
+	// requests when HTTP_LISTEN isn't set, only local clients can reach it.
+	DefaultAddress = "127.0.0.1:5180"
+
+	// Path to which the events are posted.
+	Path = "/logs"
+
+	// Requests with larger bodies, once decompressed, are rejected.
+	maxBodySize = 16 * 1024 * 1024
+
+	// How long clients may take to send the headers and the body of their
+	// requests, so slow clients don't hold connections forever.
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 1 * time.Minute
+)
+
+// Config is the configuration of the http source.
+type Config struct {
+	// Tokens accepted in the Authorization header of the requests, any
+	// request is accepted when empty.
+	Tokens []string
+
+	// Group and stream of the events posted without them.
+	Group  string
+	Stream string
+}
+
+// NewReader returns a reader of the events posted to the address set by
+// HTTP_LISTEN, over TLS when HTTP_TLS_CERT and HTTP_TLS_KEY are set. Requests
+// must have one of the bearer tokens of HTTP_TOKENS when it's set, which is
+// required unless the address is a loopback address.
+func NewReader() (r lib.Reader, err error) {
+	var l net.Listener
+	var address string
+
+	if address = os.Getenv("HTTP_LISTEN"); len(address) == 0 {
+		address = DefaultAddress
+	}
+
+	config := Config{
+		Group:  os.Getenv("HTTP_GROUP"),
+		Stream: os.Getenv("HTTP_STREAM"),
+	}
+
+	for _, token := range strings.Split(os.Getenv("HTTP_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); len(token) != 0 {
+			config.Tokens = append(config.Tokens, token)
+		}
+	}
+
+	if len(config.Tokens) == 0 && !lib.IsLoopbackAddress(address) {
+		err = fmt.Errorf("HTTP_TOKENS must be set to listen on a non-loopback address: %s", address)
+		return
+	}
+
+	if len(config.Stream) == 0 {
+		config.Stream, _ = os.Hostname()
+	}
+
+	cert, key := os.Getenv("HTTP_TLS_CERT"), os.Getenv("HTTP_TLS_KEY")
+
+	if len(cert) != 0 || len(key) != 0 {
+		var c tls.Certificate
+
+		if c, err = tls.LoadX509KeyPair(cert, key); err != nil {
+			err = fmt.Errorf("invalid HTTP_TLS_CERT or HTTP_TLS_KEY: %s", err)
+			return
+		}
+
+		l, err = tls.Listen("tcp", address, &tls.Config{Certificates: []tls.Certificate{c}})
+	} else {
+		l, err = net.Listen("tcp", address)
+	}
+
+	if err != nil {
+		return
+	}
+
+	r = NewReaderWith(l, config)
+	return
+}
+
+// NewReaderWith returns a reader of the events posted to the requests accepted
+// by l.
+func NewReaderWith(l net.Listener, config Config) lib.Reader {
+	r := &reader{
+		config:  config,
+		results: make(chan lib.Message),
+		done:    make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path, r.serveLogs)
+	r.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+	}
+
+	go r.serve(l)
+	return r
+}
+
+type reader struct {
+	config  Config
+	server  *http.Server
+	results chan lib.Message
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (r *reader) Close() (err error) {
+	r.once.Do(func() {
+		close(r.done)
+		err = r.server.Close()
+	})
+	return
+}
+
+func (r *reader) serve(l net.Listener) {
+	if err := r.server.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.WithFields(log.Fields{
+			"address": l.Addr().String(),
+			"error":   err,
+		}).Error("the http source stopped accepting requests")
+	}
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	select {
+	case msg = <-r.results:
+	case <-r.done:
+		err = io.EOF
+	}
+	return
+}
+
+// serveLogs accepts a JSON array of events or messages, or one of them per
+// line. The events of a request are either all accepted or all rejected, and
+// the response is sent once they were all taken by the pipeline so clients
+// are slowed down when ecs-logs can't keep up. Once valid, the events are all
+// passed to the pipeline even if the client went away, it may then send them
+// again but a part of them is never lost.
+func (r *reader) serveLogs(res http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		res.Header().Set("Allow", "POST")
+		httpError(res, http.StatusMethodNotAllowed, "the events must be posted")
+		return
+	}
+
+	if !r.authorized(req) {
+		res.Header().Set("WWW-Authenticate", `Bearer realm="ecs-logs"`)
+		httpError(res, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+
+	var body io.Reader = req.Body
+
+	switch req.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		z, err := gzip.NewReader(req.Body)
+		if err != nil {
+			httpError(res, http.StatusBadRequest, "invalid gzip body: "+err.Error())
+			return
+		}
+		defer z.Close()
+		body = z
+	default:
+		httpError(res, http.StatusUnsupportedMediaType, "unsupported content encoding: "+req.Header.Get("Content-Encoding"))
+		return
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize+1))
+
+	if err != nil {
+		httpError(res, http.StatusBadRequest, "failed to read the body: "+err.Error())
+		return
+	}
+
+	if len(b) > maxBodySize {
+		httpError(res, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body is larger than %d bytes", maxBodySize))
+		return
+	}
+
+	msgs, err := r.parse(b)
+
+	if err != nil {
+		httpError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, msg := range msgs {
+		select {
+		case r.results <- msg:
+		case <-r.done:
+			httpError(res, http.StatusServiceUnavailable, "the source is closed")
+			return
+		}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(res).Encode(struct {
+		Accepted int `json:"accepted"`
+	}{len(msgs)})
+}
+
+func (r *reader) authorized(req *http.Request) bool {
+	if len(r.config.Tokens) == 0 {
+		return true
+	}
+
+	auth := req.Header.Get("Authorization")
+
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := []byte(strings.TrimSpace(auth[len("Bearer "):]))
+
+	for _, t := range r.config.Tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parse returns the messages of a request body, either a JSON array or one
+// JSON object per line.
+func (r *reader) parse(b []byte) (msgs []lib.Message, err error) {
+	var items []json.RawMessage
+
+	if b = bytes.TrimSpace(b); len(b) != 0 && b[0] == '[' {
+		if err = json.Unmarshal(b, &items); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %s", err)
+		}
+	} else {
+		s := bufio.NewScanner(bytes.NewReader(b))
+		s.Buffer(nil, maxBodySize)
+
+		for s.Scan() {
+			if line := bytes.TrimSpace(s.Bytes()); len(line) != 0 {
+				items = append(items, json.RawMessage(append([]byte(nil), line...)))
+			}
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no events in the request")
+	}
+
+	for i, item := range items {
+		var msg lib.Message
+
+		if msg, err = lib.ParseMessage(item, r.config.Group, r.config.Stream); err != nil {
+			return nil, fmt.Errorf("event %d: %s", i+1, err)
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return
+}
+
+func httpError(res http.ResponseWriter, status int, message string) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
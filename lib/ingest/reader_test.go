@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func newReader(t *testing.T, config Config) (lib.Reader, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewReaderWith(l, config), "http://" + l.Addr().String() + Path
+}
+
+func post(t *testing.T, url string, token string, encoding string, body []byte) int {
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+
+	if len(token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if len(encoding) != 0 {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestReader(t *testing.T) {
+	r, url := newReader(t, Config{Group: "cron", Stream: "host"})
+	defer r.Close()
+
+	var compressed bytes.Buffer
+	z := gzip.NewWriter(&compressed)
+	z.Write([]byte(`{"message":"gzip"}`))
+	z.Close()
+
+	bodies := []struct {
+		encoding string
+		body     []byte
+		messages []string
+	}{
+		{"", []byte(`[{"message":"a"},{"group":"api","stream":"0","event":{"message":"b"}}]`), []string{"cron/host: a", "api/0: b"}},
+		{"", []byte("{\"message\":\"c\"}\n\n{\"message\":\"d\"}\n"), []string{"cron/host: c", "cron/host: d"}},
+		{"gzip", compressed.Bytes(), []string{"cron/host: gzip"}},
+	}
+
+	for _, test := range bodies {
+		status := make(chan int, 1)
+		go func(encoding string, body []byte) { status <- post(t, url, "", encoding, body) }(test.encoding, test.body)
+
+		for _, expected := range test.messages {
+			msg, err := r.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s := msg.Group + "/" + msg.Stream + ": " + msg.Event.Message; s != expected {
+				t.Errorf("invalid message: %s", s)
+			}
+		}
+
+		if s := <-status; s != http.StatusAccepted {
+			t.Errorf("invalid status: %d", s)
+		}
+	}
+}
+
+func TestReaderRejected(t *testing.T) {
+	r, url := newReader(t, Config{Tokens: []string{"secret"}, Group: "cron", Stream: "host"})
+	defer r.Close()
+
+	tests := []struct {
+		token    string
+		encoding string
+		body     string
+		status   int
+	}{
+		{"", "", `{"message":"a"}`, http.StatusUnauthorized},
+		{"wrong", "", `{"message":"a"}`, http.StatusUnauthorized},
+		{"secret", "br", `{"message":"a"}`, http.StatusUnsupportedMediaType},
+		{"secret", "gzip", `{"message":"a"}`, http.StatusBadRequest},
+		{"secret", "", ``, http.StatusBadRequest},
+		{"secret", "", `[{"message":"a"},{"level":"LOUD","message":"b"}]`, http.StatusBadRequest},
+		{"secret", "", "{\"message\":\"a\"}\nnot json\n", http.StatusBadRequest},
+		{"secret", "", `{"message":"` + strings.Repeat("a", maxBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		if status := post(t, url, test.token, test.encoding, []byte(test.body)); status != test.status {
+			t.Errorf("%.40s: invalid status: %d", test.body, status)
+		}
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("invalid status of a GET request: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,154 @@
+package lib
+
+import (
+	"hash/crc32"
+	"sync"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// IntegrityKey is the reserved key of the event data under which batch
+// integrity markers are recorded.
+const IntegrityKey = "_ecs_logs_batch"
+
+// BatchIntegrity is attached to each message of a batch so consumers can detect
+// gaps between batches of a stream, with the sequence number, and messages lost
+// or truncated within a batch, with the index, size and checksum.
+type BatchIntegrity struct {
+	// Sequence numbers start at 1 for each epoch, which changes when the
+	// program restarts, and when a stream expired and is seen again.
+	Epoch int64  `json:"epoch"`
+	Seq   uint64 `json:"seq"`
+	Index int    `json:"index"`
+	Size  int    `json:"size"`
+
+	// CRC-32 (IEEE) of the messages of the batch, each followed by a newline.
+	CRC32 uint32 `json:"crc32"`
+
+	// Batches too large for the destination are split, each part carrying
+	// the index of its first message and the size of the batch of the
+	// sequence number, while the other fields describe the part.
+	Offset int `json:"offset,omitempty"`
+	Total  int `json:"total,omitempty"`
+}
+
+// BatchSequencer numbers the batches of each stream.
+type BatchSequencer struct {
+	mutex sync.Mutex
+	seqs  map[string]sequence
+}
+
+type sequence struct {
+	epoch int64
+	seq   uint64
+}
+
+func NewBatchSequencer() *BatchSequencer {
+	return &BatchSequencer{seqs: make(map[string]sequence)}
+}
+
+// Remove forgets the sequence number of the stream, the batches of the stream
+// are numbered from 1 again in a new epoch if it's seen again.
+func (s *BatchSequencer) Remove(group string, stream string) {
+	s.mutex.Lock()
+	delete(s.seqs, group+":"+stream)
+	s.mutex.Unlock()
+}
+
+// Mark returns a copy of batch where the messages carry the integrity markers
+// of the next batch of the stream. The event data of the messages is copied
+// since it may be shared with batches sent to other destinations.
+func (s *BatchSequencer) Mark(group string, stream string, batch MessageBatch) MessageBatch {
+	s.mutex.Lock()
+	key := group + ":" + stream
+	seq, ok := s.seqs[key]
+	if !ok {
+		seq.epoch = epochNow()
+	}
+	seq.seq++
+	s.seqs[key] = seq
+	s.mutex.Unlock()
+
+	return markBatch(batch, BatchIntegrity{Epoch: seq.epoch, Seq: seq.seq})
+}
+
+// SplitMarkedBatch splits a batch marked by a BatchSequencer at i, the
+// messages of each part carry the index, size and checksum of their part.
+// Batches that weren't marked are split as is.
+func SplitMarkedBatch(batch MessageBatch, i int) (MessageBatch, MessageBatch) {
+	head, tail := batch[:i], batch[i:]
+
+	if len(batch) == 0 {
+		return head, tail
+	}
+
+	m, ok := batch[0].Event.Data[IntegrityKey].(BatchIntegrity)
+	if !ok {
+		return head, tail
+	}
+
+	if m.Total == 0 {
+		m.Total = m.Size
+	}
+
+	head = markBatch(head, m)
+	m.Offset += i
+	tail = markBatch(tail, m)
+	return head, tail
+}
+
+// markBatch returns a copy of batch where the messages carry m, with their
+// index and the size and checksum of batch.
+func markBatch(batch MessageBatch, m BatchIntegrity) MessageBatch {
+	marked := make(MessageBatch, len(batch))
+
+	m.Size = len(batch)
+	m.CRC32 = BatchChecksum(batch)
+
+	for i, msg := range batch {
+		data := make(ecslogs.EventData, len(msg.Event.Data)+1)
+		for k, v := range msg.Event.Data {
+			data[k] = v
+		}
+		m.Index = i
+		data[IntegrityKey] = m
+		msg.Event.Data = data
+		marked[i] = msg
+	}
+
+	return marked
+}
+
+var (
+	epochmtx  sync.Mutex
+	lastEpoch int64
+)
+
+// epochNow returns a new epoch, the current time in nanoseconds made unique
+// within the process.
+func epochNow() int64 {
+	epochmtx.Lock()
+	defer epochmtx.Unlock()
+
+	epoch := time.Now().UnixNano()
+
+	if epoch <= lastEpoch {
+		epoch = lastEpoch + 1
+	}
+
+	lastEpoch = epoch
+	return epoch
+}
+
+// BatchChecksum returns the CRC-32 of the messages of batch.
+func BatchChecksum(batch MessageBatch) uint32 {
+	h := crc32.NewIEEE()
+
+	for _, msg := range batch {
+		h.Write([]byte(msg.Event.Message))
+		h.Write([]byte{'\n'})
+	}
+
+	return h.Sum32()
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestBatchSequencer(t *testing.T) {
+	s := NewBatchSequencer()
+	batch := MessageBatch{
+		{Event: ecslogs.Event{Message: "a", Data: ecslogs.EventData{"x": 1}}},
+		{Event: ecslogs.Event{Message: "b"}},
+	}
+
+	s.Mark("group", "stream", batch)
+	marked := s.Mark("group", "stream", batch)
+	other := s.Mark("group", "other", batch)
+
+	checksum := crc32.ChecksumIEEE([]byte("a\nb\n"))
+
+	epoch := marked[0].Event.Data[IntegrityKey].(BatchIntegrity).Epoch
+
+	for i, msg := range marked {
+		m := msg.Event.Data[IntegrityKey].(BatchIntegrity)
+
+		if m != (BatchIntegrity{Epoch: epoch, Seq: 2, Index: i, Size: 2, CRC32: checksum}) {
+			t.Errorf("invalid integrity markers: %+v", m)
+		}
+	}
+
+	if marked[0].Event.Data["x"] != 1 {
+		t.Error("the event data must be preserved")
+	}
+
+	if _, ok := batch[0].Event.Data[IntegrityKey]; ok {
+		t.Error("the original batch must not be modified")
+	}
+
+	if m := other[0].Event.Data[IntegrityKey].(BatchIntegrity); m.Seq != 1 || m.Epoch == epoch {
+		t.Errorf("streams must be numbered independently: %+v", m)
+	}
+
+	s.Remove("group", "stream")
+
+	if m := s.Mark("group", "stream", batch)[0].Event.Data[IntegrityKey].(BatchIntegrity); m.Seq != 1 || m.Epoch == epoch {
+		t.Errorf("removed streams must be numbered again in a new epoch: %+v", m)
+	}
+}
+
+func TestSplitMarkedBatch(t *testing.T) {
+	batch := MessageBatch{
+		{Event: ecslogs.Event{Message: "a"}},
+		{Event: ecslogs.Event{Message: "b"}},
+		{Event: ecslogs.Event{Message: "c"}},
+	}
+
+	marked := NewBatchSequencer().Mark("group", "stream", batch)
+	epoch := marked[0].Event.Data[IntegrityKey].(BatchIntegrity).Epoch
+
+	head, tail := SplitMarkedBatch(marked, 1)
+	tail1, tail2 := SplitMarkedBatch(tail, 1)
+
+	tests := []struct {
+		batch MessageBatch
+		data  string
+		m     BatchIntegrity
+	}{
+		{head, "a\n", BatchIntegrity{Size: 1, Offset: 0}},
+		{tail1, "b\n", BatchIntegrity{Size: 1, Offset: 1}},
+		{tail2, "c\n", BatchIntegrity{Size: 1, Offset: 2}},
+	}
+
+	for _, test := range tests {
+		m := test.batch[0].Event.Data[IntegrityKey].(BatchIntegrity)
+		test.m.Epoch, test.m.Seq, test.m.Total = epoch, 1, 3
+		test.m.CRC32 = crc32.ChecksumIEEE([]byte(test.data))
+
+		if m != test.m {
+			t.Errorf("invalid integrity markers of the part:\n - expected: %+v\n - found:    %+v", test.m, m)
+		}
+	}
+
+	if a, b := SplitMarkedBatch(batch, 1); len(a) != 1 || len(b) != 2 || a[0].Event.Data != nil {
+		t.Error("batches that weren't marked must be split as is")
+	}
+}
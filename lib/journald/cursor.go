@@ -0,0 +1,101 @@
+// +build linux
+
+package journald
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// How often the cursor file is written while the reader is open.
+const cursorSaveInterval = 1 * time.Second
+
+// cursorFile saves the cursor of the last entry delivered, so the reader
+// resumes after it when it's opened again.
+type cursorFile struct {
+	path   string
+	mutex  sync.Mutex
+	cursor string
+	saved  time.Time
+	dirty  bool
+	closed bool
+}
+
+// cursorPath returns the path of the cursor file of a reader restricted to the
+// given matches, readers with different filters read different entries so each
+// of them keeps its position in a file suffixed with a hash of its filter.
+func cursorPath(path string, matches []string) string {
+	if len(matches) == 0 {
+		return path
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(matches, "+")))
+	return fmt.Sprintf("%s.%08x", path, h.Sum32())
+}
+
+// readCursorFile returns the cursor saved in the file at path, or an empty
+// string if there was none.
+func readCursorFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(b)), err
+}
+
+// ack records the cursor, which is written to the file at most once per
+// cursorSaveInterval while the reader is open, and on each call once it was
+// closed so the cursors of the last batches aren't lost.
+func (f *cursorFile) ack(cursor string, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.cursor, f.dirty = cursor, true
+
+	if f.closed || now.Sub(f.saved) >= cursorSaveInterval {
+		f.save(now)
+	}
+}
+
+func (f *cursorFile) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+
+	if f.dirty {
+		f.save(time.Now())
+	}
+}
+
+// save writes the cursor to a temporary file renamed over the cursor file, so
+// the file isn't left truncated when the program is killed. It must be called
+// with the mutex held.
+func (f *cursorFile) save(now time.Time) {
+	tmp := filepath.Join(filepath.Dir(f.path), "."+filepath.Base(f.path)+".tmp")
+	err := ioutil.WriteFile(tmp, []byte(f.cursor+"\n"), 0644)
+
+	if err == nil {
+		err = os.Rename(tmp, f.path)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  f.path,
+			"error": err,
+		}).Error("failed to save the journal cursor")
+		return
+	}
+
+	f.saved, f.dirty = now, false
+}
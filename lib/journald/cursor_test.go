@@ -0,0 +1,63 @@
+// +build linux
+
+package journald
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCursorFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cursor")
+	now := time.Now()
+
+	if cursor, err := readCursorFile(path); err != nil || len(cursor) != 0 {
+		t.Fatalf("a missing cursor file should be empty: %q, %v", cursor, err)
+	}
+
+	f := &cursorFile{path: path}
+	f.ack("s=1", now)
+	f.ack("s=2", now.Add(cursorSaveInterval/2))
+
+	if cursor, _ := readCursorFile(path); cursor != "s=1" {
+		t.Errorf("invalid cursor saved before the save interval: %q", cursor)
+	}
+
+	f.close()
+
+	if cursor, _ := readCursorFile(path); cursor != "s=2" {
+		t.Errorf("invalid cursor saved when closed: %q", cursor)
+	}
+
+	f.ack("s=3", now.Add(cursorSaveInterval/2))
+
+	if cursor, _ := readCursorFile(path); cursor != "s=3" {
+		t.Errorf("invalid cursor saved after being closed: %q", cursor)
+	}
+}
+
+func TestCursorPath(t *testing.T) {
+	if path := cursorPath("/var/lib/cursor", nil); path != "/var/lib/cursor" {
+		t.Errorf("the cursor path of an unfiltered reader should be unchanged: %s", path)
+	}
+
+	a := cursorPath("/var/lib/cursor", []string{"_SYSTEMD_UNIT=a.service"})
+	b := cursorPath("/var/lib/cursor", []string{"_SYSTEMD_UNIT=b.service"})
+
+	if a == b || a == "/var/lib/cursor" {
+		t.Errorf("filtered readers should have distinct cursor paths: %s, %s", a, b)
+	}
+
+	if c := cursorPath("/var/lib/cursor", []string{"_SYSTEMD_UNIT=a.service"}); c != a {
+		t.Errorf("the cursor path of a filter should be stable: %s != %s", a, c)
+	}
+}
@@ -0,0 +1,53 @@
+// +build linux
+
+package journald
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// groupRule rewrites the groups matching a pattern, where each * matches any
+// sequence of characters that can be referenced as $1, $2... in the
+// replacement.
+type groupRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// parseGroupRules parses a comma separated list of pattern=replacement rules,
+// for example "myapp:*=myapp,registry.example.com/*=$1".
+func parseGroupRules(s string) (rules []groupRule, err error) {
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); len(r) == 0 {
+			continue
+		}
+
+		i := strings.IndexByte(r, '=')
+
+		if i <= 0 || i == len(r)-1 {
+			err = fmt.Errorf("invalid JOURNALD_GROUP_REWRITE value, expected pattern=replacement: %s", r)
+			return
+		}
+
+		expr := "^" + strings.Replace(regexp.QuoteMeta(r[:i]), `\*`, "(.*)", -1) + "$"
+
+		rules = append(rules, groupRule{
+			pattern:     regexp.MustCompile(expr),
+			replacement: r[i+1:],
+		})
+	}
+	return
+}
+
+// rewriteGroup applies the first rule matching group, it returns the group
+// unchanged if there were none.
+func rewriteGroup(rules []groupRule, group string) string {
+	for _, r := range rules {
+		if m := r.pattern.FindStringSubmatchIndex(group); m != nil {
+			return string(r.pattern.ExpandString(nil, r.replacement, group, m))
+		}
+	}
+	return group
+}
@@ -0,0 +1,36 @@
+// +build linux
+
+package journald
+
+import "testing"
+
+func TestRewriteGroup(t *testing.T) {
+	rules, err := parseGroupRules("myapp:*=myapp, registry.example.com/*:*=$1,*.staging=staging-$1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group  string
+		result string
+	}{
+		{"myapp:1.2.3", "myapp"},
+		{"myapp", "myapp"},
+		{"registry.example.com/api:latest", "api"},
+		{"registryXexample.com/api:latest", "registryXexample.com/api:latest"},
+		{"worker.staging", "staging-worker"},
+		{"other", "other"},
+	}
+
+	for _, test := range tests {
+		if result := rewriteGroup(rules, test.group); result != test.result {
+			t.Errorf("%s: invalid group: %s", test.group, result)
+		}
+	}
+
+	for _, s := range []string{"myapp", "=myapp", "myapp:*="} {
+		if _, err := parseGroupRules(s); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
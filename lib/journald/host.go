@@ -0,0 +1,41 @@
+// +build linux
+
+package journald
+
+import (
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// hostKey is the reserved key of the event data under which the IDs of the
+// host are recorded, so they don't clobber the fields of the applications.
+const hostKey = "_ecs_logs_host"
+
+// ec2InstanceID returns the ID of the EC2 instance the program runs on, or an
+// empty string if it cannot be retrieved.
+func ec2InstanceID() string {
+	id, err := lib.GetEC2InstanceIdentity()
+	if err != nil {
+		log.WithError(err).Warn("failed to fetch the EC2 instance identity, events won't carry the instance ID")
+	}
+	return id.InstanceID
+}
+
+// hostIDs returns the boot and machine IDs of the entry, and the EC2 instance
+// ID when it's known.
+func hostIDs(e entry, instanceID string) (data ecslogs.EventData, ok bool) {
+	data = ecslogs.EventData{}
+
+	for key, v := range map[string]string{
+		"boot_id":     e.getString("_BOOT_ID"),
+		"machine_id":  e.getString("_MACHINE_ID"),
+		"instance_id": instanceID,
+	} {
+		if len(v) != 0 {
+			data[key], ok = v, true
+		}
+	}
+
+	return
+}
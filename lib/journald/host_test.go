@@ -0,0 +1,34 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+)
+
+func TestGetMessageHostIDs(t *testing.T) {
+	r := &reader{streamName: "CONTAINER_ID_FULL", hostIDs: true, instanceID: "i-0123456789abcdef0"}
+	msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: map[string]string{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+		"_BOOT_ID":          "b00t",
+		"_MACHINE_ID":       "m4ch1n3",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ecslogs.EventData{hostKey: ecslogs.EventData{
+		"boot_id":     "b00t",
+		"machine_id":  "m4ch1n3",
+		"instance_id": "i-0123456789abcdef0",
+	}}
+
+	if !reflect.DeepEqual(msg.Event.Data, expected) {
+		t.Errorf("invalid event data: %v", msg.Event.Data)
+	}
+}
@@ -2,8 +2,26 @@
 
 package journald
 
-import "github.com/kapralVV/ecs-logs/lib"
+import (
+	"strings"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
 
 func init() {
-	lib.RegisterSource("journald", lib.SourceFunc(NewReader))
+	lib.RegisterSource("journald", source{})
+}
+
+// source opens journald readers, filters restrict them to the entries matching
+// a comma separated list of matches with the syntax of JOURNALD_MATCHES:
+// matches on the same field are OR'ed, matches on different fields are AND'ed
+// and a "+" separates alternatives.
+type source struct{}
+
+func (source) Open() (lib.Reader, error) {
+	return NewReader()
+}
+
+func (source) OpenFilter(filter string) (lib.Reader, error) {
+	return NewFilteredReader(strings.Split(filter, ","))
 }
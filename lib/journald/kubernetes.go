@@ -0,0 +1,39 @@
+// +build linux
+
+package journald
+
+import (
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// kubernetesKey is the reserved key of the event data under which the
+// metadata of the pods are recorded.
+const kubernetesKey = "_ecs_logs_kubernetes"
+
+// kubernetesMetadata returns the metadata of the pod a container belongs to,
+// parsed from the names given by the kubelet to docker containers:
+// k8s_<container>_<pod>_<namespace>_<pod uid>_<attempt>
+func kubernetesMetadata(name string) (data ecslogs.EventData, ok bool) {
+	parts := strings.Split(name, "_")
+
+	if len(parts) != 6 || parts[0] != "k8s" {
+		return
+	}
+
+	for _, p := range parts[1:5] {
+		if len(p) == 0 {
+			return
+		}
+	}
+
+	data = ecslogs.EventData{
+		"container": parts[1],
+		"pod":       parts[2],
+		"namespace": parts[3],
+		"pod_uid":   parts[4],
+	}
+	ok = true
+	return
+}
@@ -0,0 +1,29 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestKubernetesMetadata(t *testing.T) {
+	data, ok := kubernetesMetadata("k8s_web_api-5d8c7_default_0a1b2c3d-4e5f_1")
+
+	if !ok || !reflect.DeepEqual(data, ecslogs.EventData{
+		"container": "web",
+		"pod":       "api-5d8c7",
+		"namespace": "default",
+		"pod_uid":   "0a1b2c3d-4e5f",
+	}) {
+		t.Errorf("invalid metadata: %v", data)
+	}
+
+	for _, name := range []string{"ecs-api-1", "k8s_web_api_default_1", "k8s__api_default_uid_1"} {
+		if _, ok := kubernetesMetadata(name); ok {
+			t.Errorf("%s: not a kubernetes container", name)
+		}
+	}
+}
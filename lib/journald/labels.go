@@ -0,0 +1,76 @@
+// +build linux
+
+package journald
+
+import (
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// Prefix of the journal fields holding the docker labels of containers.
+const labelPrefix = "CONTAINER_LABEL_"
+
+// parseLabels parses a comma separated list of container labels, returning
+// the journal field of each label indexed by field, or all set when the list
+// is "*".
+func parseLabels(s string) (labels map[string]string, all bool) {
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+
+		if name == "*" {
+			all = true
+			continue
+		}
+
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+
+		labels[labelField(name)] = name
+	}
+	return
+}
+
+// labelField returns the journal field of a label, docker upper cases the
+// names and replaces the characters that aren't allowed in field names.
+func labelField(name string) string {
+	return labelPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// containerLabels returns the labels of e, either the ones listed in labels
+// or all of them, named after the lower case field name in the latter case.
+func containerLabels(e entry, labels map[string]string, all bool) (data ecslogs.EventData, ok bool) {
+	for field, v := range e.Fields {
+		if !strings.HasPrefix(field, labelPrefix) {
+			continue
+		}
+
+		name, found := labels[field]
+
+		if !found {
+			if !all {
+				continue
+			}
+			name = strings.ToLower(field[len(labelPrefix):])
+		}
+
+		if data == nil {
+			data = ecslogs.EventData{}
+		}
+
+		data[name], ok = v, true
+	}
+	return
+}
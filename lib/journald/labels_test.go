@@ -0,0 +1,50 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+)
+
+func TestContainerLabels(t *testing.T) {
+	e := entry{&sdjournal.JournalEntry{Fields: map[string]string{
+		"CONTAINER_TAG":                    "api",
+		"CONTAINER_LABEL_SERVICE":          "api",
+		"CONTAINER_LABEL_COM_EXAMPLE_TEAM": "core",
+		"CONTAINER_LABEL_VERSION":          "1.2.3",
+	}}}
+
+	tests := []struct {
+		labels string
+		data   ecslogs.EventData
+	}{
+		{
+			labels: "service, com.example.team,env",
+			data:   ecslogs.EventData{"service": "api", "com.example.team": "core"},
+		},
+		{
+			labels: "*,service",
+			data:   ecslogs.EventData{"service": "api", "com_example_team": "core", "version": "1.2.3"},
+		},
+		{
+			labels: "env",
+		},
+	}
+
+	for _, test := range tests {
+		labels, all := parseLabels(test.labels)
+		data, ok := containerLabels(e, labels, all)
+
+		if ok != (test.data != nil) {
+			t.Errorf("%s: invalid ok: %t", test.labels, ok)
+		}
+
+		if !reflect.DeepEqual(data, test.data) {
+			t.Errorf("%s: invalid labels: %v", test.labels, data)
+		}
+	}
+}
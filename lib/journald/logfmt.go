@@ -0,0 +1,121 @@
+// +build linux
+
+package journald
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+type logfmtField struct {
+	key   string
+	value string
+}
+
+// parseLogfmt parses a line of key=value pairs separated by spaces, where
+// values containing spaces are quoted. It returns false if the line isn't
+// made only of such pairs, so plain text messages are left alone.
+func parseLogfmt(s string) (fields []logfmtField, ok bool) {
+	for s = strings.TrimSpace(s); len(s) != 0; s = strings.TrimLeft(s, " ") {
+		i := strings.IndexAny(s, "= \"")
+
+		if i <= 0 || s[i] != '=' {
+			return nil, false
+		}
+
+		key := s[:i]
+		s = s[i+1:]
+
+		var value string
+
+		if strings.HasPrefix(s, `"`) {
+			j := closingQuote(s)
+
+			if j < 0 {
+				return nil, false
+			}
+
+			var err error
+			if value, err = strconv.Unquote(s[:j+1]); err != nil {
+				return nil, false
+			}
+
+			s = s[j+1:]
+
+			if len(s) != 0 && s[0] != ' ' {
+				return nil, false
+			}
+		} else {
+			if j := strings.IndexByte(s, ' '); j < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:j], s[j:]
+			}
+		}
+
+		fields = append(fields, logfmtField{key, value})
+	}
+
+	return fields, len(fields) != 0
+}
+
+// closingQuote returns the index of the quote ending the quoted string at the
+// start of s, or -1 if there is none.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// Names of levels used by logfmt loggers which aren't level names of ecslogs.
+var logfmtLevels = map[string]ecslogs.Level{
+	"warning": ecslogs.WARN,
+	"err":     ecslogs.ERROR,
+	"fatal":   ecslogs.CRIT,
+	"panic":   ecslogs.CRIT,
+	"trace":   ecslogs.DEBUG,
+}
+
+// applyLogfmt sets the message, level and time of the event from the msg,
+// level and time fields, and copies the other fields to the event data.
+func applyLogfmt(event *ecslogs.Event, fields []logfmtField) {
+	for _, f := range fields {
+		switch f.key {
+		case "msg", "message":
+			event.Message = f.value
+			continue
+
+		case "level", "lvl":
+			lvl, found := logfmtLevels[strings.ToLower(f.value)]
+
+			if !found {
+				lvl, _ = ecslogs.ParseLevel(f.value)
+			}
+
+			if lvl != ecslogs.NONE {
+				event.Level = lvl
+				continue
+			}
+
+		case "time", "ts":
+			if t, err := time.Parse(time.RFC3339Nano, f.value); err == nil {
+				event.Time = t
+				continue
+			}
+		}
+
+		if event.Data == nil {
+			event.Data = ecslogs.EventData{}
+		}
+		event.Data[f.key] = f.value
+	}
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		s      string
+		fields []logfmtField
+	}{
+		{
+			s:      `level=info msg="request served" status=200 path=/users`,
+			fields: []logfmtField{{"level", "info"}, {"msg", "request served"}, {"status", "200"}, {"path", "/users"}},
+		},
+		{
+			s:      `err="unexpected \"EOF\""  retry=`,
+			fields: []logfmtField{{"err", `unexpected "EOF"`}, {"retry", ""}},
+		},
+		{s: "hello world"},
+		{s: "x = 1"},
+		{s: `a="unterminated`},
+		{s: `a="b"c`},
+		{s: ""},
+	}
+
+	for _, test := range tests {
+		fields, ok := parseLogfmt(test.s)
+
+		if ok != (test.fields != nil) {
+			t.Errorf("%s: invalid ok: %t", test.s, ok)
+		}
+
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: invalid fields: %q", test.s, fields)
+		}
+	}
+}
+
+func TestGetMessageLogfmt(t *testing.T) {
+	r := &reader{streamName: "CONTAINER_ID_FULL", logfmt: true}
+	msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: map[string]string{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+		"MESSAGE":           `ts=2017-06-01T12:00:00Z level=warning msg="slow request" duration=1.5s`,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Event.Message != "slow request" {
+		t.Errorf("invalid message: %s", msg.Event.Message)
+	}
+
+	if msg.Event.Level != ecslogs.WARN {
+		t.Errorf("invalid level: %s", msg.Event.Level)
+	}
+
+	if !msg.Event.Time.Equal(time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid time: %s", msg.Event.Time)
+	}
+
+	if !reflect.DeepEqual(msg.Event.Data, ecslogs.EventData{"duration": "1.5s"}) {
+		t.Errorf("invalid event data: %v", msg.Event.Data)
+	}
+}
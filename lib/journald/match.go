@@ -0,0 +1,139 @@
+// +build linux
+
+package journald
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+)
+
+// addMatches restricts the journal to the entries matching each group of
+// terms. Within a group, terms are FIELD=value matches combined like the
+// arguments of journalctl: matches on the same field are OR'ed, matches on
+// different fields are AND'ed and a "+" term separates alternatives. The
+// PRIORITY field can also be compared with <= and >=.
+func addMatches(j *sdjournal.Journal, groups ...[]string) (err error) {
+	added := false
+
+	for _, terms := range groups {
+		var matches []string
+
+		if matches, err = parseMatches(terms); err != nil {
+			return
+		}
+
+		if len(matches) == 0 {
+			continue
+		}
+
+		if added {
+			if err = j.AddConjunction(); err != nil {
+				return
+			}
+		}
+
+		for _, m := range matches {
+			if m == "+" {
+				err = j.AddDisjunction()
+			} else {
+				err = j.AddMatch(m)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+
+		added = true
+	}
+
+	return
+}
+
+// parseMatches translates terms into the FIELD=value matches and "+"
+// disjunctions supported by sd-journal, empty terms are ignored.
+func parseMatches(terms []string) (matches []string, err error) {
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+
+		switch {
+		case len(term) == 0:
+		case term == "+":
+			matches = append(matches, term)
+		case strings.HasPrefix(term, "PRIORITY<="), strings.HasPrefix(term, "PRIORITY>="):
+			var p int
+
+			if p, err = strconv.Atoi(term[len("PRIORITY<="):]); err != nil || p < 0 || p > 7 {
+				err = fmt.Errorf("invalid journald priority match: %s", term)
+				return
+			}
+
+			min, max := 0, p
+			if term[len("PRIORITY")] == '>' {
+				min, max = p, 7
+			}
+
+			for i := min; i <= max; i++ {
+				matches = append(matches, "PRIORITY="+strconv.Itoa(i))
+			}
+		case strings.Index(term, "=") > 0:
+			matches = append(matches, term)
+		default:
+			err = fmt.Errorf("invalid journald match, expected FIELD=value: %s", term)
+			return
+		}
+	}
+
+	return
+}
+
+// parseExclusions parses a comma separated list of FIELD=value terms, entries
+// matching any of them are skipped. The journal only supports positive
+// matches, so exclusions are applied to the entries after they're read.
+func parseExclusions(s string) (exclusions map[string]map[string]bool, err error) {
+	for _, term := range strings.Split(s, ",") {
+		if term = strings.TrimSpace(term); len(term) == 0 {
+			continue
+		}
+
+		i := strings.Index(term, "=")
+
+		if i <= 0 {
+			err = fmt.Errorf("invalid JOURNALD_EXCLUDE value, expected FIELD=value: %s", term)
+			return
+		}
+
+		if exclusions == nil {
+			exclusions = make(map[string]map[string]bool)
+		}
+
+		field, value := term[:i], term[i+1:]
+
+		if exclusions[field] == nil {
+			exclusions[field] = make(map[string]bool)
+		}
+
+		exclusions[field][value] = true
+	}
+	return
+}
+
+// parsePriority parses a syslog priority given as a number between 0 (emerg)
+// and 7 (debug), or as the name of a level.
+func parsePriority(s string) (p int, err error) {
+	if p, err = strconv.Atoi(s); err == nil && p >= 0 && p <= 7 {
+		return
+	}
+
+	if lvl, e := ecslogs.ParseLevel(s); e == nil && lvl != ecslogs.NONE {
+		p, err = int(lvl)-1, nil
+		return
+	}
+
+	err = fmt.Errorf("invalid JOURNALD_MIN_PRIORITY value: %s", s)
+	return
+}
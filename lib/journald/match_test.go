@@ -0,0 +1,74 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMatches(t *testing.T) {
+	tests := []struct {
+		terms   []string
+		matches []string
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{"_SYSTEMD_UNIT=docker.service"}, []string{"_SYSTEMD_UNIT=docker.service"}},
+		{[]string{"_SYSTEMD_UNIT=docker.service", "PRIORITY<=2"}, []string{"_SYSTEMD_UNIT=docker.service", "PRIORITY=0", "PRIORITY=1", "PRIORITY=2"}},
+		{[]string{"PRIORITY>=6", "+", "_COMM=sshd"}, []string{"PRIORITY=6", "PRIORITY=7", "+", "_COMM=sshd"}},
+	}
+
+	for _, test := range tests {
+		matches, err := parseMatches(test.terms)
+
+		if err != nil {
+			t.Errorf("%q: %s", test.terms, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(matches, test.matches) {
+			t.Errorf("%q: invalid matches: %q", test.terms, matches)
+		}
+	}
+
+	for _, term := range []string{"docker", "=value", "PRIORITY<=8", "PRIORITY>=high"} {
+		if _, err := parseMatches([]string{term}); err == nil {
+			t.Errorf("%s: expected an error", term)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		s string
+		p int
+	}{
+		{"0", 0},
+		{"4", 4},
+		{"7", 7},
+		{"emerg", 0},
+		{"warn", 4},
+		{"INFO", 6},
+		{"debug", 7},
+	}
+
+	for _, test := range tests {
+		p, err := parsePriority(test.s)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.s, err)
+			continue
+		}
+
+		if p != test.p {
+			t.Errorf("%s: invalid priority: %d", test.s, p)
+		}
+	}
+
+	for _, s := range []string{"", "8", "-1", "none", "loud"} {
+		if _, err := parsePriority(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
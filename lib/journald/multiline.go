@@ -0,0 +1,229 @@
+// +build linux
+
+package journald
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// maxJoinedLines is the maximum number of lines of a pending JSON object, or
+// multi-line message, it's forwarded as is once exceeded.
+const maxJoinedLines = 1000
+
+// joiner reassembles messages spread over multiple journal entries.
+type joiner interface {
+	// add returns the messages completed by msg, which may be none when msg
+	// starts or continues a message spread over multiple lines.
+	add(msg lib.Message, now time.Time) []lib.Message
+
+	// expire returns the pending messages that were started before the
+	// timeout, or all of them when force is true.
+	expire(now time.Time, force bool) []lib.Message
+}
+
+// join passes msgs through the joiners, returning the messages completed by
+// the last one.
+func join(joiners []joiner, msgs []lib.Message, now time.Time) []lib.Message {
+	for _, j := range joiners {
+		var next []lib.Message
+		for _, msg := range msgs {
+			next = append(next, j.add(msg, now)...)
+		}
+		msgs = next
+	}
+	return msgs
+}
+
+// expire returns the messages of the joiners that expired, those of a joiner
+// go through the next ones, which are expired after it.
+func expire(joiners []joiner, now time.Time, force bool) (msgs []lib.Message) {
+	for i, j := range joiners {
+		msgs = append(msgs, join(joiners[i+1:], j.expire(now, force), now)...)
+	}
+	return
+}
+
+// jsonJoiner reassembles the JSON objects pretty-printed over multiple lines,
+// which docker writes to the journal as one entry per line. Lines of a stream
+// starting an object that isn't closed on the same line are held until the
+// braces balance, or until the timeout expires.
+type jsonJoiner struct {
+	timeout time.Duration
+	pending map[string]*pendingJSON
+}
+
+type pendingJSON struct {
+	msg      lib.Message
+	lines    []string
+	since    time.Time
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func newJSONJoiner(timeout time.Duration) *jsonJoiner {
+	return &jsonJoiner{
+		timeout: timeout,
+		pending: make(map[string]*pendingJSON),
+	}
+}
+
+func (j *jsonJoiner) add(msg lib.Message, now time.Time) []lib.Message {
+	key := msg.Group + "/" + msg.Stream
+	line := msg.Event.Message
+
+	if p := j.pending[key]; p != nil {
+		p.scan(line)
+		p.lines = append(p.lines, line)
+		p.msg.Cursor = msg.Cursor
+
+		if p.depth > 0 && len(p.lines) < maxJoinedLines {
+			return nil
+		}
+
+		delete(j.pending, key)
+		return []lib.Message{p.message()}
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return []lib.Message{msg}
+	}
+
+	p := &pendingJSON{msg: msg, lines: []string{line}, since: now}
+
+	if p.scan(line); p.depth <= 0 {
+		return []lib.Message{msg}
+	}
+
+	j.pending[key] = p
+	return nil
+}
+
+func (j *jsonJoiner) expire(now time.Time, force bool) (msgs []lib.Message) {
+	for key, p := range j.pending {
+		if force || now.Sub(p.since) >= j.timeout {
+			delete(j.pending, key)
+			msgs = append(msgs, p.message())
+		}
+	}
+	return
+}
+
+// scan updates the nesting depth of the object with a new line.
+func (p *pendingJSON) scan(line string) {
+	for i := 0; i != len(line); i++ {
+		c := line[i]
+
+		switch {
+		case p.escaped:
+			p.escaped = false
+		case p.inString:
+			switch c {
+			case '\\':
+				p.escaped = true
+			case '"':
+				p.inString = false
+			}
+		default:
+			switch c {
+			case '"':
+				p.inString = true
+			case '{', '[':
+				p.depth++
+			case '}', ']':
+				p.depth--
+			}
+		}
+	}
+}
+
+// message returns the message made of the pending lines, compacted to a
+// single line when they form a valid JSON value.
+func (p *pendingJSON) message() lib.Message {
+	text := strings.Join(p.lines, "\n")
+	msg := p.msg
+
+	var buf bytes.Buffer
+	if p.depth == 0 && json.Compact(&buf, []byte(text)) == nil {
+		text = buf.String()
+	}
+
+	msg.Event.Message = text
+	return msg
+}
+
+// lineJoiner merges the lines of a stream that don't match the start pattern
+// with the line before them, for example the lines of a stack trace with the
+// line of the exception. Messages are held until the next line matching the
+// pattern, or until no lines were added for the timeout.
+type lineJoiner struct {
+	start   *regexp.Regexp
+	timeout time.Duration
+	pending map[string]*pendingLines
+}
+
+type pendingLines struct {
+	msg   lib.Message
+	lines []string
+	since time.Time
+}
+
+func newLineJoiner(start *regexp.Regexp, timeout time.Duration) *lineJoiner {
+	return &lineJoiner{
+		start:   start,
+		timeout: timeout,
+		pending: make(map[string]*pendingLines),
+	}
+}
+
+func (j *lineJoiner) add(msg lib.Message, now time.Time) (msgs []lib.Message) {
+	key := msg.Group + "/" + msg.Stream
+	line := msg.Event.Message
+	p := j.pending[key]
+
+	if j.start.MatchString(line) {
+		if p != nil {
+			msgs = append(msgs, p.message())
+		}
+		j.pending[key] = &pendingLines{msg: msg, lines: []string{line}, since: now}
+		return
+	}
+
+	if p == nil {
+		// Lines that don't follow a start line are forwarded as is.
+		return []lib.Message{msg}
+	}
+
+	p.lines = append(p.lines, line)
+	p.msg.Cursor = msg.Cursor
+	p.since = now
+
+	if len(p.lines) >= maxJoinedLines {
+		delete(j.pending, key)
+		msgs = append(msgs, p.message())
+	}
+
+	return
+}
+
+func (j *lineJoiner) expire(now time.Time, force bool) (msgs []lib.Message) {
+	for key, p := range j.pending {
+		if force || now.Sub(p.since) >= j.timeout {
+			delete(j.pending, key)
+			msgs = append(msgs, p.message())
+		}
+	}
+	return
+}
+
+func (p *pendingLines) message() lib.Message {
+	msg := p.msg
+	msg.Event.Message = strings.Join(p.lines, "\n")
+	return msg
+}
@@ -0,0 +1,120 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestJSONJoiner(t *testing.T) {
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+	j := newJSONJoiner(time.Second)
+
+	line := func(stream string, s string) lib.Message {
+		msg := lib.Message{Group: "api", Stream: stream}
+		msg.Event.Message = s
+		return msg
+	}
+
+	var msgs []string
+	for _, m := range []lib.Message{
+		line("a", "hello"),
+		line("a", "{"),
+		line("b", `{"inline": true}`),
+		line("a", `  "msg": "} {",`),
+		line("a", `  "list": [1, 2]`),
+		line("a", "}"),
+		line("b", "{"),
+		line("b", `  "unterminated": true,`),
+	} {
+		for _, msg := range j.add(m, now) {
+			msgs = append(msgs, msg.Stream+" "+msg.Event.Message)
+		}
+	}
+
+	for _, msg := range j.expire(now.Add(time.Second), false) {
+		msgs = append(msgs, msg.Stream+" "+msg.Event.Message)
+	}
+
+	if !reflect.DeepEqual(msgs, []string{
+		"a hello",
+		`b {"inline": true}`,
+		`a {"msg":"} {","list":[1,2]}`,
+		"b {\n  \"unterminated\": true,",
+	}) {
+		t.Errorf("invalid messages: %q", msgs)
+	}
+
+	if len(j.pending) != 0 {
+		t.Errorf("messages left pending: %d", len(j.pending))
+	}
+}
+
+func TestLineJoiner(t *testing.T) {
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+	j := newLineJoiner(regexp.MustCompile(`^\S`), time.Second)
+
+	line := func(stream string, s string) lib.Message {
+		msg := lib.Message{Group: "api", Stream: stream}
+		msg.Event.Message = s
+		return msg
+	}
+
+	var msgs []string
+	for _, m := range []lib.Message{
+		line("a", "  orphan"),
+		line("a", "Exception: oops"),
+		line("b", "hello"),
+		line("a", "  at main.go:1"),
+		line("a", "  at main.go:2"),
+		line("a", "next"),
+		line("b", "world"),
+	} {
+		for _, msg := range j.add(m, now) {
+			msgs = append(msgs, msg.Stream+" "+msg.Event.Message)
+		}
+	}
+
+	for _, msg := range j.expire(now.Add(time.Second), false) {
+		msgs = append(msgs, msg.Stream+" "+msg.Event.Message)
+	}
+	sort.Strings(msgs[3:])
+
+	if !reflect.DeepEqual(msgs, []string{
+		"a   orphan",
+		"a Exception: oops\n  at main.go:1\n  at main.go:2",
+		"b hello",
+		"a next",
+		"b world",
+	}) {
+		t.Errorf("invalid messages: %q", msgs)
+	}
+}
+
+func TestJoinChain(t *testing.T) {
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+	joiners := []joiner{newJSONJoiner(time.Second), newLineJoiner(regexp.MustCompile(`^\S`), time.Second)}
+
+	var msgs []lib.Message
+	for _, s := range []string{"{", `  "a": 1`, "}", "  trailer"} {
+		msg := lib.Message{Group: "api", Stream: "a"}
+		msg.Event.Message = s
+		msgs = append(msgs, join(joiners, []lib.Message{msg}, now)...)
+	}
+
+	if len(msgs) != 0 {
+		t.Errorf("messages must be pending: %v", msgs)
+	}
+
+	msgs = expire(joiners, now, true)
+
+	if len(msgs) != 1 || msgs[0].Event.Message != "{\"a\":1}\n  trailer" {
+		t.Errorf("invalid messages: %v", msgs)
+	}
+}
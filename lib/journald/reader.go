@@ -6,24 +6,132 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
-	"strconv"
 
+	"github.com/apex/log"
 	"github.com/coreos/go-systemd/sdjournal"
 	ecslogs "github.com/kapralVV/ecs-logs-go"
 	"github.com/kapralVV/ecs-logs/lib"
 )
 
+// reopenAttempts is the number of attempts made to open the journal again
+// after reading it failed.
+const reopenAttempts = 5
+
+// Default maximum number of journal entries retrieved each time the reader
+// wakes up, and how long it waits for new entries once it reached the end of
+// the journal.
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = 1 * time.Second
+)
+
+// StreamNameWithID is the value of JOURNALD_STREAM_NAME naming streams after
+// the container name followed by its short ID, which is readable and still
+// unique when containers are replaced.
+const StreamNameWithID = "CONTAINER_NAME_ID"
+
+// defaultExcludedFields are the fields that JOURNALD_INCLUDE_ALL_FIELDS doesn't
+// copy to the event data: the message, which is already the message of the
+// event, and the fields that may hold secrets or are large, like the command
+// lines and environment of processes. They can still be copied explicitly with
+// JOURNALD_EXTRA_FIELDS.
+var defaultExcludedFields = []string{
+	"MESSAGE",
+	"_CMDLINE",
+	"COREDUMP",
+	"COREDUMP_CMDLINE",
+	"COREDUMP_ENVIRON",
+	"COREDUMP_OPEN_FDS",
+	"COREDUMP_PROC_MAPS",
+	"COREDUMP_PROC_MOUNTINFO",
+	"COREDUMP_PROC_STATUS",
+}
+
+// parseExcludedFields returns the set of the fields not copied by
+// JOURNALD_INCLUDE_ALL_FIELDS, the default ones and those of the comma
+// separated list s.
+func parseExcludedFields(s string) map[string]bool {
+	fields := make(map[string]bool, len(defaultExcludedFields))
+
+	for _, field := range defaultExcludedFields {
+		fields[field] = true
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); len(field) != 0 {
+			fields[field] = true
+		}
+	}
+
+	return fields
+}
+
+// maxPartialSize is the maximum size of a message reassembled from partial
+// messages, it's forwarded as is once exceeded.
+const maxPartialSize = 1024 * 1024
+
+// partialTimeout is how long the fragments of a message split by docker are
+// held waiting for the last one, docker writes them all at once so they are
+// only left incomplete when the container is stopped while writing.
+const partialTimeout = 2 * time.Second
+
 func NewReader() (r lib.Reader, err error) {
+	return NewFilteredReader(nil)
+}
+
+// NewFilteredReader returns a reader of the journal entries matching both
+// JOURNALD_MATCHES and the given matches.
+func NewFilteredReader(matches []string) (r lib.Reader, err error) {
 	var j *sdjournal.Journal
 
-	if j, err = sdjournal.NewJournal(); err != nil {
+	path := os.Getenv("JOURNALD_PATH")
+	conditions := strings.Split(os.Getenv("JOURNALD_MATCHES"), ",")
+	start := os.Getenv("JOURNALD_START")
+
+	// Filtering the priorities with a match skips the entries in the journal
+	// instead of reading and discarding them.
+	var priorities []string
+	if s := os.Getenv("JOURNALD_MIN_PRIORITY"); len(s) != 0 {
+		var p int
+		if p, err = parsePriority(s); err != nil {
+			return
+		}
+		priorities = []string{"PRIORITY<=" + strconv.Itoa(p)}
+	}
+
+	open := func() (j *sdjournal.Journal, err error) {
+		if j, err = openJournal(path); err != nil {
+			return
+		}
+		if err = addMatches(j, conditions, matches, priorities); err != nil {
+			j.Close()
+			j = nil
+		}
+		return
+	}
+
+	if j, err = open(); err != nil {
 		return
 	}
 
-	if err = j.SeekTail(); err != nil {
+	var cursor string
+	var cursors *cursorFile
+	if path := os.Getenv("JOURNALD_CURSOR_FILE"); len(path) != 0 {
+		path = cursorPath(path, matches)
+		if cursor, err = readCursorFile(path); err != nil {
+			j.Close()
+			return
+		}
+		cursors = &cursorFile{path: path, cursor: cursor}
+	}
+
+	if err = seek(j, cursor, start); err != nil {
 		j.Close()
 		return
 	}
@@ -33,56 +141,490 @@ func NewReader() (r lib.Reader, err error) {
 		streamName = "CONTAINER_ID_FULL"
 	}
 
-	r = &reader{Journal: j, streamName: streamName}
+	var system bool
+	if s := os.Getenv("JOURNALD_SYSTEM"); len(s) != 0 {
+		if system, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_SYSTEM value: %s", s)
+			return
+		}
+	}
+
+	var extraFields map[string]string
+	if extraFields, err = parseExtraFields(os.Getenv("JOURNALD_EXTRA_FIELDS")); err != nil {
+		j.Close()
+		return
+	}
+
+	var allFields bool
+	if s := os.Getenv("JOURNALD_INCLUDE_ALL_FIELDS"); len(s) != 0 {
+		if allFields, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_INCLUDE_ALL_FIELDS value: %s", s)
+			return
+		}
+	}
+
+	var kubernetes bool
+	if s := os.Getenv("JOURNALD_KUBERNETES"); len(s) != 0 {
+		if kubernetes, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_KUBERNETES value: %s", s)
+			return
+		}
+	}
+
+	var instanceID string
+	var hostIDs bool
+	if s := os.Getenv("JOURNALD_HOST_IDS"); len(s) != 0 {
+		if hostIDs, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_HOST_IDS value: %s", s)
+			return
+		}
+		if hostIDs {
+			instanceID = ec2InstanceID()
+		}
+	}
+
+	var logfmt bool
+	if s := os.Getenv("JOURNALD_LOGFMT"); len(s) != 0 {
+		if logfmt, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_LOGFMT value: %s", s)
+			return
+		}
+	}
+
+	labels, allLabels := parseLabels(os.Getenv("JOURNALD_LABELS"))
+
+	var groupRules []groupRule
+	if groupRules, err = parseGroupRules(os.Getenv("JOURNALD_GROUP_REWRITE")); err != nil {
+		j.Close()
+		return
+	}
+
+	var exclusions map[string]map[string]bool
+	if exclusions, err = parseExclusions(os.Getenv("JOURNALD_EXCLUDE")); err != nil {
+		j.Close()
+		return
+	}
+
+	var excludedFields map[string]bool
+	if allFields {
+		excludedFields = parseExcludedFields(os.Getenv("JOURNALD_EXCLUDE_FIELDS"))
+	}
+
+	batchSize := defaultBatchSize
+	if s := os.Getenv("JOURNALD_BATCH_SIZE"); len(s) != 0 {
+		if batchSize, err = strconv.Atoi(s); err != nil || batchSize < 1 {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_BATCH_SIZE value: %s", s)
+			return
+		}
+	}
+
+	pollInterval := defaultPollInterval
+	if s := os.Getenv("JOURNALD_POLL_INTERVAL"); len(s) != 0 {
+		if pollInterval, err = time.ParseDuration(s); err != nil || pollInterval <= 0 {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_POLL_INTERVAL value: %s", s)
+			return
+		}
+	}
+
+	var joiners []joiner
+	if s := os.Getenv("JOURNALD_MULTILINE_JSON"); len(s) != 0 {
+		var enabled bool
+		if enabled, err = strconv.ParseBool(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_MULTILINE_JSON value: %s", s)
+			return
+		}
+
+		timeout := 2 * time.Second
+		if s := os.Getenv("JOURNALD_MULTILINE_JSON_TIMEOUT"); len(s) != 0 {
+			if timeout, err = time.ParseDuration(s); err != nil || timeout <= 0 {
+				j.Close()
+				err = fmt.Errorf("invalid JOURNALD_MULTILINE_JSON_TIMEOUT value: %s", s)
+				return
+			}
+		}
+
+		if enabled {
+			joiners = append(joiners, newJSONJoiner(timeout))
+		}
+	}
+
+	if s := os.Getenv("JOURNALD_MULTILINE_START"); len(s) != 0 {
+		var start *regexp.Regexp
+		if start, err = regexp.Compile(s); err != nil {
+			j.Close()
+			err = fmt.Errorf("invalid JOURNALD_MULTILINE_START value: %s", s)
+			return
+		}
+
+		timeout := 2 * time.Second
+		if s := os.Getenv("JOURNALD_MULTILINE_TIMEOUT"); len(s) != 0 {
+			if timeout, err = time.ParseDuration(s); err != nil || timeout <= 0 {
+				j.Close()
+				err = fmt.Errorf("invalid JOURNALD_MULTILINE_TIMEOUT value: %s", s)
+				return
+			}
+		}
+
+		joiners = append(joiners, newLineJoiner(start, timeout))
+	}
+
+	hostname, _ := os.Hostname()
+
+	r = &reader{
+		Journal:        j,
+		open:           open,
+		start:          start,
+		cursor:         cursor,
+		cursors:        cursors,
+		streamName:     streamName,
+		system:         system,
+		kubernetes:     kubernetes,
+		hostIDs:        hostIDs,
+		logfmt:         logfmt,
+		instanceID:     instanceID,
+		labels:         labels,
+		allLabels:      allLabels,
+		extraFields:    extraFields,
+		excludedFields: excludedFields,
+		exclusions:     exclusions,
+		groupRules:     groupRules,
+		joiners:        joiners,
+		hostname:       hostname,
+		coredumpGroup:  os.Getenv("JOURNALD_COREDUMP_GROUP"),
+		auditGroup:     os.Getenv("JOURNALD_AUDIT_GROUP"),
+		batchSize:      batchSize,
+		pollInterval:   pollInterval,
+		batch:          make([]lib.Message, 0, batchSize),
+	}
 	return
 }
 
+// openJournal opens the journal of the system when path is empty, the journal
+// files of the directory when path is a directory, like a /var/log/journal
+// mounted from the host, or else the comma separated list of journal files.
+func openJournal(path string) (*sdjournal.Journal, error) {
+	if len(path) == 0 {
+		return sdjournal.NewJournal()
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return sdjournal.NewJournalFromDir(path)
+	}
+
+	return sdjournal.NewJournalFromFiles(strings.Split(path, ",")...)
+}
+
 type reader struct {
+	// Last time the journal was checked for new entries, first in the struct
+	// so it's aligned for atomic operations.
+	polled int64
+
 	streamName string
+	system     bool
+	kubernetes bool
 	stopped    int32
+	stopAtEnd  int32
 	*sdjournal.Journal
+
+	// Journal fields copied to the event data, indexed by field name. When
+	// excludedFields is set all the other fields except these ones are
+	// copied as well.
+	extraFields    map[string]string
+	excludedFields map[string]bool
+
+	// Whether messages made of key=value pairs are parsed into the fields of
+	// the events.
+	logfmt bool
+
+	// Whether the boot, machine and EC2 instance IDs are recorded, the latter
+	// is fetched once when the reader is created.
+	hostIDs    bool
+	instanceID string
+
+	// Docker labels copied to the event data, indexed by journal field,
+	// allLabels is set when all of them are copied.
+	labels    map[string]string
+	allLabels bool
+
+	// Values of journal fields identifying entries that are skipped, like the
+	// ones written by ecs-logs itself.
+	exclusions map[string]map[string]bool
+
+	// Rewrite the groups taken from CONTAINER_TAG, so they don't change with
+	// the image tags for example.
+	groupRules []groupRule
+
+	// Name of the host, the stream of the entries that have no _HOSTNAME in
+	// system mode.
+	hostname string
+
+	// Groups of the crash and audit events, which aren't forwarded when
+	// empty.
+	coredumpGroup string
+	auditGroup    string
+
+	// Reassemble the messages spread over multiple entries, the messages
+	// completed by a joiner go through the next ones.
+	joiners []joiner
+
+	// Fragments of the lines that docker split because they were too long,
+	// indexed by group and stream.
+	partials map[string]partialMessage
+
+	// Maximum number of entries read at once, and how long to wait for new
+	// entries at the end of the journal.
+	batchSize    int
+	pollInterval time.Duration
+
+	// Opens the journal again when reading it failed, the reader then resumes
+	// from the cursor of the last entry read, or from the start position if
+	// there was none.
+	open   func() (*sdjournal.Journal, error)
+	start  string
+	cursor string
+
+	// Saves the cursor of the last entry delivered when JOURNALD_CURSOR_FILE
+	// is set, the reader then starts after it.
+	cursors *cursorFile
+
+	// Messages read from the journal, the position of the next one to be
+	// returned by ReadMessage, and the error that interrupted the last batch
+	// (if any).
+	batch []lib.Message
+	index int
+	err   error
+}
+
+func (r *reader) StopAtEnd() {
+	atomic.StoreInt32(&r.stopAtEnd, 1)
+}
+
+// LastPoll returns the last time the reader checked the journal for new
+// entries.
+func (r *reader) LastPoll() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&r.polled))
 }
 
 func (r *reader) Close() (err error) {
 	atomic.StoreInt32(&r.stopped, 1)
+
+	if r.cursors != nil {
+		r.cursors.close()
+	}
+
 	return
 }
 
+// Ack saves the cursor of the last entry delivered when JOURNALD_CURSOR_FILE
+// is set.
+func (r *reader) Ack(cursor string) {
+	if r.cursors != nil {
+		r.cursors.ack(cursor, time.Now())
+	}
+}
+
 func (r *reader) ReadMessage() (msg lib.Message, err error) {
 	for atomic.LoadInt32(&r.stopped) == 0 {
+		var eof bool
+
+		if r.index < len(r.batch) {
+			msg = r.batch[r.index]
+			r.index++
+			return
+		}
+
+		if err, r.err = r.err, nil; err != nil {
+			if err = r.reopen(err); err != nil {
+				return
+			}
+			continue
+		}
+
+		eof, err = r.readBatch()
+		atomic.StoreInt64(&r.polled, time.Now().UnixNano())
+
+		if err != nil {
+			if err = r.reopen(err); err != nil {
+				return
+			}
+			continue
+		}
+
+		if eof && len(r.batch) == 0 {
+			if atomic.LoadInt32(&r.stopAtEnd) != 0 {
+				now := time.Now()
+				r.batch = join(r.joiners, r.expirePartials(now, true), now)
+
+				if r.batch = append(r.batch, expire(r.joiners, now, true)...); len(r.batch) != 0 {
+					continue
+				}
+				break
+			}
+			r.Wait(r.pollInterval)
+		}
+	}
+
+	r.Journal.Close()
+	err = io.EOF
+	return
+}
+
+// readBatch retrieves up to r.batchSize entries from the journal, converting
+// each of them into a message with a single call to GetEntry instead of
+// querying the fields one by one. The returned eof flag is set when there
+// were no more entries to read.
+func (r *reader) readBatch() (eof bool, err error) {
+	r.batch, r.index = r.batch[:0], 0
+
+	for i := 0; i != r.batchSize; i++ {
 		var cur int
+		var ent *sdjournal.JournalEntry
+		var msg lib.Message
 		var ok bool
 
 		if cur, err = r.Next(); err != nil {
-			return
+			err = journalError{err}
+			break
 		}
 
 		if cur == 0 {
-			r.Wait(1 * time.Second)
+			eof = true
+			break
+		}
+
+		if ent, err = r.GetEntry(); err != nil {
+			err = journalError{err}
+			break
+		}
+
+		r.cursor = ent.Cursor
+
+		if msg, ok, err = r.getMessage(entry{ent}); err != nil {
+			break
+		}
+
+		if !ok {
 			continue
 		}
 
-		if msg, ok, err = r.getMessage(); ok || err != nil {
+		r.batch = append(r.batch, join(r.joiners, []lib.Message{msg}, time.Now())...)
+	}
+
+	now := time.Now()
+	r.batch = append(r.batch, join(r.joiners, r.expirePartials(now, false), now)...)
+	r.batch = append(r.batch, expire(r.joiners, now, false)...)
+
+	if err != nil && len(r.batch) != 0 {
+		// Deliver the messages that were successfully read before reporting
+		// the error.
+		r.err, err = err, nil
+	}
+
+	return
+}
+
+// journalError is returned by readBatch when reading the journal failed, as
+// opposed to an entry being invalid.
+type journalError struct {
+	error
+}
+
+// reopen replaces the journal after reading it failed with a journalError,
+// for example when files were rotated or removed by a vacuum, and seeks back
+// to where the reader was. Other errors are returned as is.
+func (r *reader) reopen(cause error) (err error) {
+	if _, ok := cause.(journalError); !ok {
+		return cause
+	}
+
+	log.WithError(cause).Warn("reopening the journal after it failed to be read")
+
+	for attempt := 1; ; attempt++ {
+		var j *sdjournal.Journal
+
+		if j, err = r.open(); err == nil {
+			if err = r.seek(j); err == nil {
+				r.Journal.Close()
+				r.Journal = j
+				return
+			}
+			j.Close()
+		}
+
+		if attempt == reopenAttempts || atomic.LoadInt32(&r.stopped) != 0 {
 			return
 		}
+
+		time.Sleep(r.pollInterval)
+	}
+}
+
+// seek positions j after the last entry read, the entry itself may have been
+// removed in which case j is positioned before the next one.
+func (r *reader) seek(j *sdjournal.Journal) error {
+	return seek(j, r.cursor, r.start)
+}
+
+// seek moves the journal after the entry at cursor, or to the start position
+// when cursor is empty.
+func seek(j *sdjournal.Journal, cursor string, start string) (err error) {
+	if len(cursor) == 0 {
+		return seekStart(j, start, time.Now())
+	}
+
+	if err = j.SeekCursor(cursor); err != nil {
+		return
+	}
+
+	if _, err = j.Next(); err != nil {
+		return
+	}
+
+	if j.TestCursor(cursor) != nil {
+		_, err = j.Previous()
 	}
 
-	r.Journal.Close()
-	err = io.EOF
 	return
 }
 
-func (r *reader) getMessage() (msg lib.Message, ok bool, err error) {
-	if msg.Group, err = r.GetDataValue("CONTAINER_TAG"); len(msg.Group) == 0 {
-		// No CONTAINER_TAG, this must be a journal message from a process that
-		// isn't running in a docker container.
-		err = nil
+func (r *reader) getMessage(e entry) (msg lib.Message, ok bool, err error) {
+	var specialKey string
+	var specialFields specialFields
+
+	if r.excluded(e) {
 		return
 	}
 
-	if msg.Stream, err = r.GetDataValue(r.streamName); err != nil {
+	if msg.Group, specialKey, specialFields = r.specialEntry(e); len(msg.Group) != 0 {
+		// Crash and audit events are written by systemd-coredump and auditd
+		// to their own groups.
+		msg.Stream = r.entryHost(e)
+	} else if msg.Group = e.getString("CONTAINER_TAG"); len(msg.Group) == 0 {
+		// No CONTAINER_TAG, this must be a journal message from a process that
+		// isn't running in a docker container, these are only forwarded in
+		// system mode.
+		if !r.system {
+			return
+		}
+
+		if msg.Group = e.getString("_SYSTEMD_UNIT"); len(msg.Group) == 0 {
+			if msg.Group = e.getString("SYSLOG_IDENTIFIER"); len(msg.Group) == 0 {
+				return
+			}
+		}
+
+		msg.Stream = r.entryHost(e)
+	} else if msg.Stream = r.getStream(e); len(msg.Stream) == 0 {
 		// Fallback to CONTAINER_ID_FULL
-		if msg.Stream, err = r.GetDataValue("CONTAINER_ID_FULL"); err != nil {
+		if msg.Stream = e.getString("CONTAINER_ID_FULL"); len(msg.Stream) == 0 {
 			// There's a CONTAINER_TAG but no CONTAINER_ID_FULL, something is seriously
 			// wrong here, the log docker log driver is misbehaving.
 			err = fmt.Errorf("missing CONTAINER_ID_FULL in message with CONTAINER_TAG=%s", msg.Group)
@@ -91,59 +633,238 @@ func (r *reader) getMessage() (msg lib.Message, ok bool, err error) {
 		}
 	}
 
+	if len(specialKey) == 0 && msg.Group == e.getString("CONTAINER_TAG") {
+		msg.Group = rewriteGroup(r.groupRules, msg.Group)
+	}
+
 	msg.Stream = sanitizeStreamName(msg.Stream)
 
-	message := r.getString("MESSAGE")
+	message := e.getString("MESSAGE")
+
+	// Docker splits long lines in multiple entries, all but the last one
+	// having CONTAINER_PARTIAL_MESSAGE set, which are joined back in a single
+	// message.
+	key := msg.Group + "/" + msg.Stream
+	partial := e.getString("CONTAINER_PARTIAL_MESSAGE") == "true"
+
+	if p, found := r.partials[key]; found || partial {
+		since := time.Now()
+
+		if found {
+			message, since = p.message+message, p.since
+		}
+
+		if partial && len(message) < maxPartialSize {
+			if r.partials == nil {
+				r.partials = make(map[string]partialMessage)
+			}
+			r.partials[key] = partialMessage{
+				msg:           msg,
+				message:       message,
+				entry:         e,
+				specialKey:    specialKey,
+				specialFields: specialFields,
+				since:         since,
+			}
+			return
+		}
+
+		delete(r.partials, key)
+	}
+
+	msg, ok = r.makeMessage(e, msg, message, specialKey, specialFields), true
+	return
+}
+
+// partialMessage is the beginning of a line that docker split in multiple
+// entries because it was too long, and the last fragment received.
+type partialMessage struct {
+	msg           lib.Message
+	message       string
+	entry         entry
+	specialKey    string
+	specialFields specialFields
+	since         time.Time
+}
+
+// expirePartials returns the messages of the lines split by docker whose last
+// fragment wasn't received within partialTimeout, or of all of them when force
+// is set, so they aren't held forever or lost when the reader stops.
+func (r *reader) expirePartials(now time.Time, force bool) (msgs []lib.Message) {
+	var expired []partialMessage
+
+	for key, p := range r.partials {
+		if force || now.Sub(p.since) >= partialTimeout {
+			expired = append(expired, p)
+			delete(r.partials, key)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].since.Before(expired[j].since)
+	})
 
+	for _, p := range expired {
+		msgs = append(msgs, r.makeMessage(p.entry, p.msg, p.message, p.specialKey, p.specialFields))
+	}
+
+	return
+}
+
+// makeMessage completes msg, which has its group and stream set, with the
+// message and the fields of the entry e.
+func (r *reader) makeMessage(e entry, msg lib.Message, message string, specialKey string, specialFields specialFields) lib.Message {
 	if msg.Event.Level == ecslogs.NONE {
-		msg.Event.Level = r.getPriority()
+		msg.Event.Level = e.getPriority()
 	}
 
 	if len(msg.Event.Info.Host) == 0 {
-		msg.Event.Info.Host = r.getString("_HOSTNAME")
+		msg.Event.Info.Host = e.getString("_HOSTNAME")
 	}
 
 	if len(msg.Event.Info.Source) == 0 {
 		msg.Event.Info.Source = (ecslogs.FuncInfo{
-			File: r.getString("CODE_FILE"),
-			Func: r.getString("CODE_FUNC"),
-			Line: r.getInt("CODE_LINE"),
+			File: e.getString("CODE_FILE"),
+			Func: e.getString("CODE_FUNC"),
+			Line: e.getInt("CODE_LINE"),
 		}).String()
 	}
 
 	if len(msg.Event.Info.ID) == 0 {
-		msg.Event.Info.ID = r.getString("MESSAGE_ID")
+		msg.Event.Info.ID = e.getString("MESSAGE_ID")
 	}
 
 	if msg.Event.Info.PID == 0 {
-		msg.Event.Info.PID = r.getInt("_PID")
+		msg.Event.Info.PID = e.getInt("_PID")
 	}
 
 	if msg.Event.Info.GID == 0 {
-		msg.Event.Info.GID = r.getInt("_GID")
+		msg.Event.Info.GID = e.getInt("_GID")
 	}
 
 	if msg.Event.Info.UID == 0 {
-		msg.Event.Info.UID = r.getInt("_UID")
+		msg.Event.Info.UID = e.getInt("_UID")
 	}
 
 	if msg.Event.Time == (time.Time{}) {
-		msg.Event.Time = r.getTime()
+		msg.Event.Time = e.getTime()
 	}
 
 	msg.Event = ecslogs.MakeEvent(msg.Event.Level, message)
+	msg.Cursor = e.Cursor
 
-	ok = true
-	return
+	if r.logfmt {
+		if fields, ok := parseLogfmt(message); ok {
+			applyLogfmt(&msg.Event, fields)
+		}
+	}
+
+	if len(specialKey) != 0 {
+		if msg.Event.Data == nil {
+			msg.Event.Data = ecslogs.EventData{}
+		}
+		msg.Event.Data[specialKey] = specialData(e, specialFields)
+	}
+
+	if r.kubernetes {
+		if k8s, ok := kubernetesMetadata(e.getString("CONTAINER_NAME")); ok {
+			if msg.Event.Data == nil {
+				msg.Event.Data = ecslogs.EventData{}
+			}
+			msg.Event.Data[kubernetesKey] = k8s
+		}
+	}
+
+	if r.hostIDs {
+		if ids, ok := hostIDs(e, r.instanceID); ok {
+			if msg.Event.Data == nil {
+				msg.Event.Data = ecslogs.EventData{}
+			}
+			msg.Event.Data[hostKey] = ids
+		}
+	}
+
+	if r.labels != nil || r.allLabels {
+		if labels, ok := containerLabels(e, r.labels, r.allLabels); ok {
+			if msg.Event.Data == nil {
+				msg.Event.Data = ecslogs.EventData{}
+			}
+			msg.Event.Data[lib.LabelsKey] = labels
+		}
+	}
+
+	for field, v := range e.Fields {
+		key, ok := r.extraFields[field]
+
+		if !ok {
+			if r.excludedFields == nil || r.excludedFields[field] {
+				continue
+			}
+			key = field
+		}
+
+		if msg.Event.Data == nil {
+			msg.Event.Data = ecslogs.EventData{}
+		}
+		msg.Event.Data[key] = v
+	}
+
+	return msg
 }
 
-func (r *reader) getInt(k string) (v int) {
-	v, _ = strconv.Atoi(r.getString(k))
+// entryHost returns the host that wrote e, the journal may have entries
+// without _HOSTNAME, for example those forwarded from other systems.
+func (r *reader) entryHost(e entry) string {
+	if host := e.getString("_HOSTNAME"); len(host) != 0 {
+		return host
+	}
+	return r.hostname
+}
+
+// excluded returns whether e matches one of the exclusions of the reader.
+func (r *reader) excluded(e entry) bool {
+	for field, values := range r.exclusions {
+		if v, ok := e.Fields[field]; ok && values[v] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reader) getStream(e entry) string {
+	if r.streamName != StreamNameWithID {
+		return e.getString(r.streamName)
+	}
+
+	name := e.getString("CONTAINER_NAME")
+	id := e.getString("CONTAINER_ID")
+
+	if len(id) == 0 {
+		if id = e.getString("CONTAINER_ID_FULL"); len(id) > 12 {
+			id = id[:12]
+		}
+	}
+
+	if len(name) == 0 || len(id) == 0 {
+		return ""
+	}
+
+	return name + "-" + id
+}
+
+// entry wraps a journal entry retrieved with GetEntry and exposes typed
+// accessors to its fields.
+type entry struct {
+	*sdjournal.JournalEntry
+}
+
+func (e entry) getInt(k string) (v int) {
+	v, _ = strconv.Atoi(e.getString(k))
 	return
 }
 
-func (r *reader) getTime() (t time.Time) {
-	if u, e := r.GetRealtimeUsec(); e == nil {
+func (e entry) getTime() (t time.Time) {
+	if u := e.RealtimeTimestamp; u != 0 {
 		t = time.Unix(int64(u/1000000), int64((u%1000000)*1000))
 	} else {
 		t = time.Now()
@@ -151,8 +872,8 @@ func (r *reader) getTime() (t time.Time) {
 	return
 }
 
-func (r *reader) getPriority() (p ecslogs.Level) {
-	if v, e := strconv.Atoi(r.getString("PRIORITY")); e != nil {
+func (e entry) getPriority() (p ecslogs.Level) {
+	if v, err := strconv.Atoi(e.getString("PRIORITY")); err != nil {
 		p = ecslogs.INFO
 	} else {
 		p = ecslogs.MakeLevel(v)
@@ -160,8 +881,36 @@ func (r *reader) getPriority() (p ecslogs.Level) {
 	return
 }
 
-func (r *reader) getString(k string) (s string) {
-	s, _ = r.GetDataValue(k)
+func (e entry) getString(k string) string {
+	return e.Fields[k]
+}
+
+// parseExtraFields parses a comma separated list of journal fields, each
+// optionally followed by a colon and the key it's copied to in the event data.
+// The keys reserved by ecs-logs can't be the target of a field.
+func parseExtraFields(s string) (fields map[string]string, err error) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); len(f) == 0 {
+			continue
+		}
+
+		field, key := f, f
+
+		if i := strings.IndexByte(f, ':'); i >= 0 {
+			field, key = f[:i], f[i+1:]
+		}
+
+		if len(field) == 0 || len(key) == 0 || strings.HasPrefix(key, lib.ProvenanceKey) {
+			err = fmt.Errorf("invalid JOURNALD_EXTRA_FIELDS value: %s", s)
+			return
+		}
+
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+
+		fields[field] = key
+	}
 	return
 }
 
@@ -0,0 +1,356 @@
+// +build linux
+
+package journald
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+)
+
+func TestGetMessageSystem(t *testing.T) {
+	tests := []struct {
+		system bool
+		fields map[string]string
+		group  string
+		stream string
+	}{
+		{
+			system: false,
+			fields: map[string]string{"_SYSTEMD_UNIT": "sshd.service", "_HOSTNAME": "host-1"},
+		},
+		{
+			system: true,
+			fields: map[string]string{"_SYSTEMD_UNIT": "sshd.service", "SYSLOG_IDENTIFIER": "sshd", "_HOSTNAME": "host-1"},
+			group:  "sshd.service",
+			stream: "host-1",
+		},
+		{
+			system: true,
+			fields: map[string]string{"SYSLOG_IDENTIFIER": "kernel", "_HOSTNAME": "host-1"},
+			group:  "kernel",
+			stream: "host-1",
+		},
+		{
+			system: true,
+			fields: map[string]string{"SYSLOG_IDENTIFIER": "kernel"},
+			group:  "kernel",
+			stream: "local-host",
+		},
+		{
+			system: true,
+			fields: map[string]string{"CONTAINER_TAG": "api", "CONTAINER_ID_FULL": "1234", "_SYSTEMD_UNIT": "docker.service"},
+			group:  "api",
+			stream: "1234",
+		},
+		{
+			system: true,
+			fields: map[string]string{"_HOSTNAME": "host-1"},
+		},
+	}
+
+	for _, test := range tests {
+		r := &reader{streamName: "CONTAINER_ID_FULL", system: test.system, hostname: "local-host"}
+		msg, ok, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: test.fields}})
+
+		if err != nil {
+			t.Errorf("%v: %s", test.fields, err)
+			continue
+		}
+
+		if ok != (len(test.group) != 0) {
+			t.Errorf("%v: invalid ok: %t", test.fields, ok)
+			continue
+		}
+
+		if msg.Group != test.group || msg.Stream != test.stream {
+			t.Errorf("%v: invalid group and stream: %s/%s", test.fields, msg.Group, msg.Stream)
+		}
+	}
+}
+
+func TestGetMessageExtraFields(t *testing.T) {
+	fields, err := parseExtraFields("_SYSTEMD_UNIT:unit, _COMM:comm,_PID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &reader{streamName: "CONTAINER_ID_FULL", extraFields: fields}
+	msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: map[string]string{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+		"_SYSTEMD_UNIT":     "docker.service",
+		"_PID":              "42",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(msg.Event.Data, ecslogs.EventData{"unit": "docker.service", "_PID": "42"}) {
+		t.Errorf("invalid event data: %v", msg.Event.Data)
+	}
+
+	for _, s := range []string{"_COMM:", ":comm", "_COMM:_ecs_logs_host"} {
+		if _, err := parseExtraFields(s); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
+
+func TestGetMessageCursor(t *testing.T) {
+	r := &reader{streamName: "CONTAINER_ID_FULL"}
+	msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Cursor: "s=1;i=2", Fields: map[string]string{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Cursor != "s=1;i=2" {
+		t.Errorf("invalid message cursor: %q", msg.Cursor)
+	}
+}
+
+func TestGetMessageExcluded(t *testing.T) {
+	exclusions, err := parseExclusions("CONTAINER_TAG=ecs-logs, _COMM=ecs-logs,_COMM=journalctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fields   map[string]string
+		excluded bool
+	}{
+		{map[string]string{"CONTAINER_TAG": "api", "CONTAINER_ID_FULL": "1234", "_COMM": "node"}, false},
+		{map[string]string{"CONTAINER_TAG": "ecs-logs", "CONTAINER_ID_FULL": "1234"}, true},
+		{map[string]string{"CONTAINER_TAG": "api", "CONTAINER_ID_FULL": "1234", "_COMM": "journalctl"}, true},
+		{map[string]string{"_SYSTEMD_UNIT": "ecs-logs.service", "_COMM": "ecs-logs", "_HOSTNAME": "host-1"}, true},
+	}
+
+	for _, test := range tests {
+		r := &reader{streamName: "CONTAINER_ID_FULL", system: true, exclusions: exclusions}
+		_, ok, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: test.fields}})
+
+		if err != nil {
+			t.Errorf("%v: %s", test.fields, err)
+			continue
+		}
+
+		if ok == test.excluded {
+			t.Errorf("%v: invalid ok: %t", test.fields, ok)
+		}
+	}
+
+	for _, s := range []string{"ecs-logs", "=ecs-logs"} {
+		if _, err := parseExclusions(s); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
+
+func TestGetMessageGroupRewrite(t *testing.T) {
+	rules, err := parseGroupRules("registry.example.com/*:*=$1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fields map[string]string
+		group  string
+	}{
+		{
+			fields: map[string]string{"CONTAINER_TAG": "registry.example.com/api:1.2.3", "CONTAINER_ID_FULL": "1234"},
+			group:  "api",
+		},
+		{
+			// Only the groups taken from CONTAINER_TAG are rewritten.
+			fields: map[string]string{"_SYSTEMD_UNIT": "registry.example.com/api:1.2.3", "_HOSTNAME": "host-1"},
+			group:  "registry.example.com/api:1.2.3",
+		},
+	}
+
+	for _, test := range tests {
+		r := &reader{streamName: "CONTAINER_ID_FULL", system: true, groupRules: rules}
+		msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: test.fields}})
+
+		if err != nil {
+			t.Errorf("%v: %s", test.fields, err)
+			continue
+		}
+
+		if msg.Group != test.group {
+			t.Errorf("%v: invalid group: %s", test.fields, msg.Group)
+		}
+	}
+}
+
+func TestGetMessageAllFields(t *testing.T) {
+	r := &reader{
+		streamName:     "CONTAINER_ID_FULL",
+		extraFields:    map[string]string{"_COMM": "comm"},
+		excludedFields: parseExcludedFields("_PID, "),
+	}
+	msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: map[string]string{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+		"MESSAGE":           "hello",
+		"_COMM":             "node",
+		"_PID":              "42",
+		"_CMDLINE":          "node --token=secret",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(msg.Event.Data, ecslogs.EventData{
+		"CONTAINER_TAG":     "api",
+		"CONTAINER_ID_FULL": "1234",
+		"comm":              "node",
+	}) {
+		t.Errorf("invalid event data: %v", msg.Event.Data)
+	}
+}
+
+func TestGetMessagePartial(t *testing.T) {
+	r := &reader{streamName: "CONTAINER_ID_FULL"}
+
+	var msgs []string
+	for _, fields := range []map[string]string{
+		{"CONTAINER_ID_FULL": "1", "MESSAGE": `{"a":`, "CONTAINER_PARTIAL_MESSAGE": "true"},
+		{"CONTAINER_ID_FULL": "2", "MESSAGE": "hello"},
+		{"CONTAINER_ID_FULL": "1", "MESSAGE": `"b",`, "CONTAINER_PARTIAL_MESSAGE": "true"},
+		{"CONTAINER_ID_FULL": "1", "MESSAGE": `"c":1}`, "CONTAINER_PARTIAL_LAST": "true"},
+		{"CONTAINER_ID_FULL": "1", "MESSAGE": "world"},
+	} {
+		fields["CONTAINER_TAG"] = "api"
+
+		msg, ok, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: fields}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			msgs = append(msgs, msg.Stream+" "+msg.Event.Message)
+		}
+	}
+
+	if !reflect.DeepEqual(msgs, []string{"2 hello", `1 {"a":"b","c":1}`, "1 world"}) {
+		t.Errorf("invalid messages: %q", msgs)
+	}
+}
+
+func TestExpirePartials(t *testing.T) {
+	r := &reader{streamName: "CONTAINER_ID_FULL"}
+
+	for _, fields := range []map[string]string{
+		{"CONTAINER_TAG": "api", "CONTAINER_ID_FULL": "1", "MESSAGE": "hello ", "CONTAINER_PARTIAL_MESSAGE": "true"},
+		{"CONTAINER_TAG": "api", "CONTAINER_ID_FULL": "1", "MESSAGE": "world", "CONTAINER_PARTIAL_MESSAGE": "true"},
+	} {
+		if _, ok, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: fields}}); ok || err != nil {
+			t.Fatalf("partial messages must be held (%v)", err)
+		}
+	}
+
+	now := time.Now()
+
+	if msgs := r.expirePartials(now, false); len(msgs) != 0 {
+		t.Errorf("partial messages must be held until the timeout: %v", msgs)
+	}
+
+	msgs := r.expirePartials(now.Add(partialTimeout), false)
+
+	if len(msgs) != 1 || msgs[0].Event.Message != "hello world" || msgs[0].Stream != "1" {
+		t.Errorf("invalid expired messages: %+v", msgs)
+	}
+
+	if len(r.partials) != 0 {
+		t.Errorf("expired partial messages must be removed: %v", r.partials)
+	}
+}
+
+func TestGetMessageStreamNameWithID(t *testing.T) {
+	tests := []struct {
+		fields map[string]string
+		stream string
+	}{
+		{
+			fields: map[string]string{"CONTAINER_NAME": "ecs-api-1", "CONTAINER_ID": "0123456789ab", "CONTAINER_ID_FULL": "0123456789abcdef"},
+			stream: "ecs-api-1-0123456789ab",
+		},
+		{
+			fields: map[string]string{"CONTAINER_NAME": "ecs-api-1", "CONTAINER_ID_FULL": "0123456789abcdef"},
+			stream: "ecs-api-1-0123456789ab",
+		},
+		{
+			fields: map[string]string{"CONTAINER_ID_FULL": "0123456789abcdef"},
+			stream: "0123456789abcdef",
+		},
+	}
+
+	for _, test := range tests {
+		test.fields["CONTAINER_TAG"] = "api"
+
+		r := &reader{streamName: StreamNameWithID}
+		msg, _, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: test.fields}})
+
+		if err != nil {
+			t.Errorf("%v: %s", test.fields, err)
+			continue
+		}
+
+		if msg.Stream != test.stream {
+			t.Errorf("%v: invalid stream: %s", test.fields, msg.Stream)
+		}
+	}
+}
+
+func TestGetMessageSpecial(t *testing.T) {
+	r := &reader{coredumpGroup: "crashes", auditGroup: "audit"}
+
+	tests := []struct {
+		fields map[string]string
+		group  string
+		key    string
+		data   ecslogs.EventData
+	}{
+		{
+			fields: map[string]string{"_HOSTNAME": "host-1", "COREDUMP_EXE": "/usr/bin/app", "COREDUMP_SIGNAL_NAME": "SIGSEGV", "COREDUMP_ENVIRON": "TOKEN=secret", "COREDUMP": "\x7fELF", "_PID": "1"},
+			group:  "crashes",
+			key:    coredumpKey,
+			data:   ecslogs.EventData{"exe": "/usr/bin/app", "signal_name": "SIGSEGV"},
+		},
+		{
+			fields: map[string]string{"_HOSTNAME": "host-1", "_TRANSPORT": "audit", "_AUDIT_TYPE": "1300", "AUDIT_FIELD_SYSCALL": "execve"},
+			group:  "audit",
+			key:    auditKey,
+			data:   ecslogs.EventData{"type": "1300", "syscall": "execve"},
+		},
+	}
+
+	for _, test := range tests {
+		msg, ok, err := r.getMessage(entry{&sdjournal.JournalEntry{Fields: test.fields}})
+
+		if err != nil || !ok {
+			t.Errorf("%v: the message must be forwarded (%v)", test.fields, err)
+			continue
+		}
+
+		if msg.Group != test.group || msg.Stream != "host-1" {
+			t.Errorf("%v: invalid group and stream: %s/%s", test.fields, msg.Group, msg.Stream)
+		}
+
+		if !reflect.DeepEqual(msg.Event.Data[test.key], test.data) {
+			t.Errorf("%v: invalid event data: %v", test.fields, msg.Event.Data)
+		}
+	}
+
+	r.coredumpGroup = ""
+
+	if _, ok, _ := r.getMessage(entry{&sdjournal.JournalEntry{Fields: tests[0].fields}}); ok {
+		t.Error("crash events must not be forwarded when disabled")
+	}
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package journald
+
+import (
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// specialFields selects the fields of the special entries recorded in the
+// event data.
+type specialFields struct {
+	prefixes []string
+
+	// When set, only these fields are recorded.
+	allowed map[string]bool
+}
+
+var (
+	// The entries of systemd-coredump carry the environment, memory maps and
+	// content of the crashed process, which may be large or hold secrets,
+	// only the fields describing the crash are recorded.
+	coredumpFields = specialFields{
+		prefixes: []string{"COREDUMP_"},
+		allowed: map[string]bool{
+			"COREDUMP_EXE":         true,
+			"COREDUMP_SIGNAL":      true,
+			"COREDUMP_SIGNAL_NAME": true,
+			"COREDUMP_PID":         true,
+			"COREDUMP_UID":         true,
+			"COREDUMP_COMM":        true,
+			"COREDUMP_CMDLINE":     true,
+		},
+	}
+
+	auditFields = specialFields{
+		prefixes: []string{"_AUDIT_", "AUDIT_FIELD_"},
+	}
+)
+
+// Reserved keys of the event data under which the specialized fields of the
+// crashes and audit events are recorded.
+const (
+	coredumpKey = "_ecs_logs_coredump"
+	auditKey    = "_ecs_logs_audit"
+)
+
+// specialEntry returns the group of the entries written by systemd-coredump
+// and auditd when they are forwarded, the key of the event data under which
+// their specialized fields are recorded, and these fields.
+func (r *reader) specialEntry(e entry) (group string, key string, fields specialFields) {
+	switch {
+	case len(r.coredumpGroup) != 0 && len(e.getString("COREDUMP_EXE")) != 0:
+		return r.coredumpGroup, coredumpKey, coredumpFields
+
+	case len(r.auditGroup) != 0 && e.getString("_TRANSPORT") == "audit":
+		return r.auditGroup, auditKey, auditFields
+	}
+	return
+}
+
+// specialData returns the fields of e selected by fields, without their prefix
+// and lower cased, for example COREDUMP_EXE becomes exe.
+func specialData(e entry, fields specialFields) ecslogs.EventData {
+	data := ecslogs.EventData{}
+
+	for field, v := range e.Fields {
+		if fields.allowed != nil && !fields.allowed[field] {
+			continue
+		}
+
+		for _, prefix := range fields.prefixes {
+			if strings.HasPrefix(field, prefix) {
+				data[strings.ToLower(field[len(prefix):])] = v
+				break
+			}
+		}
+	}
+
+	return data
+}
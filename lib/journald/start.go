@@ -0,0 +1,65 @@
+// +build linux
+
+package journald
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// seekStart moves the journal to the position set by JOURNALD_START, which is
+// "tail" (the default) to read only new entries, "head" to read the whole
+// journal, or "since=" followed by a RFC 3339 time or a duration to read the
+// entries written since that time, or for that long.
+func seekStart(j *sdjournal.Journal, start string, now time.Time) (err error) {
+	var since time.Time
+
+	if since, err = parseStart(start, now); err != nil {
+		return
+	}
+
+	switch {
+	case len(start) == 0 || start == "tail":
+		err = j.SeekTail()
+	case start == "head":
+		err = j.SeekHead()
+	default:
+		err = j.SeekRealtimeUsec(uint64(since.UnixNano() / 1000))
+	}
+
+	return
+}
+
+// parseStart validates the start position and returns the time it refers to
+// if it is a "since=" position.
+func parseStart(start string, now time.Time) (since time.Time, err error) {
+	switch start {
+	case "", "tail", "head":
+		return
+	}
+
+	if !strings.HasPrefix(start, "since=") {
+		err = fmt.Errorf("invalid JOURNALD_START value: %s", start)
+		return
+	}
+
+	s := start[len("since="):]
+
+	if d, e := time.ParseDuration(s); e == nil {
+		if d < 0 {
+			err = fmt.Errorf("invalid JOURNALD_START value: %s", start)
+		} else {
+			since = now.Add(-d)
+		}
+		return
+	}
+
+	if since, err = time.Parse(time.RFC3339, s); err != nil {
+		err = fmt.Errorf("invalid JOURNALD_START value: %s", start)
+	}
+
+	return
+}
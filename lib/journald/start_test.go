@@ -0,0 +1,42 @@
+// +build linux
+
+package journald
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStart(t *testing.T) {
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		start string
+		since time.Time
+	}{
+		{"", time.Time{}},
+		{"tail", time.Time{}},
+		{"head", time.Time{}},
+		{"since=10m", now.Add(-10 * time.Minute)},
+		{"since=2016-06-13T10:00:00Z", time.Date(2016, 6, 13, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		since, err := parseStart(test.start, now)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.start, err)
+			continue
+		}
+
+		if !since.Equal(test.since) {
+			t.Errorf("%s: invalid time: %s != %s", test.start, test.since, since)
+		}
+	}
+
+	for _, start := range []string{"middle", "since=", "since=-1h", "since=yesterday"} {
+		if _, err := parseStart(start, now); err == nil {
+			t.Errorf("%s: expected an error", start)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package lib
+
+// LabelsKey is the reserved key of the event data under which sources record
+// the labels of the containers that emitted the events, so they don't clobber
+// the fields of the applications.
+const LabelsKey = "_ecs_logs_labels"
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// Reserved keys of the event data under which StampLatency records when events
+// were taken from their source, the ingest_time and pipeline_latency_ms fields,
+// and how long they waited in the pipeline before being sent.
+const (
+	IngestTimeKey      = "_ecs_logs_ingest_time"
+	PipelineLatencyKey = "_ecs_logs_pipeline_latency_ms"
+)
+
+// StampLatency returns a copy of batch where the events carry the time they
+// were ingested at, and the number of milliseconds elapsed between then and
+// now, when they are sent. Events generated by the program, which have no
+// ingest time, are left as is. The event data of the messages is copied since
+// it may be shared with batches sent to other destinations.
+func StampLatency(batch MessageBatch, now time.Time) MessageBatch {
+	stamped := make(MessageBatch, len(batch))
+
+	for i, msg := range batch {
+		if !msg.IngestTime.IsZero() {
+			data := make(ecslogs.EventData, len(msg.Event.Data)+2)
+			for k, v := range msg.Event.Data {
+				data[k] = v
+			}
+			data[IngestTimeKey] = msg.IngestTime
+			data[PipelineLatencyKey] = int64(now.Sub(msg.IngestTime) / time.Millisecond)
+			msg.Event.Data = data
+		}
+		stamped[i] = msg
+	}
+
+	return stamped
+}
@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestStampLatency(t *testing.T) {
+	now := time.Date(2016, 6, 13, 12, 0, 0, 0, time.UTC)
+	ingest := now.Add(-1500 * time.Millisecond)
+	batch := MessageBatch{
+		{Event: ecslogs.Event{Time: now.Add(-time.Hour), Data: ecslogs.EventData{"x": 1}}, IngestTime: ingest},
+		{Event: ecslogs.Event{Time: now}},
+	}
+
+	stamped := StampLatency(batch, now)
+
+	if d := stamped[0].Event.Data; d[IngestTimeKey] != ingest || d[PipelineLatencyKey] != int64(1500) || d["x"] != 1 {
+		t.Errorf("invalid event data: %v", d)
+	}
+
+	if _, ok := stamped[1].Event.Data[PipelineLatencyKey]; ok {
+		t.Error("events without an ingest time must not have a latency")
+	}
+
+	if _, ok := batch[0].Event.Data[IngestTimeKey]; ok {
+		t.Error("the original batch must not be modified")
+	}
+}
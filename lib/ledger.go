@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The maximum number of expired streams a ledger remembers, the ones that
+// were delivered the longest ago are forgotten first.
+const maxExpiredDeliveries = 1000
+
+// A Ledger keeps track of the last messages successfully delivered to a
+// destination on each stream, including the streams that expired.
+type Ledger struct {
+	mutex   sync.RWMutex
+	entries map[string]*Delivery
+	expired int
+}
+
+// Delivery describes how far a stream has been delivered.
+type Delivery struct {
+	Group       string    `json:"group"`
+	Stream      string    `json:"stream"`
+	Cursor      string    `json:"cursor,omitempty"`
+	Time        time.Time `json:"time"`
+	DeliveredOn time.Time `json:"delivered_on"`
+	Count       int       `json:"count"`
+	Expired     bool      `json:"expired,omitempty"`
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		entries: make(map[string]*Delivery, 100),
+	}
+}
+
+// Record updates the ledger after batch was delivered on the given stream.
+func (l *Ledger) Record(group string, stream string, batch MessageBatch, now time.Time) {
+	if len(batch) == 0 {
+		return
+	}
+
+	last := batch[len(batch)-1]
+	key := group + ":" + stream
+
+	l.mutex.Lock()
+
+	d := l.entries[key]
+	if d == nil {
+		d = &Delivery{Group: group, Stream: stream}
+		l.entries[key] = d
+	}
+
+	if d.Expired {
+		d.Expired = false
+		l.expired--
+	}
+
+	if len(last.Cursor) != 0 {
+		d.Cursor = last.Cursor
+	}
+
+	d.Time = last.Event.Time
+	d.DeliveredOn = now
+	d.Count += len(batch)
+
+	l.mutex.Unlock()
+}
+
+// Expire marks the entry of the given stream as expired, it is kept so the
+// last delivery of the stream can still be looked up, and is reset when the
+// stream is delivered again.
+func (l *Ledger) Expire(group string, stream string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	d := l.entries[group+":"+stream]
+	if d == nil || d.Expired {
+		return
+	}
+
+	d.Expired = true
+	l.expired++
+
+	if l.expired <= maxExpiredDeliveries {
+		return
+	}
+
+	var oldestKey string
+	var oldest *Delivery
+
+	for k, x := range l.entries {
+		if x.Expired && (oldest == nil || x.DeliveredOn.Before(oldest.DeliveredOn)) {
+			oldestKey, oldest = k, x
+		}
+	}
+
+	delete(l.entries, oldestKey)
+	l.expired--
+}
+
+// Deliveries returns the list of entries in the ledger sorted by group and
+// stream.
+func (l *Ledger) Deliveries() (list []Delivery) {
+	l.mutex.RLock()
+	list = make([]Delivery, 0, len(l.entries))
+
+	for _, d := range l.entries {
+		list = append(list, *d)
+	}
+
+	l.mutex.RUnlock()
+
+	sort.Sort(deliveries(list))
+	return
+}
+
+type deliveries []Delivery
+
+func (list deliveries) Len() int {
+	return len(list)
+}
+
+func (list deliveries) Swap(i int, j int) {
+	list[i], list[j] = list[j], list[i]
+}
+
+func (list deliveries) Less(i int, j int) bool {
+	if list[i].Group != list[j].Group {
+		return list[i].Group < list[j].Group
+	}
+	return list[i].Stream < list[j].Stream
+}
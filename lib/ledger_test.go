@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestLedger(t *testing.T) {
+	t0 := time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC)
+	t1 := t0.Add(1 * time.Second)
+	t2 := t0.Add(2 * time.Second)
+	now := t0.Add(1 * time.Minute)
+
+	l := NewLedger()
+	l.Record("B", "1", MessageBatch{
+		Message{Event: ecslogs.Event{Time: t0}, Cursor: "c0"},
+		Message{Event: ecslogs.Event{Time: t1}, Cursor: "c1"},
+	}, now)
+	l.Record("A", "2", MessageBatch{
+		Message{Event: ecslogs.Event{Time: t0}},
+	}, now)
+	l.Record("B", "1", MessageBatch{
+		Message{Event: ecslogs.Event{Time: t2}, Cursor: "c2"},
+	}, now)
+	l.Record("C", "3", MessageBatch{
+		Message{Event: ecslogs.Event{Time: t2}},
+	}, now)
+	l.Expire("C", "3")
+	l.Expire("A", "2")
+	l.Record("A", "2", MessageBatch{
+		Message{Event: ecslogs.Event{Time: t1}},
+	}, now)
+
+	ref := []Delivery{
+		{Group: "A", Stream: "2", Time: t1, DeliveredOn: now, Count: 2},
+		{Group: "B", Stream: "1", Cursor: "c2", Time: t2, DeliveredOn: now, Count: 3},
+		{Group: "C", Stream: "3", Time: t2, DeliveredOn: now, Count: 1, Expired: true},
+	}
+
+	if list := l.Deliveries(); !reflect.DeepEqual(list, ref) {
+		t.Errorf("invalid deliveries:\n- expected: %v\n- found:    %v", ref, list)
+	}
+}
+
+func TestLedgerMaxExpired(t *testing.T) {
+	t0 := time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC)
+	l := NewLedger()
+
+	for i := 0; i <= maxExpiredDeliveries; i++ {
+		stream := strconv.Itoa(i)
+		l.Record("A", stream, MessageBatch{Message{}}, t0.Add(time.Duration(i)*time.Second))
+		l.Expire("A", stream)
+	}
+
+	list := l.Deliveries()
+
+	if len(list) != maxExpiredDeliveries {
+		t.Errorf("invalid number of expired deliveries: %d", len(list))
+	}
+
+	for _, d := range list {
+		if d.Stream == "0" {
+			t.Error("the oldest expired delivery should have been forgotten")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// LevelRange is a range of event levels, Min is the most severe level of the
+// range and Max the least severe one.
+type LevelRange struct {
+	Min ecslogs.Level
+	Max ecslogs.Level
+}
+
+// ParseLevelRange parses "warn+" as warn and more severe levels, "info-" as
+// info and less severe levels, "notice..info" as the levels between notice and
+// info, or a single level.
+func ParseLevelRange(s string) (r LevelRange, err error) {
+	var min, max = s, s
+
+	switch {
+	case strings.HasSuffix(s, "+"):
+		min, max = "emerg", s[:len(s)-1]
+	case strings.HasSuffix(s, "-"):
+		min, max = s[:len(s)-1], "debug"
+	case strings.Contains(s, ".."):
+		i := strings.Index(s, "..")
+		min, max = s[:i], s[i+2:]
+	}
+
+	if r.Min, err = parseLevel(min); err != nil {
+		return
+	}
+
+	if r.Max, err = parseLevel(max); err != nil {
+		return
+	}
+
+	if r.Min > r.Max {
+		r.Min, r.Max = r.Max, r.Min
+	}
+
+	return
+}
+
+func parseLevel(s string) (lvl ecslogs.Level, err error) {
+	if lvl, err = ecslogs.ParseLevel(s); err == nil && lvl == ecslogs.NONE {
+		err = fmt.Errorf("invalid level: %s", s)
+	}
+	return
+}
+
+// Contains returns true if lvl is in the range. Events without a level, like
+// plain text messages, are considered informational.
+func (r LevelRange) Contains(lvl ecslogs.Level) bool {
+	if lvl == ecslogs.NONE {
+		lvl = ecslogs.INFO
+	}
+	return lvl >= r.Min && lvl <= r.Max
+}
+
+// Filter returns the messages of batch which have a level in the range.
+func (r LevelRange) Filter(batch MessageBatch) MessageBatch {
+	n := 0
+
+	for _, msg := range batch {
+		if r.Contains(msg.Event.Level) {
+			n++
+		}
+	}
+
+	if n == len(batch) {
+		return batch
+	}
+
+	list := make(MessageBatch, 0, n)
+
+	for _, msg := range batch {
+		if r.Contains(msg.Event.Level) {
+			list = append(list, msg)
+		}
+	}
+
+	return list
+}
+
+// String returns the range in the "min..max" form accepted by ParseLevelRange.
+func (r LevelRange) String() string {
+	return strings.ToLower(r.Min.String()) + ".." + strings.ToLower(r.Max.String())
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestParseLevelRange(t *testing.T) {
+	tests := []struct {
+		s string
+		r LevelRange
+	}{
+		{"warn+", LevelRange{ecslogs.EMERG, ecslogs.WARN}},
+		{"info-", LevelRange{ecslogs.INFO, ecslogs.DEBUG}},
+		{"notice..debug", LevelRange{ecslogs.NOTICE, ecslogs.DEBUG}},
+		{"debug..notice", LevelRange{ecslogs.NOTICE, ecslogs.DEBUG}},
+		{"error", LevelRange{ecslogs.ERROR, ecslogs.ERROR}},
+	}
+
+	for _, test := range tests {
+		if r, err := ParseLevelRange(test.s); err != nil {
+			t.Errorf("%s: %s", test.s, err)
+		} else if r != test.r {
+			t.Errorf("%s: invalid range: %+v", test.s, r)
+		}
+	}
+
+	for _, s := range []string{"", "oops+", "none"} {
+		if _, err := ParseLevelRange(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestLevelRangeFilter(t *testing.T) {
+	r := LevelRange{ecslogs.INFO, ecslogs.DEBUG}
+	batch := MessageBatch{
+		{Event: ecslogs.Event{Level: ecslogs.ERROR}},
+		{Event: ecslogs.Event{Level: ecslogs.DEBUG}},
+		{Event: ecslogs.Event{Level: ecslogs.NONE}},
+		{Event: ecslogs.Event{Level: ecslogs.WARN}},
+	}
+
+	if list := r.Filter(batch); len(list) != 2 || list[0].Event.Level != ecslogs.DEBUG || list[1].Event.Level != ecslogs.NONE {
+		t.Errorf("invalid filtered batch: %+v", list)
+	}
+}
@@ -61,6 +61,7 @@ func NewWriter(group string, stream string) (w lib.Writer, err error) {
 			InsecureSkipVerify: true,
 		},
 		SocksProxy: socksProxy,
+		HTTPProxy:  syslog.HTTPProxyFromEnvironment(address),
 	})
 }
 
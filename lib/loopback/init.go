@@ -0,0 +1,7 @@
+package loopback
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterDestination("loopback", lib.DestinationFunc(NewWriter))
+}
@@ -0,0 +1,80 @@
+package loopback
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// Queue receives the messages written to the loopback destination, the
+// program reads them back into the pipeline under their new group and stream.
+var Queue = lib.NewMessageQueue()
+
+type WriterConfig struct {
+	// Group to which messages are re-injected, messages already in this group
+	// are dropped so they don't loop forever.
+	Group string
+
+	// Stream to which messages are re-injected, messages keep their stream
+	// when empty.
+	Stream string
+
+	Queue *lib.MessageQueue
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+
+	if c.Group = os.Getenv("LOOPBACK_GROUP"); len(c.Group) == 0 {
+		err = fmt.Errorf("missing LOOPBACK_GROUP environment variable")
+		return
+	}
+
+	c.Stream = os.Getenv("LOOPBACK_STREAM")
+	c.Queue = Queue
+
+	w = NewWriterWith(c)
+	return
+}
+
+func NewWriterWith(config WriterConfig) lib.Writer {
+	return writer{config}
+}
+
+type writer struct {
+	config WriterConfig
+}
+
+func (w writer) Close() error {
+	return nil
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) error {
+	n := 0
+
+	for _, msg := range batch {
+		if msg.Group == w.config.Group {
+			continue
+		}
+
+		msg.Group = w.config.Group
+
+		if len(w.config.Stream) != 0 {
+			msg.Stream = w.config.Stream
+		}
+
+		w.config.Queue.Push(msg)
+		n++
+	}
+
+	if n != 0 {
+		w.config.Queue.Notify()
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package loopback
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestWriter(t *testing.T) {
+	q := lib.NewMessageQueue()
+	w := NewWriterWith(WriterConfig{Group: "aggregate", Stream: "all", Queue: q})
+
+	if err := w.WriteMessageBatch(lib.MessageBatch{
+		{Group: "a", Stream: "1"},
+		{Group: "aggregate", Stream: "all"},
+		{Group: "b", Stream: "2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-q.C:
+	default:
+		t.Error("the queue was not notified")
+	}
+
+	batch := q.Flush()
+	expected := lib.MessageBatch{
+		{Group: "aggregate", Stream: "all"},
+		{Group: "aggregate", Stream: "all"},
+	}
+
+	if !reflect.DeepEqual(batch, expected) {
+		t.Errorf("invalid messages re-injected:\n%#v\n%#v", expected, batch)
+	}
+}
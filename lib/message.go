@@ -3,6 +3,7 @@ package lib
 import (
 	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/kapralVV/ecs-logs-go"
 	"github.com/segmentio/jutil"
@@ -12,6 +13,18 @@ type Message struct {
 	Group  string        `json:"group,omitempty"`
 	Stream string        `json:"stream,omitempty"`
 	Event  ecslogs.Event `json:"event,omitempty"`
+
+	// Cursor is the position of the message in the source it was read from,
+	// if the source supports it.
+	Cursor string `json:"-"`
+
+	// Ack tracks the delivery of the message when the reader it was read
+	// from saves its position.
+	Ack *Ack `json:"-"`
+
+	// IngestTime is when the message was taken from its source, it is zero
+	// for the messages generated by the program.
+	IngestTime time.Time `json:"-"`
 }
 
 func (m Message) Bytes() []byte {
@@ -42,6 +55,13 @@ func (list MessageBatch) Len() int {
 	return len(list)
 }
 
+func (list MessageBatch) ContentLength() (n int) {
+	for _, msg := range list {
+		n += msg.ContentLength()
+	}
+	return
+}
+
 type MessageQueue struct {
 	C      <-chan struct{}
 	signal chan struct{}
@@ -1,10 +1,14 @@
 package lib
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -95,6 +99,45 @@ func TestMessageEncoderDecoder(t *testing.T) {
 	}
 }
 
+func TestMessageDecoderParseError(t *testing.T) {
+	d := NewMessageDecoder(strings.NewReader(
+		`{"group":"a","stream":"1"}` + "\n" +
+			`{"group":"b", oops}` + "\n" +
+			`{"group":42}` + "\n" +
+			`{"group":"c","stream":"3"}` + "\n",
+	))
+
+	var groups []string
+	var inputs []string
+
+	for {
+		msg, err := d.ReadMessage()
+
+		if err == io.EOF {
+			break
+		}
+
+		if e, ok := err.(*ParseError); ok {
+			inputs = append(inputs, e.Input)
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		groups = append(groups, msg.Group)
+	}
+
+	if !reflect.DeepEqual(groups, []string{"a", "c"}) {
+		t.Errorf("invalid messages decoded: %v", groups)
+	}
+
+	if !reflect.DeepEqual(inputs, []string{`{"group":"b", oops}`, `{"group":42}`}) {
+		t.Errorf("invalid inputs reported in parse errors: %q", inputs)
+	}
+}
+
 func TestMessageEncoderWriteMessageBatchError(t *testing.T) {
 	batch := MessageBatch{
 		Message{
@@ -125,6 +168,84 @@ func TestMessageEncoderWriteMessageBatchError(t *testing.T) {
 	}
 }
 
+func TestMessageDecoderGzipEnvelope(t *testing.T) {
+	b := &bytes.Buffer{}
+	z := gzip.NewWriter(b)
+	z.Write([]byte(`{"messageType":"CONTROL_MESSAGE","logGroup":"","logStream":"","logEvents":[]}` + "\n"))
+	z.Write([]byte(`{"messageType":"DATA_MESSAGE","logGroup":"api","logStream":"web-1","logEvents":[` +
+		`{"id":"1","timestamp":1465820622000,"message":"hello"},` +
+		`{"id":"2","timestamp":1465820623000,"message":"world"}]}` + "\n"))
+	z.Write([]byte(`{"group":"a","stream":"1"}` + "\n"))
+	z.Close()
+
+	d := NewMessageDecoder(b)
+
+	var msgs []string
+	for {
+		msg, err := d.ReadMessage()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs = append(msgs, fmt.Sprintf("%s/%s %s %s %d", msg.Group, msg.Stream, msg.Event.Info.ID, msg.Event.Message, msg.Event.Time.Unix()))
+	}
+
+	if !reflect.DeepEqual(msgs, []string{
+		"api/web-1 1 hello 1465820622",
+		"api/web-1 2 world 1465820623",
+		"a/1   -62135596800",
+	}) {
+		t.Errorf("invalid messages decoded: %q", msgs)
+	}
+}
+
+func TestMessageDecoderS3Envelope(t *testing.T) {
+	d := NewMessageDecoder(strings.NewReader(
+		`{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2016-06-13T12:23:42Z","Bucket":"logs"}` + "\n" +
+			`{"Records":[{"eventSource":"aws:s3","awsRegion":"us-west-2","eventTime":"2016-06-13T12:23:42Z","eventName":"ObjectCreated:Put",` +
+			`"s3":{"bucket":{"name":"logs"},"object":{"key":"alb/1.log.gz","size":1024}}}]}` + "\n" +
+			`{"group":"a","stream":"1"}` + "\n",
+	))
+
+	msg, err := d.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Group != "logs" || msg.Stream != "us-west-2" || msg.Event.Message != "ObjectCreated:Put s3://logs/alb/1.log.gz" || msg.Event.Data["size"] != int64(1024) {
+		t.Errorf("invalid message unwrapped from the S3 notification: %v", msg)
+	}
+
+	if msg, err = d.ReadMessage(); err != nil || msg.Group != "a" {
+		t.Errorf("invalid message read after the S3 notification: %v (%v)", msg, err)
+	}
+}
+
+func TestDecompressedReader(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		fail  bool
+	}{
+		{"hello", false},
+		{"hello world", true},
+	} {
+		b, err := ioutil.ReadAll(&decompressedReader{r: strings.NewReader(test.input), remaining: 5})
+
+		if test.fail && err == nil {
+			t.Errorf("%s: reading past the limit must fail", test.input)
+		}
+
+		if !test.fail && (err != nil || string(b) != test.input) {
+			t.Errorf("%s: invalid input read: %q (%v)", test.input, b, err)
+		}
+	}
+}
+
 // The errorWriter type is used to mock message encoders with a writer that
 // always returns an error so we can test error cases.
 type errorWriter struct {
@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is the registry shared by the components of the program to report
+// their counters and timers.
+var Metrics = NewMetricsRegistry()
+
+// MetricsRegistry holds counters and timers identified by a name and a list of
+// label name and value pairs.
+type MetricsRegistry struct {
+	mutex    sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+	timers   map[string]*Timer
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		counters: make(map[string]*Counter),
+		gauges:   make(map[string]*Gauge),
+		timers:   make(map[string]*Timer),
+	}
+}
+
+// Counter returns the counter with the given name and labels, creating it if
+// it didn't exist.
+func (r *MetricsRegistry) Counter(name string, labels ...string) (c *Counter) {
+	key := metricKey(name, labels)
+	r.mutex.Lock()
+
+	if c = r.counters[key]; c == nil {
+		c = &Counter{}
+		r.counters[key] = c
+	}
+
+	r.mutex.Unlock()
+	return
+}
+
+// RemoveCounter removes the counter with the given name and labels, it is
+// created again if it is used after being removed.
+func (r *MetricsRegistry) RemoveCounter(name string, labels ...string) {
+	key := metricKey(name, labels)
+	r.mutex.Lock()
+	delete(r.counters, key)
+	r.mutex.Unlock()
+}
+
+// Gauge returns the gauge with the given name and labels, creating it if it
+// didn't exist.
+func (r *MetricsRegistry) Gauge(name string, labels ...string) (g *Gauge) {
+	key := metricKey(name, labels)
+	r.mutex.Lock()
+
+	if g = r.gauges[key]; g == nil {
+		g = &Gauge{}
+		r.gauges[key] = g
+	}
+
+	r.mutex.Unlock()
+	return
+}
+
+// Timer returns the timer with the given name and labels, creating it if it
+// didn't exist.
+func (r *MetricsRegistry) Timer(name string, labels ...string) (t *Timer) {
+	key := metricKey(name, labels)
+	r.mutex.Lock()
+
+	if t = r.timers[key]; t == nil {
+		t = &Timer{}
+		r.timers[key] = t
+	}
+
+	r.mutex.Unlock()
+	return
+}
+
+// WriteTo writes the metrics of the registry in the Prometheus text format,
+// timers are reported as the count, sum and maximum of their observations in
+// seconds. The maximum is the one observed since the previous report, so a
+// slow operation doesn't hide the ones that follow.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (n int64, err error) {
+	var lines []string
+
+	r.mutex.Lock()
+
+	for key, c := range r.counters {
+		lines = append(lines, fmt.Sprintf("%s %d", key, c.Value()))
+	}
+
+	for key, g := range r.gauges {
+		lines = append(lines, fmt.Sprintf("%s %d", key, g.Value()))
+	}
+
+	for key, t := range r.timers {
+		name, labels := key, ""
+		if i := strings.IndexByte(key, '{'); i >= 0 {
+			name, labels = key[:i], key[i:]
+		}
+		count, sum, max := t.report()
+		lines = append(lines,
+			fmt.Sprintf("%s_count%s %d", name, labels, count),
+			fmt.Sprintf("%s_sum%s %g", name, labels, sum.Seconds()),
+			fmt.Sprintf("%s_max%s %g", name, labels, max.Seconds()),
+		)
+	}
+
+	r.mutex.Unlock()
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		var c int
+
+		if c, err = io.WriteString(w, line+"\n"); err != nil {
+			return
+		}
+
+		n += int64(c)
+	}
+
+	return
+}
+
+func metricKey(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a monotonic counter safe for concurrent use.
+type Counter struct {
+	value int64
+}
+
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.value, n)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// Gauge is a value that can go up and down, safe for concurrent use.
+type Gauge struct {
+	value int64
+}
+
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// Timer records the number, total and maximum duration of operations.
+type Timer struct {
+	mutex sync.Mutex
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+func (t *Timer) Observe(d time.Duration) {
+	t.mutex.Lock()
+	t.count++
+	t.sum += d
+	if d > t.max {
+		t.max = d
+	}
+	t.mutex.Unlock()
+}
+
+func (t *Timer) Value() (count int64, sum time.Duration, max time.Duration) {
+	t.mutex.Lock()
+	count, sum, max = t.count, t.sum, t.max
+	t.mutex.Unlock()
+	return
+}
+
+// report returns the value of the timer and resets its maximum.
+func (t *Timer) report() (count int64, sum time.Duration, max time.Duration) {
+	t.mutex.Lock()
+	count, sum, max = t.count, t.sum, t.max
+	t.max = 0
+	t.mutex.Unlock()
+	return
+}
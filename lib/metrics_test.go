@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := NewMetricsRegistry()
+
+	r.Counter("messages_total", "address", "localhost:514").Add(2)
+	r.Counter("messages_total", "address", "localhost:514").Add(3)
+	r.Counter("errors_total").Add(1)
+
+	r.Gauge("healthy", "address", "localhost:514").Set(1)
+	r.Gauge("healthy", "address", "localhost:514").Set(0)
+
+	r.Timer("flush_seconds", "address", "localhost:514").Observe(1 * time.Second)
+	r.Timer("flush_seconds", "address", "localhost:514").Observe(3 * time.Second)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+
+	expected := `errors_total 1
+flush_seconds_count{address="localhost:514"} 2
+flush_seconds_max{address="localhost:514"} 3
+flush_seconds_sum{address="localhost:514"} 4
+healthy{address="localhost:514"} 0
+messages_total{address="localhost:514"} 5
+`
+
+	if s := buf.String(); s != expected {
+		t.Errorf("invalid metrics:\n%s", s)
+	}
+}
+
+func TestMetricsRegistryTimerMax(t *testing.T) {
+	r := NewMetricsRegistry()
+	timer := r.Timer("flush_seconds")
+
+	timer.Observe(3 * time.Second)
+	r.WriteTo(&bytes.Buffer{})
+	timer.Observe(1 * time.Second)
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+
+	expected := `flush_seconds_count 2
+flush_seconds_max 1
+flush_seconds_sum 4
+`
+
+	if s := buf.String(); s != expected {
+		t.Errorf("the maximum should be reset after each report:\n%s", s)
+	}
+}
@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// OversizeKey is the reserved key of the event data under which the action
+// taken on events exceeding the size limit of a destination is recorded.
+const OversizeKey = "_ecs_logs_oversize"
+
+// Actions taken on events exceeding the size limit of a destination.
+const (
+	OversizeTruncate = "truncate"
+	OversizeSplit    = "split"
+	OversizeDivert   = "divert"
+)
+
+// Oversize is attached to the events that exceeded the size limit, with the
+// original size of their message and, when split, the index of the part and
+// the number of parts.
+type Oversize struct {
+	Action string `json:"action"`
+	Size   int    `json:"size"`
+	Part   int    `json:"part,omitempty"`
+	Parts  int    `json:"parts,omitempty"`
+}
+
+// OversizePolicy is the action taken on events whose serialized size is larger
+// than Limit bytes.
+type OversizePolicy struct {
+	Action string
+	Limit  int
+}
+
+// ParseOversizePolicy parses "action:limit", for example "split:262144".
+func ParseOversizePolicy(s string) (p OversizePolicy, err error) {
+	i := strings.IndexByte(s, ':')
+
+	if i < 0 {
+		err = fmt.Errorf("missing limit: %s", s)
+		return
+	}
+
+	switch p.Action = s[:i]; p.Action {
+	case OversizeTruncate, OversizeSplit, OversizeDivert:
+	default:
+		err = fmt.Errorf("invalid action: %s", p.Action)
+		return
+	}
+
+	if p.Limit, err = strconv.Atoi(s[i+1:]); err != nil || p.Limit < 1 {
+		err = fmt.Errorf("invalid limit: %s", s[i+1:])
+	}
+
+	return
+}
+
+// Apply returns the batch with the events exceeding the limit truncated or
+// split, and the messages to divert to another destination. Batches without
+// oversized events are returned as is.
+//
+// The limit applies to the serialized events, the messages of truncated and
+// split events are cut so the events with their oversize marker fit, each
+// part carrying at least one character when the other fields alone already
+// exceed the limit.
+func (p OversizePolicy) Apply(batch MessageBatch) (kept MessageBatch, diverted MessageBatch) {
+	for i, msg := range batch {
+		if msg.ContentLength() <= p.Limit {
+			if kept != nil {
+				kept = append(kept, msg)
+			}
+			continue
+		}
+
+		if kept == nil {
+			kept = make(MessageBatch, i, len(batch))
+			copy(kept, batch[:i])
+		}
+
+		size := len(msg.Event.Message)
+
+		switch p.Action {
+		case OversizeTruncate:
+			m := Oversize{Action: p.Action, Size: size}
+			n := messageCut(msg.Event.Message, p.Limit-markOversize(msg, "", m).ContentLength())
+			kept = append(kept, markOversize(msg, msg.Event.Message[:n], m))
+
+		case OversizeSplit:
+			// The marker of the last part has the largest indexes, it's used to
+			// compute the space left for the message in all the parts.
+			m := Oversize{Action: p.Action, Size: size, Part: size, Parts: size}
+			limit := p.Limit - markOversize(msg, "", m).ContentLength()
+
+			var parts []string
+			for s := msg.Event.Message; len(s) != 0; {
+				n := messageCut(s, limit)
+				if n == 0 {
+					_, n = utf8.DecodeRuneInString(s)
+				}
+				parts, s = append(parts, s[:n]), s[n:]
+			}
+			for j, part := range parts {
+				kept = append(kept, markOversize(msg, part, Oversize{
+					Action: p.Action,
+					Size:   size,
+					Part:   j + 1,
+					Parts:  len(parts),
+				}))
+			}
+
+		case OversizeDivert:
+			diverted = append(diverted, markOversize(msg, msg.Event.Message, Oversize{
+				Action: p.Action,
+				Size:   size,
+			}))
+		}
+	}
+
+	if kept == nil && len(diverted) == 0 {
+		kept = batch
+	}
+
+	return
+}
+
+// messageCut returns the length of the longest prefix of s which doesn't cut a
+// UTF-8 sequence and takes at most limit bytes once escaped in JSON.
+func messageCut(s string, limit int) int {
+	n := 0
+
+	for i, r := range s {
+		if n += escapedLen(r, s[i:]); n > limit {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// escapedLen returns the number of bytes taken by r, the rune at the start of
+// s, in a JSON string encoded by the encoding/json package.
+func escapedLen(r rune, s string) int {
+	switch {
+	case r == '"', r == '\\', r == '\n', r == '\r', r == '\t':
+		return 2
+	case r < 0x20, r == '<', r == '>', r == '&', r == '\u2028', r == '\u2029':
+		return 6
+	case r == utf8.RuneError:
+		if _, n := utf8.DecodeRuneInString(s); n == 1 {
+			return 6
+		}
+	}
+	return utf8.RuneLen(r)
+}
+
+// markOversize returns a copy of msg with the given message and the oversize
+// marker, the event data is copied since it may be shared with batches sent to
+// other destinations.
+func markOversize(msg Message, message string, m Oversize) Message {
+	data := make(ecslogs.EventData, len(msg.Event.Data)+1)
+	for k, v := range msg.Event.Data {
+		data[k] = v
+	}
+	data[OversizeKey] = m
+	msg.Event.Data = data
+	msg.Event.Message = message
+	return msg
+}
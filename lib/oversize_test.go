@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestParseOversizePolicy(t *testing.T) {
+	if p, err := ParseOversizePolicy("split:1024"); err != nil || p != (OversizePolicy{Action: OversizeSplit, Limit: 1024}) {
+		t.Errorf("invalid policy: %+v (%v)", p, err)
+	}
+
+	for _, s := range []string{"split", "split:0", "compress:1024"} {
+		if _, err := ParseOversizePolicy(s); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
+
+func TestOversizePolicy(t *testing.T) {
+	// The message must be longer than the oversize marker so the limits
+	// relative to the marker are exceeded.
+	long := "héllo" + strings.Repeat("-", 128)
+	batch := MessageBatch{
+		{Event: ecslogs.Event{Message: "ok"}},
+		{Event: ecslogs.Event{Message: long, Data: ecslogs.EventData{"x": 1}}},
+	}
+
+	messages := func(batch MessageBatch) (list []string) {
+		for _, msg := range batch {
+			list = append(list, msg.Event.Message)
+		}
+		return
+	}
+
+	// The limits are relative to the size of the events with an empty message
+	// and their oversize marker.
+	overhead := func(m Oversize) int {
+		return markOversize(batch[1], "", m).ContentLength()
+	}
+
+	if kept, _ := (OversizePolicy{Action: OversizeSplit, Limit: batch[1].ContentLength()}).Apply(batch); !reflect.DeepEqual(kept, batch) {
+		t.Errorf("batches without oversized events must be left as is: %q", messages(kept))
+	}
+
+	truncated := Oversize{Action: OversizeTruncate, Size: len(long)}
+	kept, diverted := OversizePolicy{Action: OversizeTruncate, Limit: overhead(truncated) + 2}.Apply(batch)
+
+	if !reflect.DeepEqual(messages(kept), []string{"ok", "h"}) || len(diverted) != 0 {
+		t.Errorf("invalid truncated messages: %q", messages(kept))
+	}
+
+	if m := kept[1].Event.Data[OversizeKey]; m != truncated || kept[1].Event.Data["x"] != 1 {
+		t.Errorf("invalid event data: %v", kept[1].Event.Data)
+	}
+
+	for _, msg := range kept {
+		if n := msg.ContentLength(); n > overhead(truncated)+2 {
+			t.Errorf("truncated event larger than the limit: %d", n)
+		}
+	}
+
+	split := Oversize{Action: OversizeSplit, Size: len(long), Part: len(long), Parts: len(long)}
+	kept, _ = OversizePolicy{Action: OversizeSplit, Limit: overhead(split) + 2}.Apply(batch)
+	parts := messages(kept)
+
+	if len(parts) < 4 || !reflect.DeepEqual(parts[:4], []string{"ok", "h", "é", "ll"}) || strings.Join(parts[1:], "") != long {
+		t.Errorf("invalid split messages: %q", parts)
+	}
+
+	last := len(kept) - 1
+	if m := kept[last].Event.Data[OversizeKey]; m != (Oversize{Action: OversizeSplit, Size: len(long), Part: last, Parts: last}) {
+		t.Errorf("invalid split marker: %v", m)
+	}
+
+	kept, diverted = OversizePolicy{Action: OversizeDivert, Limit: batch[0].ContentLength()}.Apply(batch)
+
+	if !reflect.DeepEqual(messages(kept), []string{"ok"}) || !reflect.DeepEqual(messages(diverted), []string{long}) {
+		t.Errorf("invalid diverted messages: %q %q", messages(kept), messages(diverted))
+	}
+
+	if _, ok := batch[1].Event.Data[OversizeKey]; ok {
+		t.Error("the original batch must not be modified")
+	}
+}
+
+func TestOversizeEventData(t *testing.T) {
+	// The message is short but the other fields of the event exceed the
+	// limit, the event is oversized.
+	msg := Message{Event: ecslogs.Event{Message: "a", Data: ecslogs.EventData{"x": strings.Repeat("x", 100)}}}
+
+	if _, diverted := (OversizePolicy{Action: OversizeDivert, Limit: 50}).Apply(MessageBatch{msg}); len(diverted) != 1 {
+		t.Error("events with large data must be oversized")
+	}
+
+	if kept, _ := (OversizePolicy{Action: OversizeSplit, Limit: 50}).Apply(MessageBatch{msg}); len(kept) != 1 || kept[0].Event.Message != "a" {
+		t.Errorf("split events must carry at least one character: %+v", kept)
+	}
+}
+
+func TestMessageCut(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit int
+		n     int
+	}{
+		{"hello", 10, 5},
+		{"hello", 3, 3},
+		{"héllo", 2, 1},
+		{"héllo", 3, 3},
+		{`a"b`, 2, 1},
+		{`a"b`, 3, 2},
+		{"a<b", 6, 1},
+		{"a\x00b", 7, 2},
+		{"a\xffb", 6, 1},
+	}
+
+	for _, test := range tests {
+		if n := messageCut(test.s, test.limit); n != test.n {
+			t.Errorf("%q: %d: invalid cut: %d != %d", test.s, test.limit, n, test.n)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package peer
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("peer", lib.SourceFunc(NewReader))
+	lib.RegisterDestination("peer", lib.DestinationFunc(NewWriter))
+}
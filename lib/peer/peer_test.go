@@ -0,0 +1,115 @@
+package peer
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestPeer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith(l, Config{})
+	defer r.Close()
+
+	w, err := NewWriterWith(WriterConfig{
+		Network: "tcp",
+		Address: l.Addr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	now := time.Date(2016, 7, 5, 9, 8, 12, 0, time.UTC)
+	batch := lib.MessageBatch{
+		{Group: "abc", Stream: "0", Event: ecslogs.Event{Level: ecslogs.INFO, Time: now, Message: "hello"}},
+		{Group: "abc", Stream: "1", Event: ecslogs.Event{Level: ecslogs.ERROR, Time: now, Message: "world"}},
+	}
+
+	if err := w.WriteMessageBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range batch {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Group != expected.Group || msg.Stream != expected.Stream || msg.Event.Message != expected.Event.Message || !msg.Event.Time.Equal(now) {
+			t.Errorf("invalid message read:\n- expected: %v\n- found:    %v", expected, msg)
+		}
+	}
+}
+
+func TestPeerParseError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith(l, Config{})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("oops\n{\"group\":\"abc\",\"stream\":\"0\"}\n"))
+
+	if _, err := r.ReadMessage(); err == nil {
+		t.Error("reading invalid input must fail")
+	} else if e, ok := err.(*lib.ParseError); !ok || e.Input != "oops" {
+		t.Errorf("invalid error: %v", err)
+	}
+
+	if msg, err := r.ReadMessage(); err != nil || msg.Group != "abc" {
+		t.Errorf("invalid message read after a parse error: %v (%v)", msg, err)
+	}
+
+	r.Close()
+
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("reading from a closed reader must return io.EOF: %v", err)
+	}
+}
+
+func TestPeerToken(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith(l, Config{Tokens: []string{"secret"}})
+	defer r.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		w, err := NewWriterWith(WriterConfig{Network: "tcp", Address: l.Addr().String(), Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteMessage(lib.Message{Group: "abc", Stream: "0", Event: ecslogs.Event{Message: "rejected"}})
+	}
+
+	w, err := NewWriterWith(WriterConfig{Network: "tcp", Address: l.Addr().String(), Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteMessage(lib.Message{Group: "abc", Stream: "0", Event: ecslogs.Event{Message: "accepted"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, err := r.ReadMessage(); err != nil || msg.Event.Message != "accepted" {
+		t.Errorf("only the messages of authenticated peers must be read: %v (%v)", msg, err)
+	}
+}
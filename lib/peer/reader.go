@@ -0,0 +1,226 @@
+package peer
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+const (
+	// DefaultAddress is the address on which the peer source accepts
+	// connections when PEER_LISTEN isn't set, only local agents can reach it.
+	DefaultAddress = "127.0.0.1:5140"
+
+	// How long peers have to send their token once connected.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Config is the configuration of the peer source.
+type Config struct {
+	// Tokens accepted from the peers, any connection is accepted when empty.
+	Tokens []string
+}
+
+// NewReader returns a reader of the messages sent by other ecs-logs agents
+// through the peer destination. It accepts connections on the address set by
+// PEER_LISTEN, over TLS when PEER_TLS_CERT and PEER_TLS_KEY are set. Peers
+// must send one of the tokens of PEER_TOKENS when it's set, which is required
+// unless the address is a loopback address.
+func NewReader() (r lib.Reader, err error) {
+	var l net.Listener
+	var address string
+	var config Config
+
+	if address = os.Getenv("PEER_LISTEN"); len(address) == 0 {
+		address = DefaultAddress
+	}
+
+	for _, token := range strings.Split(os.Getenv("PEER_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); len(token) != 0 {
+			config.Tokens = append(config.Tokens, token)
+		}
+	}
+
+	if len(config.Tokens) == 0 && !lib.IsLoopbackAddress(address) {
+		err = fmt.Errorf("PEER_TOKENS must be set to listen on a non-loopback address: %s", address)
+		return
+	}
+
+	cert, key := os.Getenv("PEER_TLS_CERT"), os.Getenv("PEER_TLS_KEY")
+
+	if len(cert) != 0 || len(key) != 0 {
+		var c tls.Certificate
+
+		if c, err = tls.LoadX509KeyPair(cert, key); err != nil {
+			err = fmt.Errorf("invalid PEER_TLS_CERT or PEER_TLS_KEY: %s", err)
+			return
+		}
+
+		l, err = tls.Listen("tcp", address, &tls.Config{Certificates: []tls.Certificate{c}})
+	} else {
+		l, err = net.Listen("tcp", address)
+	}
+
+	if err != nil {
+		return
+	}
+
+	r = NewReaderWith(l, config)
+	return
+}
+
+// NewReaderWith returns a reader of the messages sent to the connections
+// accepted by l.
+func NewReaderWith(l net.Listener, config Config) lib.Reader {
+	r := &reader{
+		config:   config,
+		listener: l,
+		results:  make(chan result),
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go r.accept()
+	return r
+}
+
+type result struct {
+	msg lib.Message
+	err error
+}
+
+type reader struct {
+	config   Config
+	listener net.Listener
+	results  chan result
+	done     chan struct{}
+	once     sync.Once
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (r *reader) Close() (err error) {
+	r.once.Do(func() {
+		close(r.done)
+		err = r.listener.Close()
+
+		r.mutex.Lock()
+		for conn := range r.conns {
+			conn.Close()
+		}
+		r.mutex.Unlock()
+	})
+	return
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	select {
+	case res := <-r.results:
+		return res.msg, res.err
+	case <-r.done:
+		return msg, io.EOF
+	}
+}
+
+func (r *reader) accept() {
+	err := lib.Accept(r.listener, r.done, func(conn net.Conn) {
+		r.mutex.Lock()
+		r.conns[conn] = struct{}{}
+		r.mutex.Unlock()
+
+		go r.read(conn)
+	})
+
+	if err != nil {
+		select {
+		case <-r.done:
+		case r.results <- result{err: err}:
+		}
+		// The source is abandoned once it reported the error, the listeners
+		// and the open connections must be closed with it.
+		r.Close()
+	}
+}
+
+func (r *reader) read(conn net.Conn) {
+	defer func() {
+		r.mutex.Lock()
+		delete(r.conns, conn)
+		r.mutex.Unlock()
+		conn.Close()
+	}()
+
+	b := bufio.NewReader(conn)
+
+	if len(r.config.Tokens) != 0 {
+		conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+
+		if !r.authenticate(b) {
+			log.WithField("peer", conn.RemoteAddr().String()).Warn("rejecting peer connection with a missing or invalid token")
+			return
+		}
+
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	d := lib.NewMessageDecoder(b)
+
+	for {
+		msg, err := d.ReadMessage()
+
+		if err != nil {
+			if _, ok := err.(*lib.ParseError); !ok {
+				select {
+				case <-r.done:
+				default:
+					if err != io.EOF {
+						log.WithFields(log.Fields{
+							"peer":  conn.RemoteAddr().String(),
+							"error": err,
+						}).Warn("closing peer connection")
+					}
+				}
+				return
+			}
+		}
+
+		select {
+		case r.results <- result{msg, err}:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// authenticate reads the handshake sent by the peer destination when it
+// connects, a JSON object holding its token on the first line.
+func (r *reader) authenticate(b *bufio.Reader) bool {
+	var handshake struct {
+		Token string `json:"token"`
+	}
+
+	line, err := b.ReadSlice('\n')
+
+	if err != nil || json.Unmarshal(line, &handshake) != nil {
+		return false
+	}
+
+	for _, t := range r.config.Tokens {
+		if subtle.ConstantTimeCompare([]byte(handshake.Token), []byte(t)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
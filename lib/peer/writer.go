@@ -0,0 +1,183 @@
+package peer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/syslog/pool"
+)
+
+const (
+	poolSize            = 4
+	defaultDialTimeout  = 10 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+)
+
+var (
+	poolsLock sync.Mutex
+	pools     = map[WriterConfig]*pool.LimitedConnPool{}
+)
+
+type WriterConfig struct {
+	// Network is either "tcp" or "tls".
+	Network      string
+	Address      string
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Token sent to the peer when connecting, if any.
+	Token string
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+	var u *url.URL
+	var s string
+
+	if s = os.Getenv("PEER_URL"); len(s) == 0 {
+		err = fmt.Errorf("missing PEER_URL environment variable")
+		return
+	}
+
+	if u, err = url.Parse(s); err != nil {
+		err = fmt.Errorf("invalid peer URL: %s", err)
+		return
+	}
+
+	if u.Scheme != "tcp" && u.Scheme != "tls" {
+		err = fmt.Errorf("invalid peer URL: only the tcp and tls protocols are supported but %s was found", u.Scheme)
+		return
+	}
+
+	c.Network = u.Scheme
+	c.Address = u.Host
+	c.Token = os.Getenv("PEER_TOKEN")
+	return NewWriterWith(c)
+}
+
+// NewWriterWith returns a writer sending messages to the ecs-logs peer
+// described by config. Connections are shared by all writers with the same
+// config.
+func NewWriterWith(config WriterConfig) (w lib.Writer, err error) {
+	var p *pool.LimitedConnPool
+
+	if config.DialTimeout == 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+
+	if p, err = getPool(config); err != nil {
+		err = lib.NewWriterError(lib.UnreachableError, err)
+		return
+	}
+
+	w = writer{config: config, pool: p}
+	return
+}
+
+type writer struct {
+	config WriterConfig
+	pool   *pool.LimitedConnPool
+}
+
+func (w writer) Close() error {
+	return nil
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch sends the batch to the peer as a stream of JSON messages,
+// the format read by the peer source.
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	var buf bytes.Buffer
+
+	if err = lib.NewMessageEncoder(&buf).WriteMessageBatch(batch); err != nil {
+		return
+	}
+
+	conn, ok := w.pool.TryGet(w.config.DialTimeout)
+	if !ok {
+		return lib.NewWriterError(lib.UnreachableError, fmt.Errorf("no connection available to the ecs-logs peer at %s", w.config.Address))
+	}
+
+	// Closing the connection returns it to the pool, or discards it if the
+	// write failed.
+	defer conn.Close()
+
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		err = lib.NewWriterError(lib.UnreachableError, err)
+	}
+
+	return
+}
+
+func getPool(config WriterConfig) (p *pool.LimitedConnPool, err error) {
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+
+	if p = pools[config]; p == nil {
+		if p, err = pool.NewLimited(poolSize, func() (io.WriteCloser, error) { return dial(config) }); err == nil {
+			pools[config] = p
+		}
+	}
+
+	return
+}
+
+func dial(config WriterConfig) (io.WriteCloser, error) {
+	var conn net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: config.DialTimeout}
+
+	if config.Network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", config.Address, nil)
+	} else {
+		conn, err = dialer.Dial(config.Network, config.Address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := timeoutConn{conn, config.WriteTimeout}
+
+	if len(config.Token) != 0 {
+		if err = json.NewEncoder(c).Encode(struct {
+			Token string `json:"token"`
+		}{config.Token}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// timeoutConn sets a deadline on each write so writers don't hang forever on
+// peers that stopped reading.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c timeoutConn) Write(b []byte) (int, error) {
+	if err := c.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// encodeWriteRequest serializes the series as a protobuf remote write request:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+//
+// Labels must already be sorted by name.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var req []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var lb []byte
+			lb = appendBytes(lb, 1, []byte(l.name))
+			lb = appendBytes(lb, 2, []byte(l.value))
+			ts = appendBytes(ts, 1, lb)
+		}
+
+		var sample []byte
+		sample = appendTag(sample, 1, 1)
+		sample = appendFixed64(sample, math.Float64bits(s.value))
+		sample = appendTag(sample, 2, 0)
+		sample = appendVarint(sample, uint64(s.timestamp))
+		ts = appendBytes(ts, 2, sample)
+
+		req = appendBytes(req, 1, ts)
+	}
+
+	return req
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+// appendBytes appends a length-delimited field.
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, 2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// encodeSnappy wraps src in the snappy block format as a single literal, the
+// payload isn't compressed but is valid for any snappy decoder. Requests are
+// small so this avoids depending on a compression library.
+func encodeSnappy(src []byte) []byte {
+	b := appendVarint(make([]byte, 0, len(src)+10), uint64(len(src)))
+
+	if len(src) == 0 {
+		return b
+	}
+
+	switch n := uint32(len(src) - 1); {
+	case n < 60:
+		b = append(b, byte(n<<2))
+	case n < 1<<8:
+		b = append(b, 60<<2, byte(n))
+	case n < 1<<16:
+		b = append(b, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		b = append(b, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		b = append(b, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(b, src...)
+}
@@ -0,0 +1,54 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeSnappy(t *testing.T) {
+	tests := []struct {
+		size   int
+		header []byte
+	}{
+		{0, []byte{0}},
+		{1, []byte{1, 0 << 2}},
+		{60, []byte{60, 59 << 2}},
+		{61, []byte{61, 60 << 2, 60}},
+		{300, []byte{0xac, 0x02, 61 << 2, 0x2b, 0x01}},
+	}
+
+	for _, test := range tests {
+		src := bytes.Repeat([]byte{'x'}, test.size)
+		b := encodeSnappy(src)
+
+		if !bytes.HasPrefix(b, test.header) {
+			t.Errorf("%d bytes: invalid snappy header: %v", test.size, b[:len(test.header)])
+		}
+
+		if !bytes.Equal(b[len(test.header):], src) {
+			t.Errorf("%d bytes: invalid snappy literal", test.size)
+		}
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	b := encodeWriteRequest([]timeSeries{{
+		labels:    []label{{"a", "b"}},
+		value:     1,
+		timestamp: 2,
+	}})
+
+	expected := []byte{
+		0x0a, 0x15, // timeseries
+		0x0a, 0x06, // labels
+		0x0a, 0x01, 'a', // name
+		0x12, 0x01, 'b', // value
+		0x12, 0x0b, // samples
+		0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // value
+		0x10, 0x02, // timestamp
+	}
+
+	if !bytes.Equal(b, expected) {
+		t.Errorf("invalid write request:\n%x\n%x", expected, b)
+	}
+}
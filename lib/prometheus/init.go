@@ -0,0 +1,7 @@
+package prometheus
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterDestination("prometheus", lib.DestinationFunc(NewWriter))
+}
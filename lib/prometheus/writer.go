@@ -0,0 +1,332 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// MetricName is the name of the counter of events, labeled by group and level.
+const MetricName = "ecs_logs_events_total"
+
+// Names of the histograms of the size of events in bytes and of the delay
+// between the time of events and the time they are pushed, labeled by group.
+const (
+	SizeMetricName  = "ecs_logs_event_size_bytes"
+	DelayMetricName = "ecs_logs_event_delay_seconds"
+)
+
+var (
+	sizeBuckets  = []float64{256, 1024, 4096, 16384, 65536}
+	delayBuckets = []float64{0.1, 1, 10, 60, 300}
+)
+
+type WriterConfig struct {
+	URL      string
+	Instance string
+	Client   *http.Client
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+	var u *url.URL
+
+	if c.URL = os.Getenv("PROMETHEUS_REMOTE_WRITE_URL"); len(c.URL) == 0 {
+		err = fmt.Errorf("missing PROMETHEUS_REMOTE_WRITE_URL environment variable")
+		return
+	}
+
+	if u, err = url.Parse(c.URL); err != nil {
+		err = fmt.Errorf("invalid prometheus remote write URL: %s", err)
+		return
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("invalid prometheus remote write URL: only the HTTP and HTTPS protocols are supported but %s was found", u.Scheme)
+		return
+	}
+
+	if c.Instance = os.Getenv("PROMETHEUS_INSTANCE"); len(c.Instance) == 0 {
+		if c.Instance, err = os.Hostname(); err != nil {
+			err = fmt.Errorf("missing PROMETHEUS_INSTANCE environment variable: %s", err)
+			return
+		}
+	}
+
+	w = NewWriterWith(c)
+	return
+}
+
+func NewWriterWith(config WriterConfig) lib.Writer {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return writer{config}
+}
+
+type writer struct {
+	config WriterConfig
+}
+
+func (w writer) Close() error {
+	return nil
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch adds the events of the batch to the counters and
+// histograms and sends the new value of the ones that changed to the remote
+// write endpoint. They are only updated once the endpoint accepted them, so
+// retried batches aren't counted twice, and pushes are serialized so the values
+// sent never decrease.
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	metricsmtx.Lock()
+	defer metricsmtx.Unlock()
+
+	now := time.Now()
+	next := observe(batch, now)
+
+	if err = w.push(next.series(w.config.Instance, now)); err == nil {
+		next.commit()
+	}
+
+	return
+}
+
+func (w writer) push(series []timeSeries) error {
+	body := encodeSnappy(encodeWriteRequest(series))
+
+	req, err := http.NewRequest("POST", w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "ecs-logs")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	res, err := w.config.Client.Do(req)
+	if err != nil {
+		return lib.NewWriterError(lib.UnreachableError, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		err = lib.NewHTTPError("prometheus remote write", res)
+
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests:
+			err = lib.NewWriterError(lib.ThrottledError, err)
+		case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+			err = lib.NewWriterError(lib.AuthFailureError, err)
+		case res.StatusCode == http.StatusRequestEntityTooLarge:
+			err = lib.NewWriterError(lib.OversizedError, err)
+		case res.StatusCode/100 == 5:
+			err = lib.NewWriterError(lib.UnreachableError, err)
+		}
+	}
+
+	return err
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+type timeSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+type counterKey struct {
+	group string
+	level ecslogs.Level
+}
+
+type histogramKey struct {
+	name  string
+	group string
+}
+
+type histogram struct {
+	bounds []float64
+	counts []float64 // per bucket, the last one being +Inf
+	sum    float64
+	count  float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]float64, len(bounds)+1)}
+}
+
+func (h histogram) copy() histogram {
+	c := h
+	c.counts = append([]float64(nil), h.counts...)
+	return c
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// update holds the new values of the counters and histograms changed by a
+// batch, metricsmtx must be held while it is used.
+type update struct {
+	counters   map[counterKey]float64
+	histograms map[histogramKey]*histogram
+}
+
+// observe returns the values the counters and histograms would have after
+// counting the events of the batch by group and level and observing their
+// size and delay.
+func observe(batch lib.MessageBatch, now time.Time) update {
+	u := update{
+		counters:   make(map[counterKey]float64, 10),
+		histograms: make(map[histogramKey]*histogram, 10),
+	}
+
+	for _, msg := range batch {
+		k := counterKey{group: msg.Group, level: msg.Event.Level}
+
+		if _, ok := u.counters[k]; !ok {
+			u.counters[k] = counters[k]
+		}
+
+		u.counters[k]++
+
+		u.histogram(SizeMetricName, msg.Group, sizeBuckets).observe(float64(msg.ContentLength()))
+
+		if !msg.Event.Time.IsZero() {
+			delay := now.Sub(msg.Event.Time)
+
+			if delay < 0 {
+				delay = 0
+			}
+
+			u.histogram(DelayMetricName, msg.Group, delayBuckets).observe(delay.Seconds())
+		}
+	}
+
+	return u
+}
+
+func (u update) histogram(name string, group string, bounds []float64) *histogram {
+	k := histogramKey{name: name, group: group}
+
+	if h := u.histograms[k]; h != nil {
+		return h
+	}
+
+	h, ok := histograms[k]
+
+	if ok {
+		h = h.copy()
+	} else {
+		h = newHistogram(bounds)
+	}
+
+	u.histograms[k] = &h
+	return &h
+}
+
+// commit makes the values of the update the current values of the counters and
+// histograms.
+func (u update) commit() {
+	for k, v := range u.counters {
+		counters[k] = v
+	}
+
+	for k, h := range u.histograms {
+		histograms[k] = *h
+	}
+}
+
+// series returns the time series of the counters and histograms of the update,
+// labeled by instance if it isn't empty.
+func (u update) series(instance string, now time.Time) (series []timeSeries) {
+	ts := now.UnixNano() / int64(time.Millisecond)
+
+	// The labels of each series are sorted by name.
+	labels := func(name string, group string, extra ...label) []label {
+		l := []label{{"__name__", name}, {"group", group}}
+		if len(instance) != 0 {
+			l = append(l, label{"instance", instance})
+		}
+		return append(l, extra...)
+	}
+
+	for k, v := range u.counters {
+		series = append(series, timeSeries{
+			labels:    labels(MetricName, k.group, label{"level", strings.ToLower(k.level.String())}),
+			value:     v,
+			timestamp: ts,
+		})
+	}
+
+	for k, h := range u.histograms {
+		var cumulative float64
+
+		for i, count := range h.counts {
+			le := "+Inf"
+
+			if i < len(h.bounds) {
+				le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+			}
+
+			cumulative += count
+			series = append(series, timeSeries{
+				labels:    labels(k.name+"_bucket", k.group, label{"le", le}),
+				value:     cumulative,
+				timestamp: ts,
+			})
+		}
+
+		series = append(series,
+			timeSeries{labels: labels(k.name+"_sum", k.group), value: h.sum, timestamp: ts},
+			timeSeries{labels: labels(k.name+"_count", k.group), value: h.count, timestamp: ts},
+		)
+	}
+
+	sort.Slice(series, func(i int, j int) bool {
+		return seriesKey(series[i]) < seriesKey(series[j])
+	})
+	return
+}
+
+func seriesKey(s timeSeries) string {
+	values := make([]string, len(s.labels))
+
+	for i, l := range s.labels {
+		values[i] = l.value
+	}
+
+	return strings.Join(values, "\x00")
+}
+
+var (
+	metricsmtx sync.Mutex
+	counters   = map[counterKey]float64{}
+	histograms = map[histogramKey]histogram{}
+)
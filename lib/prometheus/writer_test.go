@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestWriter(t *testing.T) {
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Encoding") != "snappy" {
+			t.Error("invalid content encoding:", req.Header.Get("Content-Encoding"))
+		}
+		body, _ = ioutil.ReadAll(req.Body)
+	}))
+	defer server.Close()
+
+	w := NewWriterWith(WriterConfig{URL: server.URL, Instance: "host-1"})
+
+	if err := w.WriteMessageBatch(lib.MessageBatch{
+		{Group: "test-writer", Event: ecslogs.Event{Level: ecslogs.INFO, Time: time.Now()}},
+		{Group: "test-writer", Event: ecslogs.Event{Level: ecslogs.ERROR}},
+		{Group: "test-writer", Event: ecslogs.Event{Level: ecslogs.INFO}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{MetricName, SizeMetricName, DelayMetricName, "test-writer", "host-1", "info", "error"} {
+		if !bytes.Contains(body, []byte(s)) {
+			t.Errorf("%s not found in the request", s)
+		}
+	}
+}
+
+func TestWriterErrorKind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	w := NewWriterWith(WriterConfig{URL: server.URL})
+	err := w.WriteMessage(lib.Message{Group: "test-writer-error"})
+
+	if kind := lib.ErrorKindOf(err); kind != lib.ThrottledError {
+		t.Errorf("invalid error kind: %s (%v)", kind, err)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	now := time.Now()
+	batch := lib.MessageBatch{
+		{Group: "test-observe", Event: ecslogs.Event{Level: ecslogs.WARN, Time: now.Add(-2 * time.Second)}},
+		{Group: "test-observe", Event: ecslogs.Event{Level: ecslogs.WARN, Time: now.Add(-2 * time.Second)}},
+	}
+
+	metricsmtx.Lock()
+	defer metricsmtx.Unlock()
+
+	observe(batch, now).commit()
+	observe(batch, now) // not committed, as if the push had failed
+	series := observe(batch, now).series("host-1", now)
+
+	values := make(map[string]float64)
+
+	for _, s := range series {
+		if s.labels[1].value != "test-observe" || s.labels[2] != (label{"instance", "host-1"}) {
+			t.Errorf("invalid labels: %+v", s.labels)
+		}
+		key := s.labels[0].value
+		if len(s.labels) == 4 {
+			key += "{" + s.labels[3].value + "}"
+		}
+		values[key] = s.value
+	}
+
+	for key, value := range map[string]float64{
+		MetricName + "{warn}":             4,
+		SizeMetricName + "_bucket{256}":   4,
+		SizeMetricName + "_bucket{+Inf}":  4,
+		SizeMetricName + "_count":         4,
+		DelayMetricName + "_bucket{1}":    0,
+		DelayMetricName + "_bucket{10}":   4,
+		DelayMetricName + "_bucket{+Inf}": 4,
+		DelayMetricName + "_sum":          8,
+		DelayMetricName + "_count":        4,
+	} {
+		if v, ok := values[key]; !ok || v != value {
+			t.Errorf("%s: invalid value: %v", key, v)
+		}
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(res, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWriterWith(WriterConfig{URL: server.URL})
+	msg := lib.Message{Group: "test-writer-retry", Event: ecslogs.Event{Level: ecslogs.INFO}}
+
+	if err := w.WriteMessage(msg); err == nil {
+		t.Fatal("writing to an unavailable endpoint should fail")
+	}
+
+	if err := w.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	metricsmtx.Lock()
+	defer metricsmtx.Unlock()
+
+	if v := counters[counterKey{group: "test-writer-retry", level: ecslogs.INFO}]; v != 1 {
+		t.Errorf("retried events should be counted once: %v", v)
+	}
+}
@@ -0,0 +1,15 @@
+package lib
+
+import "time"
+
+// ProvenanceKey is the reserved key of the event data under which provenance
+// annotations are recorded.
+const ProvenanceKey = "_ecs_logs"
+
+// Provenance describes where and when a message entered the pipeline.
+type Provenance struct {
+	Source     string    `json:"source"`
+	Host       string    `json:"host"`
+	Cursor     string    `json:"cursor,omitempty"`
+	IngestTime time.Time `json:"ingest_time"`
+}
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestProvenanceJSON(t *testing.T) {
+	tests := []struct {
+		prov Provenance
+		json string
+	}{
+		{
+			prov: Provenance{Source: "journald", Host: "web-1", Cursor: "s=1;i=2", IngestTime: time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)},
+			json: `{"source":"journald","host":"web-1","cursor":"s=1;i=2","ingest_time":"2017-06-01T12:00:00Z"}`,
+		},
+		{
+			prov: Provenance{Source: "stdin", Host: "web-1", IngestTime: time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)},
+			json: `{"source":"stdin","host":"web-1","ingest_time":"2017-06-01T12:00:00Z"}`,
+		},
+	}
+
+	for _, test := range tests {
+		if b, err := json.Marshal(test.prov); err != nil {
+			t.Error(err)
+		} else if s := string(b); s != test.json {
+			t.Errorf("invalid provenance:\n - expected: %s\n - found:    %s", test.json, s)
+		}
+	}
+}
+
+func TestMessageCursorNotEncoded(t *testing.T) {
+	msg := Message{
+		Group:  "abc",
+		Stream: "0123456789",
+		Event:  ecslogs.Event{Message: "Hello World!"},
+		Cursor: "s=1;i=2",
+	}
+
+	var m map[string]interface{}
+
+	if err := json.Unmarshal(msg.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m["cursor"]; ok {
+		t.Errorf("the cursor of the message should not be encoded: %s", msg)
+	}
+
+	if _, ok := m["Cursor"]; ok {
+		t.Errorf("the cursor of the message should not be encoded: %s", msg)
+	}
+}
@@ -1,36 +1,190 @@
 package lib
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
+// MaxDecompressedSize is the maximum size of compressed input once
+// decompressed, reading fails past it so small payloads can't expand into
+// more than the program can process.
+const MaxDecompressedSize = 256 * 1024 * 1024
+
 type Reader interface {
 	io.Closer
 
 	ReadMessage() (Message, error)
 }
 
+// StopAtEndReader is implemented by readers of sources that keep receiving
+// data. After StopAtEnd is called they return io.EOF once they have read the
+// data currently available instead of waiting for more. StopAtEnd may be
+// called while ReadMessage is in progress in another goroutine.
+type StopAtEndReader interface {
+	Reader
+
+	StopAtEnd()
+}
+
+// PollingReader is implemented by readers that periodically check their source
+// for new data while they wait for messages, LastPoll returns the last time
+// they did so an idle reader can be told apart from a stuck one.
+type PollingReader interface {
+	Reader
+
+	LastPoll() time.Time
+}
+
 func NewMessageDecoder(r io.Reader) Reader {
-	return decoder{
-		j: json.NewDecoder(r),
-		r: r,
+	in := &input{r: bufio.NewReader(r)}
+	return &decoder{
+		j:  json.NewDecoder(in),
+		in: in,
+		r:  r,
 	}
 }
 
 type decoder struct {
-	j *json.Decoder
-	r io.Reader
+	j  *json.Decoder
+	in *input
+	r  io.Reader
+
+	// Messages unwrapped from an envelope that are still to be returned.
+	pending []Message
 }
 
-func (d decoder) Close() (err error) {
+func (d *decoder) Close() (err error) {
 	if c, ok := d.r.(io.Closer); ok {
 		err = c.Close()
 	}
 	return
 }
 
-func (d decoder) ReadMessage() (msg Message, err error) {
-	err = d.j.Decode(&msg)
+// ReadMessage decodes the next message from the input. Input that cannot be
+// decoded is reported with a ParseError, the following messages can still be
+// read after that. Envelopes holding multiple messages, like the payloads of
+// CloudWatch Logs subscriptions, are unwrapped.
+func (d *decoder) ReadMessage() (msg Message, err error) {
+	var raw json.RawMessage
+
+	for len(d.pending) == 0 {
+		if err = d.j.Decode(&raw); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				err = d.skipLine(err)
+			}
+			return
+		}
+
+		if msgs, ok := unwrapEnvelope(raw); ok {
+			d.pending = msgs
+			continue
+		}
+
+		if err = json.Unmarshal(raw, &msg); err != nil {
+			err = &ParseError{Input: string(raw), Err: err}
+		}
+
+		return
+	}
+
+	msg, d.pending = d.pending[0], d.pending[1:]
+	return
+}
+
+// skipLine discards the input up to the end of the line on which a syntax
+// error was found, decoding then resumes on the next line.
+func (d *decoder) skipLine(cause error) error {
+	// The data buffered by the decoder starts with the value that couldn't be
+	// decoded (after the white spaces preceding it), it is followed by what
+	// the decoder didn't read yet.
+	buffered, _ := ioutil.ReadAll(d.j.Buffered())
+	data := bytes.TrimLeft(append(buffered, d.in.buf...), " \t\r\n")
+	line := data
+	d.in.buf = nil
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line, d.in.buf = data[:i], data[i+1:]
+	} else {
+		s, _ := d.in.r.ReadString('\n')
+		line = append(line, s...)
+	}
+
+	d.j = json.NewDecoder(d.in)
+	return &ParseError{Input: strings.TrimSpace(string(line)), Err: cause}
+}
+
+// input is the reader consumed by the JSON decoder, data pushed back after a
+// syntax error is read before the rest of the input. Input starting with the
+// gzip or zstd magic numbers is decompressed.
+type input struct {
+	buf      []byte
+	r        *bufio.Reader
+	detected bool
+}
+
+func (in *input) Read(b []byte) (n int, err error) {
+	if !in.detected {
+		in.detected = true
+
+		var z io.Reader
+		var magic, _ = in.r.Peek(4)
+
+		switch {
+		case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+			z, err = gzip.NewReader(in.r)
+
+		case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+			// A single goroutine decodes the input synchronously, the
+			// decoder doesn't need to be closed.
+			z, err = zstd.NewReader(in.r, zstd.WithDecoderConcurrency(1))
+		}
+
+		if err != nil {
+			return
+		}
+
+		if z != nil {
+			in.r = bufio.NewReader(&decompressedReader{r: z, remaining: MaxDecompressedSize})
+		}
+	}
+
+	if len(in.buf) != 0 {
+		n = copy(b, in.buf)
+		in.buf = in.buf[n:]
+		return
+	}
+	return in.r.Read(b)
+}
+
+// decompressedReader fails once more than remaining bytes were read.
+type decompressedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (d *decompressedReader) Read(b []byte) (n int, err error) {
+	if d.remaining <= 0 {
+		// The input may end right at the limit.
+		if n, err = d.r.Read(make([]byte, 1)); n != 0 || err == nil {
+			n, err = 0, fmt.Errorf("the decompressed input is larger than %d bytes", MaxDecompressedSize)
+		}
+		return
+	}
+
+	if int64(len(b)) > d.remaining {
+		b = b[:d.remaining]
+	}
+
+	n, err = d.r.Read(b)
+	d.remaining -= int64(n)
 	return
 }
@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// DefaultPrefix is the prefix of the object keys when S3_PREFIX isn't set.
+const DefaultPrefix = "ecs-logs/"
+
+// Client is the subset of the S3 API used by the writer.
+type Client interface {
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+type WriterConfig struct {
+	Bucket string
+
+	// Prefix of the object keys, followed by the group, the stream, the date
+	// and a name unique to each batch.
+	Prefix string
+
+	// Hostname is part of the object names so writers running on different
+	// hosts don't overwrite each other's objects.
+	Hostname string
+
+	Client Client
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+
+	if c.Bucket = os.Getenv("S3_BUCKET"); len(c.Bucket) == 0 {
+		err = fmt.Errorf("missing S3_BUCKET environment variable")
+		return
+	}
+
+	if c.Prefix = os.Getenv("S3_PREFIX"); len(c.Prefix) == 0 {
+		c.Prefix = DefaultPrefix
+	}
+
+	if c.Hostname, err = os.Hostname(); err != nil {
+		return
+	}
+
+	c.Client = getClient(os.Getenv("S3_REGION"))
+	w = NewWriterWith(group, stream, c)
+	return
+}
+
+func NewWriterWith(group string, stream string, config WriterConfig) lib.Writer {
+	return writer{
+		WriterConfig: config,
+		group:        group,
+		stream:       stream,
+	}
+}
+
+type writer struct {
+	WriterConfig
+	group  string
+	stream string
+}
+
+func (w writer) Close() error {
+	return nil
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch uploads the batch as a gzipped object holding one JSON
+// message per line.
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var b bytes.Buffer
+	var z = gzip.NewWriter(&b)
+
+	if err = lib.NewMessageEncoder(z).WriteMessageBatch(batch); err != nil {
+		return
+	}
+
+	if err = z.Close(); err != nil {
+		return
+	}
+
+	if _, err = w.Client.PutObject(&s3.PutObjectInput{
+		Body:            bytes.NewReader(b.Bytes()),
+		Bucket:          aws.String(w.Bucket),
+		ContentEncoding: aws.String("gzip"),
+		ContentType:     aws.String("application/x-ndjson"),
+		Key:             aws.String(w.key(time.Now())),
+	}); err != nil {
+		err = lib.NewWriterError(errorKind(err), lib.HTTPErrorFrom("s3 PutObject", err))
+	}
+
+	return
+}
+
+// key returns the key of the object holding a batch written at now.
+func (w writer) key(now time.Time) string {
+	now = now.UTC()
+	return w.Prefix + path.Join(
+		w.group,
+		w.stream,
+		now.Format("2006/01/02"),
+		fmt.Sprintf("%s-%d-%d.json.gz", w.Hostname, now.UnixNano(), atomic.AddUint64(&seq, 1)),
+	)
+}
+
+func errorKind(err error) lib.ErrorKind {
+	e, ok := err.(awserr.Error)
+
+	if !ok {
+		return lib.UnknownError
+	}
+
+	switch e.Code() {
+	case "SlowDown", "ServiceUnavailable", "RequestTimeout":
+		return lib.ThrottledError
+
+	case "EntityTooLarge":
+		return lib.OversizedError
+
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+		return lib.AuthFailureError
+
+	case "RequestError":
+		return lib.UnreachableError
+	}
+
+	return lib.UnknownError
+}
+
+func getClient(region string) Client {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if client == nil {
+		config := &aws.Config{}
+		if len(region) != 0 {
+			config.Region = aws.String(region)
+		}
+		client = s3.New(session.New(config))
+	}
+
+	return client
+}
+
+var (
+	mutex  sync.Mutex
+	client *s3.S3
+
+	// seq makes the names of objects written in the same nanosecond unique.
+	seq uint64
+)
@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+type testClient struct {
+	inputs []*s3.PutObjectInput
+	bodies []string
+	err    error
+}
+
+func (c *testClient) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	z, err := gzip.NewReader(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(z)
+	if err != nil {
+		return nil, err
+	}
+	c.inputs = append(c.inputs, in)
+	c.bodies = append(c.bodies, string(b))
+	return &s3.PutObjectOutput{}, c.err
+}
+
+type testError struct{ code string }
+
+func (e testError) Error() string   { return e.code }
+func (e testError) Code() string    { return e.code }
+func (e testError) Message() string { return e.code }
+func (e testError) OrigErr() error  { return nil }
+
+func TestWriter(t *testing.T) {
+	c := &testClient{}
+	w := NewWriterWith("group", "stream", WriterConfig{
+		Bucket:   "bucket",
+		Prefix:   "logs/",
+		Hostname: "host",
+		Client:   c,
+	})
+
+	if err := w.WriteMessageBatch(lib.MessageBatch{
+		{Event: ecslogs.Event{Message: "a"}},
+		{Event: ecslogs.Event{Message: "b"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.inputs) != 1 {
+		t.Fatalf("a batch must be written as one object: %d", len(c.inputs))
+	}
+
+	if bucket := aws.StringValue(c.inputs[0].Bucket); bucket != "bucket" {
+		t.Errorf("invalid bucket: %s", bucket)
+	}
+
+	if key := aws.StringValue(c.inputs[0].Key); !strings.HasPrefix(key, "logs/group/stream/") || !strings.HasSuffix(key, ".json.gz") || !strings.Contains(key, "/host-") {
+		t.Errorf("invalid key: %s", key)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(c.bodies[0]), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"message":"b"`) {
+		t.Errorf("invalid object: %q", c.bodies[0])
+	}
+}
+
+func TestWriterError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind lib.ErrorKind
+	}{
+		{testError{"SlowDown"}, lib.ThrottledError},
+		{testError{"EntityTooLarge"}, lib.OversizedError},
+		{testError{"AccessDenied"}, lib.AuthFailureError},
+		{testError{"RequestError"}, lib.UnreachableError},
+		{testError{"NoSuchBucket"}, lib.UnknownError},
+		{errors.New("oops"), lib.UnknownError},
+	}
+
+	for _, test := range tests {
+		w := NewWriterWith("group", "stream", WriterConfig{Client: &testClient{err: test.err}})
+
+		if err := w.WriteMessage(lib.Message{}); lib.ErrorKindOf(err) != test.kind {
+			t.Errorf("%v: invalid error kind: %s", test.err, lib.ErrorKindOf(err))
+		}
+	}
+}
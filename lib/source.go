@@ -2,15 +2,56 @@ package lib
 
 import (
 	"io"
+	"net"
 	"os"
 	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/apex/log"
 )
 
 type Source interface {
 	Open() (Reader, error)
 }
 
+// FilteredSource is implemented by sources that can be opened multiple times
+// with different filters, so the load of a busy source is shared between
+// concurrent readers each handling a subset of its messages.
+type FilteredSource interface {
+	Source
+
+	OpenFilter(filter string) (Reader, error)
+}
+
+// SplitSourceSpecs splits a comma separated list of source specifications.
+// Filters may contain commas themselves, the elements that can't start a
+// specification, because they aren't a source name, continue the filter of
+// the previous one: "journald:A=1,B=2,journald:A=3" holds the "journald:A=1,B=2"
+// and "journald:A=3" specifications.
+func SplitSourceSpecs(s string) (specs []string) {
+	for _, item := range strings.Split(s, ",") {
+		name, _ := ParseSourceSpec(item)
+
+		if len(specs) != 0 && strings.ContainsAny(name, "=+<>") {
+			specs[len(specs)-1] += "," + item
+			continue
+		}
+
+		specs = append(specs, item)
+	}
+	return
+}
+
+// ParseSourceSpec splits a source specification formatted as name[:filter].
+func ParseSourceSpec(spec string) (name string, filter string) {
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
 type SourceFunc func() (Reader, error)
 
 func (f SourceFunc) Open() (Reader, error) {
@@ -103,3 +144,71 @@ func pipe(w *io.PipeWriter, r io.Reader) {
 
 	w.CloseWithError(err)
 }
+
+// The longest delay between two attempts to accept connections after a
+// temporary error.
+const maxAcceptDelay = 1 * time.Second
+
+// Accept passes the connections accepted by l to handle until done is closed.
+// Temporary errors, like running out of file descriptors, are retried with a
+// backoff like net/http.Server does. It returns nil once done is closed, or
+// the first error that isn't temporary.
+func Accept(l net.Listener, done <-chan struct{}, handle func(net.Conn)) error {
+	var delay time.Duration
+
+	for {
+		conn, err := l.Accept()
+
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+
+			if e, ok := err.(net.Error); !ok || !e.Temporary() {
+				return err
+			}
+
+			if delay *= 2; delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+
+			log.WithFields(log.Fields{
+				"address": l.Addr().String(),
+				"error":   err,
+				"delay":   delay,
+			}).Warn("failed to accept connection, retrying")
+
+			select {
+			case <-done:
+				return nil
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		delay = 0
+		handle(conn)
+	}
+}
+
+// IsLoopbackAddress returns whether a source listening on address only accepts
+// connections from the local host, an address without a host listens on all
+// interfaces.
+func IsLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil || len(host) == 0 {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSourceSpecs(t *testing.T) {
+	tests := []struct {
+		s     string
+		specs []string
+	}{
+		{"journald", []string{"journald"}},
+		{"journald,stdin", []string{"journald", "stdin"}},
+		{
+			"journald:CONTAINER_TAG=api,PRIORITY<=4,journald:CONTAINER_TAG=worker",
+			[]string{"journald:CONTAINER_TAG=api,PRIORITY<=4", "journald:CONTAINER_TAG=worker"},
+		},
+		{
+			"journald:CONTAINER_TAG=api,+,_SYSTEMD_UNIT=docker.service,stdin",
+			[]string{"journald:CONTAINER_TAG=api,+,_SYSTEMD_UNIT=docker.service", "stdin"},
+		},
+	}
+
+	for _, test := range tests {
+		if specs := SplitSourceSpecs(test.s); !reflect.DeepEqual(specs, test.specs) {
+			t.Errorf("%s: invalid specifications: %q", test.s, specs)
+		}
+	}
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		loopback bool
+	}{
+		{"127.0.0.1:5180", true},
+		{"[::1]:5180", true},
+		{"localhost:5180", true},
+		{":5180", false},
+		{"0.0.0.0:5180", false},
+		{"10.0.0.1:5180", false},
+		{"5180", false},
+	}
+
+	for _, test := range tests {
+		if loopback := IsLoopbackAddress(test.address); loopback != test.loopback {
+			t.Errorf("%s: loopback = %t", test.address, loopback)
+		}
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+type acceptListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *acceptListener) Accept() (net.Conn, error) {
+	if len(l.errs) == 0 {
+		return nil, errors.New("closed")
+	}
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	if err != nil {
+		return nil, err
+	}
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func (l *acceptListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestAccept(t *testing.T) {
+	l := &acceptListener{errs: []error{temporaryError{}, temporaryError{}, nil}}
+	n := 0
+
+	err := Accept(l, make(chan struct{}), func(conn net.Conn) {
+		conn.Close()
+		n++
+	})
+
+	if err == nil || err.Error() != "closed" {
+		t.Error("bad error:", err)
+	}
+
+	if n != 1 {
+		t.Error("bad number of accepted connections:", n)
+	}
+}
+
+func TestAcceptDone(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+
+	if err := Accept(&acceptListener{}, done, func(net.Conn) {}); err != nil {
+		t.Error(err)
+	}
+}
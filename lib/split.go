@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+// An EventSplitter splits the events carrying an array of records, like batched
+// application payloads, into one event per record so destinations index them
+// individually.
+type EventSplitter struct {
+	path []string
+}
+
+// NewEventSplitter returns a splitter of the events where field is an array,
+// nested fields are separated by dots.
+func NewEventSplitter(field string) *EventSplitter {
+	return &EventSplitter{path: strings.Split(field, ".")}
+}
+
+// Split returns one message per element of the array field of msg, where the
+// field is set to the element and the rest of the event is preserved. The ID of
+// the event, if any, is suffixed with the index of the element so the messages
+// can still be deduplicated by ID. Messages where the field is missing, empty
+// or not an array are returned unchanged.
+func (s *EventSplitter) Split(msg Message) []Message {
+	m := map[string]interface{}(msg.Event.Data)
+
+	for _, key := range s.path[:len(s.path)-1] {
+		if m, _ = m[key].(map[string]interface{}); m == nil {
+			return []Message{msg}
+		}
+	}
+
+	records, _ := m[s.path[len(s.path)-1]].([]interface{})
+
+	if len(records) == 0 {
+		return []Message{msg}
+	}
+
+	msgs := make([]Message, len(records))
+
+	for i, record := range records {
+		// The event data of each message is a deep copy so later stages can
+		// modify it in place.
+		data := copyMap(msg.Event.Data)
+		m := data
+
+		for _, key := range s.path[:len(s.path)-1] {
+			m = m[key].(map[string]interface{})
+		}
+
+		m[s.path[len(s.path)-1]] = record
+		msgs[i] = msg
+		msgs[i].Event.Data = ecslogs.EventData(data)
+
+		if len(msg.Event.Info.ID) != 0 {
+			msgs[i].Event.Info.ID = msg.Event.Info.ID + "-" + strconv.Itoa(i)
+		}
+	}
+
+	return msgs
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+
+	for k, v := range m {
+		if n, ok := v.(map[string]interface{}); ok {
+			v = copyMap(n)
+		}
+		c[k] = v
+	}
+
+	return c
+}
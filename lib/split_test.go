@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+)
+
+func TestEventSplitter(t *testing.T) {
+	msg := Message{
+		Group:  "group",
+		Stream: "stream",
+		Event: ecslogs.Event{
+			Message: "batch",
+			Data: ecslogs.EventData{
+				"service": "api",
+				"payload": map[string]interface{}{
+					"user":    map[string]interface{}{"id": 1},
+					"records": []interface{}{"a", map[string]interface{}{"b": 2}},
+				},
+			},
+		},
+	}
+
+	msgs := NewEventSplitter("payload.records").Split(msg)
+
+	if len(msgs) != 2 {
+		t.Fatalf("invalid number of messages: %d", len(msgs))
+	}
+
+	for i, record := range []interface{}{"a", map[string]interface{}{"b": 2}} {
+		m := msgs[i]
+
+		if m.Group != "group" || m.Stream != "stream" || m.Event.Message != "batch" || m.Event.Data["service"] != "api" {
+			t.Errorf("message %d: the shared metadata was not preserved: %+v", i, m)
+		}
+
+		payload := m.Event.Data["payload"].(map[string]interface{})
+
+		if !reflect.DeepEqual(payload["records"], record) {
+			t.Errorf("message %d: invalid record: %v", i, payload["records"])
+		}
+	}
+
+	// Modifying the data of a message doesn't affect the others.
+	msgs[0].Event.Data["payload"].(map[string]interface{})["user"].(map[string]interface{})["id"] = 2
+
+	if id := msgs[1].Event.Data["payload"].(map[string]interface{})["user"].(map[string]interface{})["id"]; id != 1 {
+		t.Error("the event data is shared between the messages")
+	}
+
+	if _, ok := msg.Event.Data["payload"].(map[string]interface{})["records"].([]interface{}); !ok {
+		t.Error("the original message must not be modified")
+	}
+}
+
+func TestEventSplitterNoArray(t *testing.T) {
+	tests := []ecslogs.EventData{
+		nil,
+		{"records": "a"},
+		{"records": []interface{}{}},
+	}
+
+	for _, data := range tests {
+		msg := Message{Event: ecslogs.Event{Data: data}}
+
+		if msgs := NewEventSplitter("records").Split(msg); len(msgs) != 1 || !reflect.DeepEqual(msgs[0], msg) {
+			t.Errorf("%v: the message must be returned unchanged", data)
+		}
+	}
+}
+
+func TestEventSplitterIDs(t *testing.T) {
+	msg := Message{Event: ecslogs.Event{
+		Info: ecslogs.EventInfo{ID: "1234"},
+		Data: ecslogs.EventData{"records": []interface{}{"a", "b"}},
+	}}
+
+	msgs := NewEventSplitter("records").Split(msg)
+
+	if len(msgs) != 2 || msgs[0].Event.Info.ID != "1234-0" || msgs[1].Event.Info.ID != "1234-1" {
+		t.Errorf("the split events must have distinct IDs: %+v", msgs)
+	}
+
+	msg.Event.Info.ID = ""
+
+	for _, m := range NewEventSplitter("records").Split(msg) {
+		if len(m.Event.Info.ID) != 0 {
+			t.Errorf("events without IDs must not get one: %s", m.Event.Info.ID)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// DefaultSpoolMaxBytes is the default limit of the size of the batches kept in
+// a spool directory.
+const DefaultSpoolMaxBytes = 100 * 1024 * 1024
+
+// ErrSpoolFull is returned when pushing a batch would exceed the size limit of
+// a spool.
+var ErrSpoolFull = errors.New("the spool directory is full")
+
+// A Spool persists batches that couldn't be written to a destination in a
+// directory, so they can be replayed once writes succeed again. The size and
+// number of the spooled files are tracked so the directory is only listed when
+// replaying.
+type Spool struct {
+	dir       string
+	max       int64
+	mutex     sync.Mutex
+	seq       int64
+	used      int64
+	count     int
+	replaying int32
+}
+
+// OpenSpool returns a spool keeping its batches in dir, which is created if it
+// doesn't exist, up to max bytes (DefaultSpoolMaxBytes when zero). Batches
+// spooled before are replayed too.
+func OpenSpool(dir string, max int64) (s *Spool, err error) {
+	var list []os.FileInfo
+
+	if max == 0 {
+		max = DefaultSpoolMaxBytes
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	if list, err = ioutil.ReadDir(dir); err != nil {
+		return
+	}
+
+	s = &Spool{dir: dir, max: max}
+
+	for _, f := range list {
+		if strings.HasSuffix(f.Name(), ".spool") {
+			s.used += f.Size()
+			s.count++
+		}
+	}
+
+	return
+}
+
+// Push writes batch to a new file of the spool directory, unless it would
+// exceed the size limit of the spool.
+func (s *Spool) Push(batch MessageBatch) (err error) {
+	var buf bytes.Buffer
+
+	if err = NewMessageEncoder(&buf).WriteMessageBatch(batch); err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.used+int64(buf.Len()) > s.max {
+		return ErrSpoolFull
+	}
+
+	// Files are written under a temporary name so partial batches are never
+	// replayed.
+	s.seq++
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d-%06d.spool", time.Now().UnixNano(), s.seq))
+
+	if err = ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return
+	}
+
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return
+	}
+
+	s.used += int64(buf.Len())
+	s.count++
+	return
+}
+
+// Pending returns the number of batches waiting to be replayed.
+func (s *Spool) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Size returns the number of bytes used by the spooled batches.
+func (s *Spool) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.used
+}
+
+// Replay passes the spooled batches to write in the order they were spooled,
+// removing them once written, until the spool is empty. It stops at the first
+// batch that fails to be written, and does nothing if another goroutine is
+// already replaying.
+func (s *Spool) Replay(write func(MessageBatch) error) (n int, err error) {
+	if !atomic.CompareAndSwapInt32(&s.replaying, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.replaying, 0)
+
+	for {
+		var files []string
+
+		if files, err = s.files(); err != nil || len(files) == 0 {
+			return
+		}
+
+		for _, path := range files {
+			var batch MessageBatch
+
+			if batch, err = readSpoolFile(path); err != nil {
+				log.WithFields(log.Fields{
+					"file":  path,
+					"error": err,
+				}).Error("discarding corrupted spool file")
+			} else if err = write(batch); err != nil {
+				return
+			}
+
+			s.remove(path)
+			n++
+		}
+	}
+}
+
+func (s *Spool) remove(path string) {
+	info, err := os.Stat(path)
+
+	if err == nil {
+		err = os.Remove(path)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  path,
+			"error": err,
+		}).Error("failed to remove spool file")
+		return
+	}
+
+	s.mutex.Lock()
+	s.used -= info.Size()
+	s.count--
+	s.mutex.Unlock()
+}
+
+func (s *Spool) files() (files []string, err error) {
+	var list []os.FileInfo
+
+	if list, err = ioutil.ReadDir(s.dir); err != nil {
+		return
+	}
+
+	for _, f := range list {
+		if strings.HasSuffix(f.Name(), ".spool") {
+			files = append(files, filepath.Join(s.dir, f.Name()))
+		}
+	}
+
+	sort.Strings(files)
+	return
+}
+
+func readSpoolFile(path string) (batch MessageBatch, err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+
+	d := NewMessageDecoder(bytes.NewReader(b))
+
+	for {
+		var msg Message
+
+		if msg, err = d.ReadMessage(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		batch = append(batch, msg)
+	}
+}
@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := []MessageBatch{
+		{{Group: "abc", Stream: "0"}, {Group: "abc", Stream: "1"}},
+		{{Group: "def", Stream: "2"}},
+	}
+
+	for _, batch := range batches {
+		if err := s.Push(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Batches are kept when they fail to be replayed.
+	if _, err := s.Replay(func(MessageBatch) error { return errors.New("oops") }); err == nil {
+		t.Error("expected an error when replaying to a failing writer")
+	}
+
+	var replayed []MessageBatch
+
+	n, err := s.Replay(func(batch MessageBatch) error {
+		replayed = append(replayed, batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("invalid number of batches replayed: %d", n)
+	}
+
+	for i := range replayed {
+		for j := range replayed[i] {
+			if m := replayed[i][j]; m.Group != batches[i][j].Group || m.Stream != batches[i][j].Stream {
+				t.Errorf("invalid message replayed: %v", m)
+			}
+		}
+	}
+
+	if files, _ := s.files(); len(files) != 0 {
+		t.Errorf("spool files left after replaying: %v", files)
+	}
+
+	if n, size := s.Pending(), s.Size(); n != 0 || size != 0 {
+		t.Errorf("invalid spool state after replaying: %d batches, %d bytes", n, size)
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSpool(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := MessageBatch{{Group: "abc", Stream: "0"}}
+
+	for err == nil {
+		err = s.Push(batch)
+	}
+
+	if err != ErrSpoolFull {
+		t.Errorf("invalid error: %v", err)
+	}
+
+	if size := s.Size(); size > 100 {
+		t.Errorf("the spool exceeds its size limit: %d bytes", size)
+	}
+}
+
+func TestSpoolReplayPushedWhileReplaying(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Push(MessageBatch{{Group: "abc", Stream: "0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var streams []string
+
+	n, err := s.Replay(func(batch MessageBatch) error {
+		if len(streams) == 0 {
+			if err := s.Push(MessageBatch{{Group: "abc", Stream: "1"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		streams = append(streams, batch[0].Stream)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 || len(streams) != 2 || streams[0] != "0" || streams[1] != "1" {
+		t.Errorf("invalid batches replayed: %d %v", n, streams)
+	}
+}
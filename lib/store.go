@@ -12,6 +12,13 @@ func NewStore() *Store {
 	}
 }
 
+func (store *Store) Get(group string, stream string) *Stream {
+	if g := store.groups[group]; g != nil {
+		return g.Get(stream)
+	}
+	return nil
+}
+
 func (store *Store) Add(msg Message, now time.Time) (group *Group, stream *Stream) {
 	if group = store.groups[msg.Group]; group == nil {
 		group = NewGroup(msg.Group, now)
@@ -13,6 +13,8 @@ type Stream struct {
 	createdOn time.Time
 	updatedOn time.Time
 	flushedOn time.Time
+	beatOn    time.Time
+	idle      bool
 }
 
 type StreamLimits struct {
@@ -45,10 +47,50 @@ func (stream *Stream) Name() string {
 	return stream.name
 }
 
+// Pending returns the number of messages buffered in the stream and their
+// size in bytes.
+func (stream *Stream) Pending() (messages int, bytes int) {
+	return len(stream.messages), stream.bytes
+}
+
 func (stream *Stream) Add(msg Message, now time.Time) {
 	stream.bytes += msg.ContentLength()
 	stream.messages = append(stream.messages, msg)
 	stream.updatedOn = now
+	stream.idle = false
+}
+
+// MarkIdle adds msg to the stream to signal that it stopped receiving
+// messages, unless it was already marked idle and nothing was added since.
+// Like heartbeats the message doesn't count as activity on the stream.
+func (stream *Stream) MarkIdle(msg Message) bool {
+	if stream.idle {
+		return false
+	}
+	stream.bytes += msg.ContentLength()
+	stream.messages = append(stream.messages, msg)
+	stream.idle = true
+	return true
+}
+
+// Heartbeat adds msg to the stream if no message was added and no heartbeat
+// was emitted during the last interval. Heartbeats don't count as activity on
+// the stream, idle streams still expire after the cache timeout.
+func (stream *Stream) Heartbeat(msg Message, interval time.Duration, now time.Time) bool {
+	last := stream.updatedOn
+
+	if stream.beatOn.After(last) {
+		last = stream.beatOn
+	}
+
+	if now.Sub(last) < interval {
+		return false
+	}
+
+	stream.bytes += msg.ContentLength()
+	stream.messages = append(stream.messages, msg)
+	stream.beatOn = now
+	return true
 }
 
 func (stream *Stream) HasExpired(timeout time.Duration, now time.Time) bool {
@@ -109,6 +109,65 @@ func TestStreamNotExpiredDueToTimeout(t *testing.T) {
 	}
 }
 
+func TestStreamHeartbeat(t *testing.T) {
+	ts := time.Now()
+	st := NewStream("A", "0123456789", ts)
+	hb := Message{
+		Group:  "A",
+		Stream: "0123456789",
+		Event: ecslogs.Event{
+			Time:    ts,
+			Message: "heartbeat",
+		},
+	}
+
+	if st.Heartbeat(hb, 2*time.Second, ts.Add(1*time.Second)) {
+		t.Error("no heartbeat should be emitted before the interval elapsed")
+	}
+
+	if !st.Heartbeat(hb, 2*time.Second, ts.Add(2*time.Second)) {
+		t.Error("a heartbeat should be emitted after the interval elapsed")
+	}
+
+	if st.Heartbeat(hb, 2*time.Second, ts.Add(3*time.Second)) {
+		t.Error("no heartbeat should be emitted right after a heartbeat")
+	}
+
+	if len(st.messages) != 1 || st.bytes != hb.ContentLength() {
+		t.Error("invalid stream state after heartbeat:", st.messages)
+	}
+
+	st.Flush(StreamLimits{Force: true}, ts.Add(3*time.Second))
+
+	if !st.HasExpired(2*time.Second, ts.Add(3*time.Second)) {
+		t.Error("heartbeats should not prevent streams from expiring")
+	}
+}
+
+func TestStreamMarkIdle(t *testing.T) {
+	ts := time.Now()
+	st := NewStream("A", "0123456789", ts)
+	m := Message{Group: "A", Stream: "0123456789"}
+
+	if !st.MarkIdle(m) {
+		t.Error("the stream should be marked idle")
+	}
+
+	if st.MarkIdle(m) {
+		t.Error("the stream should not be marked idle twice")
+	}
+
+	st.Add(m, ts)
+
+	if !st.MarkIdle(m) {
+		t.Error("the stream should be marked idle again after receiving messages")
+	}
+
+	if len(st.messages) != 3 {
+		t.Error("invalid list of messages in stream:", st.messages)
+	}
+}
+
 func TestStreamBytes(t *testing.T) {
 	ts := time.Now()
 	st := NewStream("A", "0123456789", ts)
@@ -0,0 +1,8 @@
+// +build !windows
+
+package syslog
+
+// defaultSocketPaths are the unix sockets tried when no syslog address is
+// configured. This was copied from the standard log/syslog package, they do
+// the same and try to guess at runtime which socket syslogd is using.
+var defaultSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
@@ -0,0 +1,7 @@
+// +build windows
+
+package syslog
+
+// There is no local syslog socket on windows, writers fall back to a syslog
+// server listening on the loopback interface when no address is configured.
+var defaultSocketPaths []string
@@ -0,0 +1,157 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// ECSStructuredDataID is the SD-ID of the element carrying the ECS task
+// metadata in RFC 5424 messages.
+const ECSStructuredDataID = "ecs@32473"
+
+// ecsMetadataTimeout is how long fetching the task metadata may take, and
+// ecsMetadataRetryInterval how long to wait before fetching it again when it
+// failed.
+const (
+	ecsMetadataTimeout       = 5 * time.Second
+	ecsMetadataRetryInterval = time.Minute
+)
+
+// ecsTaskMetadata is the subset of the response of the task metadata endpoint
+// written in the structured data.
+type ecsTaskMetadata struct {
+	Cluster          string
+	TaskARN          string
+	Family           string
+	Revision         string
+	AvailabilityZone string
+}
+
+// ecsContainerMetadata is the subset of the response of the container metadata
+// endpoint written in the structured data.
+type ecsContainerMetadata struct {
+	Name string
+}
+
+// The task metadata doesn't change while the task runs, it is fetched once and
+// shared by all writers.
+var ecsMetadata struct {
+	sync.Mutex
+	sd          string
+	fetching    bool
+	unavailable bool
+	retry       time.Time
+}
+
+// ecsStructuredData returns the SD-ELEMENT describing the ECS task ecs-logs
+// runs in, or an empty string while the task metadata isn't available. It
+// never blocks, the metadata is fetched in the background and fetched again
+// after a while when it failed.
+func ecsStructuredData() string {
+	ecsMetadata.Lock()
+	defer ecsMetadata.Unlock()
+
+	if len(ecsMetadata.sd) != 0 || ecsMetadata.fetching || ecsMetadata.unavailable || time.Now().Before(ecsMetadata.retry) {
+		return ecsMetadata.sd
+	}
+
+	uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+
+	if len(uri) == 0 {
+		uri = os.Getenv("ECS_CONTAINER_METADATA_URI")
+	}
+
+	if len(uri) == 0 {
+		log.Warn("the ECS task metadata endpoint is not available, ecs-logs must run on ECS")
+		ecsMetadata.unavailable = true
+		return ""
+	}
+
+	ecsMetadata.fetching = true
+	go fetchECSMetadata(uri)
+	return ""
+}
+
+func fetchECSMetadata(uri string) {
+	sd, err := fetchECSStructuredData(uri)
+
+	ecsMetadata.Lock()
+	defer ecsMetadata.Unlock()
+
+	ecsMetadata.fetching = false
+
+	if err != nil {
+		log.WithError(err).Warnf("failed to fetch the ECS task metadata, retrying in %s", ecsMetadataRetryInterval)
+		ecsMetadata.retry = time.Now().Add(ecsMetadataRetryInterval)
+		return
+	}
+
+	ecsMetadata.sd = sd
+}
+
+func fetchECSStructuredData(uri string) (sd string, err error) {
+	var task ecsTaskMetadata
+	var container ecsContainerMetadata
+
+	client := &http.Client{Timeout: ecsMetadataTimeout}
+
+	if err = fetchECSMetadataEndpoint(client, uri, &container); err != nil {
+		return
+	}
+
+	if err = fetchECSMetadataEndpoint(client, uri+"/task", &task); err != nil {
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('[')
+	b.WriteString(ECSStructuredDataID)
+
+	for _, param := range []struct{ name, value string }{
+		{"cluster", task.Cluster},
+		{"taskArn", task.TaskARN},
+		{"family", task.Family},
+		{"revision", task.Revision},
+		{"containerName", container.Name},
+		{"availabilityZone", task.AvailabilityZone},
+	} {
+		if len(param.value) != 0 {
+			b.WriteByte(' ')
+			b.WriteString(param.name)
+			b.WriteString(`="`)
+			writeParamValue(&b, param.value)
+			b.WriteByte('"')
+		}
+	}
+
+	b.WriteByte(']')
+	sd = b.String()
+	return
+}
+
+func fetchECSMetadataEndpoint(client *http.Client, uri string, v interface{}) (err error) {
+	var res *http.Response
+
+	if res, err = client.Get(uri); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = lib.NewHTTPError("ECS task metadata", res)
+		return
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+		err = fmt.Errorf("invalid ECS task metadata: %s", err)
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package syslog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchECSStructuredData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4/abc":
+			w.Write([]byte(`{"Name": "ecs-logs", "DockerId": "1234"}`))
+			return
+		case "/v4/abc/task":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"Cluster": "prod",
+			"TaskARN": "arn:aws:ecs:us-west-2:111122223333:task/prod/158d1c8083dd49d6b527399fd6414f5c",
+			"Family": "api",
+			"Revision": "42",
+			"Containers": []
+		}`))
+	}))
+	defer server.Close()
+
+	sd, err := fetchECSStructuredData(server.URL + "/v4/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sd != `[ecs@32473 cluster="prod" taskArn="arn:aws:ecs:us-west-2:111122223333:task/prod/158d1c8083dd49d6b527399fd6414f5c" family="api" revision="42" containerName="ecs-logs"]` {
+		t.Errorf("invalid structured data: %s", sd)
+	}
+
+	if _, err := fetchECSStructuredData(server.URL + "/v4/missing"); err == nil {
+		t.Error("fetching the metadata from an invalid endpoint should fail")
+	}
+}
+
+func TestECSStructuredDataRetry(t *testing.T) {
+	var fail int32 = 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) != 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Name": "ecs-logs", "Cluster": "prod"}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("ECS_CONTAINER_METADATA_URI_V4", server.URL)
+	defer os.Unsetenv("ECS_CONTAINER_METADATA_URI_V4")
+
+	ecsMetadata.Lock()
+	ecsMetadata.sd, ecsMetadata.fetching, ecsMetadata.unavailable, ecsMetadata.retry = "", false, false, time.Time{}
+	ecsMetadata.Unlock()
+
+	// waitFetched waits for the background fetch to complete and clears the
+	// retry delay.
+	waitFetched := func() {
+		for {
+			ecsMetadata.Lock()
+			fetching := ecsMetadata.fetching
+			ecsMetadata.retry = time.Time{}
+			ecsMetadata.Unlock()
+
+			if !fetching {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if sd := ecsStructuredData(); sd != "" {
+		t.Errorf("invalid structured data before fetching the metadata: %s", sd)
+	}
+	waitFetched()
+
+	atomic.StoreInt32(&fail, 0)
+
+	if sd := ecsStructuredData(); sd != "" {
+		t.Errorf("invalid structured data after failing to fetch the metadata: %s", sd)
+	}
+	waitFetched()
+
+	if sd := ecsStructuredData(); sd != `[ecs@32473 cluster="prod" containerName="ecs-logs"]` {
+		t.Errorf("invalid structured data after fetching the metadata: %s", sd)
+	}
+}
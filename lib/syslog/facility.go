@@ -0,0 +1,56 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultFacility is the facility of messages sent by writers that don't set
+// one explicitly (user-level messages).
+const DefaultFacility = 1
+
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"ntp":      12,
+	"security": 13,
+	"console":  14,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// ParseFacility returns the code of the syslog facility, which can be given by
+// name (daemon, local0, ...) or by value. An empty string is interpreted as
+// the default facility.
+func ParseFacility(s string) (int, error) {
+	if len(s) == 0 {
+		return DefaultFacility, nil
+	}
+
+	if f, ok := facilities[strings.ToLower(s)]; ok {
+		return f, nil
+	}
+
+	if f, err := strconv.Atoi(s); err == nil && f >= 0 && f <= 23 {
+		return f, nil
+	}
+
+	return 0, fmt.Errorf("invalid syslog facility: %s", s)
+}
@@ -0,0 +1,31 @@
+package syslog
+
+import "testing"
+
+func TestParseFacility(t *testing.T) {
+	tests := []struct {
+		s string
+		f int
+	}{
+		{"", 1},
+		{"user", 1},
+		{"daemon", 3},
+		{"LOCAL3", 19},
+		{"local7", 23},
+		{"16", 16},
+	}
+
+	for _, test := range tests {
+		if f, err := ParseFacility(test.s); err != nil {
+			t.Errorf("%q: %s", test.s, err)
+		} else if f != test.f {
+			t.Errorf("%q: invalid facility: %d != %d", test.s, f, test.f)
+		}
+	}
+
+	for _, s := range []string{"local8", "24", "-1", "whatever"} {
+		if _, err := ParseFacility(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package syslog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// EndpointStatus reports the health of an endpoint that messages are fanned
+// out to, Failures is the number of consecutive failed writes.
+type EndpointStatus struct {
+	Endpoint
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// Health returns the status of all endpoints used by fan-out writers, sorted
+// by network and address.
+func Health() (list []EndpointStatus) {
+	healthmtx.Lock()
+	list = make([]EndpointStatus, 0, len(healthmap))
+
+	for _, h := range healthmap {
+		list = append(list, h.EndpointStatus)
+	}
+
+	healthmtx.Unlock()
+
+	sort.Slice(list, func(i int, j int) bool {
+		if list[i].Network != list[j].Network {
+			return list[i].Network < list[j].Network
+		}
+		return list[i].Address < list[j].Address
+	})
+	return
+}
+
+// dialFanout returns a writer sending messages to the primary address and all
+// other endpoints of config. Endpoints that cannot be reached are skipped, the
+// call only fails if none of them could be.
+func dialFanout(config WriterConfig) (lib.Writer, error) {
+	var err error
+	var w = &fanoutWriter{}
+
+	endpoints := append([]Endpoint{{Network: config.Network, Address: config.Address}}, config.Endpoints...)
+
+	for _, e := range endpoints {
+		c := config
+		c.Network, c.Address, c.Mode, c.Endpoints = e.Network, e.Address, "", nil
+
+		h := getHealth(e)
+		ew, dialErr := DialWriter(c)
+
+		if dialErr != nil {
+			h.failed(dialErr, time.Now())
+			err = lib.AppendError(err, dialErr)
+			continue
+		}
+
+		w.endpoints = append(w.endpoints, fanoutEndpoint{health: h, writer: ew})
+	}
+
+	if len(w.endpoints) == 0 {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+type fanoutWriter struct {
+	endpoints []fanoutEndpoint
+}
+
+type fanoutEndpoint struct {
+	health *endpointHealth
+	writer lib.Writer
+}
+
+func (w *fanoutWriter) Close() (err error) {
+	for _, e := range w.endpoints {
+		if e2 := e.writer.Close(); e2 != nil {
+			err = lib.AppendError(err, e2)
+		}
+	}
+	return
+}
+
+func (w *fanoutWriter) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch duplicates the batch to all endpoints. The write succeeds
+// if at least one endpoint accepted the batch, retrying would otherwise send
+// it again to the healthy ones.
+func (w *fanoutWriter) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	ok := false
+
+	for _, e := range w.endpoints {
+		if e2 := e.writer.WriteMessageBatch(batch); e2 != nil {
+			e.health.failed(e2, time.Now())
+			err = lib.AppendError(err, e2)
+		} else {
+			e.health.succeeded()
+			ok = true
+		}
+	}
+
+	if ok {
+		err = nil
+	}
+
+	return
+}
+
+type endpointHealth struct {
+	EndpointStatus
+}
+
+func (h *endpointHealth) failed(err error, now time.Time) {
+	healthmtx.Lock()
+	h.Healthy = false
+	h.Failures++
+	h.LastError = err.Error()
+	h.LastFailure = now
+	healthmtx.Unlock()
+
+	log.WithFields(log.Fields{
+		"network": h.Network,
+		"address": h.Address,
+		"error":   err,
+	}).Warn("syslog endpoint failed")
+}
+
+func (h *endpointHealth) succeeded() {
+	healthmtx.Lock()
+	h.Healthy = true
+	h.Failures = 0
+	healthmtx.Unlock()
+}
+
+func getHealth(e Endpoint) (h *endpointHealth) {
+	healthmtx.Lock()
+	key := e.Network + "://" + e.Address
+
+	if h = healthmap[key]; h == nil {
+		h = &endpointHealth{EndpointStatus{Endpoint: e, Healthy: true}}
+		healthmap[key] = h
+	}
+
+	healthmtx.Unlock()
+	return
+}
+
+var (
+	healthmtx sync.Mutex
+	healthmap = map[string]*endpointHealth{}
+)
@@ -0,0 +1,55 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestFanoutWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	up := getHealth(Endpoint{Network: "test", Address: "up"})
+	down := getHealth(Endpoint{Network: "test", Address: "down"})
+
+	w := &fanoutWriter{
+		endpoints: []fanoutEndpoint{
+			{health: up, writer: lib.NewMessageEncoder(b)},
+			{health: down, writer: failingWriter{}},
+		},
+	}
+
+	if err := w.WriteMessage(lib.Message{Group: "abc"}); err != nil {
+		t.Error("writing to at least one endpoint should succeed:", err)
+	}
+
+	if b.Len() == 0 {
+		t.Error("nothing was written to the healthy endpoint")
+	}
+
+	status := map[string]EndpointStatus{}
+	for _, s := range Health() {
+		status[s.Address] = s
+	}
+
+	if s := status["up"]; !s.Healthy || s.Failures != 0 {
+		t.Errorf("invalid status of the healthy endpoint: %+v", s)
+	}
+
+	if s := status["down"]; s.Healthy || s.Failures != 1 || s.LastError != "oops" {
+		t.Errorf("invalid status of the failing endpoint: %+v", s)
+	}
+
+	w.endpoints = w.endpoints[1:]
+
+	if err := w.WriteMessage(lib.Message{Group: "abc"}); err == nil {
+		t.Error("writing should fail when all endpoints fail")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Close() error                             { return nil }
+func (failingWriter) WriteMessage(lib.Message) error           { return errors.New("oops") }
+func (failingWriter) WriteMessageBatch(lib.MessageBatch) error { return errors.New("oops") }
@@ -3,5 +3,19 @@ package syslog
 import "github.com/kapralVV/ecs-logs/lib"
 
 func init() {
-	lib.RegisterDestination("syslog", lib.DestinationFunc(NewWriter))
+	lib.RegisterDestination("syslog", destination{})
+	lib.RegisterWarmUp("syslog", warmUp)
+	lib.RegisterCheck("syslog", check)
+}
+
+// destination opens syslog writers and forgets the state kept for streams
+// once they expired.
+type destination struct{}
+
+func (destination) Open(group string, stream string) (lib.Writer, error) {
+	return NewWriter(group, stream)
+}
+
+func (destination) Close(group string, stream string) {
+	removeRateLimiters(group, stream)
 }
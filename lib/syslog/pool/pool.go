@@ -2,6 +2,7 @@ package pool
 
 import (
 	"io"
+	"sync"
 	"time"
 
 	"github.com/jpillora/backoff"
@@ -17,6 +18,28 @@ type LimitedConnPool struct {
 	live   chan struct{} // Keep a count of living connections (in our hands, or the client)
 	signal chan struct{} // Used to wake up the connection producer
 	err    chan error    // Send dial errors back to the client
+	opts   Options
+
+	// Held while sending to the channels of the pool, which are closed once
+	// done is closed.
+	closing sync.RWMutex
+	done    chan struct{}
+}
+
+// Options configure when connections taken from the pool are closed and
+// replaced instead of being reused.
+type Options struct {
+	// Connections that stayed in the pool for longer than IdleTimeout are
+	// discarded, zero disables the eviction of idle connections.
+	IdleTimeout time.Duration
+
+	// Check is called before reusing a connection, those for which it returns
+	// an error are discarded.
+	Check func(io.WriteCloser) error
+
+	// Idle connections are checked every CheckInterval so dead connections
+	// are replaced before being needed, zero disables the periodic checks.
+	CheckInterval time.Duration
 }
 
 // conn wraps an io.WriteCloser, marking the connection as dead
@@ -27,6 +50,7 @@ type conn struct {
 	conn io.WriteCloser
 	pool *LimitedConnPool
 	dead bool
+	idle time.Time // when the connection was returned to the pool
 }
 
 func (w *conn) Write(p []byte) (int, error) {
@@ -47,13 +71,22 @@ type bufferedWriter interface {
 
 func (w *conn) Flush() error {
 	if t, ok := w.conn.(bufferedWriter); ok {
-		return t.Flush()
+		if err := t.Flush(); err != nil {
+			w.dead = true
+			return err
+		}
 	}
 	return nil
 }
 
 // NewLimited returns a new LimitedConnPool with the given size limit and dial function.
 func NewLimited(size int, dial func() (io.WriteCloser, error)) (*LimitedConnPool, error) {
+	return NewLimitedWithOptions(size, dial, Options{})
+}
+
+// NewLimitedWithOptions is like NewLimited but the reuse of connections is
+// configured by opts.
+func NewLimitedWithOptions(size int, dial func() (io.WriteCloser, error), opts Options) (*LimitedConnPool, error) {
 	// Tentative first try - if this doesn't work, we assume it never will
 	// and fail to initialize. This is admittedly not great, but we rely on
 	// unreachable addresses failing immediately in our syslog package, which,
@@ -72,11 +105,15 @@ func NewLimited(size int, dial func() (io.WriteCloser, error)) (*LimitedConnPool
 		// try to make this large enough to avoid dropping
 		// errors if clients only check errors occasionally
 		err: make(chan error, size),
+
+		opts: opts,
+		done: make(chan struct{}),
 	}
 
 	p.conns <- &conn{
 		conn: w,
 		pool: &p,
+		idle: time.Now(),
 	}
 	p.live <- struct{}{}
 
@@ -93,20 +130,20 @@ func NewLimited(size int, dial func() (io.WriteCloser, error)) (*LimitedConnPool
 			for len(p.live) < size {
 				w, err := dial()
 				if err != nil {
+					if !p.dialFailed(err) {
+						return
+					}
 					select {
-					case p.err <- err:
-					default:
-						// error channel is full, drop this error.
+					case <-time.After(backoff.Duration()):
+					case <-p.done:
+						return
 					}
-					time.Sleep(backoff.Duration())
 					continue
 				}
 				backoff.Reset()
-				p.conns <- &conn{
-					conn: w,
-					pool: &p,
+				if !p.add(w) {
+					return
 				}
-				p.live <- struct{}{}
 			}
 		}
 	}()
@@ -114,10 +151,22 @@ func NewLimited(size int, dial func() (io.WriteCloser, error)) (*LimitedConnPool
 	// kick off the producer
 	p.signal <- struct{}{}
 
+	if opts.CheckInterval != 0 {
+		go p.checkIdle(opts.CheckInterval)
+	}
+
 	return &p, nil
 }
 
 func (p *LimitedConnPool) Close() {
+	p.closing.Lock()
+	defer p.closing.Unlock()
+
+	if p.closed() {
+		return
+	}
+	close(p.done)
+
 	// Important to close this first, so the dialer doesn't loop again.
 	close(p.signal)
 
@@ -132,9 +181,70 @@ func (p *LimitedConnPool) Close() {
 	close(p.err)
 }
 
+// closed returns whether the pool was closed, the closing lock must be held.
+func (p *LimitedConnPool) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// add puts a connection made by the dialer in the pool, it returns false and
+// closes the connection if the pool was closed.
+func (p *LimitedConnPool) add(w io.WriteCloser) bool {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed() {
+		w.Close()
+		return false
+	}
+
+	p.conns <- &conn{
+		conn: w,
+		pool: p,
+		idle: time.Now(),
+	}
+	p.live <- struct{}{}
+	return true
+}
+
+// dialFailed reports a dial error to the client, it returns false if the pool
+// was closed.
+func (p *LimitedConnPool) dialFailed(err error) bool {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed() {
+		return false
+	}
+
+	select {
+	case p.err <- err:
+	default:
+		// error channel is full, drop this error.
+	}
+	return true
+}
+
 // put returns a connection to the pool. If the connection is dead,
 // it is removed from the pool so that a new connection can be dialed.
 func (p *LimitedConnPool) put(w *conn) error {
+	return p.release(w, time.Now())
+}
+
+// release is like put but sets the time at which the connection became idle.
+// Connections released after the pool was closed are closed.
+func (p *LimitedConnPool) release(w *conn, idle time.Time) error {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+
+	if p.closed() {
+		return w.conn.Close()
+	}
+
 	if w.dead {
 		// decrement the live connection count
 		<-p.live
@@ -147,17 +257,119 @@ func (p *LimitedConnPool) put(w *conn) error {
 
 		return w.conn.Close()
 	}
+	w.idle = idle
 	p.conns <- w
 	return nil
 }
 
+// reusable returns whether a connection taken from the pool can be handed to
+// the client, connections that cannot are closed so a new one gets dialed.
+func (p *LimitedConnPool) reusable(w *conn) bool {
+	if p.opts.IdleTimeout != 0 && time.Since(w.idle) > p.opts.IdleTimeout {
+		w.dead = true
+	} else if p.opts.Check != nil && p.opts.Check(w.conn) != nil {
+		w.dead = true
+	}
+
+	if w.dead {
+		p.put(w)
+		return false
+	}
+
+	return true
+}
+
+// checkIdle periodically takes the connections sitting in the pool and puts
+// back those that are still reusable.
+func (p *LimitedConnPool) checkIdle(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.checkConns(len(p.conns))
+	}
+}
+
+// checkConns checks up to n connections from the pool, the time at which
+// reusable connections became idle is preserved.
+func (p *LimitedConnPool) checkConns(n int) {
+	for ; n != 0; n-- {
+		select {
+		case c, ok := <-p.conns:
+			if !ok {
+				// The pool was closed.
+				return
+			}
+			if p.reusable(c) {
+				p.release(c, c.idle)
+			}
+		default:
+			return
+		}
+	}
+}
+
 // Get retrieves a connection from the pool, if available.
 // A new connection will only be dialed if the total number
 // of live connections is below the configured size limit.
 // Closing the returned io.WriteCloser automatically returns
-// the connection to the pool.
+// the connection to the pool. It returns nil if the pool was closed.
 func (p *LimitedConnPool) Get() io.WriteCloser {
-	return <-p.conns
+	for {
+		c := <-p.conns
+		if c == nil {
+			return nil
+		}
+		if p.reusable(c) {
+			return c
+		}
+	}
+}
+
+// TryGet is like Get but gives up if no connection becomes available within
+// the given timeout.
+func (p *LimitedConnPool) TryGet(timeout time.Duration) (io.WriteCloser, bool) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		// Connections already in the pool are taken even if the timer expired.
+		select {
+		case c := <-p.conns:
+			if c == nil {
+				return nil, false
+			}
+			if p.reusable(c) {
+				return c, true
+			}
+			continue
+		default:
+		}
+
+		select {
+		case c := <-p.conns:
+			if c == nil {
+				return nil, false
+			}
+			if p.reusable(c) {
+				return c, true
+			}
+		case <-t.C:
+			return nil, false
+		}
+	}
+}
+
+// Stats returns the number of live connections, the number of those idle in
+// the pool, and the maximum number of connections.
+func (p *LimitedConnPool) Stats() (live int, idle int, size int) {
+	return len(p.live), len(p.conns), cap(p.live)
 }
 
 // Errors returns a channel of errors encountered when dialing new
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -43,9 +44,18 @@ func TestPool(t *testing.T) {
 	}()
 
 	// report pool stats once per second
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
 		start := time.Now()
-		for range time.Tick(1 * time.Second) {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
 			t.Logf("T+%02.2vs: live=%d pool=%d failures=%d\n", time.Since(start).Seconds(), len(p.live), len(p.conns), atomic.LoadUint64(&failures))
 		}
 	}()
@@ -89,3 +99,175 @@ func TestPool(t *testing.T) {
 		t.Errorf("dialed %d connections, want %d", newConnections, poolSize)
 	}
 }
+
+func TestPoolOptions(t *testing.T) {
+	var dialed int32
+	var broken = errors.New("broken")
+
+	dial := func() (io.WriteCloser, error) {
+		atomic.AddInt32(&dialed, 1)
+		return &nopConn{}, nil
+	}
+
+	p, err := NewLimitedWithOptions(1, dial, Options{
+		IdleTimeout: 50 * time.Millisecond,
+		Check: func(w io.WriteCloser) error {
+			if w.(*nopConn).broken {
+				return broken
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Connections returned to the pool are reused.
+	w, _ := p.TryGet(time.Second)
+	w.Close()
+	w, _ = p.TryGet(time.Second)
+	w.Close()
+
+	if n := atomic.LoadInt32(&dialed); n != 1 {
+		t.Errorf("dialed %d connections, want 1", n)
+	}
+
+	// Connections failing the check are replaced.
+	w, _ = p.TryGet(time.Second)
+	w.(*conn).conn.(*nopConn).broken = true
+	w.Close()
+	w, ok := p.TryGet(time.Second)
+	if !ok || w.(*conn).conn.(*nopConn).broken {
+		t.Error("a broken connection was reused")
+	}
+	w.Close()
+
+	// Idle connections are replaced.
+	time.Sleep(100 * time.Millisecond)
+	w, ok = p.TryGet(time.Second)
+	if !ok {
+		t.Fatal("no connection available")
+	}
+	w.Close()
+
+	if n := atomic.LoadInt32(&dialed); n != 3 {
+		t.Errorf("dialed %d connections, want 3", n)
+	}
+}
+
+type nopConn struct {
+	broken bool
+}
+
+func (c *nopConn) Write(b []byte) (int, error) { return len(b), nil }
+
+func (c *nopConn) Close() error { return nil }
+
+func TestPoolCheckInterval(t *testing.T) {
+	var dialed int32
+	var conns = make(chan *nopConn, 10)
+
+	dial := func() (io.WriteCloser, error) {
+		atomic.AddInt32(&dialed, 1)
+		c := &nopConn{}
+		conns <- c
+		return c, nil
+	}
+
+	var mutex sync.Mutex
+	p, err := NewLimitedWithOptions(1, dial, Options{
+		CheckInterval: 10 * time.Millisecond,
+		Check: func(w io.WriteCloser) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if w.(*nopConn).broken {
+				return errors.New("broken")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// The connection breaks while sitting in the pool, it gets replaced
+	// without the client having to take it.
+	c := <-conns
+	mutex.Lock()
+	c.broken = true
+	mutex.Unlock()
+
+	select {
+	case <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("the broken connection wasn't replaced")
+	}
+
+	// Wait for the new connection to be in the pool before closing it.
+	if w, ok := p.TryGet(time.Second); ok {
+		w.Close()
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	var dials int32
+
+	p, err := NewLimited(2, func() (io.WriteCloser, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return nopCloser{}, nil
+		}
+		return nil, errors.New("unreachable")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := p.Get()
+
+	// Let the dialer report errors while the pool is closed.
+	time.Sleep(20 * time.Millisecond)
+	p.Close()
+	p.Close()
+
+	// Connections returned after the pool was closed are closed.
+	c.Write([]byte("hello"))
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if c := p.Get(); c != nil {
+		t.Error("getting a connection from a closed pool should return nil")
+	}
+
+	if _, ok := p.TryGet(time.Millisecond); ok {
+		t.Error("getting a connection from a closed pool should fail")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	p, err := NewLimited(1, func() (io.WriteCloser, error) { return nopCloser{}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	c := p.Get()
+
+	if live, idle, size := p.Stats(); live != 1 || idle != 0 || size != 1 {
+		t.Errorf("invalid stats of a pool with a connection in use: %d live, %d idle, %d max", live, idle, size)
+	}
+
+	c.Close()
+
+	if live, idle, size := p.Stats(); live != 1 || idle != 1 || size != 1 {
+		t.Errorf("invalid stats of a pool with an idle connection: %d live, %d idle, %d max", live, idle, size)
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Write(b []byte) (int, error) { return len(b), nil }
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,95 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPProxyFromEnvironment returns the URL of the HTTP proxy that connections
+// to address should be tunneled through, based on the HTTPS_PROXY and NO_PROXY
+// environment variables. An empty string is returned when no proxy is set.
+func HTTPProxyFromEnvironment(address string) string {
+	u, err := http.ProxyFromEnvironment(&http.Request{
+		URL: &url.URL{Scheme: "https", Host: address},
+	})
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+// dialHTTPProxy opens a tunnel to address through the HTTP proxy at proxyURL
+// with the CONNECT method.
+func dialHTTPProxy(dialer *net.Dialer, proxyURL string, address string) (conn net.Conn, err error) {
+	var u *url.URL
+	var res *http.Response
+
+	if u, err = url.Parse(proxyURL); err != nil {
+		return nil, fmt.Errorf("invalid HTTP proxy URL: %s", err)
+	}
+
+	host := u.Host
+	if _, _, err = net.SplitHostPort(host); err != nil {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+
+	switch u.Scheme {
+	case "http":
+		conn, err = dialer.Dial("tcp", host)
+	case "https":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported HTTP proxy protocol: %s", u.Scheme)
+	}
+
+	if err != nil {
+		return
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if dialer.Timeout != 0 {
+		conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+
+	if err = req.Write(conn); err == nil {
+		// Syslog servers don't send anything before the client does, so the
+		// buffered reader cannot consume data past the proxy response.
+		if res, err = http.ReadResponse(bufio.NewReader(conn), req); err == nil {
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				err = fmt.Errorf("HTTP proxy refused to connect to %s: %s", address, res.Status)
+			}
+		}
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return
+}
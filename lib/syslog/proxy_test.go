@@ -0,0 +1,93 @@
+package syslog
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDialHTTPProxy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+
+		if req.Method != "CONNECT" || req.Host != "logs.example.com:6514" {
+			received <- "unexpected request: " + req.Method + " " + req.Host
+			return
+		}
+
+		if user, pass, _ := parseProxyAuth(req); user != "user" || pass != "secret" {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			received <- "invalid credentials"
+			return
+		}
+
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		line, _ := r.ReadString('\n')
+		received <- line
+	}()
+
+	dialer := &net.Dialer{Timeout: time.Second}
+	conn, err := dialHTTPProxy(dialer, "http://user:secret@"+l.Addr().String(), "logs.example.com:6514")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("hello\n"))
+
+	if s := <-received; s != "hello\n" {
+		t.Error(s)
+	}
+}
+
+func TestDialHTTPProxyRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		http.ReadRequest(bufio.NewReader(conn))
+		conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+	}()
+
+	dialer := &net.Dialer{Timeout: time.Second}
+	if _, err := dialHTTPProxy(dialer, "http://"+l.Addr().String(), "logs.example.com:6514"); err == nil {
+		t.Error("tunneling through a proxy that refused the connection should fail")
+	}
+}
+
+func parseProxyAuth(req *http.Request) (user string, pass string, ok bool) {
+	// Reuse the parsing of the Authorization header.
+	r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+	return r.BasicAuth()
+}
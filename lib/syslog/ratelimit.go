@@ -0,0 +1,221 @@
+package syslog
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// Policies applied to messages exceeding the rate limit of their stream,
+// RateLimitDrop is used when no policy is set.
+const (
+	RateLimitDrop    = "drop"
+	RateLimitSummary = "summary"
+)
+
+// Writers are opened for each batch so the state of the rate limiters is kept
+// in a global map, indexed by group, stream and limits. The limiters of a
+// stream are removed when the stream expires.
+var (
+	rateLimitersLock sync.Mutex
+	rateLimiters     = make(map[string]*rateLimiter)
+)
+
+// rateLimit is the configuration of rate limiters.
+type rateLimit struct {
+	rate   float64
+	burst  int
+	policy string
+}
+
+func (l rateLimit) key(group, stream string) string {
+	return fmt.Sprintf("%s:%s:%g:%d:%s", group, stream, l.rate, l.burst, l.policy)
+}
+
+// limiter returns the rate limiter of the given stream.
+func (l rateLimit) limiter(group, stream string) *rateLimiter {
+	rateLimitersLock.Lock()
+	defer rateLimitersLock.Unlock()
+
+	key := l.key(group, stream)
+	r, ok := rateLimiters[key]
+	if !ok {
+		r = &rateLimiter{
+			rateLimit: l,
+			group:     group,
+			stream:    stream,
+			dropped:   lib.Metrics.Counter("syslog_rate_limited_total", "group", group, "stream", stream),
+		}
+		rateLimiters[key] = r
+	}
+
+	return r
+}
+
+// removeRateLimiters removes the rate limiters of the given stream and the
+// metric counting the messages they dropped.
+func removeRateLimiters(group, stream string) {
+	rateLimitersLock.Lock()
+	defer rateLimitersLock.Unlock()
+
+	for key, r := range rateLimiters {
+		if r.group == group && r.stream == stream {
+			delete(rateLimiters, key)
+		}
+	}
+
+	lib.Metrics.RemoveCounter("syslog_rate_limited_total", "group", group, "stream", stream)
+}
+
+// rateLimiter is a token bucket refilled at the configured rate, each message
+// written takes one token and the bucket holds at most burst tokens.
+type rateLimiter struct {
+	rateLimit
+	group  string
+	stream string
+
+	mutex   sync.Mutex
+	tokens  float64
+	last    time.Time
+	dropped *lib.Counter
+}
+
+// limit returns the messages of batch that fit in the rate limit. Messages at
+// the end of the batch are dropped first, with the summary policy they are
+// replaced by a single warning reporting how many were dropped.
+//
+// The tokens taken are only kept and the dropped messages only counted once
+// the reservation is committed, a batch that fails to be written is retried
+// so it must be given back its tokens with cancel.
+func (r *rateLimiter) limit(batch lib.MessageBatch, now time.Time) (lib.MessageBatch, rateReservation) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.last.IsZero() {
+		r.tokens = float64(r.burst)
+	} else if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens = math.Min(float64(r.burst), r.tokens+elapsed.Seconds()*r.rate)
+	}
+	r.last = now
+
+	n := len(batch)
+	if tokens := int(r.tokens); n > tokens {
+		n = tokens
+	}
+	r.tokens -= float64(n)
+
+	res := rateReservation{limiter: r, tokens: n, dropped: len(batch) - n}
+	dropped := res.dropped
+	if dropped == 0 {
+		return batch, res
+	}
+
+	if r.policy != RateLimitSummary {
+		return batch[:n], res
+	}
+
+	last := batch[len(batch)-1]
+	summary := lib.Message{
+		Group:  last.Group,
+		Stream: last.Stream,
+		Event:  ecslogs.MakeEvent(ecslogs.WARN, fmt.Sprintf("rate limited %d messages", dropped)),
+	}
+	summary.Event.Info.Host = last.Event.Info.Host
+	summary.Event.Time = last.Event.Time
+
+	// The batch is owned by the caller, its backing array must not be
+	// modified.
+	return append(batch[:n:n], summary), res
+}
+
+// rateReservation is the outcome of limiting a batch, the tokens it took and
+// how many of its messages were dropped.
+type rateReservation struct {
+	limiter *rateLimiter
+	tokens  int
+	dropped int
+}
+
+// commit counts the messages dropped from the batch once it was written.
+func (res rateReservation) commit() {
+	if res.dropped != 0 {
+		res.limiter.dropped.Add(int64(res.dropped))
+	}
+}
+
+// cancel gives back the tokens taken by a batch which couldn't be written.
+func (res rateReservation) cancel() {
+	r := res.limiter
+	r.mutex.Lock()
+	r.tokens = math.Min(float64(r.burst), r.tokens+float64(res.tokens))
+	r.mutex.Unlock()
+}
+
+// dialRateLimited opens a writer for config which drops the messages exceeding
+// its rate limit.
+func dialRateLimited(config WriterConfig) (lib.Writer, error) {
+	switch config.RateLimitPolicy {
+	case "", RateLimitDrop, RateLimitSummary:
+	default:
+		return nil, fmt.Errorf("unsupported syslog rate limit policy: %s", config.RateLimitPolicy)
+	}
+
+	if config.RateLimit < 0 {
+		return nil, fmt.Errorf("invalid syslog rate limit: %g", config.RateLimit)
+	}
+
+	l := rateLimit{
+		rate:   config.RateLimit,
+		burst:  config.RateLimitBurst,
+		policy: config.RateLimitPolicy,
+	}
+
+	if l.burst == 0 {
+		l.burst = int(math.Ceil(l.rate))
+	}
+
+	c := config
+	c.RateLimit = 0
+
+	w, err := DialWriter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return rateLimitedWriter{Writer: w, limit: l}, nil
+}
+
+type rateLimitedWriter struct {
+	lib.Writer
+	limit rateLimit
+}
+
+func (w rateLimitedWriter) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+func (w rateLimitedWriter) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	if len(batch) == 0 {
+		return
+	}
+
+	// Batches are made of messages of a single stream.
+	first := batch[0]
+	batch, res := w.limit.limiter(first.Group, first.Stream).limit(batch, time.Now())
+
+	if len(batch) != 0 {
+		err = w.Writer.WriteMessageBatch(batch)
+	}
+
+	if err != nil {
+		res.cancel()
+	} else {
+		res.commit()
+	}
+
+	return
+}
@@ -0,0 +1,110 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func makeRateLimitBatch(group, stream string, n int) lib.MessageBatch {
+	batch := make(lib.MessageBatch, n)
+	for i := range batch {
+		batch[i] = lib.Message{Group: group, Stream: stream, Event: ecslogs.MakeEvent(ecslogs.INFO, "hello")}
+	}
+	return batch
+}
+
+func limitBatch(r *rateLimiter, batch lib.MessageBatch, now time.Time) lib.MessageBatch {
+	batch, res := r.limit(batch, now)
+	res.commit()
+	return batch
+}
+
+func TestRateLimiterDrop(t *testing.T) {
+	l := rateLimit{rate: 10, burst: 5}
+	r := l.limiter("test-drop", "stream")
+	now := time.Now()
+
+	if n := len(limitBatch(r, makeRateLimitBatch("test-drop", "stream", 8), now)); n != 5 {
+		t.Errorf("the first batch must be limited to the burst: %d messages written", n)
+	}
+
+	if n := len(limitBatch(r, makeRateLimitBatch("test-drop", "stream", 8), now)); n != 0 {
+		t.Errorf("no message can be written until the bucket is refilled: %d messages written", n)
+	}
+
+	if n := len(limitBatch(r, makeRateLimitBatch("test-drop", "stream", 8), now.Add(300*time.Millisecond))); n != 3 {
+		t.Errorf("the bucket must be refilled at the configured rate: %d messages written", n)
+	}
+
+	if v := r.dropped.Value(); v != 16 {
+		t.Errorf("invalid count of dropped messages: %d", v)
+	}
+
+	if l.limiter("test-drop", "other") == r {
+		t.Error("streams must be limited independently")
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	r := rateLimit{rate: 1, burst: 5}.limiter("test-cancel", "stream")
+	now := time.Now()
+
+	batch, res := r.limit(makeRateLimitBatch("test-cancel", "stream", 8), now)
+	res.cancel()
+
+	if n := len(batch); n != 5 {
+		t.Errorf("the first batch must be limited to the burst: %d messages written", n)
+	}
+
+	if n := len(limitBatch(r, makeRateLimitBatch("test-cancel", "stream", 8), now)); n != 5 {
+		t.Errorf("a retried batch must be given back its tokens: %d messages written", n)
+	}
+
+	if v := r.dropped.Value(); v != 3 {
+		t.Errorf("the messages of a batch must be counted as dropped once: %d", v)
+	}
+}
+
+func TestRemoveRateLimiters(t *testing.T) {
+	l := rateLimit{rate: 1, burst: 1}
+	r := l.limiter("test-remove", "stream")
+	o := l.limiter("test-remove", "other")
+
+	removeRateLimiters("test-remove", "stream")
+
+	if l.limiter("test-remove", "stream") == r {
+		t.Error("the rate limiters of an expired stream must be removed")
+	}
+
+	if l.limiter("test-remove", "other") != o {
+		t.Error("the rate limiters of other streams must be kept")
+	}
+}
+
+func TestRateLimiterSummary(t *testing.T) {
+	r := rateLimit{rate: 1, burst: 2, policy: RateLimitSummary}.limiter("test-summary", "stream")
+	batch := makeRateLimitBatch("test-summary", "stream", 5)
+
+	limited := limitBatch(r, batch, time.Now())
+
+	if len(limited) != 3 {
+		t.Fatalf("invalid number of messages: %d", len(limited))
+	}
+
+	summary := limited[2]
+
+	if summary.Event.Level != ecslogs.WARN || summary.Event.Message != "rate limited 3 messages" {
+		t.Errorf("invalid summary event: %+v", summary.Event)
+	}
+
+	if summary.Group != "test-summary" || summary.Stream != "stream" {
+		t.Errorf("invalid summary stream: %s/%s", summary.Group, summary.Stream)
+	}
+
+	if batch[2].Event.Message != "hello" {
+		t.Error("the original batch must not be modified")
+	}
+}
@@ -0,0 +1,231 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultRELPWindow is the default number of messages sent to a RELP server
+// before waiting for them to be acknowledged.
+const DefaultRELPWindow = 128
+
+// relpOffer is sent when opening a RELP session, ecs-logs only sends syslog
+// messages.
+const relpOffer = "relp_version=0\nrelp_software=ecs-logs\ncommands=syslog"
+
+// relpMaxTxnr is the largest transaction number, the next one wraps to 1.
+const relpMaxTxnr = 999999999
+
+// relpConn sends syslog messages with the Reliable Event Logging Protocol,
+// each write is sent as one message and Flush returns once all messages were
+// acknowledged by the server.
+type relpConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	txnr    int
+	window  int
+	unacked map[int]struct{}
+	timeout time.Duration
+}
+
+// newRELPConn opens a RELP session on conn.
+func newRELPConn(conn net.Conn, window int, timeout time.Duration) (c *relpConn, err error) {
+	if window <= 0 {
+		window = DefaultRELPWindow
+	}
+
+	c = &relpConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		txnr:    1,
+		window:  window,
+		unacked: make(map[int]struct{}),
+		timeout: timeout,
+	}
+
+	if err = c.send("open", []byte(relpOffer)); err == nil {
+		err = c.wait(0)
+	}
+
+	if err != nil {
+		conn.Close()
+		c = nil
+	}
+
+	return
+}
+
+func (c *relpConn) Write(b []byte) (n int, err error) {
+	// The frame delimits the message, it doesn't need a trailing newline.
+	if err = c.send("syslog", bytes.TrimRight(b, "\n")); err != nil {
+		return
+	}
+
+	if len(c.unacked) >= c.window {
+		if err = c.wait(c.window / 2); err != nil {
+			return
+		}
+	}
+
+	return len(b), nil
+}
+
+func (c *relpConn) Flush() error {
+	return c.wait(0)
+}
+
+func (c *relpConn) Close() error {
+	if c.send("close", nil) == nil {
+		c.wait(0)
+	}
+	return c.conn.Close()
+}
+
+func (c *relpConn) send(cmd string, data []byte) (err error) {
+	fmt.Fprintf(c.w, "%d %s %d", c.txnr, cmd, len(data))
+
+	if len(data) != 0 {
+		c.w.WriteByte(' ')
+		c.w.Write(data)
+	}
+
+	if err = c.w.WriteByte('\n'); err == nil {
+		c.unacked[c.txnr] = struct{}{}
+
+		if c.txnr++; c.txnr > relpMaxTxnr {
+			c.txnr = 1
+		}
+	}
+
+	return
+}
+
+// wait flushes the frames sent so far and reads responses until no more than
+// max messages are left unacknowledged.
+func (c *relpConn) wait(max int) (err error) {
+	if c.timeout != 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	if err = c.w.Flush(); err != nil {
+		return
+	}
+
+	for len(c.unacked) > max {
+		var txnr int
+		var cmd string
+		var data []byte
+
+		if txnr, cmd, data, err = readRELPFrame(c.r); err != nil {
+			return
+		}
+
+		switch cmd {
+		case "rsp":
+		case "serverclose":
+			// The server is shutting down, the messages it didn't acknowledge
+			// must be sent again on a new session.
+			return fmt.Errorf("relp: session closed by the server")
+		default:
+			return fmt.Errorf("relp: unexpected %s command from the server", cmd)
+		}
+
+		if _, ok := c.unacked[txnr]; !ok {
+			return fmt.Errorf("relp: unexpected response to transaction %d", txnr)
+		}
+		delete(c.unacked, txnr)
+
+		if !bytes.HasPrefix(data, []byte("200")) {
+			return relpRejectedError{string(firstLine(data))}
+		}
+	}
+
+	return
+}
+
+// readRELPFrame reads a frame formatted as "TXNR COMMAND DATALEN[ DATA]\n".
+func readRELPFrame(r *bufio.Reader) (txnr int, cmd string, data []byte, err error) {
+	var s string
+	var n int
+
+	if s, err = readRELPToken(r); err != nil {
+		return
+	}
+
+	if txnr, err = strconv.Atoi(s); err != nil {
+		err = fmt.Errorf("relp: invalid transaction number: %s", s)
+		return
+	}
+
+	if cmd, err = readRELPToken(r); err != nil {
+		return
+	}
+
+	if s, err = readRELPToken(r); err != nil {
+		return
+	}
+
+	if n, err = strconv.Atoi(s); err != nil || n < 0 {
+		err = fmt.Errorf("relp: invalid data length: %s", s)
+		return
+	}
+
+	if n != 0 {
+		data = make([]byte, n)
+
+		if _, err = io.ReadFull(r, data); err != nil {
+			return
+		}
+
+		if _, err = r.ReadByte(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// readRELPToken reads the bytes up to the next space or newline, which is
+// discarded.
+func readRELPToken(r *bufio.Reader) (string, error) {
+	var b []byte
+
+	for {
+		c, err := r.ReadByte()
+
+		if err != nil {
+			return "", err
+		}
+
+		if c == ' ' || c == '\n' {
+			return string(b), nil
+		}
+
+		b = append(b, c)
+	}
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+// relpRejectedError is returned when the server rejects a message, sending it
+// again wouldn't help.
+type relpRejectedError struct {
+	reason string
+}
+
+func (e relpRejectedError) Error() string {
+	return "relp: message rejected by the server: " + e.reason
+}
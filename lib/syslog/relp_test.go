@@ -0,0 +1,164 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRELPConn(t *testing.T) {
+	// net.Pipe isn't buffered and would deadlock when both ends write, so the
+	// test runs over a local TCP connection.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []string, 1)
+
+	// The server acknowledges all frames and reports the syslog messages it
+	// received once the client closes the session.
+	go func() {
+		server, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			received <- nil
+			return
+		}
+		defer server.Close()
+
+		var msgs []string
+		r := bufio.NewReader(server)
+
+		for {
+			txnr, cmd, data, err := readRELPFrame(r)
+			if err != nil {
+				t.Error(err)
+				received <- msgs
+				return
+			}
+
+			switch cmd {
+			case "syslog":
+				msgs = append(msgs, string(data))
+			case "open":
+				if string(data) != relpOffer {
+					t.Errorf("invalid offer: %q", data)
+				}
+			}
+
+			if cmd == "syslog" && string(data) == "reject" {
+				fmt.Fprintf(server, "%d rsp 8 500 oops\n", txnr)
+			} else {
+				fmt.Fprintf(server, "%d rsp 6 200 OK\n", txnr)
+			}
+
+			if cmd == "close" {
+				received <- msgs
+				return
+			}
+		}
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newRELPConn(client, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"a\n", "b\n", "c\n"} {
+		if _, err := c.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(c.unacked); n != 0 {
+		t.Errorf("messages left unacknowledged after flushing: %d", n)
+	}
+
+	c.Write([]byte("reject"))
+
+	if err := c.Flush(); err == nil {
+		t.Error("flushing a rejected message should fail")
+	}
+
+	c.Close()
+
+	if msgs := <-received; !reflect.DeepEqual(msgs, []string{"a", "b", "c", "reject"}) {
+		t.Errorf("invalid messages received: %q", msgs)
+	}
+}
+
+func TestRELPConnServerClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server accepts the session then shuts down without acknowledging
+	// the messages.
+	go func() {
+		server, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer server.Close()
+
+		r := bufio.NewReader(server)
+
+		if txnr, _, _, err := readRELPFrame(r); err == nil {
+			fmt.Fprintf(server, "%d rsp 6 200 OK\n", txnr)
+		}
+
+		if _, _, _, err := readRELPFrame(r); err == nil {
+			fmt.Fprint(server, "0 serverclose 0\n")
+		}
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	c, err := newRELPConn(client, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Write([]byte("a\n"))
+
+	if err := c.Flush(); err == nil || err.Error() != "relp: session closed by the server" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestRELPTxnrWrap(t *testing.T) {
+	c := &relpConn{
+		w:       bufio.NewWriter(ioutil.Discard),
+		txnr:    relpMaxTxnr,
+		unacked: make(map[int]struct{}),
+	}
+
+	c.send("syslog", []byte("a"))
+	c.send("syslog", []byte("b"))
+
+	if !reflect.DeepEqual(c.unacked, map[int]struct{}{relpMaxTxnr: {}, 1: {}}) {
+		t.Errorf("invalid transaction numbers: %v", c.unacked)
+	}
+}
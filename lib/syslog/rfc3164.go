@@ -0,0 +1,85 @@
+package syslog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// rfc3164MaxLength is the maximum size of a BSD syslog message, the trailing
+// newline delimiting messages on stream transports is not accounted for.
+const rfc3164MaxLength = 1024
+
+// rfc3164TagMaxLength is the maximum length of the TAG field.
+const rfc3164TagMaxLength = 32
+
+func newRFC3164Formatter(cfg WriterConfig, facility int) formatter {
+	tag := mustParseTag(cfg.Tag)
+
+	// Unlike RFC 5424, RFC 3164 has no nil value for the HOSTNAME, messages
+	// of events without a host are sent with the name of the local host.
+	hostname, _ := os.Hostname()
+
+	if len(hostname) == 0 {
+		hostname = "localhost"
+	}
+
+	return func(w io.Writer, msg lib.Message) error {
+		var b bytes.Buffer
+		var m = makeMessage(msg, facility, "Jan _2 15:04:05", tag)
+		var tag = m.TAG
+
+		if len(tag) == 0 {
+			tag = m.GROUP
+		}
+
+		b.WriteByte('<')
+		b.WriteString(strconv.Itoa(m.PRIVAL))
+		b.WriteByte('>')
+		b.WriteString(m.TIMESTAMP)
+		b.WriteByte(' ')
+		if len(msg.Event.Info.Host) != 0 {
+			b.WriteString(headerField(msg.Event.Info.Host, 255))
+		} else {
+			b.WriteString(headerField(hostname, 255))
+		}
+		b.WriteByte(' ')
+		b.WriteString(rfc3164Tag(tag))
+
+		// The process ID is only written when the event has one.
+		if msg.Event.Info.PID != 0 {
+			b.WriteByte('[')
+			b.WriteString(m.PROCID)
+			b.WriteByte(']')
+		}
+
+		b.WriteString(": ")
+		b.WriteString(msg.Event.String())
+
+		if b.Len() > rfc3164MaxLength {
+			// The rune crossing the limit is cut entirely so the message
+			// remains valid UTF-8.
+			n := rfc3164MaxLength
+			for n > 0 && !utf8.RuneStart(b.Bytes()[n]) {
+				n--
+			}
+			b.Truncate(n)
+		}
+
+		b.WriteByte('\n')
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+}
+
+// rfc3164Tag returns s as a valid TAG, made of at most 32 alphanumeric
+// characters.
+func rfc3164Tag(s string) string {
+	return printable(s, rfc3164TagMaxLength, func(c byte) bool {
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	})
+}
@@ -0,0 +1,123 @@
+package syslog
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestRFC3164Formatter(t *testing.T) {
+	msg := lib.Message{
+		Group:  "my-service",
+		Stream: "0123456789",
+		Event: ecslogs.Event{
+			Level:   ecslogs.WARN,
+			Time:    time.Date(2016, 6, 3, 12, 23, 42, 0, time.UTC),
+			Info:    ecslogs.EventInfo{Host: "localhost", PID: 42},
+			Message: "Hello World!",
+		},
+	}
+
+	b := &bytes.Buffer{}
+	f := newRFC3164Formatter(WriterConfig{}, DefaultFacility)
+
+	if err := f(b, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := "<12>Jun  3 12:23:42 localhost my_service[42]: " + msg.Event.String() + "\n"
+
+	if s := b.String(); s != ref {
+		t.Errorf("invalid RFC 3164 message:\n- expected: %s- found:    %s", ref, s)
+	}
+}
+
+func TestRFC3164FormatterDefaults(t *testing.T) {
+	msg := lib.Message{
+		Group:  "my-service",
+		Stream: "0123456789",
+		Event: ecslogs.Event{
+			Level:   ecslogs.WARN,
+			Time:    time.Date(2016, 6, 3, 12, 23, 42, 0, time.UTC),
+			Message: "Hello World!",
+		},
+	}
+
+	b := &bytes.Buffer{}
+	f := newRFC3164Formatter(WriterConfig{}, DefaultFacility)
+
+	if err := f(b, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	hostname, _ := os.Hostname()
+	ref := "<12>Jun  3 12:23:42 " + headerField(hostname, 255) + " my_service: " + msg.Event.String() + "\n"
+
+	if s := b.String(); s != ref {
+		t.Errorf("invalid RFC 3164 message:\n- expected: %s- found:    %s", ref, s)
+	}
+}
+
+func TestRFC3164FormatterTruncate(t *testing.T) {
+	msg := lib.Message{
+		Group:  "abc",
+		Stream: "0123456789",
+		Event: ecslogs.Event{
+			Level:   ecslogs.INFO,
+			Time:    time.Now(),
+			Message: strings.Repeat("A", 2000),
+		},
+	}
+
+	b := &bytes.Buffer{}
+	f := newRFC3164Formatter(WriterConfig{Tag: "a-very-long-tag-that-does-not-fit-in-32-characters"}, DefaultFacility)
+
+	if err := f(b, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := b.Len(); n != rfc3164MaxLength+1 {
+		t.Errorf("invalid RFC 3164 message length: %d", n)
+	}
+
+	if !strings.Contains(b.String(), " a_very_long_tag_that_does_not_fi: ") {
+		t.Errorf("invalid RFC 3164 tag: %s", b.String())
+	}
+}
+
+func TestRFC3164FormatterTruncateRunes(t *testing.T) {
+	f := newRFC3164Formatter(WriterConfig{}, DefaultFacility)
+
+	// One of the paddings puts the limit in the middle of a rune.
+	for pad := 0; pad != 3; pad++ {
+		msg := lib.Message{
+			Group:  "abc",
+			Stream: "0123456789",
+			Event: ecslogs.Event{
+				Level:   ecslogs.INFO,
+				Time:    time.Now(),
+				Message: strings.Repeat("A", pad) + strings.Repeat("€", 1000),
+			},
+		}
+
+		b := &bytes.Buffer{}
+
+		if err := f(b, msg); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := b.Len(); n > rfc3164MaxLength+1 || n < rfc3164MaxLength-2 {
+			t.Errorf("invalid RFC 3164 message length: %d", n)
+		}
+
+		if !utf8.Valid(b.Bytes()) {
+			t.Errorf("invalid UTF-8 in RFC 3164 message: %q", b.String()[b.Len()-8:])
+		}
+	}
+}
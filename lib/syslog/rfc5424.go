@@ -0,0 +1,243 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// DefaultStructuredDataID is the SD-ID of the element carrying the event data
+// in RFC 5424 messages. 32473 is the private enterprise number reserved for
+// documentation (RFC 5612), deployments with their own number should set the
+// StructuredDataID field of the writer configuration.
+const DefaultStructuredDataID = "data@32473"
+
+// The RFC 5424 timestamp is RFC 3339 limited to microsecond precision.
+const rfc5424TimeFormat = "2006-01-02T15:04:05.999999Z07:00"
+
+func newRFC5424Formatter(cfg WriterConfig, facility int) formatter {
+	sdid := cfg.StructuredDataID
+
+	if len(sdid) == 0 {
+		sdid = DefaultStructuredDataID
+	}
+
+	tag := mustParseTag(cfg.Tag)
+
+	if cfg.ECSMetadata {
+		// Starts fetching the task metadata before the first message.
+		ecsStructuredData()
+	}
+
+	return func(w io.Writer, msg lib.Message) error {
+		var b bytes.Buffer
+		var m = makeMessage(msg, facility, rfc5424TimeFormat, tag)
+		var extra = cfg.StructuredData
+
+		if cfg.ECSMetadata {
+			extra += ecsStructuredData()
+		}
+
+		if msg.Event.Time.IsZero() {
+			m.TIMESTAMP = "-"
+		}
+
+		b.WriteByte('<')
+		b.WriteString(strconv.Itoa(m.PRIVAL))
+		b.WriteString(">1 ")
+		b.WriteString(m.TIMESTAMP)
+		b.WriteByte(' ')
+		b.WriteString(headerField(m.HOSTNAME, 255))
+		b.WriteByte(' ')
+		b.WriteString(headerField(appName(m), 48))
+		b.WriteByte(' ')
+		b.WriteString(headerField(m.STREAM, 128))
+		b.WriteByte(' ')
+		b.WriteString(headerField(m.MSGID, 32))
+		b.WriteByte(' ')
+		writeStructuredData(&b, extra, sdid, msg.Event.Data)
+
+		if len(msg.Event.Message) != 0 {
+			b.WriteByte(' ')
+			b.WriteString(msg.Event.Message)
+		}
+
+		b.WriteByte('\n')
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+}
+
+// appName returns the APP-NAME of a message, its tag or its group when it has
+// none, so a templated tag tells apart the services of a group.
+func appName(m message) string {
+	if len(m.TAG) != 0 {
+		return m.TAG
+	}
+	return m.GROUP
+}
+
+// writeStructuredData outputs the STRUCTURED-DATA part of a RFC 5424 message,
+// the extra SD-ELEMENTs followed by an element identified by sdid with one
+// parameter per field of the event data.
+func writeStructuredData(b *bytes.Buffer, extra string, sdid string, data ecslogs.EventData) {
+	if len(extra) == 0 && len(data) == 0 {
+		b.WriteByte('-')
+		return
+	}
+
+	b.WriteString(extra)
+
+	if len(data) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(data))
+
+	for k := range data {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	b.WriteByte('[')
+	b.WriteString(sdName(sdid))
+
+	for _, k := range keys {
+		b.WriteByte(' ')
+		b.WriteString(sdName(k))
+		b.WriteString(`="`)
+		writeParamValue(b, data[k])
+		b.WriteByte('"')
+	}
+
+	b.WriteByte(']')
+}
+
+func writeParamValue(b *bytes.Buffer, v interface{}) {
+	var s string
+
+	switch x := v.(type) {
+	case string:
+		s = x
+	default:
+		j, _ := json.Marshal(x)
+		s = string(j)
+	}
+
+	for i := 0; i != len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// headerField returns s as a valid RFC 5424 header field, which must be made
+// of printable US-ASCII characters and not exceed max bytes, or the NILVALUE
+// if s is empty.
+func headerField(s string, max int) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return printable(s, max, func(c byte) bool { return true })
+}
+
+// sdName returns s as a valid SD-NAME, which has the same constraints than a
+// header field but is limited to 32 bytes and cannot contain '=', ']' or '"'.
+func sdName(s string) string {
+	return printable(s, 32, validSDNameChar)
+}
+
+func validSDNameChar(c byte) bool {
+	return c > ' ' && c <= '~' && c != '=' && c != ']' && c != '"'
+}
+
+// validStructuredData returns whether s is a sequence of valid SD-ELEMENTs,
+// so it can be written verbatim in RFC 5424 messages.
+func validStructuredData(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+
+	for len(s) != 0 {
+		if s[0] != '[' {
+			return false
+		}
+
+		n := sdNameLen(s[1:])
+		if n == 0 {
+			return false
+		}
+		s = s[1+n:]
+
+		for len(s) != 0 && s[0] == ' ' {
+			s = s[1:]
+
+			n = sdNameLen(s)
+			if n == 0 || n+1 >= len(s) || s[n] != '=' || s[n+1] != '"' {
+				return false
+			}
+			s = s[n+2:]
+
+			// '"', '\' and ']' are escaped with a backslash in the values.
+			i := 0
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				} else if s[i] == ']' {
+					return false
+				}
+			}
+			if i >= len(s) {
+				return false
+			}
+			s = s[i+1:]
+		}
+
+		if len(s) == 0 || s[0] != ']' {
+			return false
+		}
+		s = s[1:]
+	}
+
+	return true
+}
+
+// sdNameLen returns the length of the SD-NAME at the beginning of s, or zero
+// if there is none or it is too long.
+func sdNameLen(s string) int {
+	n := 0
+	for n < len(s) && validSDNameChar(s[n]) {
+		n++
+	}
+	if n > 32 {
+		return 0
+	}
+	return n
+}
+
+func printable(s string, max int, valid func(byte) bool) string {
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	b := []byte(s)
+
+	for i, c := range b {
+		if c <= ' ' || c > '~' || !valid(c) {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
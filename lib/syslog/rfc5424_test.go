@@ -0,0 +1,91 @@
+package syslog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestRFC5424Formatter(t *testing.T) {
+	tests := []struct {
+		tag string
+		msg lib.Message
+		out string
+	}{
+		{
+			msg: lib.Message{
+				Group:  "abc",
+				Stream: "0123456789",
+				Event: ecslogs.Event{
+					Level:   ecslogs.INFO,
+					Time:    time.Date(2016, 6, 13, 12, 23, 42, 123456789, time.UTC),
+					Info:    ecslogs.EventInfo{Host: "localhost"},
+					Message: "Hello World!",
+				},
+			},
+			out: "<14>1 2016-06-13T12:23:42.123456Z localhost abc 0123456789 - - Hello World!\n",
+		},
+		{
+			tag: `{{.GROUP}}-{{.STREAM | substr 0 4}}`,
+			msg: lib.Message{
+				Group:  "my group",
+				Stream: "0123456789",
+				Event: ecslogs.Event{
+					Level: ecslogs.ERROR,
+					Time:  time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC),
+					Info:  ecslogs.EventInfo{ID: "42"},
+					Data: ecslogs.EventData{
+						"user":  "bob",
+						"quote": `"a]b\c"`,
+						"count": 10,
+					},
+					Message: "oops",
+				},
+			},
+			out: `<11>1 2016-06-13T12:23:42Z - my_group-0123 0123456789 42 [data@32473 count="10" quote="\"a\]b\\c\"" user="bob"] oops` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		f := newRFC5424Formatter(WriterConfig{Tag: test.tag}, DefaultFacility)
+
+		if err := f(b, test.msg); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if s := b.String(); s != test.out {
+			t.Errorf("invalid RFC 5424 message:\n- expected: %s- found:    %s", test.out, s)
+		}
+	}
+}
+
+func TestValidStructuredData(t *testing.T) {
+	tests := []struct {
+		sd    string
+		valid bool
+	}{
+		{``, true},
+		{`[origin@32473]`, true},
+		{`[origin@32473 env="prod"][meta@32473 a="1" b="\"\]\\"]`, true},
+		{`origin@32473`, false},
+		{`[origin@32473`, false},
+		{`[origin@32473 env=prod]`, false},
+		{`[origin@32473 env="prod]`, false},
+		{`[origin@32473 env="a]b"]`, false},
+		{`[origin@32473 env="prod"] `, false},
+		{`[]`, false},
+		{`[0123456789012345678901234567890123456789]`, false},
+		{"[origin@32473 env=\"\xff\"]", false},
+	}
+
+	for _, test := range tests {
+		if valid := validStructuredData(test.sd); valid != test.valid {
+			t.Errorf("%s: structured data validity should be %t", test.sd, test.valid)
+		}
+	}
+}
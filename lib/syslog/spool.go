@@ -0,0 +1,55 @@
+package syslog
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// DefaultSpoolMaxBytes is the default limit of the size of the batches kept in
+// a spool directory.
+const DefaultSpoolMaxBytes = lib.DefaultSpoolMaxBytes
+
+var (
+	spoolsLock sync.Mutex
+	spools     = map[string]*lib.Spool{}
+)
+
+// getSpool returns the spool of the given endpoint, its batches are kept in a
+// subdirectory of dir. The writers of an endpoint share its spool.
+func getSpool(dir string, max int64, e Endpoint) (s *lib.Spool, err error) {
+	name := strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(e.Network + "_" + e.Address)
+	dir = filepath.Join(dir, name)
+
+	spoolsLock.Lock()
+	defer spoolsLock.Unlock()
+
+	if s = spools[dir]; s == nil {
+		if s, err = lib.OpenSpool(dir, max); err != nil {
+			return
+		}
+		spools[dir] = s
+	}
+
+	return
+}
+
+// spoolWriter is used when the syslog server cannot be reached at all, it
+// spools the batches until a writer can be opened to replay them.
+type spoolWriter struct {
+	spool *lib.Spool
+}
+
+func (w spoolWriter) Close() error {
+	return nil
+}
+
+func (w spoolWriter) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+func (w spoolWriter) WriteMessageBatch(batch lib.MessageBatch) error {
+	return lib.NewWriterError(lib.UnreachableError, w.spool.Push(batch))
+}
@@ -0,0 +1,36 @@
+package syslog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestSpoolWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := Endpoint{Network: "tcp", Address: "localhost:514"}
+
+	s, err := getSpool(dir, 0, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if x, _ := getSpool(dir, 0, e); x != s {
+		t.Error("the writers of an endpoint should share its spool")
+	}
+
+	if err := (spoolWriter{s}).WriteMessageBatch(lib.MessageBatch{{Group: "abc", Stream: "0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Pending(); n != 1 {
+		t.Errorf("invalid number of spooled batches: %d", n)
+	}
+}
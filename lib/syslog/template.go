@@ -0,0 +1,88 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the functions available in syslog templates. Functions
+// taking a string have it as last argument so they can be used in pipelines,
+// for example {{.STREAM | substr 0 12}}.
+var templateFuncs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"substr":  substr,
+	"json":    toJSON,
+	"default": defaultValue,
+	"date":    formatDate,
+}
+
+// tagFunc renders the tag of a message.
+type tagFunc func(m *message) string
+
+// parseTag returns the function rendering tag, which may be a template over
+// the fields of the message, for example "{{.GROUP}}-{{.STREAM}}". Messages
+// for which the template fails to execute get an empty tag.
+func parseTag(tag string) (tagFunc, error) {
+	if !strings.Contains(tag, "{{") {
+		return func(*message) string { return tag }, nil
+	}
+
+	t, err := template.New("tag").Funcs(templateFuncs).Parse(tag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog tag template: %s", err)
+	}
+
+	return func(m *message) string {
+		var b bytes.Buffer
+		if t.Execute(&b, m) != nil {
+			return ""
+		}
+		return b.String()
+	}, nil
+}
+
+func mustParseTag(tag string) tagFunc {
+	f, err := parseTag(tag)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// substr returns the bytes of s between start and end, which are clamped to
+// the bounds of the string.
+func substr(start int, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(s) {
+		end = len(s)
+	}
+	if start >= end {
+		return ""
+	}
+	return s[start:end]
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// defaultValue returns def if v is the zero value of its type.
+func defaultValue(def interface{}, v interface{}) interface{} {
+	if v == nil || reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface()) {
+		return def
+	}
+	return v
+}
+
+func formatDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
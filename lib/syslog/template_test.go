@@ -0,0 +1,94 @@
+package syslog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	ecslogs "github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	msg := lib.Message{
+		Group:  "abc",
+		Stream: "0123456789abcdef",
+		Event: ecslogs.Event{
+			Level:   ecslogs.INFO,
+			Time:    time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC),
+			Data:    ecslogs.EventData{"request_id": "42"},
+			Message: "Hello World!",
+		},
+	}
+
+	tests := []struct {
+		template string
+		out      string
+	}{
+		{`{{.GROUP | upper}} {{"ABC" | lower}}`, "ABC abc\n"},
+		{`{{.STREAM | substr 0 12}} {{.STREAM | substr 10 100}} [{{.STREAM | substr 20 30}}]`, "0123456789ab abcdef []\n"},
+		{`{{.GROUP | json}}`, "\"abc\"\n"},
+		{`{{.TAG | default "none"}} {{.GROUP | default "none"}}`, "none abc\n"},
+		{`{{.TIME | date "2006-01-02"}}`, "2016-06-13\n"},
+		{`{{.DATA.request_id}} {{.DATA | json}}`, "42 {\"request_id\":\"42\"}\n"},
+	}
+
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		f := newTemplateFormatter(WriterConfig{Template: test.template}, DefaultFacility)
+
+		if err := f(b, msg); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if s := b.String(); s != test.out {
+			t.Errorf("%s: invalid output: %q != %q", test.template, test.out, s)
+		}
+	}
+}
+
+func TestTagTemplate(t *testing.T) {
+	msg := lib.Message{
+		Group:  "api",
+		Stream: "0123456789abcdef",
+		Event: ecslogs.Event{
+			Level:   ecslogs.INFO,
+			Time:    time.Date(2016, 6, 13, 12, 23, 42, 0, time.UTC),
+			Data:    ecslogs.EventData{"service": "billing"},
+			Message: "Hello World!",
+		},
+	}
+
+	tests := []struct {
+		tag string
+		out string
+	}{
+		{`static`, "static: api\n"},
+		{`{{.GROUP}}-{{.STREAM | substr 0 4}}`, "api-0123: api\n"},
+		{`{{.DATA.service | default "unknown"}}`, "billing: api\n"},
+	}
+
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		f, err := newFormatter(WriterConfig{Template: "{{.TAG}}: {{.GROUP}}", Tag: test.tag})
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if err := f(b, msg); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if s := b.String(); s != test.out {
+			t.Errorf("%s: invalid output: %q != %q", test.tag, test.out, s)
+		}
+	}
+
+	if _, err := newFormatter(WriterConfig{Tag: "{{.GROUP"}); err == nil {
+		t.Error("invalid tag templates must be reported")
+	}
+}
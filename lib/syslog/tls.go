@@ -0,0 +1,230 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+var (
+	tlsOnce   sync.Once
+	tlsConfig *tls.Config
+	tlsError  error
+
+	policyOnce  sync.Once
+	policy      tlsPolicy
+	policyError error
+
+	insecureOnce sync.Once
+)
+
+// getTLSConfig returns the TLS configuration of the syslog destination built
+// from the environment, it is loaded once and shared by all writers.
+func getTLSConfig() (*tls.Config, error) {
+	tlsOnce.Do(func() { tlsConfig, tlsError = loadTLSConfig() })
+	return tlsConfig, tlsError
+}
+
+func loadTLSConfig() (config *tls.Config, err error) {
+	var cert = os.Getenv("SYSLOG_TLS_CERT")
+	var key = os.Getenv("SYSLOG_TLS_KEY")
+	var ca = os.Getenv("SYSLOG_TLS_CA")
+
+	if len(cert) == 0 && len(key) == 0 && len(ca) == 0 {
+		return
+	}
+
+	config = &tls.Config{}
+
+	if len(cert) != 0 || len(key) != 0 {
+		var crt tls.Certificate
+
+		if crt, err = tls.LoadX509KeyPair(cert, key); err != nil {
+			err = fmt.Errorf("invalid syslog TLS client certificate: %s", err)
+			return
+		}
+
+		config.Certificates = []tls.Certificate{crt}
+	}
+
+	if len(ca) != 0 {
+		if config.RootCAs, err = loadCertPool(ca); err != nil {
+			err = fmt.Errorf("invalid syslog TLS CA: %s", err)
+			return
+		}
+	}
+
+	return
+}
+
+// loadCertPool creates a certificate pool from the PEM encoded certificates
+// found at path, which is either a file or a directory.
+func loadCertPool(path string) (pool *x509.CertPool, err error) {
+	var info os.FileInfo
+	var files []string
+	var found bool
+
+	if info, err = os.Stat(path); err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*")); err != nil {
+			return
+		}
+	} else {
+		files = []string{path}
+	}
+
+	pool = x509.NewCertPool()
+
+	for _, file := range files {
+		var b []byte
+
+		if info, err = os.Stat(file); err != nil {
+			return
+		}
+
+		if info.IsDir() {
+			continue
+		}
+
+		if b, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+
+		if pool.AppendCertsFromPEM(b) {
+			found = true
+		}
+	}
+
+	if !found {
+		err = fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return
+}
+
+// warnInsecureTLS logs that the verification of server certificates is
+// disabled, once when the program starts or the first time it's used.
+func warnInsecureTLS(address string) {
+	insecureOnce.Do(func() {
+		log.WithField("address", address).Warn("syslog TLS certificate verification is disabled, connections are not secure")
+	})
+}
+
+// insecureTLSConfig returns a copy of config that skips the verification of
+// server certificates. This is only meant for testing against servers using
+// self-signed certificates so a warning is logged.
+func insecureTLSConfig(config *tls.Config, address string) *tls.Config {
+	warnInsecureTLS(address)
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	config.InsecureSkipVerify = true
+	return config
+}
+
+// tlsPolicy carries the constraints that apply to all TLS connections made by
+// the syslog writer, including those of destinations built on top of it like
+// loggly or logdna.
+type tlsPolicy struct {
+	minVersion   uint16
+	cipherSuites []uint16
+}
+
+// applyTLSPolicy returns a copy of config with the TLS policy configured in
+// the environment applied to it.
+func applyTLSPolicy(config *tls.Config) (*tls.Config, error) {
+	policyOnce.Do(func() { policy, policyError = loadTLSPolicy() })
+
+	if policyError != nil {
+		return nil, policyError
+	}
+
+	if policy.minVersion == 0 && len(policy.cipherSuites) == 0 {
+		return config, nil
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	if policy.minVersion != 0 {
+		config.MinVersion = policy.minVersion
+	}
+
+	if len(policy.cipherSuites) != 0 {
+		config.CipherSuites = policy.cipherSuites
+	}
+
+	return config, nil
+}
+
+func loadTLSPolicy() (p tlsPolicy, err error) {
+	if s := os.Getenv("TLS_MIN_VERSION"); len(s) != 0 {
+		if p.minVersion, err = parseTLSVersion(s); err != nil {
+			return
+		}
+	}
+
+	if s := os.Getenv("TLS_CIPHER_SUITES"); len(s) != 0 {
+		if p.cipherSuites, err = parseCipherSuites(s); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseTLSVersion converts a version string like "1.2" or "TLS1.2" to its
+// protocol value.
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "tls") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS version: %s", s)
+	}
+}
+
+// parseCipherSuites converts a comma separated list of cipher suite names to
+// their IDs. Note that the cipher suites of TLS 1.3 are not configurable.
+func parseCipherSuites(s string) (ids []uint16, err error) {
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+
+search:
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+
+		for _, suite := range suites {
+			if suite.Name == name {
+				ids = append(ids, suite.ID)
+				continue search
+			}
+		}
+
+		return nil, fmt.Errorf("invalid TLS cipher suite: %s", name)
+	}
+
+	return
+}
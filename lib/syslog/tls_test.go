@@ -0,0 +1,115 @@
+package syslog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadCertPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ca.pem")
+
+	if err := ioutil.WriteFile(file, makeTestCertificate(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, dir} {
+		if pool, err := loadCertPool(path); err != nil {
+			t.Errorf("%s: %s", path, err)
+		} else if n := len(pool.Subjects()); n != 1 {
+			t.Errorf("%s: invalid number of certificates loaded: %d", path, n)
+		}
+	}
+
+	if _, err := loadCertPool(filepath.Join(dir, "README")); err == nil {
+		t.Error("loading a file with no certificates should fail")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		s string
+		v uint16
+	}{
+		{"1.0", tls.VersionTLS10},
+		{"1.1", tls.VersionTLS11},
+		{"1.2", tls.VersionTLS12},
+		{"TLS1.3", tls.VersionTLS13},
+	}
+
+	for _, test := range tests {
+		if v, err := parseTLSVersion(test.s); err != nil {
+			t.Errorf("%s: %s", test.s, err)
+		} else if v != test.v {
+			t.Errorf("%s: invalid version: %#x != %#x", test.s, v, test.v)
+		}
+	}
+
+	if _, err := parseTLSVersion("SSL3.0"); err == nil {
+		t.Error("parsing an unsupported version should fail")
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}
+
+	if !reflect.DeepEqual(ids, ref) {
+		t.Errorf("invalid cipher suites: %v != %v", ids, ref)
+	}
+
+	if _, err := parseCipherSuites("TLS_WHATEVER"); err == nil {
+		t.Error("parsing an unknown cipher suite should fail")
+	}
+}
+
+func makeTestCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ecs-logs test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
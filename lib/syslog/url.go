@@ -0,0 +1,173 @@
+package syslog
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// applyURLOptions sets the options passed as query parameters of the syslog
+// URL on the writer configuration, they take precedence over the environment
+// variables so a single URL can fully describe a destination, for example
+// tls://logs.example.com:6514?facility=local3&framing=octet-counted
+func applyURLOptions(c *WriterConfig, query url.Values) (err error) {
+	for name, values := range query {
+		value := values[len(values)-1]
+
+		switch name {
+		case "format":
+			c.Format = value
+		case "facility":
+			c.Facility = value
+		case "template":
+			c.Template = value
+		case "time_format":
+			c.TimeFormat = value
+		case "tag":
+			c.Tag = value
+		case "sd_id":
+			c.StructuredDataID = value
+		case "structured_data":
+			c.StructuredData = value
+		case "ecs_metadata":
+			c.ECSMetadata, err = strconv.ParseBool(value)
+		case "framing":
+			c.Framing = value
+		case "newlines":
+			c.Newlines = value
+		case "mode":
+			c.Mode = value
+		case "datagram_overflow":
+			c.DatagramOverflow = value
+		case "tls_insecure":
+			c.TLSInsecure, err = strconv.ParseBool(value)
+		case "dial_timeout":
+			c.DialTimeout, err = time.ParseDuration(value)
+		case "write_timeout":
+			c.WriteTimeout, err = time.ParseDuration(value)
+		case "dial_retry_interval":
+			c.DialRetryInterval, err = time.ParseDuration(value)
+		case "dial_retry_jitter":
+			c.DialRetryJitter, err = time.ParseDuration(value)
+		case "dial_attempts":
+			if c.DialAttempts, err = strconv.Atoi(value); err == nil && c.DialAttempts < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "max_datagram_size":
+			if c.MaxDatagramSize, err = strconv.Atoi(value); err == nil && c.MaxDatagramSize < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "pool":
+			var enabled bool
+			enabled, err = strconv.ParseBool(value)
+			c.PoolDisabled = !enabled
+		case "pool_size":
+			if c.PoolSize, err = strconv.Atoi(value); err == nil && c.PoolSize < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "pool_idle_timeout":
+			c.PoolIdleTimeout, err = time.ParseDuration(value)
+		case "pool_health_check":
+			c.PoolHealthCheck, err = strconv.ParseBool(value)
+		case "pool_check_interval":
+			c.PoolCheckInterval, err = time.ParseDuration(value)
+		case "keepalive":
+			c.KeepAlive, err = time.ParseDuration(value)
+		case "spool_dir":
+			c.SpoolDir = value
+		case "spool_max_bytes":
+			if c.SpoolMaxBytes, err = strconv.ParseInt(value, 10, 64); err == nil && c.SpoolMaxBytes < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "rate_limit":
+			if c.RateLimit, err = strconv.ParseFloat(value, 64); err == nil && c.RateLimit < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "rate_limit_burst":
+			if c.RateLimitBurst, err = strconv.Atoi(value); err == nil && c.RateLimitBurst < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "rate_limit_policy":
+			c.RateLimitPolicy = value
+		case "record_prefix":
+			c.RecordPrefix, err = lib.Unescape(value)
+		case "record_suffix":
+			c.RecordSuffix, err = lib.Unescape(value)
+		case "batch_header":
+			c.BatchHeader, err = lib.Unescape(value)
+		case "batch_footer":
+			c.BatchFooter, err = lib.Unescape(value)
+		case "relp_window":
+			if c.RELPWindow, err = strconv.Atoi(value); err == nil && c.RELPWindow < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		default:
+			return fmt.Errorf("unsupported syslog URL parameter: %s", name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid %s value in syslog URL: %s", name, value)
+		}
+	}
+
+	return
+}
+
+// legacyEnvironment lists the environment variables that predate the syslog
+// URL parameters, which replace them. The other variables are still
+// supported as an alternative to the parameters.
+var legacyEnvironment = []string{
+	"SYSLOG_TEMPLATE",
+	"SYSLOG_TIME_FORMAT",
+}
+
+// migrateURL returns the syslog URL equivalent to u combined with the legacy
+// options set in the environment, and the list of variables that were folded
+// into it.
+// Parameters already present in u are left untouched since they take
+// precedence over the environment.
+func migrateURL(u *url.URL, getenv func(string) string) (migrated *url.URL, vars []string) {
+	query := u.Query()
+
+	for _, name := range legacyEnvironment {
+		value := getenv(name)
+		param := strings.ToLower(strings.TrimPrefix(name, "SYSLOG_"))
+
+		if len(value) == 0 {
+			continue
+		}
+
+		if _, ok := query[param]; !ok {
+			query.Set(param, value)
+		}
+
+		vars = append(vars, name)
+	}
+
+	clone := *u
+	clone.RawQuery = query.Encode()
+	migrated = &clone
+	return
+}
+
+var warnLegacyEnvironmentOnce sync.Once
+
+// warnLegacyEnvironment logs the syslog URL that replaces the legacy options
+// set as environment variables, once per process.
+func warnLegacyEnvironment(u *url.URL) {
+	warnLegacyEnvironmentOnce.Do(func() {
+		if migrated, vars := migrateURL(u, os.Getenv); len(vars) != 0 {
+			log.WithFields(log.Fields{
+				"variables":  strings.Join(vars, ","),
+				"SYSLOG_URL": migrated.String(),
+			}).Warn("SYSLOG_TEMPLATE and SYSLOG_TIME_FORMAT are deprecated, use the equivalent SYSLOG_URL instead")
+		}
+	})
+}
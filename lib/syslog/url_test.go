@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestApplyURLOptions(t *testing.T) {
+	u, _ := url.Parse("tls://localhost:6514?facility=local3&framing=octet-counted&tag=abc&dial_timeout=5s&relp_window=16")
+	c := WriterConfig{Facility: "user", Format: FormatRFC5424}
+
+	if err := applyURLOptions(&c, u.Query()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Facility != "local3" || c.Framing != FramingOctetCounted || c.Tag != "abc" || c.DialTimeout != 5*time.Second || c.RELPWindow != 16 {
+		t.Errorf("invalid config: %+v", c)
+	}
+
+	if c.Format != FormatRFC5424 {
+		t.Error("options missing from the URL must not be changed")
+	}
+}
+
+func TestApplyURLOptionsError(t *testing.T) {
+	tests := []string{
+		"tcp://localhost:514?dial_timeout=soon",
+		"tcp://localhost:514?dial_attempts=0",
+		"tcp://localhost:514?unknown=1",
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test)
+
+		if err := applyURLOptions(&WriterConfig{}, u.Query()); err == nil {
+			t.Errorf("%s: expected an error", test)
+		}
+	}
+}
+
+func TestMigrateURL(t *testing.T) {
+	env := map[string]string{
+		"SYSLOG_TEMPLATE":    "{{.MSG}}",
+		"SYSLOG_TIME_FORMAT": "2006-01-02",
+		"SYSLOG_FACILITY":    "local3",
+	}
+
+	u, _ := url.Parse("tls://localhost:6514?time_format=Jan+_2")
+	migrated, vars := migrateURL(u, func(name string) string { return env[name] })
+
+	// Only the variables that predate the URL parameters are deprecated.
+	if len(vars) != 2 {
+		t.Errorf("invalid list of migrated variables: %v", vars)
+	}
+
+	if s := migrated.String(); s != "tls://localhost:6514?template=%7B%7B.MSG%7D%7D&time_format=Jan+_2" {
+		t.Errorf("invalid migrated URL: %s", s)
+	}
+
+	if s := u.String(); s != "tls://localhost:6514?time_format=Jan+_2" {
+		t.Errorf("the original URL must not be modified: %s", s)
+	}
+
+	c := WriterConfig{}
+	if err := applyURLOptions(&c, migrated.Query()); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,17 +4,26 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
 	"github.com/kapralVV/ecs-logs/lib"
 	"github.com/kapralVV/ecs-logs/lib/syslog/pool"
 
@@ -23,260 +32,1399 @@ import (
 
 const DefaultTemplate = "<{{.PRIVAL}}>{{.TIMESTAMP}} {{.GROUP}}[{{.STREAM}}]: {{.MSG}}"
 
+// Formats supported by the syslog writer, FormatTemplate renders messages with
+// the configured template and is used when no format is set.
 const (
-	poolSize    = 20
-	dialTimeout = 10 * time.Second
+	FormatTemplate = "template"
+	FormatRFC3164  = "rfc3164"
+	FormatRFC5424  = "rfc5424"
+)
+
+// Framing methods of messages sent over stream transports (RFC 6587),
+// FramingNewline is used when no framing is set.
+const (
+	FramingNewline      = "newline"
+	FramingOctetCounted = "octet-counted"
+)
+
+// Policies applied to messages containing newlines, which break parsers of
+// newline delimited streams. NewlinesKeep is used when no policy is set.
+const (
+	NewlinesKeep    = "keep"
+	NewlinesEscape  = "escape"
+	NewlinesReplace = "replace"
+	NewlinesFrame   = "frame"
+)
+
+// Policies applied to messages exceeding the maximum datagram size,
+// DatagramTruncate is used when no policy is set.
+const (
+	DatagramTruncate = "truncate"
+	DatagramSplit    = "split"
+)
+
+// truncatedMarker ends messages truncated to fit in a datagram.
+const truncatedMarker = "..."
+
+// Modes in which writers use the additional endpoints of their configuration,
+// ModeFailover is used when no mode is set.
+const (
+	ModeFailover = "failover"
+	ModeFanout   = "fanout"
+)
+
+const (
+	defaultPoolSize = 20
+
+	// Default timeouts used when none are set in the writer configuration.
+	defaultDialTimeout  = 10 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+
+	// Default interval between TCP keep-alive probes.
+	defaultKeepAlive = 30 * time.Second
+
+	// Default policy applied when dialing connections fails.
+	defaultDialAttempts      = 3
+	defaultDialRetryInterval = 1 * time.Second
+
+	// How long dialing a candidate endpoint goes on before the next one is
+	// dialed concurrently.
+	dialStagger = 250 * time.Millisecond
+
+	// How often writers that failed over to another endpoint check whether
+	// the primary one can be reached again.
+	failbackInterval = 30 * time.Second
+
+	// Batches that fail to be written are retried once on a new connection,
+	// the other attempts are made by the pipeline with its own backoff.
+	writeAttempts = 2
 )
 
 var (
-	connPoolsLock sync.Mutex
-	connPools     map[string]*pool.LimitedConnPool
+	connPoolsLock     sync.Mutex
+	connPools         map[string]*pool.LimitedConnPool
+	connPoolEndpoints map[string]Endpoint
+
+	// Pools being created, writers opened concurrently for the same endpoint
+	// wait for the first dial to complete instead of all dialing it.
+	connPoolCalls map[string]*poolCall
+
+	// Last owner of the private pools of writers, when pooling is disabled.
+	poolOwners uint64
 )
 
+// poolCall is the creation of a connection pool, done is closed once the pool
+// or the error are set.
+type poolCall struct {
+	done chan struct{}
+	pool *pool.LimitedConnPool
+	err  error
+}
+
 type WriterConfig struct {
-	Network    string
-	Address    string
-	Template   string
-	TimeFormat string
-	Tag        string
-	TLS        *tls.Config
-	SocksProxy string
+	Network          string
+	Address          string
+	Format           string
+	Facility         string
+	Template         string
+	TimeFormat       string
+	Tag              string
+	StructuredDataID string
+	Framing          string
+	TLS              *tls.Config
+	TLSInsecure      bool
+	SocksProxy       string
+	HTTPProxy        string
+	DialTimeout      time.Duration
+	WriteTimeout     time.Duration
+
+	// Number of attempts made to establish a connection, how long to wait
+	// between them, and the maximum random delay added to that wait.
+	DialAttempts      int
+	DialRetryInterval time.Duration
+	DialRetryJitter   time.Duration
+
+	// Additional endpoints, depending on the mode writers either fail over to
+	// them in order when the connection to the primary address cannot be
+	// established or dies, or send messages to all of them.
+	Mode      string
+	Endpoints []Endpoint
+
+	// Maximum size of the messages sent over datagram transports (unlimited
+	// when zero), larger messages are truncated or split depending on the
+	// overflow policy.
+	MaxDatagramSize  int
+	DatagramOverflow string
+
+	// Number of messages sent before waiting for acknowledgements when using
+	// the RELP transport.
+	RELPWindow int
+
+	// Maximum number of connections shared by writers to the same server, how
+	// long connections may stay unused before being closed, and whether they
+	// are checked for being closed by the server before being reused. When
+	// PoolDisabled is set each writer has its own connection instead.
+	PoolSize        int
+	PoolIdleTimeout time.Duration
+	PoolHealthCheck bool
+	PoolDisabled    bool
+
+	// Interval between TCP keep-alive probes, negative to disable them, and
+	// between the health checks of idle pooled connections (disabled when
+	// zero), so connections dropped by NATs are detected before being used.
+	KeepAlive         time.Duration
+	PoolCheckInterval time.Duration
+
+	// Directory where batches that couldn't be written are persisted until
+	// the server can be reached again (disabled when empty), and the maximum
+	// size of the batches kept there.
+	SpoolDir      string
+	SpoolMaxBytes int64
+
+	// Maximum number of messages per second written for each stream
+	// (unlimited when zero), how many may be written at once after the
+	// stream was quiet, and the policy applied to the messages exceeding it.
+	RateLimit       float64
+	RateLimitBurst  int
+	RateLimitPolicy string
+
+	// Additional SD-ELEMENTs written verbatim in RFC 5424 messages, and
+	// whether an element describing the ECS task ecs-logs runs in is added.
+	StructuredData string
+	ECSMetadata    bool
+
+	// Policy applied to newlines in the event messages, they can be escaped
+	// as \n, replaced with spaces, or kept as is in which case "frame" uses
+	// octet-counted framing so messages can still be delimited.
+	Newlines string
+
+	// Bytes written before each message and instead of the trailing newline
+	// (kept when empty), and before and after each batch on stream
+	// transports, where {count} is replaced with the number of messages in
+	// the batch. Records can't be wrapped with octet-counted framing.
+	RecordPrefix string
+	RecordSuffix string
+	BatchHeader  string
+	BatchFooter  string
+}
+
+// Endpoint is the network and address of a syslog server. When the network is
+// empty a TLS connection is made.
+type Endpoint struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
 }
 
 // dialOpts is used to determine whether writers can share
 // the same connection pool.
 type dialOpts struct {
-	network    string
-	address    string
-	tls        *tls.Config
-	socksProxy string
+	network      string
+	address      string
+	tls          *tls.Config
+	socksProxy   string
+	httpProxy    string
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+
+	dialAttempts      int
+	dialRetryInterval time.Duration
+	dialRetryJitter   time.Duration
+
+	relpWindow int
+
+	poolSize          int
+	poolIdleTimeout   time.Duration
+	poolHealthCheck   bool
+	poolCheckInterval time.Duration
+
+	// Writers get their own pools of one connection when pooling is
+	// disabled, poolOwner identifies the writer.
+	poolDisabled bool
+	poolOwner    uint64
+
+	keepAlive time.Duration
+}
+
+// BUG: the generated key does not capture the TLS config,
+// so we are assuming that all otherwise identical dialOpts
+// have the same TLS config.
+func (o *dialOpts) key() string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%s:%d:%s:%s:%d:%d:%s:%t:%s:%d:%s", o.network, o.address, o.socksProxy, o.httpProxy, o.dialTimeout, o.writeTimeout,
+		o.dialAttempts, o.dialRetryInterval, o.dialRetryJitter, o.relpWindow, o.poolSize, o.poolIdleTimeout, o.poolHealthCheck,
+		o.poolCheckInterval, o.poolOwner, o.keepAlive)
+}
+
+func init() {
+	connPools = make(map[string]*pool.LimitedConnPool)
+	connPoolEndpoints = make(map[string]Endpoint)
+	connPoolCalls = make(map[string]*poolCall)
+}
+
+func NewWriter(group, stream string) (lib.Writer, error) {
+	c, err := configFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	return DialWriter(c)
+}
+
+// check validates the configuration of the syslog destination when the
+// program starts, and warns when certificate verification is disabled.
+func check() error {
+	c, err := configFromEnvironment()
+	if err != nil {
+		return err
+	}
+	if c.TLSInsecure {
+		warnInsecureTLS(c.Address)
+	}
+	return nil
+}
+
+// configFromEnvironment returns the writer configuration set by SYSLOG_URL
+// and the other SYSLOG_* environment variables.
+func configFromEnvironment() (c WriterConfig, err error) {
+	var query url.Values
+
+	if s := os.Getenv("SYSLOG_URL"); len(s) != 0 {
+		// Multiple comma separated URLs may be set, the first one is the
+		// primary address and the others are used for failover or fan-out.
+		for i, s := range strings.Split(s, ",") {
+			u, err := url.Parse(strings.TrimSpace(s))
+			if err != nil {
+				return c, fmt.Errorf("invalid syslog URL: %s", err)
+			}
+
+			if i == 0 {
+				c.Network = u.Scheme
+				c.Address = u.Host
+				query = u.Query()
+				warnLegacyEnvironment(u)
+			} else {
+				c.Endpoints = append(c.Endpoints, Endpoint{Network: u.Scheme, Address: u.Host})
+			}
+		}
+	}
+
+	c.Mode = os.Getenv("SYSLOG_MODE")
+	c.DatagramOverflow = os.Getenv("SYSLOG_DATAGRAM_OVERFLOW")
+	c.Newlines = os.Getenv("SYSLOG_NEWLINES")
+	c.Format = os.Getenv("SYSLOG_FORMAT")
+	c.Facility = os.Getenv("SYSLOG_FACILITY")
+	c.Template = os.Getenv("SYSLOG_TEMPLATE")
+	c.TimeFormat = os.Getenv("SYSLOG_TIME_FORMAT")
+	c.Tag = os.Getenv("SYSLOG_TAG")
+	c.StructuredDataID = os.Getenv("SYSLOG_SD_ID")
+	c.StructuredData = os.Getenv("SYSLOG_STRUCTURED_DATA")
+	c.Framing = os.Getenv("SYSLOG_FRAMING")
+	c.SpoolDir = os.Getenv("SYSLOG_SPOOL_DIR")
+	c.RateLimitPolicy = os.Getenv("SYSLOG_RATE_LIMIT_POLICY")
+
+	framing, err := lib.FramingFromEnvironment("SYSLOG_")
+	if err != nil {
+		return c, err
+	}
+	c.RecordPrefix, c.RecordSuffix = framing.RecordPrefix, framing.RecordSuffix
+	c.BatchHeader, c.BatchFooter = framing.BatchHeader, framing.BatchFooter
+
+	if s := os.Getenv("SYSLOG_TLS_INSECURE"); len(s) != 0 {
+		insecure, err := strconv.ParseBool(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_TLS_INSECURE value: %s", s)
+		}
+		c.TLSInsecure = insecure
+	}
+
+	if s := os.Getenv("SYSLOG_ECS_METADATA"); len(s) != 0 {
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_ECS_METADATA value: %s", s)
+		}
+		c.ECSMetadata = enabled
+	}
+
+	if s := os.Getenv("SYSLOG_RELP_WINDOW"); len(s) != 0 {
+		window, err := strconv.Atoi(s)
+		if err != nil || window < 1 {
+			return c, fmt.Errorf("invalid SYSLOG_RELP_WINDOW value: %s", s)
+		}
+		c.RELPWindow = window
+	}
+
+	if s := os.Getenv("SYSLOG_MAX_DATAGRAM_SIZE"); len(s) != 0 {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 0 {
+			return c, fmt.Errorf("invalid SYSLOG_MAX_DATAGRAM_SIZE value: %s", s)
+		}
+		c.MaxDatagramSize = size
+	}
+
+	if s := os.Getenv("SYSLOG_SPOOL_MAX_BYTES"); len(s) != 0 {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size < 1 {
+			return c, fmt.Errorf("invalid SYSLOG_SPOOL_MAX_BYTES value: %s", s)
+		}
+		c.SpoolMaxBytes = size
+	}
+
+	if s := os.Getenv("SYSLOG_RATE_LIMIT"); len(s) != 0 {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate < 0 {
+			return c, fmt.Errorf("invalid SYSLOG_RATE_LIMIT value: %s", s)
+		}
+		c.RateLimit = rate
+	}
+
+	if s := os.Getenv("SYSLOG_RATE_LIMIT_BURST"); len(s) != 0 {
+		burst, err := strconv.Atoi(s)
+		if err != nil || burst < 1 {
+			return c, fmt.Errorf("invalid SYSLOG_RATE_LIMIT_BURST value: %s", s)
+		}
+		c.RateLimitBurst = burst
+	}
+
+	if s := os.Getenv("SYSLOG_POOL_SIZE"); len(s) != 0 {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 1 {
+			return c, fmt.Errorf("invalid SYSLOG_POOL_SIZE value: %s", s)
+		}
+		c.PoolSize = size
+	}
+
+	if s := os.Getenv("SYSLOG_POOL"); len(s) != 0 {
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_POOL value: %s", s)
+		}
+		c.PoolDisabled = !enabled
+	}
+
+	if s := os.Getenv("SYSLOG_POOL_IDLE_TIMEOUT"); len(s) != 0 {
+		timeout, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_POOL_IDLE_TIMEOUT value: %s", s)
+		}
+		c.PoolIdleTimeout = timeout
+	}
+
+	if s := os.Getenv("SYSLOG_POOL_HEALTH_CHECK"); len(s) != 0 {
+		check, err := strconv.ParseBool(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_POOL_HEALTH_CHECK value: %s", s)
+		}
+		c.PoolHealthCheck = check
+	}
+
+	if s := os.Getenv("SYSLOG_POOL_CHECK_INTERVAL"); len(s) != 0 {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_POOL_CHECK_INTERVAL value: %s", s)
+		}
+		c.PoolCheckInterval = interval
+	}
+
+	if s := os.Getenv("SYSLOG_KEEPALIVE"); len(s) != 0 {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_KEEPALIVE value: %s", s)
+		}
+		c.KeepAlive = interval
+	}
+
+	if s := os.Getenv("SYSLOG_DIAL_TIMEOUT"); len(s) != 0 {
+		timeout, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_DIAL_TIMEOUT value: %s", s)
+		}
+		c.DialTimeout = timeout
+	}
+
+	if s := os.Getenv("SYSLOG_WRITE_TIMEOUT"); len(s) != 0 {
+		timeout, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_WRITE_TIMEOUT value: %s", s)
+		}
+		c.WriteTimeout = timeout
+	}
+
+	if s := os.Getenv("SYSLOG_DIAL_ATTEMPTS"); len(s) != 0 {
+		attempts, err := strconv.Atoi(s)
+		if err != nil || attempts < 1 {
+			return c, fmt.Errorf("invalid SYSLOG_DIAL_ATTEMPTS value: %s", s)
+		}
+		c.DialAttempts = attempts
+	}
+
+	if s := os.Getenv("SYSLOG_DIAL_RETRY_INTERVAL"); len(s) != 0 {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_DIAL_RETRY_INTERVAL value: %s", s)
+		}
+		c.DialRetryInterval = interval
+	}
+
+	if s := os.Getenv("SYSLOG_DIAL_RETRY_JITTER"); len(s) != 0 {
+		jitter, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid SYSLOG_DIAL_RETRY_JITTER value: %s", s)
+		}
+		c.DialRetryJitter = jitter
+	}
+
+	c.HTTPProxy = HTTPProxyFromEnvironment(c.Address)
+
+	if err := applyURLOptions(&c, query); err != nil {
+		return c, err
+	}
+
+	if c.TLS, err = getTLSConfig(); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// warmUp opens a writer so the connection pool of the endpoint is created and
+// holds a connection before the first messages are written.
+func warmUp() error {
+	w, err := NewWriter("ecs-logs", "warm-up")
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func DialWriter(config WriterConfig) (lib.Writer, error) {
+	var netopts, addropts []string
+
+	if config.RateLimit != 0 {
+		return dialRateLimited(config)
+	}
+
+	switch config.Mode {
+	case "", ModeFailover:
+	case ModeFanout:
+		if len(config.Endpoints) != 0 {
+			return dialFanout(config)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog mode: %s", config.Mode)
+	}
+
+	format, err := newFormatter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Framing {
+	case "", FramingNewline, FramingOctetCounted:
+	default:
+		return nil, fmt.Errorf("unsupported syslog framing: %s", config.Framing)
+	}
+
+	switch config.Newlines {
+	case "", NewlinesKeep, NewlinesEscape, NewlinesReplace:
+	case NewlinesFrame:
+		config.Framing = FramingOctetCounted
+	default:
+		return nil, fmt.Errorf("unsupported syslog newlines policy: %s", config.Newlines)
+	}
+
+	if config.Framing == FramingOctetCounted && (len(config.RecordPrefix) != 0 || len(config.RecordSuffix) != 0) {
+		return nil, fmt.Errorf("syslog record prefix and suffix can't be used with octet-counted framing")
+	}
+
+	switch config.DatagramOverflow {
+	case "", DatagramTruncate, DatagramSplit:
+	default:
+		return nil, fmt.Errorf("unsupported syslog datagram overflow policy: %s", config.DatagramOverflow)
+	}
+
+	if !validStructuredData(config.StructuredData) {
+		return nil, fmt.Errorf("invalid syslog structured data: %s", config.StructuredData)
+	}
+
+	if config.TLS, err = applyTLSPolicy(config.TLS); err != nil {
+		return nil, err
+	}
+
+	if config.TLSInsecure {
+		config.TLS = insecureTLSConfig(config.TLS, config.Address)
+	}
+
+	if config.DialTimeout == 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+
+	if config.DialAttempts == 0 {
+		config.DialAttempts = defaultDialAttempts
+	}
+
+	if config.KeepAlive == 0 {
+		config.KeepAlive = defaultKeepAlive
+	}
+
+	if config.DialRetryInterval == 0 {
+		config.DialRetryInterval = defaultDialRetryInterval
+	}
+
+	if len(config.Network) != 0 {
+		netopts = []string{config.Network}
+	} else if len(config.Address) == 0 && len(defaultSocketPaths) == 0 {
+		// No local syslog socket on this platform, messages are sent to the
+		// loopback interface so there's no need to secure the link.
+		netopts = []string{"udp"}
+	} else if len(config.Address) == 0 || strings.HasPrefix(config.Address, "/") {
+		// When starting with a '/' we assume it's gonna be a file path,
+		// otherwise we fallback to trying a TLS connection so we don't
+		// implicitly send logs over an unsecured link.
+		config.Network = "unix"
+		netopts = []string{"unixgram", "unix"}
+	} else {
+		netopts = []string{"tls"}
+	}
+
+	if len(config.Address) != 0 {
+		addropts = []string{config.Address}
+	} else if strings.HasPrefix(config.Network, "unix") {
+		addropts = defaultSocketPaths
+	} else {
+		// The config doesn't point to a unix domain socket, falling back to trying
+		// to connect to syslogd over a network interface.
+		addropts = []string{"localhost:514"}
+	}
+
+	// Try various fallbacks if no hints were given, then the failover
+	// endpoints.
+	var endpoints []Endpoint
+	for _, n := range netopts {
+		for _, a := range addropts {
+			endpoints = append(endpoints, Endpoint{Network: n, Address: a})
+		}
+	}
+
+	for _, e := range config.Endpoints {
+		if len(e.Network) == 0 {
+			e.Network = "tls"
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	candidates := make([]dialOpts, len(endpoints))
+	for i, e := range endpoints {
+		candidates[i] = dialOpts{
+			network:      e.Network,
+			address:      e.Address,
+			tls:          config.TLS,
+			socksProxy:   config.SocksProxy,
+			httpProxy:    config.HTTPProxy,
+			dialTimeout:  config.DialTimeout,
+			writeTimeout: config.WriteTimeout,
+
+			dialAttempts:      config.DialAttempts,
+			dialRetryInterval: config.DialRetryInterval,
+			dialRetryJitter:   config.DialRetryJitter,
+
+			relpWindow: config.RELPWindow,
+
+			poolSize:          config.PoolSize,
+			poolIdleTimeout:   config.PoolIdleTimeout,
+			poolHealthCheck:   config.PoolHealthCheck,
+			poolCheckInterval: config.PoolCheckInterval,
+			poolDisabled:      config.PoolDisabled,
+
+			keepAlive: config.KeepAlive,
+		}
+	}
+
+	var sp *lib.Spool
+	if len(config.SpoolDir) != 0 {
+		if sp, err = getSpool(config.SpoolDir, config.SpoolMaxBytes, endpoints[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	var w *writer
+	if w, err = dialFirst(candidates, config, format); err == nil {
+		w.spool = sp
+		return w, nil
+	}
+
+	if sp != nil {
+		return spoolWriter{sp}, nil
+	}
+
+	return nil, lib.NewWriterError(lib.UnreachableError, err)
+}
+
+var errConnClosed = errors.New("syslog connection closed by the server")
+
+var errNoConnection = errors.New("no syslog connection available")
+
+type multiError []error
+
+func (m multiError) Error() string {
+	s := "encountered errors:\n"
+	for err := range m {
+		s += fmt.Sprintf("\t%v\n", err)
+	}
+	return s
+}
+
+type writer struct {
+	// configuration
+	format           formatter
+	octetCounted     bool
+	maxDatagramSize  int
+	datagramOverflow string
+	newlines         *strings.Replacer
+	framing          lib.Framing
+	record           []byte
+
+	// whether messages are written to a stream, as opposed to one per write
+	stream bool
+
+	// connection state, the writer is connected to the endpoint at index
+	// current in the list of candidates
+	candidates []dialOpts
+	current    int
+	pool       *pool.LimitedConnPool
+
+	// last time the writer checked whether it could fail back to the
+	// primary endpoint
+	failbackTime time.Time
+
+	// set once the writer is closed, so private pools created in the
+	// background are closed too
+	closed  int32
+	backend io.WriteCloser
+	metrics *writerMetrics
+	spool   *lib.Spool
+
+	// number of bytes of the batch written to the backend
+	sent int64
+
+	// buffered i/o
+	buf   bytes.Buffer
+	out   func(*writer, lib.Message) error
+	flush func() error
+}
+
+// dialFirst opens a writer to the first of the candidate endpoints that can be
+// reached. Candidates are dialed in order but without waiting for the previous
+// ones to fail, the next candidate is tried after dialStagger so unreachable
+// addresses, like a missing /dev/log, don't delay the startup.
+func dialFirst(candidates []dialOpts, cfg WriterConfig, format formatter) (w *writer, err error) {
+	type result struct {
+		w   *writer
+		err error
+	}
+
+	results := make(chan result, len(candidates))
+	next, pending := 0, 0
+	var stagger <-chan time.Time
+
+	dialNext := func() {
+		i := next
+		next++
+		pending++
+
+		go func() {
+			w, err := newWriter(candidates, i, cfg, format)
+			results <- result{w, err}
+		}()
+
+		if next < len(candidates) {
+			stagger = time.After(dialStagger)
+		} else {
+			stagger = nil
+		}
+	}
+
+	err = errNoConnection
+	dialNext()
+
+	for pending != 0 {
+		select {
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				// The writers to other candidates that are still being
+				// dialed aren't needed.
+				go func(n int) {
+					for ; n != 0; n-- {
+						if r := <-results; r.err == nil {
+							r.w.Close()
+						}
+					}
+				}(pending)
+				return r.w, nil
+			}
+
+			err = r.err
+
+			if next < len(candidates) {
+				dialNext()
+			}
+
+		case <-stagger:
+			dialNext()
+		}
+	}
+
+	return nil, err
+}
+
+func newWriter(candidates []dialOpts, current int, cfg WriterConfig, format formatter) (*writer, error) {
+	if candidates[current].poolDisabled {
+		candidates = privateCandidates(candidates)
+	}
+
+	p, err := getPool(candidates[current])
+	if err != nil {
+		return nil, err
+	}
+
+	backend := p.Get()
+
+	// Check for errors reported by the pool when dialing
+	errc := p.Errors()
+	var errs multiError
+loop:
+	for {
+		select {
+		case err := <-errc:
+			errs = append(errs, err)
+		default:
+			break loop
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	w := &writer{
+		format:           format,
+		octetCounted:     cfg.Framing == FramingOctetCounted,
+		maxDatagramSize:  cfg.MaxDatagramSize,
+		datagramOverflow: cfg.DatagramOverflow,
+		newlines:         newlinesReplacer(cfg.Newlines),
+		framing: lib.Framing{
+			RecordPrefix: cfg.RecordPrefix,
+			RecordSuffix: cfg.RecordSuffix,
+			BatchHeader:  cfg.BatchHeader,
+			BatchFooter:  cfg.BatchFooter,
+		},
+		candidates: candidates,
+		current:    current,
+		pool:       p,
+	}
+	w.setBackend(backend)
+	return w, nil
+}
+
+func (w *writer) setBackend(backend io.WriteCloser) {
+	w.backend = backend
+
+	var opts dialOpts
+	if len(w.candidates) != 0 {
+		opts = w.candidates[w.current]
+	}
+	w.metrics = getWriterMetrics(opts)
+
+	switch b := backend.(type) {
+	case bufferedWriter:
+		w.out, w.flush, w.stream = (*writer).directWrite, b.Flush, true
+	default:
+		w.out, w.flush, w.stream = (*writer).bufferedWrite, func() error { return nil }, false
+	}
+
+	// Connections from the pool are wrapped so their type doesn't tell whether
+	// they expect one message per write, the network of the endpoint does.
+	if len(w.candidates) != 0 {
+		if n := w.candidates[w.current].network; isDatagram(n) || n == "relp" {
+			w.out, w.stream = (*writer).bufferedWrite, false
+		}
+	}
+}
+
+// reconnect releases the current connection, which the pool discards if it
+// failed, and replaces it with a connection to the next candidate endpoint,
+// wrapping around to the current one if none of the others are reachable.
+func (w *writer) reconnect() (err error) {
+	if w.backend != nil {
+		w.backend.Close()
+		w.backend = nil
+	}
+
+	err = errNoConnection
+
+	for i := 1; i <= len(w.candidates); i++ {
+		var p *pool.LimitedConnPool
+		var backend io.WriteCloser
+		var ok bool
+
+		next := (w.current + i) % len(w.candidates)
+		opts := w.candidates[next]
+
+		if p, err = getPool(opts); err != nil {
+			continue
+		}
+
+		if backend, ok = p.TryGet(opts.dialTimeout); !ok {
+			err = errNoConnection
+			continue
+		}
+
+		w.current, w.pool = next, p
+		w.setBackend(backend)
+		w.metrics.reconnects.Add(1)
+		return nil
+	}
+
+	return
+}
+
+// failback reconnects to the primary endpoint after the writer failed over to
+// another one, as soon as a connection to the primary endpoint is available.
+// It never waits for the primary endpoint to be dialed, its pool is created in
+// the background if it doesn't exist.
+func (w *writer) failback() {
+	if w.current == 0 || time.Since(w.failbackTime) < failbackInterval {
+		return
+	}
+	w.failbackTime = time.Now()
+
+	opts := w.candidates[0]
+	p := lookupPool(opts)
+
+	if p == nil {
+		go func() {
+			if _, err := getPool(opts); err == nil && opts.poolOwner != 0 && atomic.LoadInt32(&w.closed) != 0 {
+				closePools([]dialOpts{opts})
+			}
+		}()
+		return
+	}
+
+	backend, ok := p.TryGet(0)
+	if !ok {
+		return
+	}
+
+	if w.backend != nil {
+		w.backend.Close()
+	}
+
+	w.current, w.pool = 0, p
+	w.setBackend(backend)
+	w.metrics.reconnects.Add(1)
+}
+
+// retry calls f, and calls it again on a new connection when it fails. Writes
+// that failed because the server closed an idle connection succeed on the new
+// one, the batches still failing are reported so the caller retries them.
+func (w *writer) retry(f func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		if w.backend != nil {
+			if err = f(); err == nil {
+				return
+			}
+			w.metrics.errors.Add(1)
+		}
+
+		if attempt == writeAttempts {
+			return
+		}
+
+		if e := w.reconnect(); e != nil && err == nil {
+			err = e
+		}
+	}
+}
+
+// privateCandidates returns a copy of candidates where the pools of the
+// endpoints belong to a new owner.
+func privateCandidates(candidates []dialOpts) []dialOpts {
+	owner := atomic.AddUint64(&poolOwners, 1)
+	private := make([]dialOpts, len(candidates))
+
+	for i, opts := range candidates {
+		opts.poolOwner = owner
+		private[i] = opts
+	}
+
+	return private
+}
+
+// closePools closes the connection pools of the candidate endpoints, which
+// must be private to a writer.
+func closePools(candidates []dialOpts) {
+	for _, opts := range candidates {
+		connPoolsLock.Lock()
+		p := connPools[opts.key()]
+		delete(connPools, opts.key())
+		delete(connPoolEndpoints, opts.key())
+		connPoolsLock.Unlock()
+
+		if p != nil {
+			p.Close()
+		}
+	}
+}
+
+// PoolStatus reports the connections of a pool, pools are shared by the
+// writers of an endpoint with the same options.
+type PoolStatus struct {
+	Endpoint
+	Live int `json:"live"`
+	Idle int `json:"idle"`
+	Size int `json:"size"`
+}
+
+// Connections returns the status of all connection pools, sorted by network
+// and address.
+func Connections() (list []PoolStatus) {
+	connPoolsLock.Lock()
+	list = make([]PoolStatus, 0, len(connPools))
+
+	for key, p := range connPools {
+		s := PoolStatus{Endpoint: connPoolEndpoints[key]}
+		s.Live, s.Idle, s.Size = p.Stats()
+		list = append(list, s)
+	}
+
+	connPoolsLock.Unlock()
+
+	sort.Slice(list, func(i int, j int) bool {
+		if list[i].Network != list[j].Network {
+			return list[i].Network < list[j].Network
+		}
+		return list[i].Address < list[j].Address
+	})
+	return
+}
+
+// lookupPool returns the connection pool for the given configuration if it
+// exists.
+func lookupPool(opts dialOpts) *pool.LimitedConnPool {
+	connPoolsLock.Lock()
+	defer connPoolsLock.Unlock()
+	return connPools[opts.key()]
+}
+
+// getPool returns a connection pool for the given configuration.
+func getPool(opts dialOpts) (*pool.LimitedConnPool, error) {
+	key := opts.key()
+
+	connPoolsLock.Lock()
+
+	if p, ok := connPools[key]; ok {
+		connPoolsLock.Unlock()
+		return p, nil
+	}
+
+	if call, ok := connPoolCalls[key]; ok {
+		connPoolsLock.Unlock()
+		<-call.done
+		return call.pool, call.err
+	}
+
+	call := &poolCall{done: make(chan struct{})}
+	connPoolCalls[key] = call
+	connPoolsLock.Unlock()
+
+	// The lock isn't held while the pool dials its first connection so pools
+	// to different endpoints can be created concurrently.
+	call.pool, call.err = newPool(opts)
+
+	connPoolsLock.Lock()
+	delete(connPoolCalls, key)
+	if call.err == nil {
+		connPools[key] = call.pool
+		connPoolEndpoints[key] = Endpoint{Network: opts.network, Address: opts.address}
+	}
+	connPoolsLock.Unlock()
+
+	close(call.done)
+	return call.pool, call.err
+}
+
+func newPool(opts dialOpts) (*pool.LimitedConnPool, error) {
+	dial := func() (io.WriteCloser, error) {
+		return dialWriter(opts)
+	}
+	size := opts.poolSize
+	if size == 0 {
+		size = defaultPoolSize
+	}
+	if opts.poolOwner != 0 {
+		size = 1
+	}
+	poolOpts := pool.Options{
+		IdleTimeout:   opts.poolIdleTimeout,
+		CheckInterval: opts.poolCheckInterval,
+	}
+	if opts.poolHealthCheck || opts.poolCheckInterval != 0 {
+		poolOpts.Check = checkConn
+	}
+	return pool.NewLimitedWithOptions(size, dial, poolOpts)
+}
+
+// A formatter serializes log messages to the wire format sent to syslog.
+type formatter func(w io.Writer, msg lib.Message) error
+
+func newFormatter(cfg WriterConfig) (formatter, error) {
+	facility, err := ParseFacility(cfg.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = parseTag(cfg.Tag); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Format {
+	case "", FormatTemplate:
+		return newTemplateFormatter(cfg, facility), nil
+	case FormatRFC3164:
+		return newRFC3164Formatter(cfg, facility), nil
+	case FormatRFC5424:
+		return newRFC5424Formatter(cfg, facility), nil
+	default:
+		return nil, fmt.Errorf("unsupported syslog format: %s", cfg.Format)
+	}
+}
+
+func newTemplateFormatter(cfg WriterConfig, facility int) formatter {
+	if cfg.TimeFormat == "" {
+		cfg.TimeFormat = time.Stamp
+	}
+
+	if cfg.Template == "" {
+		cfg.Template = DefaultTemplate
+	}
+
+	tpl := newWriterTemplate(cfg.Template)
+	tag := mustParseTag(cfg.Tag)
+
+	return func(w io.Writer, msg lib.Message) error {
+		m := makeMessage(msg, facility, cfg.TimeFormat, tag)
+		m.MSG = msg.Event.String()
+		return tpl.Execute(w, m)
+	}
 }
 
-// BUG: the generated key does not capture the TLS config,
-// so we are assuming that all otherwise identical dialOpts
-// have the same TLS config.
-func (o *dialOpts) key() string {
-	return fmt.Sprintf("%s:%s:%s", o.network, o.address, o.socksProxy)
+func newWriterTemplate(format string) *template.Template {
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	t := template.New("syslog").Funcs(templateFuncs)
+	template.Must(t.Parse(format))
+	return t
 }
 
-func init() {
-	connPools = make(map[string]*pool.LimitedConnPool)
+func (w *writer) Close() (err error) {
+	if w.backend != nil {
+		err = w.backend.Close()
+		w.backend = nil
+	}
+	if len(w.candidates) != 0 && w.candidates[0].poolOwner != 0 {
+		atomic.StoreInt32(&w.closed, 1)
+		closePools(w.candidates)
+	}
+	return
 }
 
-func NewWriter(group, stream string) (lib.Writer, error) {
-	var c WriterConfig
+func (w *writer) WriteMessageBatch(batch lib.MessageBatch) error {
+	w.failback()
 
-	if s := os.Getenv("SYSLOG_URL"); len(s) != 0 {
-		u, err := url.Parse(s)
-		if err != nil {
-			return nil, fmt.Errorf("invalid syslog URL: %s", err)
+	if w.spool != nil && w.spool.Pending() != 0 && w.spool.Push(batch) == nil {
+		// The batch is queued behind the ones spooled while the server was
+		// unreachable so messages are sent in order, it is written directly
+		// only when the spool is full.
+		if _, err := w.spool.Replay(w.writeBatch); err != nil {
+			log.WithFields(log.Fields{
+				"count": w.spool.Pending(),
+				"error": err,
+			}).Warn("failed to replay syslog spool")
 		}
-
-		c.Network = u.Scheme
-		c.Address = u.Host
+		return nil
 	}
 
-	c.Template = os.Getenv("SYSLOG_TEMPLATE")
-	c.TimeFormat = os.Getenv("SYSLOG_TIME_FORMAT")
+	err := w.retry(func() error { return w.writeBatch(batch) })
+	kind := errorKind(err)
 
-	return DialWriter(c)
-}
+	if w.spool != nil {
+		if err == nil {
+			// The server is reachable, batches spooled while it wasn't can
+			// be sent.
+			w.spool.Replay(w.writeBatch)
+		} else if kind == lib.UnreachableError && w.spool.Push(batch) == nil {
+			log.WithFields(log.Fields{
+				"count": len(batch),
+				"error": err,
+			}).Warn("syslog batch spooled")
+			return nil
+		}
+	}
 
-func DialWriter(config WriterConfig) (lib.Writer, error) {
-	var netopts, addropts []string
+	return lib.NewWriterError(kind, err)
+}
 
-	if len(config.Network) != 0 {
-		netopts = []string{config.Network}
-	} else if len(config.Address) == 0 || strings.HasPrefix(config.Address, "/") {
-		// When starting with a '/' we assume it's gonna be a file path,
-		// otherwise we fallback to trying a TLS connection so we don't
-		// implicitly send logs over an unsecured link.
-		config.Network = "unix"
-		netopts = []string{"unixgram", "unix"}
-	} else {
-		netopts = []string{"tls"}
+// errorKind classifies the errors of syslog writes by their cause. Batches
+// that still fail after reconnecting are reported as unreachable so the caller
+// can try again later, unless the server rejected the certificates or the
+// messages, or they were too large to be sent.
+func errorKind(err error) lib.ErrorKind {
+	for {
+		switch e := err.(type) {
+		case *net.OpError:
+			err = e.Err
+			continue
+		case *os.SyscallError:
+			err = e.Err
+			continue
+		}
+		break
 	}
 
-	if len(config.Address) != 0 {
-		addropts = []string{config.Address}
-	} else if strings.HasPrefix(config.Network, "unix") {
-		// This was copied from the standard log/syslog package, they do the same
-		// and try to guess at runtime which socket syslogd is using.
-		addropts = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
-	} else {
-		// The config doesn't point to a unix domain socket, falling back to trying
-		// to connect to syslogd over a network interface.
-		addropts = []string{"localhost:514"}
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.CertificateInvalidError, x509.HostnameError:
+		return lib.AuthFailureError
+	case relpRejectedError:
+		return lib.UnknownError
 	}
 
-	// Try various fallbacks if no hints were given
-	var w *writer
-	var err error
-	for _, n := range netopts {
-		for _, a := range addropts {
-			opts := dialOpts{
-				network:    n,
-				address:    a,
-				tls:        config.TLS,
-				socksProxy: config.SocksProxy,
-			}
-			if w, err = newWriter(opts, config); err == nil {
-				return w, nil
-			}
-		}
+	if err == syscall.EMSGSIZE {
+		return lib.OversizedError
 	}
 
-	return nil, err
+	return lib.UnreachableError
 }
 
-type multiError []error
-
-func (m multiError) Error() string {
-	s := "encountered errors:\n"
-	for err := range m {
-		s += fmt.Sprintf("\t%v\n", err)
+func (w *writer) writeBatch(batch lib.MessageBatch) error {
+	if w.backend == nil {
+		return errNoConnection
 	}
-	return s
+	w.sent = 0
+	if err := w.writeBatchFrame(w.framing.Header(len(batch))); err != nil {
+		return err
+	}
+	for _, msg := range batch {
+		if err := w.write(msg); err != nil {
+			return err
+		}
+	}
+	if err := w.writeBatchFrame(w.framing.Footer(len(batch))); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.metrics.flush.Observe(time.Since(start))
+	w.metrics.messages.Add(int64(len(batch)))
+	w.metrics.bytes.Add(w.sent)
+	return nil
 }
 
-type writer struct {
-	// configuration
-	timefmt string
-	tpl     *template.Template
-	tag     string
-
-	// connection state
-	pool    *pool.LimitedConnPool
-	backend io.WriteCloser
+// writeBatchFrame writes the header or footer of a batch, which only exist on
+// stream transports.
+func (w *writer) writeBatchFrame(frame []byte) (err error) {
+	if len(frame) != 0 && w.stream {
+		_, err = w.send(frame)
+	}
+	return
+}
 
-	// buffered i/o
-	buf   bytes.Buffer
-	out   func(*writer, message) error
-	flush func() error
+func (w *writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
 }
 
-func newWriter(opts dialOpts, cfg WriterConfig) (*writer, error) {
-	var out func(*writer, message) error
-	var flush func() error
+func (w *writer) write(msg lib.Message) (err error) {
+	if w.newlines != nil {
+		msg.Event.Message = w.newlines.Replace(msg.Event.Message)
+	}
+	return w.out(w, msg)
+}
 
-	if cfg.TimeFormat == "" {
-		cfg.TimeFormat = time.Stamp
+func newlinesReplacer(policy string) *strings.Replacer {
+	switch policy {
+	case NewlinesEscape:
+		return strings.NewReplacer("\r", `\r`, "\n", `\n`)
+	case NewlinesReplace:
+		return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
 	}
+	return nil
+}
 
-	if cfg.Template == "" {
-		cfg.Template = DefaultTemplate
+func (w *writer) directWrite(msg lib.Message) (err error) {
+	if w.framing.Wrapped() {
+		return w.wrappedWrite(msg)
 	}
 
-	p, err := getPool(opts)
-	if err != nil {
-		return nil, err
+	if !w.octetCounted {
+		return w.format(sender{w}, msg)
 	}
 
-	backend := p.Get()
-	switch b := backend.(type) {
-	case bufferedWriter:
-		out, flush = (*writer).directWrite, b.Flush
-	default:
-		out, flush = (*writer).bufferedWrite, func() error { return nil }
+	// Octet-counted messages are prefixed with their length so they don't
+	// need a trailer, which lets them contain newlines.
+	w.buf.Reset()
+	if err = w.format(&w.buf, msg); err != nil {
+		return
 	}
 
-	// Check for errors reported by the pool when dialing
-	errc := p.Errors()
-	var errs multiError
-loop:
-	for {
-		select {
-		case err := <-errc:
-			errs = append(errs, err)
-		default:
-			break loop
-		}
+	b := w.buf.Bytes()
+	if n := len(b); n != 0 && b[n-1] == '\n' {
+		b = b[:n-1]
 	}
-	if errs != nil {
-		return nil, errs
+
+	if _, err = w.send([]byte(strconv.Itoa(len(b)) + " ")); err != nil {
+		return
 	}
 
-	return &writer{
-		timefmt: cfg.TimeFormat,
-		tpl:     newWriterTemplate(cfg.Template),
-		tag:     cfg.Tag,
+	_, err = w.send(b)
+	return
+}
 
-		backend: backend,
-		pool:    p,
+// wrappedWrite writes messages between the record prefix and suffix, the
+// suffix replaces the trailing newline when it's set.
+func (w *writer) wrappedWrite(msg lib.Message) (err error) {
+	w.buf.Reset()
+	if err = w.format(&w.buf, msg); err != nil {
+		return
+	}
 
-		flush: flush,
-		out:   out,
-	}, nil
+	w.record = w.framing.AppendRecord(w.record[:0], w.buf.Bytes())
+	_, err = w.send(w.record)
+	return
 }
 
-// getPool returns a connection pool for the given configuration.
-func getPool(opts dialOpts) (*pool.LimitedConnPool, error) {
-	connPoolsLock.Lock()
-	defer connPoolsLock.Unlock()
+// bufferedWrite is used on datagram transports, each message is sent in its
+// own datagram so no framing is applied. Messages that exceed the maximum
+// datagram size are truncated or split in multiple datagrams, each of them
+// being a complete syslog message holding a part of the event message.
+func (w *writer) bufferedWrite(msg lib.Message) (err error) {
+	w.buf.Reset()
+	if err = w.format(&w.buf, msg); err != nil {
+		return
+	}
 
-	key := opts.key()
-	p, ok := connPools[key]
-	if !ok {
-		// dial closes over opts
-		dial := func() (io.WriteCloser, error) {
-			return dialWriter(opts.network, opts.address, opts.tls, opts.socksProxy)
+	max := w.maxDatagramSize
+
+	if max == 0 || w.buf.Len() <= max {
+		_, err = w.send(w.buf.Bytes())
+		return
+	}
+
+	if w.datagramOverflow == DatagramSplit {
+		var size int
+
+		if size, err = w.messageSize(msg); err != nil {
+			return
 		}
-		var err error
-		p, err = pool.NewLimited(poolSize, dial)
-		if err != nil {
-			return nil, err
+
+		// Messages whose header alone doesn't fit are truncated.
+		if size > 0 {
+			return w.splitWrite(msg, size)
 		}
-		connPools[key] = p
 	}
 
-	return p, nil
+	_, err = w.send(truncateDatagram(w.buf.Bytes(), max))
+	return
 }
 
-func newWriterTemplate(format string) *template.Template {
-	if !strings.HasSuffix(format, "\n") {
-		format += "\n"
+// messageSize returns how many bytes of the event message fit in a datagram
+// along with the rest of the syslog message.
+func (w *writer) messageSize(msg lib.Message) (int, error) {
+	var b bytes.Buffer
+
+	msg.Event.Message = ""
+
+	if err := w.format(&b, msg); err != nil {
+		return 0, err
 	}
-	t := template.New("syslog")
-	template.Must(t.Parse(format))
-	return t
-}
 
-func (w *writer) Close() (err error) {
-	return w.backend.Close()
+	return w.maxDatagramSize - b.Len(), nil
 }
 
-func (w *writer) WriteMessageBatch(batch lib.MessageBatch) error {
-	for _, msg := range batch {
-		if err := w.write(msg); err != nil {
-			return err
+// splitWrite sends msg in datagrams holding parts of the event message of at
+// most size bytes, which are cut between UTF-8 characters.
+func (w *writer) splitWrite(msg lib.Message, size int) (err error) {
+	for text := msg.Event.Message; len(text) != 0; {
+		n := runeCut(text, size)
+		part := msg
+		part.Event.Message, text = text[:n], text[n:]
+
+		w.buf.Reset()
+		if err = w.format(&w.buf, part); err != nil {
+			return
+		}
+
+		// Escaping done by the formatter may still make the part too large.
+		if _, err = w.send(truncateDatagram(w.buf.Bytes(), w.maxDatagramSize)); err != nil {
+			return
 		}
 	}
-	if err := w.flush(); err != nil {
-		return err
+	return
+}
+
+// runeCut returns the length of the longest prefix of s of at most n bytes
+// which doesn't end in the middle of a UTF-8 character, or of its first
+// character if it's longer than n bytes.
+func runeCut(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
 	}
-	return nil
+
+	for i := n; i > 0; i-- {
+		if utf8.RuneStart(s[i]) {
+			return i
+		}
+	}
+
+	_, size := utf8.DecodeRuneInString(s)
+	return size
 }
 
-func (w *writer) WriteMessage(msg lib.Message) error {
-	if err := w.write(msg); err != nil {
-		return err
+// truncateDatagram returns b truncated to max bytes, between UTF-8 characters,
+// and ending with the truncation marker when it fits.
+func truncateDatagram(b []byte, max int) []byte {
+	if len(b) <= max {
+		return b
 	}
-	if err := w.flush(); err != nil {
-		return err
+
+	marker := truncatedMarker
+
+	if max <= len(marker) {
+		marker = ""
 	}
 
-	return nil
+	n := max - len(marker)
+
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+
+	return append(b[:n], marker...)
 }
 
-func (w *writer) write(msg lib.Message) (err error) {
-	m := message{
-		PRIVAL:    int(msg.Event.Level-1) + 8, // +8 is for user-level messages facility
+func makeMessage(msg lib.Message, facility int, timefmt string, tag tagFunc) (m message) {
+	m = message{
+		PRIVAL:    int(msg.Event.Level-1) + 8*facility,
 		HOSTNAME:  msg.Event.Info.Host,
 		MSGID:     msg.Event.Info.ID,
 		GROUP:     msg.Group,
 		STREAM:    msg.Stream,
-		TIMESTAMP: msg.Event.Time.Format(w.timefmt),
-		TAG:       w.tag,
+		TIMESTAMP: msg.Event.Time.Format(timefmt),
+		TIME:      msg.Event.Time,
+		DATA:      msg.Event.Data,
 	}
 
 	if len(m.HOSTNAME) == 0 {
@@ -293,18 +1441,8 @@ func (w *writer) write(msg lib.Message) (err error) {
 		m.PROCID = strconv.Itoa(msg.Event.Info.PID)
 	}
 
-	m.MSG = msg.Event.String()
-	return w.out(w, m)
-}
-
-func (w *writer) directWrite(m message) (err error) {
-	return w.tpl.Execute(w.backend, m)
-}
+	m.TAG = tag(&m)
 
-func (w *writer) bufferedWrite(m message) (err error) {
-	w.buf.Reset()
-	w.tpl.Execute(&w.buf, m)
-	_, err = w.backend.Write(w.buf.Bytes())
 	return
 }
 
@@ -318,6 +1456,8 @@ type message struct {
 	TAG       string
 	MSG       string
 	TIMESTAMP string
+	TIME      time.Time
+	DATA      ecslogs.EventData
 }
 
 type bufferedWriter interface {
@@ -325,33 +1465,104 @@ type bufferedWriter interface {
 }
 
 type bufferedConn struct {
-	buf  *bufio.Writer
-	conn net.Conn
+	buf     *bufio.Writer
+	conn    net.Conn
+	timeout time.Duration
+
+	// set to non-zero by watchConn once the connection was closed
+	closed *int32
+}
+
+func newBufferedConn(conn net.Conn, timeout time.Duration, watch bool) bufferedConn {
+	c := bufferedConn{
+		conn:    conn,
+		buf:     bufio.NewWriter(conn),
+		timeout: timeout,
+	}
+
+	if watch {
+		c.closed = new(int32)
+		go watchConn(conn, c.closed)
+	}
+
+	return c
+}
+
+// watchConn reads from conn until it fails and then sets closed. Servers
+// aren't expected to send data on syslog connections, reads only return when
+// the connection is closed.
+func watchConn(conn net.Conn, closed *int32) {
+	var b [512]byte
+
+	for {
+		if _, err := conn.Read(b[:]); err != nil {
+			atomic.StoreInt32(closed, 1)
+			return
+		}
+	}
+}
+
+func (c bufferedConn) Close() error { return c.conn.Close() }
+
+// Write buffers b, the buffer is sent when it's full so the write deadline
+// must be set like when flushing it.
+func (c bufferedConn) Write(b []byte) (int, error) {
+	if err := c.setDeadline(); err != nil {
+		return 0, err
+	}
+	return c.buf.Write(b)
+}
+
+// Flush sends the buffered data, giving up if the peer doesn't accept it within
+// the write timeout so a hung connection doesn't block the writer forever.
+func (c bufferedConn) Flush() error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c bufferedConn) setDeadline() error {
+	if c.timeout == 0 {
+		return nil
+	}
+	return c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
 }
 
-func (c bufferedConn) Close() error                { return c.conn.Close() }
-func (c bufferedConn) Flush() error                { return c.buf.Flush() }
-func (c bufferedConn) Write(b []byte) (int, error) { return c.buf.Write(b) }
+// newDialer returns the dialer of the connections made with opts. A negative
+// keep-alive interval disables the probes, which the zero value would enable
+// with the default interval of the dialer.
+func newDialer(opts dialOpts) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   opts.dialTimeout,
+		KeepAlive: opts.keepAlive,
+	}
+}
 
-func dialWriter(network, address string, config *tls.Config, socksProxy string) (w io.WriteCloser, err error) {
+func dialWriter(opts dialOpts) (w io.WriteCloser, err error) {
 	var conn, rawConn net.Conn
 	var dial func(string, string) (net.Conn, error)
 	var socksDialer proxy.Dialer
 
-	dialer := net.Dialer{
-		Timeout: dialTimeout,
+	network, address, config, socksProxy := opts.network, opts.address, opts.tls, opts.socksProxy
+	relp := network == "relp"
+
+	if relp {
+		network = "tcp"
 	}
+
+	dialer := newDialer(opts)
 	if network == "tls" {
 		network = "tcp"
 		dial = func(network, address string) (net.Conn, error) {
-			return tls.DialWithDialer(&dialer, network, address, config)
+			return tls.DialWithDialer(dialer, network, address, config)
 		}
 	} else {
 		dial = dialer.Dial
 	}
 
 	if socksProxy != "" {
-		if socksDialer, err = proxy.SOCKS5(network, socksProxy, nil, proxy.Direct); err != nil {
+		if socksDialer, err = proxy.SOCKS5(network, socksProxy, nil, dialer); err != nil {
 			return
 		}
 
@@ -363,40 +1574,135 @@ func dialWriter(network, address string, config *tls.Config, socksProxy string)
 				if err != nil {
 					return nil, err
 				}
-
-				tlsConn := tls.Client(rawConn, config)
-				if err = tlsConn.Handshake(); err == nil {
-					conn = tlsConn
-				}
+				conn, err = tlsHandshake(rawConn, config, opts.dialTimeout)
+			}
+			return
+		}
+	} else if opts.httpProxy != "" && network == "tcp" {
+		// HTTP proxies can only tunnel TCP connections.
+		dial = func(network, address string) (conn net.Conn, err error) {
+			if rawConn, err = dialHTTPProxy(dialer, opts.httpProxy, address); err != nil {
+				return
+			}
+			if config == nil {
+				conn = rawConn
+			} else {
+				conn, err = tlsHandshake(rawConn, config, opts.dialTimeout)
 			}
 			return
 		}
 	}
 
-	for attempt := 1; true; attempt++ {
+	for attempt := 1; ; attempt++ {
 		if conn, err = dial(network, address); err == nil {
 			break
 		}
 
-		if attempt == 3 {
+		if attempt >= opts.dialAttempts {
 			return
 		}
 
 		err = nil
-		time.Sleep(1 * time.Second)
+		time.Sleep(retryDelay(opts.dialRetryInterval, opts.dialRetryJitter))
 	}
 
 	if err == nil {
-		switch network {
-		case "udp", "udp4", "udp6", "unixgram", "unixpacket":
-			w = conn
-		default:
-			w = bufferedConn{
-				conn: conn,
-				buf:  bufio.NewWriter(conn),
+		if relp {
+			var c *relpConn
+			if c, err = newRELPConn(conn, opts.relpWindow, opts.writeTimeout); err == nil {
+				w = c
 			}
+		} else if isDatagram(network) {
+			w = conn
+		} else {
+			w = newBufferedConn(conn, opts.writeTimeout, opts.poolHealthCheck || opts.poolCheckInterval != 0)
 		}
 	}
 
 	return
 }
+
+// send writes b to the backend, counting the bytes sent.
+func (w *writer) send(b []byte) (n int, err error) {
+	n, err = w.backend.Write(b)
+	w.sent += int64(n)
+	return
+}
+
+// sender is an io.Writer sending to the backend of a writer, it is passed to
+// formatters.
+type sender struct {
+	w *writer
+}
+
+func (s sender) Write(b []byte) (int, error) {
+	return s.w.send(b)
+}
+
+// writerMetrics are the metrics reported by writers for an endpoint.
+type writerMetrics struct {
+	messages   *lib.Counter
+	bytes      *lib.Counter
+	errors     *lib.Counter
+	reconnects *lib.Counter
+	flush      *lib.Timer
+}
+
+func getWriterMetrics(opts dialOpts) *writerMetrics {
+	labels := []string{"network", opts.network, "address", opts.address}
+	return &writerMetrics{
+		messages:   lib.Metrics.Counter("syslog_messages_written_total", labels...),
+		bytes:      lib.Metrics.Counter("syslog_bytes_written_total", labels...),
+		errors:     lib.Metrics.Counter("syslog_write_errors_total", labels...),
+		reconnects: lib.Metrics.Counter("syslog_reconnects_total", labels...),
+		flush:      lib.Metrics.Timer("syslog_flush_seconds", labels...),
+	}
+}
+
+// checkConn detects stream connections closed by the server before they are
+// reused, without waiting since the connections are watched in the background.
+// RELP sessions aren't checked since responses are read by the writer.
+func checkConn(w io.WriteCloser) error {
+	c, ok := w.(bufferedConn)
+	if !ok || c.closed == nil {
+		return nil
+	}
+
+	if atomic.LoadInt32(c.closed) != 0 {
+		return errConnClosed
+	}
+
+	return nil
+}
+
+// tlsHandshake establishes a TLS session over a connection that was opened
+// through a proxy.
+func tlsHandshake(rawConn net.Conn, config *tls.Config, timeout time.Duration) (conn net.Conn, err error) {
+	tlsConn := tls.Client(rawConn, config)
+	rawConn.SetDeadline(time.Now().Add(timeout))
+
+	if err = tlsConn.Handshake(); err != nil {
+		rawConn.Close()
+		return
+	}
+
+	rawConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func isDatagram(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram", "unixpacket":
+		return true
+	}
+	return false
+}
+
+// retryDelay returns the interval to wait before retrying to dial, extended by
+// a random amount up to jitter so writers don't all retry at the same time.
+func retryDelay(interval time.Duration, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		interval += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return interval
+}
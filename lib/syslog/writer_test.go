@@ -1,16 +1,26 @@
 package syslog
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	ecslogs "github.com/kapralVV/ecs-logs-go"
 	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/syslog/pool"
 )
 
 const testGoroutines = 50
@@ -109,6 +119,460 @@ func TestGetPool(t *testing.T) {
 	}
 }
 
+func TestGetPoolConcurrent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, testGoroutines)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	opts := dialOpts{
+		network:     "tcp",
+		address:     l.Addr().String(),
+		dialTimeout: time.Second,
+		poolSize:    1,
+	}
+	defer setTestPool(opts, nil)
+
+	pools := make(chan *pool.LimitedConnPool, testGoroutines)
+
+	for i := 0; i != testGoroutines; i++ {
+		go func() {
+			p, err := getPool(opts)
+			if err != nil {
+				t.Error(err)
+			}
+			pools <- p
+		}()
+	}
+
+	first := <-pools
+	for i := 1; i != testGoroutines; i++ {
+		if p := <-pools; p != first {
+			t.Error("writers opened concurrently did not share the pool")
+		}
+	}
+
+	// Only the first connection of the pool was dialed.
+	time.Sleep(100 * time.Millisecond)
+
+	if n := len(accepted); n != 1 {
+		t.Errorf("%d connections were dialed, want 1", n)
+	}
+}
+
+func TestWriterOctetCounting(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := &writer{
+		format:       newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}: multi\nline"}, DefaultFacility),
+		octetCounted: true,
+		backend:      nopCloser{b},
+	}
+
+	for i := 0; i != 2; i++ {
+		if err := w.directWrite(lib.Message{Group: "abc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s := b.String(); s != "15 abc: multi\nline15 abc: multi\nline" {
+		t.Errorf("invalid octet-counted output: %q", s)
+	}
+}
+
+func TestWriterFraming(t *testing.T) {
+	b := &flushBuffer{}
+	w := &writer{
+		format: newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}"}, DefaultFacility),
+		framing: lib.Framing{
+			RecordPrefix: "{length}<",
+			RecordSuffix: ">\x00",
+			BatchHeader:  "BEGIN {count}\n",
+			BatchFooter:  "END\n",
+		},
+	}
+	w.setBackend(b)
+
+	if err := w.writeBatch(lib.MessageBatch{{Group: "a"}, {Group: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := b.String(); s != "BEGIN 2\n1<a>\x001<b>\x00END\n" {
+		t.Errorf("invalid framed output: %q", s)
+	}
+}
+
+func TestWriterReconnect(t *testing.T) {
+	b := &bytes.Buffer{}
+	n := 0
+	p, err := pool.NewLimited(1, func() (io.WriteCloser, error) {
+		if n++; n == 1 {
+			return failingConn{}, nil
+		}
+		return nopCloser{b}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	opts := dialOpts{network: "test", address: "reconnect", dialTimeout: time.Second}
+	setTestPool(opts, p)
+	defer setTestPool(opts, nil)
+
+	w := &writer{
+		format:     newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}\n"}, DefaultFacility),
+		candidates: []dialOpts{opts},
+		pool:       p,
+	}
+	w.setBackend(p.Get())
+	defer w.Close()
+
+	if err := w.WriteMessageBatch(lib.MessageBatch{{Group: "abc"}, {Group: "def"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := b.String(); s != "abc\ndef\n" {
+		t.Errorf("invalid output after reconnecting: %q", s)
+	}
+}
+
+func TestWriterFailover(t *testing.T) {
+	b := &bytes.Buffer{}
+	n := 0
+	p1, err := pool.NewLimited(1, func() (io.WriteCloser, error) {
+		if n++; n == 1 {
+			return failingConn{}, nil
+		}
+		return nil, io.ErrClosedPipe
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Close()
+
+	p2, err := pool.NewLimited(1, func() (io.WriteCloser, error) {
+		return nopCloser{b}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+
+	opts1 := dialOpts{network: "test", address: "primary", dialTimeout: time.Second}
+	opts2 := dialOpts{network: "test", address: "secondary", dialTimeout: time.Second}
+	setTestPool(opts1, p1)
+	setTestPool(opts2, p2)
+	defer setTestPool(opts1, nil)
+	defer setTestPool(opts2, nil)
+
+	w := &writer{
+		format:     newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}\n"}, DefaultFacility),
+		candidates: []dialOpts{opts1, opts2},
+		pool:       p1,
+	}
+	w.setBackend(p1.Get())
+	defer w.Close()
+
+	if err := w.WriteMessage(lib.Message{Group: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.current != 1 {
+		t.Errorf("the writer did not fail over to the secondary endpoint")
+	}
+
+	if s := b.String(); s != "abc\n" {
+		t.Errorf("invalid output after failing over: %q", s)
+	}
+}
+
+func TestWriterFailback(t *testing.T) {
+	b1, b2 := &bytes.Buffer{}, &bytes.Buffer{}
+
+	p1, err := pool.NewLimited(1, func() (io.WriteCloser, error) { return nopCloser{b1}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Close()
+
+	p2, err := pool.NewLimited(1, func() (io.WriteCloser, error) { return nopCloser{b2}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+
+	opts1 := dialOpts{network: "test", address: "primary", dialTimeout: time.Second}
+	opts2 := dialOpts{network: "test", address: "secondary", dialTimeout: time.Second}
+	setTestPool(opts1, p1)
+	setTestPool(opts2, p2)
+	defer setTestPool(opts1, nil)
+	defer setTestPool(opts2, nil)
+
+	w := &writer{
+		format:       newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}\n"}, DefaultFacility),
+		candidates:   []dialOpts{opts1, opts2},
+		current:      1,
+		pool:         p2,
+		failbackTime: time.Now(),
+	}
+	w.setBackend(p2.Get())
+	defer w.Close()
+
+	if err := w.WriteMessage(lib.Message{Group: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.current != 1 || b2.String() != "abc\n" {
+		t.Errorf("the writer should not fail back before the failback interval")
+	}
+
+	w.failbackTime = time.Now().Add(-failbackInterval)
+
+	if err := w.WriteMessage(lib.Message{Group: "def"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.current != 0 {
+		t.Errorf("the writer did not fail back to the primary endpoint")
+	}
+
+	if s := b1.String(); s != "def\n" {
+		t.Errorf("invalid output after failing back: %q", s)
+	}
+}
+
+func TestDialFirst(t *testing.T) {
+	// The primary server accepts connections but never completes the TLS
+	// handshake, so dialing it only fails after the dial timeout.
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+
+	fast, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	go func() {
+		for {
+			c, err := fast.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, c)
+		}
+	}()
+
+	start := time.Now()
+
+	w, err := DialWriter(WriterConfig{
+		Network:      "tls",
+		Address:      slow.Addr().String(),
+		Endpoints:    []Endpoint{{Network: "tcp", Address: fast.Addr().String()}},
+		DialTimeout:  5 * time.Second,
+		DialAttempts: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dialing waited for the unreachable endpoint: %s", elapsed)
+	}
+
+	if w.(*writer).current != 1 {
+		t.Error("the writer is not connected to the reachable endpoint")
+	}
+}
+
+func setTestPool(opts dialOpts, p *pool.LimitedConnPool) {
+	connPoolsLock.Lock()
+	defer connPoolsLock.Unlock()
+
+	if p == nil {
+		delete(connPools, opts.key())
+	} else {
+		connPools[opts.key()] = p
+	}
+}
+
+func TestBufferedConnWriteTimeout(t *testing.T) {
+	// Nothing reads from the other end of the pipe, so the flush must give up
+	// once the write timeout expires.
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	c := bufferedConn{
+		conn:    c1,
+		buf:     bufio.NewWriter(c1),
+		timeout: 10 * time.Millisecond,
+	}
+	defer c.Close()
+
+	c.Write([]byte("Hello World!\n"))
+
+	if err := c.Flush(); err == nil {
+		t.Error("flushing to a hung peer should have timed out")
+	}
+
+	// Writing more than the buffer holds sends it too.
+	c = bufferedConn{
+		conn:    c1,
+		buf:     bufio.NewWriterSize(c1, 16),
+		timeout: 10 * time.Millisecond,
+	}
+
+	if _, err := c.Write([]byte("Hello World! Hello World!\n")); err == nil {
+		t.Error("writing to a hung peer should have timed out")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d := retryDelay(time.Second, 0); d != time.Second {
+		t.Errorf("invalid retry delay without jitter: %s", d)
+	}
+
+	for i := 0; i != 100; i++ {
+		if d := retryDelay(time.Second, time.Second); d < time.Second || d >= 2*time.Second {
+			t.Errorf("retry delay out of bounds: %s", d)
+		}
+	}
+}
+
+type failingConn struct{}
+
+func (failingConn) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func (failingConn) Close() error { return nil }
+
+func TestWriterMaxDatagramSize(t *testing.T) {
+	tests := []struct {
+		overflow string
+		out      []string
+	}{
+		{DatagramTruncate, []string{"ab: 012..."}},
+		{DatagramSplit, []string{"ab: 01234\n", "ab: 5678\n", "ab: é9ab\n", "ab: cdef\n"}},
+	}
+
+	for _, test := range tests {
+		d := &datagrams{}
+		w := &writer{
+			format: func(w io.Writer, m lib.Message) error {
+				_, err := fmt.Fprintf(w, "%s: %s\n", m.Group, m.Event.Message)
+				return err
+			},
+			maxDatagramSize:  10,
+			datagramOverflow: test.overflow,
+			candidates:       []dialOpts{{network: "udp"}},
+		}
+		w.setBackend(d)
+
+		if err := w.WriteMessage(lib.Message{Group: "ab", Event: ecslogs.Event{Message: "012345678é9abcdef"}}); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !reflect.DeepEqual(d.list, test.out) {
+			t.Errorf("%s: invalid datagrams: %q", test.overflow, d.list)
+		}
+	}
+}
+
+func TestWriterNewlines(t *testing.T) {
+	tests := []struct {
+		policy string
+		out    string
+	}{
+		{NewlinesKeep, "a\r\nb\nc\n"},
+		{NewlinesEscape, `a\r\nb\nc` + "\n"},
+		{NewlinesReplace, "a b c\n"},
+	}
+
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := &writer{
+			format:   newRFC5424Formatter(WriterConfig{}, DefaultFacility),
+			newlines: newlinesReplacer(test.policy),
+		}
+		w.setBackend(nopCloser{b})
+
+		msg := lib.Message{Event: ecslogs.Event{Message: "a\r\nb\nc"}}
+
+		if err := w.write(msg); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if s := b.String(); !strings.HasSuffix(s, " "+test.out) {
+			t.Errorf("%s: invalid output: %q", test.policy, s)
+		}
+	}
+}
+
+func TestTruncateDatagram(t *testing.T) {
+	tests := []struct {
+		in  string
+		max int
+		out string
+	}{
+		{"hello", 10, "hello"},
+		{"hello world", 8, "hello..."},
+		{"héllo world", 5, "h..."},
+		{"héllo", 2, "h"},
+	}
+
+	for _, test := range tests {
+		if s := string(truncateDatagram([]byte(test.in), test.max)); s != test.out {
+			t.Errorf("%s: invalid truncated datagram: %q", test.in, s)
+		}
+	}
+}
+
+// datagrams records each write as a separate datagram.
+type datagrams struct {
+	list []string
+}
+
+func (d *datagrams) Write(b []byte) (int, error) {
+	d.list = append(d.list, string(b))
+	return len(b), nil
+}
+
+func (d *datagrams) Close() error { return nil }
+
+func (d *datagrams) Flush() error { return nil }
+
+// flushBuffer is a buffered stream backend.
+type flushBuffer struct {
+	bytes.Buffer
+}
+
+func (b *flushBuffer) Close() error { return nil }
+
+func (b *flushBuffer) Flush() error { return nil }
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
 func BenchmarkNewWriter(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		w, err := NewWriter("foo", "bar")
@@ -150,3 +614,167 @@ func BenchmarkWrite(b *testing.B) {
 		b.Fatal(err)
 	}
 }
+
+func TestCheckConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newBufferedConn(client, time.Second, true)
+
+	if err := checkConn(c); err != nil {
+		t.Error("healthy connection failed the check:", err)
+	}
+
+	server.Close()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := checkConn(c); err == nil {
+		t.Error("connection closed by the server passed the check")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	defer os.Unsetenv("SYSLOG_URL")
+	defer os.Unsetenv("SYSLOG_TLS_INSECURE")
+
+	os.Setenv("SYSLOG_URL", "tls://localhost:6514")
+	os.Setenv("SYSLOG_TLS_INSECURE", "true")
+
+	if err := check(); err != nil {
+		t.Error(err)
+	}
+
+	os.Setenv("SYSLOG_TLS_INSECURE", "maybe")
+
+	if err := check(); err == nil {
+		t.Error("checking an invalid configuration should fail")
+	}
+}
+
+func TestWriterPoolDisabled(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conns := make(chan net.Conn, 10)
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+
+	config := WriterConfig{
+		Network:      "tcp",
+		Address:      l.Addr().String(),
+		Template:     "{{.GROUP}}",
+		PoolDisabled: true,
+	}
+
+	w1, err := DialWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w2, err := DialWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range []lib.Writer{w1, w2} {
+		if err := w.WriteMessage(lib.Message{Group: "abc"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Each writer has its own connection, which is closed with the writer.
+	for i := 0; i != 2; i++ {
+		select {
+		case c := <-conns:
+			w1.Close()
+			w2.Close()
+			c.SetReadDeadline(time.Now().Add(time.Second))
+
+			if b, err := ioutil.ReadAll(c); err != nil || string(b) != "abc\n" {
+				t.Errorf("invalid data received on connection %d: %q (%v)", i, b, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("writers must have their own connection when pooling is disabled")
+		}
+	}
+}
+
+func TestWriterMetrics(t *testing.T) {
+	d := &datagrams{}
+	w := &writer{
+		format:     newTemplateFormatter(WriterConfig{Template: "{{.GROUP}}"}, DefaultFacility),
+		candidates: []dialOpts{{network: "udp", address: "metrics-test:514"}},
+	}
+	w.setBackend(d)
+
+	if err := w.WriteMessageBatch(lib.MessageBatch{{Group: "abc"}, {Group: "defg"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := []string{"network", "udp", "address", "metrics-test:514"}
+
+	if n := lib.Metrics.Counter("syslog_messages_written_total", labels...).Value(); n != 2 {
+		t.Errorf("invalid number of messages written: %d", n)
+	}
+
+	if n := lib.Metrics.Counter("syslog_bytes_written_total", labels...).Value(); n != 9 {
+		t.Errorf("invalid number of bytes written: %d", n)
+	}
+
+	if n, _, _ := lib.Metrics.Timer("syslog_flush_seconds", labels...).Value(); n != 1 {
+		t.Errorf("invalid number of flushes: %d", n)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind lib.ErrorKind
+	}{
+		{errNoConnection, lib.UnreachableError},
+		{io.ErrClosedPipe, lib.UnreachableError},
+		{&net.OpError{Op: "dial", Err: x509.UnknownAuthorityError{}}, lib.AuthFailureError},
+		{x509.HostnameError{Host: "syslog"}, lib.AuthFailureError},
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EMSGSIZE)}, lib.OversizedError},
+		{relpRejectedError{"500 too large"}, lib.UnknownError},
+	}
+
+	for _, test := range tests {
+		if kind := errorKind(test.err); kind != test.kind {
+			t.Errorf("%v: invalid error kind: %s", test.err, kind)
+		}
+	}
+}
+
+func TestNewDialerKeepAlive(t *testing.T) {
+	for _, keepAlive := range []time.Duration{-1, 10 * time.Second} {
+		if d := newDialer(dialOpts{keepAlive: keepAlive}); d.KeepAlive != keepAlive {
+			t.Errorf("invalid keep-alive interval: %s != %s", d.KeepAlive, keepAlive)
+		}
+	}
+}
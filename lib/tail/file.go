@@ -0,0 +1,122 @@
+package tail
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	// How much is read from a file at once.
+	readSize = 64 * 1024
+
+	// Lines longer than this are split in multiple messages.
+	maxLineSize = 1024 * 1024
+
+	// How much is read from a file at most each time the files are polled, so
+	// a file growing faster than it's read doesn't starve the others.
+	maxPollSize = 1024 * 1024
+)
+
+// file is a file being tailed, offset is the position in the file after the
+// last complete line read, and buf the beginning of the next line.
+type file struct {
+	path     string
+	captures []string
+	f        *os.File
+	info     os.FileInfo
+	offset   int64
+	buf      []byte
+
+	// Fragments of the docker log lines that were split because they were
+	// too long.
+	partial string
+}
+
+func openFile(path string, info os.FileInfo, captures []string, offset int64) (f *file, err error) {
+	var fd *os.File
+
+	if fd, err = os.Open(path); err != nil {
+		return
+	}
+
+	if _, err = fd.Seek(offset, io.SeekStart); err != nil {
+		fd.Close()
+		return
+	}
+
+	f = &file{
+		path:     path,
+		captures: captures,
+		f:        fd,
+		info:     info,
+		offset:   offset,
+	}
+	return
+}
+
+// readLines reads the lines appended to the file since the last call, up to
+// maxPollSize bytes, calling line with each of them and the offset following
+// it. When flush is set the file is read up to its end and the last line is
+// returned even if it isn't terminated, which is used when a file won't be
+// read anymore.
+func (f *file) readLines(flush bool, line func(s string, offset int64)) (err error) {
+	var chunk [readSize]byte
+
+	for size := 0; flush || size < maxPollSize; {
+		var n int
+
+		n, err = f.f.Read(chunk[:])
+		size += n
+		f.buf = append(f.buf, chunk[:n]...)
+
+		for {
+			i := bytes.IndexByte(f.buf, '\n')
+
+			if i < 0 {
+				if len(f.buf) < maxLineSize {
+					break
+				}
+				i = maxLineSize
+			} else {
+				i++
+			}
+
+			f.offset += int64(i)
+			line(string(bytes.TrimRight(f.buf[:i], "\r\n")), f.offset)
+			f.buf = f.buf[i:]
+		}
+
+		if err != nil || n < len(chunk) {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	if flush && len(f.buf) != 0 {
+		f.offset += int64(len(f.buf))
+		line(string(f.buf), f.offset)
+		f.buf = nil
+	}
+
+	// The remaining bytes are moved to a new buffer so the large ones used to
+	// read long lines aren't retained.
+	f.buf = append([]byte(nil), f.buf...)
+	return
+}
+
+// truncated resets the reading position when the file was truncated, as done
+// by copytruncate log rotations.
+func (f *file) truncated() (err error) {
+	if _, err = f.f.Seek(0, io.SeekStart); err == nil {
+		f.offset, f.buf, f.partial = 0, nil, ""
+	}
+	return
+}
+
+func (f *file) close() {
+	f.f.Close()
+}
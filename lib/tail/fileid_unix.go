@@ -0,0 +1,17 @@
+// +build !windows
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode of the file, used to check that a saved offset
+// belongs to the file found at the same path.
+func fileID(info os.FileInfo) uint64 {
+	if s, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(s.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+package tail
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("files", lib.SourceFunc(NewReader))
+}
@@ -0,0 +1,126 @@
+package tail
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// How often the offsets file is written while the reader is open.
+const offsetsSaveInterval = 1 * time.Second
+
+// offset is the position up to which a file was delivered.
+type offset struct {
+	ID     uint64 `json:"id,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// offsetFile saves the offsets of the files, indexed by path, so the reader
+// resumes where it stopped when it's opened again.
+type offsetFile struct {
+	path    string
+	mutex   sync.Mutex
+	offsets map[string]offset
+	saved   time.Time
+	dirty   bool
+	closed  bool
+}
+
+// readOffsetFile loads the offsets saved in the file at path, a missing file
+// holds no offsets.
+func readOffsetFile(path string) (f *offsetFile, err error) {
+	var b []byte
+
+	f = &offsetFile{path: path, offsets: make(map[string]offset)}
+
+	if b, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	err = json.Unmarshal(b, &f.offsets)
+	return
+}
+
+// get returns the saved offset of the file at path, if it was saved for the
+// same file and it's not past its end. A nil offsetFile has no offsets.
+func (f *offsetFile) get(path string, info os.FileInfo) (int64, bool) {
+	if f == nil {
+		return 0, false
+	}
+
+	f.mutex.Lock()
+	o, ok := f.offsets[path]
+	f.mutex.Unlock()
+
+	if !ok || o.ID != fileID(info) || o.Offset > info.Size() {
+		return 0, false
+	}
+
+	return o.Offset, true
+}
+
+// set records the offsets of a batch of delivered positions, which are written
+// to the file at most once per offsetsSaveInterval while the reader is open,
+// and on each call once it was closed.
+func (f *offsetFile) set(positions []position, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, p := range positions {
+		f.offsets[p.path] = offset{ID: p.id, Offset: p.offset}
+	}
+
+	f.dirty = true
+
+	if f.closed || now.Sub(f.saved) >= offsetsSaveInterval {
+		f.save(now)
+	}
+}
+
+func (f *offsetFile) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+
+	if f.dirty {
+		f.save(time.Now())
+	}
+}
+
+// save writes the offsets to a temporary file renamed over the offsets file,
+// the offsets of the files that were removed are discarded. It must be called
+// with the mutex held.
+func (f *offsetFile) save(now time.Time) {
+	for path := range f.offsets {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(f.offsets, path)
+		}
+	}
+
+	b, _ := json.Marshal(f.offsets)
+	tmp := filepath.Join(filepath.Dir(f.path), "."+filepath.Base(f.path)+".tmp")
+	err := ioutil.WriteFile(tmp, b, 0644)
+
+	if err == nil {
+		err = os.Rename(tmp, f.path)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  f.path,
+			"error": err,
+		}).Error("failed to save the file offsets")
+		return
+	}
+
+	f.saved, f.dirty = now, false
+}
@@ -0,0 +1,454 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// Formats of the lines of the files.
+const (
+	// Each line is the message of an event.
+	FormatText = "text"
+
+	// Each line is a JSON event, lines that aren't are read as text.
+	FormatJSON = "json"
+
+	// Lines are written by the json-file logging driver of docker.
+	FormatDocker = "docker"
+)
+
+const (
+	defaultPollInterval = 1 * time.Second
+	defaultGroup        = "{dir}"
+	defaultStream       = "{file}"
+
+	// Maximum size of the docker log lines reassembled from fragments.
+	maxPartialSize = 1024 * 1024
+)
+
+// Config is the configuration of a reader of files.
+type Config struct {
+	// Comma separated list of globs matching the files to read.
+	Path string
+
+	// Templates of the groups and streams of the messages, see expand.
+	Group  string
+	Stream string
+
+	// Format of the lines.
+	Format string
+
+	// Whether the files found when the reader is opened are read from the
+	// start ("head") or only their new lines ("tail", the default). Files
+	// created later are always read from the start.
+	Start string
+
+	// Path of the file where the offsets of the files are saved, the files are
+	// read from these offsets when the reader is opened again.
+	OffsetsFile string
+
+	// How often the files are checked for new lines.
+	PollInterval time.Duration
+}
+
+// NewReader returns a reader of the files configured by the FILES_*
+// environment variables.
+func NewReader() (lib.Reader, error) {
+	config := Config{
+		Path:        os.Getenv("FILES_PATH"),
+		Group:       os.Getenv("FILES_GROUP"),
+		Stream:      os.Getenv("FILES_STREAM"),
+		Format:      os.Getenv("FILES_FORMAT"),
+		Start:       os.Getenv("FILES_START"),
+		OffsetsFile: os.Getenv("FILES_OFFSETS"),
+	}
+
+	if s := os.Getenv("FILES_POLL_INTERVAL"); len(s) != 0 {
+		var err error
+		if config.PollInterval, err = time.ParseDuration(s); err != nil || config.PollInterval <= 0 {
+			return nil, fmt.Errorf("invalid FILES_POLL_INTERVAL value: %s", s)
+		}
+	}
+
+	return NewReaderWith(config)
+}
+
+// NewReaderWith returns a reader of the files matching config.
+func NewReaderWith(config Config) (lib.Reader, error) {
+	var err error
+
+	r := &reader{
+		group:        config.Group,
+		stream:       config.Stream,
+		format:       config.Format,
+		pollInterval: config.PollInterval,
+		tail:         true,
+		files:        make(map[string]*file),
+	}
+
+	for _, glob := range strings.Split(config.Path, ",") {
+		var p pattern
+
+		if glob = strings.TrimSpace(glob); len(glob) == 0 {
+			continue
+		}
+
+		if p, err = newPattern(glob); err != nil {
+			return nil, fmt.Errorf("invalid FILES_PATH value: %s", glob)
+		}
+
+		r.patterns = append(r.patterns, p)
+	}
+
+	if len(r.patterns) == 0 {
+		return nil, fmt.Errorf("no files to read, FILES_PATH must be set")
+	}
+
+	switch r.format {
+	case "":
+		r.format = FormatText
+	case FormatText, FormatJSON, FormatDocker:
+	default:
+		return nil, fmt.Errorf("invalid FILES_FORMAT value: %s", r.format)
+	}
+
+	switch config.Start {
+	case "", "tail":
+	case "head":
+		r.tail = false
+	default:
+		return nil, fmt.Errorf("invalid FILES_START value: %s", config.Start)
+	}
+
+	if len(r.group) == 0 {
+		r.group = defaultGroup
+	}
+
+	if len(r.stream) == 0 {
+		r.stream = defaultStream
+	}
+
+	if r.pollInterval == 0 {
+		r.pollInterval = defaultPollInterval
+	}
+
+	if len(config.OffsetsFile) != 0 {
+		if r.offsets, err = readOffsetFile(config.OffsetsFile); err != nil {
+			return nil, fmt.Errorf("invalid FILES_OFFSETS file: %s", err)
+		}
+	}
+
+	return r, nil
+}
+
+// position is the offset following a message read from a file, recorded until
+// the message is delivered when the offsets are saved.
+type position struct {
+	seq    uint64
+	path   string
+	id     uint64
+	offset int64
+}
+
+type reader struct {
+	// Last time the files were checked for new lines, first in the struct so
+	// it's aligned for atomic operations.
+	polled int64
+
+	patterns     []pattern
+	group        string
+	stream       string
+	format       string
+	pollInterval time.Duration
+	stopped      int32
+	stopAtEnd    int32
+
+	// Whether the files found by the next poll are read from their end, which
+	// is only the case for the first poll unless the reader starts at the
+	// head of the files.
+	tail bool
+
+	// Files being read, indexed by path.
+	files map[string]*file
+
+	// Messages read by the last poll and the position of the next one to be
+	// returned by ReadMessage.
+	batch []lib.Message
+	index int
+
+	// Saves the offsets of the files up to the last message delivered, the
+	// positions of the messages are numbered in the order they were read and
+	// their number is used as cursor.
+	offsets   *offsetFile
+	mutex     sync.Mutex
+	seq       uint64
+	positions []position
+}
+
+func (r *reader) StopAtEnd() {
+	atomic.StoreInt32(&r.stopAtEnd, 1)
+}
+
+// LastPoll returns the last time the reader checked the files for new lines.
+func (r *reader) LastPoll() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&r.polled))
+}
+
+func (r *reader) Close() (err error) {
+	atomic.StoreInt32(&r.stopped, 1)
+
+	if r.offsets != nil {
+		r.offsets.close()
+	}
+
+	return
+}
+
+// Ack saves the offsets of the files up to the message with the given cursor
+// when FILES_OFFSETS is set.
+func (r *reader) Ack(cursor string) {
+	if r.offsets == nil {
+		return
+	}
+
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for n < len(r.positions) && r.positions[n].seq <= seq {
+		n++
+	}
+
+	if n != 0 {
+		r.offsets.set(r.positions[:n], time.Now())
+		r.positions = append(r.positions[:0], r.positions[n:]...)
+	}
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	for atomic.LoadInt32(&r.stopped) == 0 {
+		if r.index < len(r.batch) {
+			msg = r.batch[r.index]
+			r.index++
+			return
+		}
+
+		r.batch, r.index = r.batch[:0], 0
+		r.poll()
+		atomic.StoreInt64(&r.polled, time.Now().UnixNano())
+
+		if len(r.batch) == 0 {
+			if atomic.LoadInt32(&r.stopAtEnd) != 0 {
+				break
+			}
+			time.Sleep(r.pollInterval)
+		}
+	}
+
+	for _, f := range r.files {
+		f.close()
+	}
+
+	r.files = nil
+	err = io.EOF
+	return
+}
+
+// poll finds the files matching the patterns and reads their new lines. Files
+// that were renamed are followed while they match, the others are read up to
+// their end before being closed, so the last lines written to a file rotated
+// by renaming it aren't lost.
+func (r *reader) poll() {
+	captures := make(map[string][]string)
+	infos := make(map[string]os.FileInfo)
+
+	for _, p := range r.patterns {
+		paths, _ := filepath.Glob(p.glob)
+
+		for _, path := range paths {
+			if _, ok := infos[path]; ok {
+				continue
+			}
+
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				infos[path] = info
+				captures[path] = p.captures(path)
+			}
+		}
+	}
+
+	tracked := r.files
+	r.files = make(map[string]*file, len(infos))
+
+	for path, f := range tracked {
+		if info, ok := infos[path]; ok && os.SameFile(f.info, info) {
+			r.files[path] = f
+			continue
+		}
+
+		if moved := r.follow(f, infos, captures, tracked); !moved {
+			r.read(f, true)
+			f.close()
+		}
+	}
+
+	for path, info := range infos {
+		f := r.files[path]
+
+		if f == nil {
+			var err error
+			var offset int64
+
+			if o, ok := r.offsets.get(path, info); ok {
+				offset = o
+			} else if r.tail {
+				offset = info.Size()
+			}
+
+			if f, err = openFile(path, info, captures[path], offset); err != nil {
+				log.WithFields(log.Fields{
+					"path":  path,
+					"error": err,
+				}).Error("failed to open file")
+				continue
+			}
+
+			r.files[path] = f
+		} else if info.Size() < f.offset {
+			if err := f.truncated(); err != nil {
+				continue
+			}
+		}
+
+		f.info = info
+		r.read(f, false)
+	}
+
+	r.tail = false
+}
+
+// follow moves f to the path it was renamed to if it still matches one of the
+// patterns and isn't already being read.
+func (r *reader) follow(f *file, infos map[string]os.FileInfo, captures map[string][]string, tracked map[string]*file) bool {
+	for path, info := range infos {
+		if !os.SameFile(f.info, info) {
+			continue
+		}
+
+		if r.files[path] != nil {
+			return false
+		}
+
+		if g := tracked[path]; g != nil && os.SameFile(g.info, info) {
+			return false
+		}
+
+		f.path, f.captures = path, captures[path]
+		r.files[path] = f
+		return true
+	}
+
+	return false
+}
+
+// read appends the messages of the new lines of f to the batch.
+func (r *reader) read(f *file, flush bool) {
+	group := expand(r.group, f.path, f.captures)
+	stream := expand(r.stream, f.path, f.captures)
+	id := fileID(f.info)
+	now := time.Now()
+
+	err := f.readLines(flush, func(line string, offset int64) {
+		event, ok := r.parse(f, line, now)
+
+		if !ok {
+			return
+		}
+
+		msg := lib.Message{
+			Group:  group,
+			Stream: stream,
+			Event:  event,
+		}
+
+		if r.offsets != nil {
+			r.mutex.Lock()
+			r.seq++
+			r.positions = append(r.positions, position{seq: r.seq, path: f.path, id: id, offset: offset})
+			msg.Cursor = strconv.FormatUint(r.seq, 10)
+			r.mutex.Unlock()
+		}
+
+		r.batch = append(r.batch, msg)
+	})
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  f.path,
+			"error": err,
+		}).Error("failed to read file")
+	}
+}
+
+// parse returns the event of a line in the format of the reader, the returned
+// flag is false for the fragments of docker log lines.
+func (r *reader) parse(f *file, line string, now time.Time) (event ecslogs.Event, ok bool) {
+	switch r.format {
+	case FormatJSON:
+		if err := json.Unmarshal([]byte(line), &event); err == nil {
+			if event.Time.IsZero() {
+				event.Time = now
+			}
+			return event, true
+		}
+
+	case FormatDocker:
+		var entry struct {
+			Log    string    `json:"log"`
+			Stream string    `json:"stream"`
+			Time   time.Time `json:"time"`
+		}
+
+		if err := json.Unmarshal([]byte(line), &entry); err == nil {
+			// Docker splits the lines longer than 16KB in multiple entries,
+			// only the last one ends with a newline.
+			if !strings.HasSuffix(entry.Log, "\n") && len(f.partial)+len(entry.Log) < maxPartialSize {
+				f.partial += entry.Log
+				return
+			}
+
+			level := ecslogs.INFO
+			if entry.Stream == "stderr" {
+				level = ecslogs.ERROR
+			}
+
+			event = ecslogs.MakeEvent(level, strings.TrimSuffix(f.partial+entry.Log, "\n"))
+			event.Time = entry.Time
+			event.Info.Source = f.path
+			f.partial = ""
+			return event, true
+		}
+	}
+
+	event = ecslogs.MakeEvent(ecslogs.INFO, line)
+	event.Time = now
+	event.Info.Source = f.path
+	return event, true
+}
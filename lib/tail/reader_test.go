@@ -0,0 +1,224 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// pollLines polls the files once and returns the lines that were read.
+func pollLines(r lib.Reader) (lines []string) {
+	t := r.(*reader)
+	t.poll()
+
+	for _, msg := range t.batch {
+		lines = append(lines, msg.Group+"/"+msg.Stream+": "+msg.Event.Message)
+	}
+
+	t.batch = t.batch[:0]
+	return
+}
+
+func appendFile(t *testing.T, path string, s string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	api := filepath.Join(dir, "api")
+	os.Mkdir(api, 0755)
+	path := filepath.Join(api, "app.log")
+
+	appendFile(t, path, "before\n")
+
+	r, err := NewReaderWith(Config{Path: filepath.Join(dir, "*", "*.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The lines written before the reader was opened are skipped.
+	if lines := pollLines(r); len(lines) != 0 {
+		t.Errorf("invalid lines at the start: %q", lines)
+	}
+
+	appendFile(t, path, "A\nB\nincomplete")
+
+	if lines := pollLines(r); !reflect.DeepEqual(lines, []string{"api/app.log: A", "api/app.log: B"}) {
+		t.Errorf("invalid lines: %q", lines)
+	}
+
+	// The rest of a file renamed out of the patterns is read before it's
+	// closed, and the new file is read from the start.
+	appendFile(t, path, " line\nC\n")
+	os.Rename(path, path+".1")
+	appendFile(t, path, "D\n")
+
+	if lines := pollLines(r); !reflect.DeepEqual(lines, []string{"api/app.log: incomplete line", "api/app.log: C", "api/app.log: D"}) {
+		t.Errorf("invalid lines after the rotation: %q", lines)
+	}
+
+	// Truncated files are read from the start again.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := pollLines(r); len(lines) != 0 {
+		t.Errorf("invalid lines after the truncation: %q", lines)
+	}
+
+	appendFile(t, path, "E\n")
+
+	if lines := pollLines(r); !reflect.DeepEqual(lines, []string{"api/app.log: E"}) {
+		t.Errorf("invalid lines after the truncation: %q", lines)
+	}
+}
+
+func TestReaderOffsets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	config := Config{
+		Path:        path,
+		Group:       "app",
+		Stream:      "host",
+		Start:       "head",
+		OffsetsFile: filepath.Join(dir, "offsets.json"),
+	}
+
+	appendFile(t, path, "A\nB\nC\n")
+
+	r, err := NewReaderWith(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.(lib.StopAtEndReader).StopAtEnd()
+	var msgs []lib.Message
+
+	for {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("invalid number of messages: %d", len(msgs))
+	}
+
+	// Only A and B were delivered.
+	r.(lib.AckReader).Ack(msgs[1].Cursor)
+	r.Close()
+
+	if r, err = NewReaderWith(config); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if lines := pollLines(r); !reflect.DeepEqual(lines, []string{"app/host: C"}) {
+		t.Errorf("invalid lines after reopening: %q", lines)
+	}
+}
+
+func TestReaderDocker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "0123abcd-json.log")
+	appendFile(t, path, `{"log":"hello ","stream":"stdout","time":"2017-06-01T12:00:00Z"}
+{"log":"world\n","stream":"stdout","time":"2017-06-01T12:00:00Z"}
+{"log":"oops\n","stream":"stderr","time":"2017-06-01T12:00:01Z"}
+`)
+
+	r, err := NewReaderWith(Config{Path: path, Format: FormatDocker, Start: "head"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.(lib.StopAtEndReader).StopAtEnd()
+	var events []ecslogs.Event
+
+	for {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			break
+		}
+		events = append(events, msg.Event)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("invalid number of events: %d", len(events))
+	}
+
+	if events[0].Message != "hello world" || events[0].Level != ecslogs.INFO {
+		t.Errorf("invalid first event: %s %s", events[0].Level, events[0].Message)
+	}
+
+	if events[1].Message != "oops" || events[1].Level != ecslogs.ERROR {
+		t.Errorf("invalid second event: %s %s", events[1].Level, events[1].Message)
+	}
+}
+
+func TestReaderPollSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	line := strings.Repeat("x", 1023) + "\n"
+	count := 3 * maxPollSize / len(line)
+	appendFile(t, filepath.Join(dir, "app.log"), strings.Repeat(line, count))
+
+	r, err := NewReaderWith(Config{Path: filepath.Join(dir, "*.log"), Start: "head"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// A large file is read over multiple polls.
+	n := 0
+
+	for i := 0; i != 3; i++ {
+		lines := pollLines(r)
+
+		if len(lines) == 0 || len(lines) > maxPollSize/len(line)+1 {
+			t.Fatalf("invalid number of lines read by poll %d: %d", i, len(lines))
+		}
+
+		n += len(lines)
+	}
+
+	if n != count {
+		t.Errorf("invalid number of lines: %d != %d", n, count)
+	}
+}
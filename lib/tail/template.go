@@ -0,0 +1,60 @@
+package tail
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pattern is a glob matching the files to read, the parts of the paths
+// matched by its wildcards can be used in the group and stream templates.
+type pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func newPattern(glob string) (p pattern, err error) {
+	if _, err = filepath.Match(glob, ""); err != nil {
+		return
+	}
+
+	expr := regexp.QuoteMeta(filepath.ToSlash(glob))
+	expr = strings.Replace(expr, `\*`, `([^/]*)`, -1)
+	expr = strings.Replace(expr, `\?`, `([^/])`, -1)
+
+	p.glob = glob
+	p.re, err = regexp.Compile("^" + expr + "$")
+	return
+}
+
+// captures returns the parts of path matched by the wildcards of the pattern,
+// the list is empty if the pattern uses character classes.
+func (p pattern) captures(path string) []string {
+	if m := p.re.FindStringSubmatch(filepath.ToSlash(path)); m != nil {
+		return m[1:]
+	}
+	return nil
+}
+
+// expand replaces the variables of a group or stream template: {path} is the
+// path of the file, {file} its name, {dir} the name of the directory it's in
+// and {1}, {2}... the parts of the path matched by the wildcards of the
+// pattern.
+func expand(template string, path string, captures []string) string {
+	if strings.IndexByte(template, '{') < 0 {
+		return template
+	}
+
+	vars := []string{
+		"{path}", path,
+		"{file}", filepath.Base(path),
+		"{dir}", filepath.Base(filepath.Dir(path)),
+	}
+
+	for i, c := range captures {
+		vars = append(vars, "{"+strconv.Itoa(i+1)+"}", c)
+	}
+
+	return strings.NewReplacer(vars...).Replace(template)
+}
@@ -0,0 +1,35 @@
+package tail
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	p, err := newPattern("/var/lib/docker/containers/*/*-json.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/var/lib/docker/containers/0123abcd/0123abcd-json.log"
+	captures := p.captures(path)
+
+	tests := []struct {
+		template string
+		result   string
+	}{
+		{"api", "api"},
+		{"{dir}", "0123abcd"},
+		{"{file}", "0123abcd-json.log"},
+		{"{path}", path},
+		{"docker-{1}", "docker-0123abcd"},
+		{"{2}/{3}", "0123abcd/{3}"},
+	}
+
+	for _, test := range tests {
+		if result := expand(test.template, path, captures); result != test.result {
+			t.Errorf("%s: invalid expansion: %s", test.template, result)
+		}
+	}
+
+	if _, err := newPattern("/var/log/[a-"); err == nil {
+		t.Error("invalid globs should be rejected")
+	}
+}
@@ -0,0 +1,8 @@
+package tcp
+
+import "github.com/kapralVV/ecs-logs/lib"
+
+func init() {
+	lib.RegisterSource("tcp", lib.SourceFunc(NewReader))
+	lib.RegisterDestination("tcp", lib.DestinationFunc(NewWriter))
+}
@@ -0,0 +1,329 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+const (
+	// DefaultAddress is the address on which the tcp source accepts
+	// connections when neither TCP_LISTEN nor TCP_SOCKET is set, it only
+	// accepts local connections since the applications push their logs to
+	// the agent running on their host.
+	DefaultAddress = "127.0.0.1:5170"
+
+	// Lines longer than this are rejected.
+	maxLineSize = 1024 * 1024
+
+	// How long clients have to send their token once connected.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Config is the configuration of the tcp source.
+type Config struct {
+	// Group and stream of the events sent without them.
+	Group  string
+	Stream string
+
+	// Tokens accepted from the clients connecting over TCP, any connection
+	// is accepted when empty. Clients of the unix socket never send one
+	// since the permissions of the socket restrict who can connect.
+	Tokens []string
+}
+
+// NewReader returns a reader of the JSON events sent one per line to the TCP
+// address set by TCP_LISTEN and to the unix socket set by TCP_SOCKET. Clients
+// connecting over TCP must send one of the tokens of TCP_TOKENS when it's set,
+// which is required unless the address is a loopback address.
+func NewReader() (r lib.Reader, err error) {
+	var listeners []net.Listener
+
+	defer func() {
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+		}
+	}()
+
+	address, socket := os.Getenv("TCP_LISTEN"), os.Getenv("TCP_SOCKET")
+
+	if len(address) == 0 && len(socket) == 0 {
+		address = DefaultAddress
+	}
+
+	config := Config{
+		Group:  os.Getenv("TCP_GROUP"),
+		Stream: os.Getenv("TCP_STREAM"),
+	}
+
+	for _, token := range strings.Split(os.Getenv("TCP_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); len(token) != 0 {
+			config.Tokens = append(config.Tokens, token)
+		}
+	}
+
+	if len(address) != 0 && len(config.Tokens) == 0 && !lib.IsLoopbackAddress(address) {
+		err = fmt.Errorf("TCP_TOKENS must be set to listen on a non-loopback address: %s", address)
+		return
+	}
+
+	if len(address) != 0 {
+		var l net.Listener
+
+		if l, err = net.Listen("tcp", address); err != nil {
+			return
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	if len(socket) != 0 {
+		var l net.Listener
+
+		if err = removeSocket(socket); err != nil {
+			return
+		}
+
+		if l, err = net.Listen("unix", socket); err != nil {
+			return
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	if len(config.Stream) == 0 {
+		config.Stream, _ = os.Hostname()
+	}
+
+	r = NewReaderWith(listeners, config)
+	return
+}
+
+// removeSocket removes the socket left at path by a previous run, which would
+// prevent listening. Other files are kept and reported since TCP_SOCKET was
+// likely set to the wrong path.
+func removeSocket(path string) error {
+	info, err := os.Lstat(path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("invalid TCP_SOCKET value: %s is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
+
+// NewReaderWith returns a reader of the JSON events sent to the connections
+// accepted by the listeners.
+func NewReaderWith(listeners []net.Listener, config Config) lib.Reader {
+	r := &reader{
+		config:    config,
+		listeners: listeners,
+		results:   make(chan result),
+		done:      make(chan struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	for _, l := range listeners {
+		go r.accept(l)
+	}
+
+	return r
+}
+
+type result struct {
+	msg lib.Message
+	err error
+}
+
+type reader struct {
+	config    Config
+	listeners []net.Listener
+	results   chan result
+	done      chan struct{}
+	once      sync.Once
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (r *reader) Close() (err error) {
+	r.once.Do(func() {
+		close(r.done)
+
+		for _, l := range r.listeners {
+			if e := l.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		r.mutex.Lock()
+		for conn := range r.conns {
+			conn.Close()
+		}
+		r.mutex.Unlock()
+	})
+	return
+}
+
+func (r *reader) ReadMessage() (msg lib.Message, err error) {
+	select {
+	case res := <-r.results:
+		return res.msg, res.err
+	case <-r.done:
+		return msg, io.EOF
+	}
+}
+
+func (r *reader) accept(l net.Listener) {
+	err := lib.Accept(l, r.done, func(conn net.Conn) {
+		r.mutex.Lock()
+		r.conns[conn] = struct{}{}
+		r.mutex.Unlock()
+
+		go r.read(conn)
+	})
+
+	if err != nil {
+		select {
+		case <-r.done:
+		case r.results <- result{err: err}:
+		}
+		// The source is abandoned once it reported the error, the listeners
+		// and the open connections must be closed with it.
+		r.Close()
+	}
+}
+
+func (r *reader) read(conn net.Conn) {
+	defer func() {
+		r.mutex.Lock()
+		delete(r.conns, conn)
+		r.mutex.Unlock()
+		conn.Close()
+	}()
+
+	in := bufio.NewReader(conn)
+
+	if _, unix := conn.(*net.UnixConn); !unix && len(r.config.Tokens) != 0 {
+		conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+
+		if !r.authenticate(in) {
+			log.WithField("client", conn.RemoteAddr().String()).Warn("rejecting tcp source connection with a missing or invalid token")
+			return
+		}
+
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	for {
+		line, truncated, err := readLine(in)
+
+		if err != nil {
+			select {
+			case <-r.done:
+			default:
+				if err != io.EOF {
+					log.WithFields(log.Fields{
+						"client": conn.RemoteAddr().String(),
+						"error":  err,
+					}).Warn("closing tcp source connection")
+				}
+			}
+			return
+		}
+
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		var msg lib.Message
+
+		if truncated {
+			err = fmt.Errorf("line longer than %d bytes", maxLineSize)
+		} else {
+			msg, err = lib.ParseMessage(line, r.config.Group, r.config.Stream)
+		}
+
+		if err != nil {
+			if len(line) > 1024 {
+				line = line[:1024]
+			}
+			err = &lib.ParseError{Input: string(line), Err: err}
+		}
+
+		select {
+		case r.results <- result{msg, err}:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// authenticate reads the handshake sent by the client when it connects, a
+// JSON object holding its token on the first line.
+func (r *reader) authenticate(in *bufio.Reader) bool {
+	var handshake struct {
+		Token string `json:"token"`
+	}
+
+	line, _, err := readLine(in)
+
+	if err != nil || json.Unmarshal(line, &handshake) != nil {
+		return false
+	}
+
+	for _, t := range r.config.Tokens {
+		if subtle.ConstantTimeCompare([]byte(handshake.Token), []byte(t)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readLine reads the next line, the returned flag is set when it was longer
+// than maxLineSize in which case only its beginning is returned.
+func readLine(r *bufio.Reader) (line []byte, truncated bool, err error) {
+	for {
+		var b []byte
+
+		b, err = r.ReadSlice('\n')
+
+		if n := maxLineSize - len(line); len(b) > n {
+			line, truncated = append(line, b[:n]...), true
+		} else {
+			line = append(line, b...)
+		}
+
+		if err != bufio.ErrBufferFull {
+			break
+		}
+	}
+
+	if err == io.EOF && len(line) != 0 {
+		err = nil
+	}
+
+	return
+}
@@ -0,0 +1,193 @@
+package tcp
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestReader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith([]net.Listener{l}, Config{Group: "app", Stream: "host"})
+	defer r.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, `{"level":"WARN","time":"2017-06-01T12:00:00Z","info":{"host":"web-1"},"data":{"user":42},"message":"hello"}
+
+{"group":"api","stream":"0","event":{"message":"world"}}
+{"message":"hi","extra":true}
+{"level":"LOUD","message":"hi"}
+{"info":{"hostname":"web-1"},"message":"hi"}
+{"level":"INFO"}
+not json
+{"message":"`+strings.Repeat("a", maxLineSize)+`"}
+{"message":"last"}`)
+	conn.(*net.TCPConn).CloseWrite()
+
+	msg, err := r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Group != "app" || msg.Stream != "host" || msg.Event.Level != ecslogs.WARN || msg.Event.Message != "hello" || msg.Event.Info.Host != "web-1" || msg.Event.Data["user"] != float64(42) {
+		t.Errorf("invalid message: %v", msg)
+	}
+
+	if msg, err = r.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Group != "api" || msg.Stream != "0" || msg.Event.Level != ecslogs.INFO || msg.Event.Message != "world" || msg.Event.Time.IsZero() {
+		t.Errorf("invalid message: %v", msg)
+	}
+
+	for _, reason := range []string{
+		"unknown field",
+		"invalid level",
+		"unknown info field",
+		"missing message",
+		"invalid JSON",
+		"line too long",
+	} {
+		if _, err := r.ReadMessage(); err == nil {
+			t.Errorf("%s: reading an invalid event must fail", reason)
+		} else if _, ok := err.(*lib.ParseError); !ok {
+			t.Errorf("%s: invalid error: %v", reason, err)
+		}
+	}
+
+	if msg, err = r.ReadMessage(); err != nil || msg.Event.Message != "last" {
+		t.Errorf("invalid last message: %v (%v)", msg, err)
+	}
+}
+
+func TestReaderTokens(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith([]net.Listener{l}, Config{Group: "app", Stream: "host", Tokens: []string{"A", "B"}})
+	defer r.Close()
+
+	for i, handshake := range []string{`{"token":"C"}`, `{"message":"hi"}`, `{"token":"B"}`} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, handshake+"\n"+`{"message":"`+strconv.Itoa(i)+`"}`+"\n")
+		conn.(*net.TCPConn).CloseWrite()
+	}
+
+	msg, err := r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Event.Message != "2" {
+		t.Errorf("invalid message: %v", msg)
+	}
+}
+
+func TestReaderUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "ecs-logs.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderWith([]net.Listener{l}, Config{})
+	defer r.Close()
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "{\"message\":\"no group\"}\n{\"group\":\"api\",\"event\":{\"message\":\"hello\"}}\n")
+
+	if _, err := r.ReadMessage(); err == nil {
+		t.Error("events without a group must be rejected")
+	}
+
+	if _, err := r.ReadMessage(); err == nil {
+		t.Error("events without a stream must be rejected")
+	}
+}
+
+func TestRemoveSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-logs-tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "ecs-logs.sock")
+
+	if err := removeSocket(socket); err != nil {
+		t.Error("a missing socket must be ignored:", err)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing the listener would remove the socket.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	if err := removeSocket(socket); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("the socket left by a previous run must be removed")
+	}
+
+	file := filepath.Join(dir, "ecs-logs.log")
+	ioutil.WriteFile(file, []byte("hello\n"), 0600)
+
+	if err := removeSocket(file); err == nil {
+		t.Error("removing a file which isn't a socket must fail")
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		t.Error("files which aren't sockets must be kept:", err)
+	}
+}
+
+func TestNewReaderNonLoopback(t *testing.T) {
+	defer os.Unsetenv("TCP_LISTEN")
+	os.Setenv("TCP_LISTEN", "0.0.0.0:0")
+
+	if r, err := NewReader(); err == nil {
+		r.Close()
+		t.Error("listening on a non-loopback address without tokens should fail")
+	}
+}
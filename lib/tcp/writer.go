@@ -0,0 +1,143 @@
+package tcp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/syslog/pool"
+)
+
+const (
+	poolSize            = 4
+	defaultDialTimeout  = 10 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+)
+
+var (
+	poolsLock sync.Mutex
+	pools     = map[WriterConfig]*pool.LimitedConnPool{}
+)
+
+type WriterConfig struct {
+	Address      string
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Framing of the records and batches sent to the server.
+	Framing lib.Framing
+}
+
+func NewWriter(group string, stream string) (w lib.Writer, err error) {
+	var c WriterConfig
+
+	if c.Address = os.Getenv("TCP_ADDRESS"); len(c.Address) == 0 {
+		err = fmt.Errorf("missing TCP_ADDRESS environment variable")
+		return
+	}
+
+	if c.Framing, err = lib.FramingFromEnvironment("TCP_"); err != nil {
+		return
+	}
+
+	return NewWriterWith(c)
+}
+
+// NewWriterWith returns a writer sending messages to the TCP server described
+// by config, one JSON message per record. Connections are shared by all
+// writers with the same config.
+func NewWriterWith(config WriterConfig) (w lib.Writer, err error) {
+	var p *pool.LimitedConnPool
+
+	if config.DialTimeout == 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+
+	if p, err = getPool(config); err != nil {
+		err = lib.NewWriterError(lib.UnreachableError, err)
+		return
+	}
+
+	w = writer{config: config, pool: p}
+	return
+}
+
+type writer struct {
+	config WriterConfig
+	pool   *pool.LimitedConnPool
+}
+
+func (w writer) Close() error {
+	return nil
+}
+
+func (w writer) WriteMessage(msg lib.Message) error {
+	return w.WriteMessageBatch(lib.MessageBatch{msg})
+}
+
+// WriteMessageBatch sends the framed batch to the server in a single write.
+func (w writer) WriteMessageBatch(batch lib.MessageBatch) (err error) {
+	var b []byte
+
+	if b, err = w.config.Framing.EncodeBatch(batch); err != nil {
+		return
+	}
+
+	conn, ok := w.pool.TryGet(w.config.DialTimeout)
+	if !ok {
+		return lib.NewWriterError(lib.UnreachableError, fmt.Errorf("no connection available to the TCP server at %s", w.config.Address))
+	}
+
+	// Closing the connection returns it to the pool, or discards it if the
+	// write failed.
+	defer conn.Close()
+
+	if _, err = conn.Write(b); err != nil {
+		err = lib.NewWriterError(lib.UnreachableError, err)
+	}
+
+	return
+}
+
+func getPool(config WriterConfig) (p *pool.LimitedConnPool, err error) {
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+
+	if p = pools[config]; p == nil {
+		if p, err = pool.NewLimited(poolSize, func() (io.WriteCloser, error) { return dial(config) }); err == nil {
+			pools[config] = p
+		}
+	}
+
+	return
+}
+
+func dial(config WriterConfig) (io.WriteCloser, error) {
+	conn, err := net.DialTimeout("tcp", config.Address, config.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return timeoutConn{conn, config.WriteTimeout}, nil
+}
+
+// timeoutConn sets a deadline on each write so writers don't hang forever on
+// servers that stopped reading.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c timeoutConn) Write(b []byte) (int, error) {
+	if err := c.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
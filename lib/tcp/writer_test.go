@@ -0,0 +1,69 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestWriter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	framing := lib.Framing{RecordPrefix: "{length32}", RecordSuffix: "\n", BatchHeader: "{count}\n"}
+	batch := lib.MessageBatch{
+		{Group: "a", Stream: "1", Event: ecslogs.Event{Message: "hello"}},
+		{Group: "a", Stream: "1", Event: ecslogs.Event{Message: "world"}},
+	}
+	expected, _ := framing.EncodeBatch(batch)
+	received := make(chan []byte, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, len(expected))
+		n, _ := io.ReadFull(conn, b)
+		received <- b[:n]
+	}()
+
+	w, err := NewWriterWith(WriterConfig{Address: l.Addr().String(), Framing: framing})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteMessageBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := <-received; string(b) != string(expected) {
+		t.Errorf("invalid data received by the server: %q", b)
+	}
+}
+
+func TestWriterUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	w, err := NewWriterWith(WriterConfig{Address: address, DialTimeout: 100 * time.Millisecond})
+	if err == nil {
+		err = w.WriteMessage(lib.Message{})
+	}
+
+	if lib.ErrorKindOf(err) != lib.UnreachableError {
+		t.Errorf("writing to an unreachable server should fail with an unreachable error: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package lib
+
+import "sync"
+
+// RegisterWarmUp sets the function called to prepare the named destination
+// before messages are written to it, for example to establish connections or
+// load credentials, so the first batches aren't delayed by it.
+func RegisterWarmUp(name string, warmUp func() error) {
+	wumtx.Lock()
+	wumap[name] = warmUp
+	wumtx.Unlock()
+}
+
+func DeregisterWarmUp(name string) {
+	wumtx.Lock()
+	delete(wumap, name)
+	wumtx.Unlock()
+}
+
+// WarmUp calls the function registered to warm up the named destination, if
+// any.
+func WarmUp(name string) (err error) {
+	wumtx.RLock()
+	warmUp := wumap[name]
+	wumtx.RUnlock()
+
+	if warmUp != nil {
+		err = warmUp()
+	}
+
+	return
+}
+
+var (
+	wumtx sync.RWMutex
+	wumap = map[string]func() error{}
+)
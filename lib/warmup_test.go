@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	var calls int
+
+	RegisterWarmUp("test", func() error {
+		calls++
+		return errors.New("oops")
+	})
+	defer DeregisterWarmUp("test")
+
+	if err := WarmUp("test"); err == nil || calls != 1 {
+		t.Errorf("warm up should have failed: err = %v, calls = %d", err, calls)
+	}
+
+	if err := WarmUp("other"); err != nil {
+		t.Errorf("destinations without warm up should succeed: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// lockRetryInterval is how often standby instances try to take over the lock
+// of a source.
+const lockRetryInterval = 5 * time.Second
+
+// lockSources takes an exclusive lock on a file in dir for each source, so a
+// single instance reads a source shared between replicas. It blocks until all
+// locks are held, which happens when the instance holding them exits. The
+// returned files must be kept open for the locks to be held.
+func lockSources(dir string, sources []source) (files []*os.File, err error) {
+	for _, s := range sources {
+		var f *os.File
+		var ok bool
+
+		// Filters of source specifications may contain slashes.
+		path := filepath.Join(dir, url.PathEscape(s.name)+".lock")
+
+		if f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644); err != nil {
+			return
+		}
+
+		files = append(files, f)
+
+		for attempt := 0; ; attempt++ {
+			if ok, err = tryLock(f); err != nil || ok {
+				break
+			}
+
+			if attempt == 0 {
+				log.WithFields(log.Fields{
+					"source": s.name,
+					"lock":   path,
+				}).Info("another instance owns the source, waiting for its lock")
+			}
+
+			time.Sleep(lockRetryInterval)
+		}
+
+		if err != nil {
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"source": s.name,
+			"lock":   path,
+		}).Info("acquired source lock")
+	}
+
+	return
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
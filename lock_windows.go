@@ -0,0 +1,13 @@
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Source locks rely on flock(2), which isn't available on windows.
+func tryLock(f *os.File) (bool, error) {
+	return false, errors.New("source locks are not supported on windows")
+}
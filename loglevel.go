@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/apex/log"
+)
+
+// logLevel tracks the verbosity of the program's own logs, which can be
+// changed at runtime to investigate issues without restarting and losing the
+// buffered messages.
+//
+// The level of the apex logger is a plain field read by every goroutine that
+// logs, so it is set once to debug and the entries are filtered by logLevel,
+// which wraps the handler and reads the current level atomically.
+type logLevel struct {
+	mutex   sync.Mutex
+	initial log.Level
+	current int32
+	handler log.Handler
+}
+
+func newLogLevel(lvl log.Level, handler log.Handler) *logLevel {
+	l := &logLevel{initial: lvl, current: int32(lvl), handler: handler}
+	log.SetLevel(log.DebugLevel)
+	log.SetHandler(l)
+	return l
+}
+
+// HandleLog satisfies the log.Handler interface, passing the entries at or
+// above the current level to the wrapped handler.
+func (l *logLevel) HandleLog(e *log.Entry) error {
+	if e.Level < l.get() {
+		return nil
+	}
+	return l.handler.HandleLog(e)
+}
+
+func (l *logLevel) get() log.Level {
+	return log.Level(atomic.LoadInt32(&l.current))
+}
+
+func (l *logLevel) set(lvl log.Level) {
+	l.mutex.Lock()
+	atomic.StoreInt32(&l.current, int32(lvl))
+	l.mutex.Unlock()
+}
+
+// toggleDebug switches between the debug level and the level the program was
+// started with, returning the new level.
+func (l *logLevel) toggleDebug() (lvl log.Level) {
+	l.mutex.Lock()
+
+	if l.get() == log.DebugLevel {
+		lvl = l.initial
+	} else {
+		lvl = log.DebugLevel
+	}
+
+	atomic.StoreInt32(&l.current, int32(lvl))
+	l.mutex.Unlock()
+	return
+}
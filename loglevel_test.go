@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+)
+
+func TestLogLevel(t *testing.T) {
+	var entries []*log.Entry
+
+	l := &logLevel{
+		initial: log.WarnLevel,
+		current: int32(log.WarnLevel),
+		handler: log.HandlerFunc(func(e *log.Entry) error {
+			entries = append(entries, e)
+			return nil
+		}),
+	}
+
+	l.HandleLog(&log.Entry{Level: log.InfoLevel})
+	l.HandleLog(&log.Entry{Level: log.ErrorLevel})
+
+	if len(entries) != 1 {
+		t.Errorf("entries below the level should be filtered: %d handled", len(entries))
+	}
+
+	if lvl := l.toggleDebug(); lvl != log.DebugLevel {
+		t.Errorf("invalid level after toggling debug: %s", lvl)
+	}
+
+	l.HandleLog(&log.Entry{Level: log.DebugLevel})
+
+	if len(entries) != 2 {
+		t.Errorf("debug entries should be handled after toggling debug: %d handled", len(entries))
+	}
+
+	if lvl := l.toggleDebug(); lvl != log.WarnLevel {
+		t.Errorf("toggling debug again should restore the initial level: %s", lvl)
+	}
+}
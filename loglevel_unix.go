@@ -0,0 +1,13 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func setupDebugSignal(debugchan chan<- os.Signal) {
+	signal.Notify(debugchan, syscall.SIGUSR2)
+}
@@ -0,0 +1,9 @@
+// +build windows
+
+package main
+
+import "os"
+
+// There is no SIGUSR2 on windows, the log level can only be changed with the
+// admin endpoint.
+func setupDebugSignal(debugchan chan<- os.Signal) {}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,15 +23,27 @@ import (
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
 	"github.com/apex/log/handlers/multi"
+	"github.com/jpillora/backoff"
 	"github.com/kapralVV/ecs-logs-go"
 	"github.com/kapralVV/ecs-logs/lib"
+	"github.com/kapralVV/ecs-logs/lib/loopback"
 
+	_ "github.com/kapralVV/ecs-logs/lib/chaos"
 	_ "github.com/kapralVV/ecs-logs/lib/cloudwatchlogs"
 	_ "github.com/kapralVV/ecs-logs/lib/datadog"
+	_ "github.com/kapralVV/ecs-logs/lib/docker"
+	_ "github.com/kapralVV/ecs-logs/lib/file"
+	_ "github.com/kapralVV/ecs-logs/lib/fluentd"
+	_ "github.com/kapralVV/ecs-logs/lib/ingest"
 	_ "github.com/kapralVV/ecs-logs/lib/logdna"
 	_ "github.com/kapralVV/ecs-logs/lib/loggly"
+	_ "github.com/kapralVV/ecs-logs/lib/peer"
+	_ "github.com/kapralVV/ecs-logs/lib/prometheus"
+	_ "github.com/kapralVV/ecs-logs/lib/s3"
 	_ "github.com/kapralVV/ecs-logs/lib/statsd"
 	_ "github.com/kapralVV/ecs-logs/lib/syslog"
+	_ "github.com/kapralVV/ecs-logs/lib/tail"
+	_ "github.com/kapralVV/ecs-logs/lib/tcp"
 )
 
 type source struct {
@@ -37,12 +53,41 @@ type source struct {
 
 type destination struct {
 	lib.Destination
-	name string
+	name   string
+	ledger *lib.Ledger
+	state  *destinationState
+	limit  *lib.BandwidthLimiter
+	cost   *lib.CostMeter
+	levels *lib.LevelRange
+	marks  *lib.BatchSequencer
+	outage *outage
+
+	// Slots of the batches being written to the destination, when their
+	// number is limited. A slot is taken before the goroutine writing a
+	// batch is started and given back once it returns, which signals the
+	// shared freed channel so the main loop flushes the streams it skipped.
+	window chan struct{}
+	freed  chan struct{}
+
+	// Shared count of the messages waiting to be written, pausing the
+	// sources when there are too many.
+	pending *backpressure
+
+	// Whether events are stamped with their ingest time and latency.
+	latency bool
+
+	// Action taken on events exceeding the size limit of the destination,
+	// and the destination they are diverted to.
+	oversize *lib.OversizePolicy
+	divert   lib.Destination
 }
 
 type reader struct {
 	lib.Reader
-	name string
+	name    string
+	catchUp *lib.CatchUpLimiter
+	acks    *lib.AckTracker
+	done    chan struct{}
 }
 
 func main() {
@@ -56,6 +101,43 @@ func main() {
 	var flushTimeout time.Duration
 	var cacheTimeout time.Duration
 	var profileAddr string
+	var adminAddr string
+	var maxBandwidth int
+	var bandwidthWeights string
+	var provenance bool
+	var quarantineDst string
+	var heartbeatInterval time.Duration
+	var lifecycle bool
+	var dumpFile string
+	var lockDir string
+	var encryptKey string
+	var encryptFields string
+	var costs string
+	var levelRoutes string
+	var oversizePolicies string
+	var oversizeDivert string
+	var once bool
+	var integrity bool
+	var catchUpThreshold time.Duration
+	var catchUpRate int
+	var splitField string
+	var tapDir string
+	var eventIDs string
+	var eventIDNode int
+	var outagePolicy string
+	var outageSpoolDir string
+	var outageSpoolMax int64
+	var warm bool
+	var latency bool
+	var costReportInterval time.Duration
+	var canaryInterval time.Duration
+	var maxPending int
+	var watchdogTimeout time.Duration
+	var maxInflight string
+	var featuresFile string
+	var featuresInterval time.Duration
+	var graph bool
+	var graphFormat string
 
 	hostname, _ = os.Hostname()
 
@@ -68,6 +150,48 @@ func main() {
 	flag.DurationVar(&flushTimeout, "flush-timeout", 5*time.Second, "How often messages will be flushed")
 	flag.DurationVar(&cacheTimeout, "cache-timeout", 5*time.Minute, "How to wait before clearing unused internal cache")
 	flag.StringVar(&profileAddr, "pprof-addr", "", "Address to serve profile information")
+	flag.IntVar(&maxBandwidth, "max-bandwidth", 0, "The maximum number of bytes per second sent across all destinations (unlimited when zero)")
+	flag.StringVar(&bandwidthWeights, "bandwidth-weights", "", "A comma separated list of destination:weight pairs used to share the bandwidth between destinations")
+	flag.StringVar(&costs, "cost-per-gb", "", "A comma separated list of destination:price pairs used to estimate the ingestion cost of each group")
+	flag.DurationVar(&costReportInterval, "cost-report-interval", 24*time.Hour, "How often events reporting the estimated ingestion costs are emitted")
+	flag.DurationVar(&canaryInterval, "canary-interval", 0, "How often a canary event is written to each destination to check that it accepts events (disabled when zero)")
+	flag.StringVar(&oversizePolicies, "oversize-policy", "", "A comma separated list of destination:action:limit triples, where action is truncate, split or divert (to the -oversize-divert destination), applied to events larger than limit bytes once serialized")
+	flag.StringVar(&oversizeDivert, "oversize-divert", "s3", "The destination oversized events are diverted to")
+	flag.StringVar(&levelRoutes, "level-routes", "", "A comma separated list of destination:levels pairs restricting the levels of events sent to destinations (e.g. syslog:info-,cloudwatchlogs:warn+)")
+	flag.StringVar(&adminAddr, "admin-addr", "", "Address to serve the admin endpoints")
+	flag.StringVar(&tapDir, "tap-dir", os.TempDir(), "Directory where the taps opened with the admin endpoints write messages")
+	flag.DurationVar(&heartbeatInterval, "heartbeat-interval", 0, "How often heartbeat events are emitted on streams that receive no messages until they expire, must be shorter than -cache-timeout (disabled when zero)")
+	flag.BoolVar(&lifecycle, "lifecycle-events", false, "Emit events when streams are opened and when they become idle")
+	flag.StringVar(&dumpFile, "state-dump-file", "", "Path to the file to which the state report is appended on SIGUSR1 (stderr when empty)")
+	flag.StringVar(&quarantineDst, "quarantine", "", "The destination to which input that couldn't be parsed is sent, with the parse error attached (dropped when empty)")
+	flag.StringVar(&lockDir, "source-lock-dir", "", "Directory, on a volume shared between replicas, where locks ensure a single instance reads each source (disabled when empty)")
+	flag.StringVar(&encryptKey, "encrypt-key", "", "Path to the PEM encoded RSA public key used to encrypt the fields set by -encrypt-fields")
+	flag.StringVar(&encryptFields, "encrypt-fields", "", "A comma separated list of event data fields to encrypt, nested fields are separated by dots (e.g. user.email)")
+	flag.BoolVar(&once, "once", false, "Exit once the messages currently available from the sources have been shipped, with a non-zero status if some were dropped")
+	flag.DurationVar(&catchUpThreshold, "catch-up-threshold", 0, "How old messages must be to be considered part of a backlog the sources are catching up with (disabled when zero)")
+	flag.IntVar(&catchUpRate, "catch-up-rate", 0, "The maximum number of messages per second read by each source while catching up (unlimited when zero)")
+	flag.StringVar(&splitField, "split-field", "", "An event data field holding an array of records, events are split into one event per record (nested fields are separated by dots)")
+	flag.StringVar(&eventIDs, "event-ids", "", "The kind of IDs set on events that have none [uuidv7, ulid, snowflake] (disabled when empty)")
+	flag.IntVar(&eventIDNode, "event-id-node", -1, "The node of snowflake IDs, from 0 to 1023 and unique in the deployment (derived from the hostname when negative)")
+	flag.StringVar(&maxInflight, "max-inflight", "", "A comma separated list of destination:count pairs limiting the number of batches written concurrently to destinations (unlimited by default)")
+	flag.DurationVar(&watchdogTimeout, "source-watchdog", 0, "How long a source can go without being polled before its reader is replaced, failed readers are replaced as well (disabled when zero)")
+	flag.IntVar(&maxPending, "max-pending-messages", 0, "The maximum number of messages waiting to be written to the destinations before the sources stop being read (unlimited when zero)")
+	flag.StringVar(&outagePolicy, "outage-policy", "", "What to do when all destinations are down [drop, block, crash, spool] (batches are retried a few times then dropped when empty)")
+	flag.StringVar(&outageSpoolDir, "outage-spool-dir", "", "The directory where batches are written while all destinations are down, with the spool outage policy")
+	flag.Int64Var(&outageSpoolMax, "outage-spool-max-bytes", lib.DefaultSpoolMaxBytes, "The maximum size of the batches spooled for each destination")
+	flag.BoolVar(&warm, "warm-up", false, "Establish the connections to the destinations before reading the sources instead of on the first messages")
+	flag.BoolVar(&latency, "latency-fields", false, "Annotate events with the time they are sent to the destinations and how long they took to get there")
+	flag.BoolVar(&integrity, "batch-integrity", false, "Annotate events with the sequence number, size and checksum of the batch they were sent in")
+	flag.StringVar(&featuresFile, "features-file", "", "Path to a JSON file, polled for changes, setting the log level, drained destinations and debugging taps at runtime (disabled when empty)")
+	flag.DurationVar(&featuresInterval, "features-interval", 30*time.Second, "How often the features file is checked for changes")
+	flag.StringVar(&graphFormat, "graph-format", "dot", "The format of the pipeline topology written by the graph command [dot, json]")
+	flag.BoolVar(&provenance, "provenance", false, "Annotate events with the source, host, cursor and time at which they were read")
+	// "ecs-logs graph ..." writes the topology of the configured pipeline
+	// instead of running it.
+	if len(os.Args) > 1 && os.Args[1] == "graph" {
+		graph, os.Args = true, append(os.Args[:1], os.Args[2:]...)
+	}
+
 	flag.Parse()
 
 	logger := &lib.LogHandler{
@@ -76,8 +200,7 @@ func main() {
 		Hostname: hostname,
 		Queue:    lib.NewMessageQueue(),
 	}
-	log.SetLevel(log.Level(level))
-	log.SetHandler(multi.New(cli.New(os.Stderr), logger))
+	loglevel := newLogLevel(log.Level(level), multi.New(cli.New(os.Stderr), logger))
 
 	// serve profiles if address is configured
 	if profileAddr != "" {
@@ -92,12 +215,24 @@ func main() {
 	var sources []source
 	var readers []reader
 	var dests []destination
+	var quarantineDest lib.Destination
+	var encrypter *lib.FieldEncrypter
+	var splitter *lib.EventSplitter
 
 	if len(hostname) == 0 {
 		log.Fatal("no hostname configured")
 	}
 
-	if sources = getSources(strings.Split(src, ",")); len(sources) == 0 {
+	// Heartbeats don't keep streams alive, none would ever be emitted if
+	// streams expired before the interval elapsed.
+	if heartbeatInterval != 0 && heartbeatInterval >= cacheTimeout {
+		log.WithFields(log.Fields{
+			"heartbeat-interval": heartbeatInterval,
+			"cache-timeout":      cacheTimeout,
+		}).Fatal("the heartbeat interval must be shorter than the cache timeout")
+	}
+
+	if sources = getSources(lib.SplitSourceSpecs(src)); len(sources) == 0 {
 		log.Fatal("no or invalid log sources")
 	}
 
@@ -105,10 +240,203 @@ func main() {
 		log.Fatal("no or invalid log destinations")
 	}
 
+	if len(quarantineDst) != 0 {
+		if quarantineDest = lib.GetDestination(quarantineDst); quarantineDest == nil {
+			log.WithField("destination", quarantineDst).Fatal("invalid quarantine destination")
+		}
+	}
+
+	if len(splitField) != 0 {
+		splitter = lib.NewEventSplitter(splitField)
+	}
+
+	if len(encryptFields) != 0 {
+		var key []byte
+
+		if len(encryptKey) == 0 {
+			log.Fatal("-encrypt-fields requires -encrypt-key to be set")
+		}
+
+		if key, err = ioutil.ReadFile(encryptKey); err != nil {
+			log.WithError(err).Fatal("failed to read the encryption key")
+		}
+
+		if encrypter, err = lib.NewFieldEncrypter(key, strings.Split(encryptFields, ",")); err != nil {
+			log.WithError(err).Fatal("invalid encryption key")
+		}
+	}
+
+	if maxBandwidth != 0 {
+		var weights map[string]int
+
+		if weights, err = parseWeights(bandwidthWeights, dests); err != nil {
+			log.WithError(err).Fatal("invalid bandwidth weights")
+		}
+
+		limit := lib.NewBandwidthLimiter(maxBandwidth, weights)
+
+		for i := range dests {
+			dests[i].limit = limit
+		}
+	}
+
+	if len(lockDir) != 0 && !graph {
+		// The lock files must stay open until the program exits.
+		var locks []*os.File
+
+		if locks, err = lockSources(lockDir, sources); err != nil {
+			log.WithError(err).Fatal("failed to lock log sources")
+		}
+
+		defer closeFiles(locks)
+	}
+
+	if len(oversizePolicies) != 0 {
+		var policies map[string]lib.OversizePolicy
+
+		if policies, err = parseOversizePolicies(oversizePolicies, dests); err != nil {
+			log.WithError(err).Fatal("invalid oversize policies")
+		}
+
+		for i := range dests {
+			if p, ok := policies[dests[i].name]; ok {
+				if p.Action == lib.OversizeDivert {
+					if dests[i].divert = lib.GetDestination(oversizeDivert); dests[i].divert == nil {
+						log.WithField("destination", oversizeDivert).Fatal("invalid oversize divert destination")
+					}
+				}
+				dests[i].oversize = &p
+			}
+		}
+	}
+
+	if len(levelRoutes) != 0 {
+		var routes map[string]lib.LevelRange
+
+		if routes, err = parseLevelRoutes(levelRoutes, dests); err != nil {
+			log.WithError(err).Fatal("invalid level routes")
+		}
+
+		for i := range dests {
+			if r, ok := routes[dests[i].name]; ok {
+				dests[i].levels = &r
+			}
+		}
+	}
+
+	var outage *outage
+	if outage, err = newOutage(outagePolicy, outageSpoolDir, outageSpoolMax); err != nil {
+		log.WithError(err).Fatal("invalid outage policy")
+	}
+
+	for i := range dests {
+		dests[i].outage = outage
+	}
+	outage.dests = dests
+
+	pending := newBackpressure(maxPending)
+
+	for i := range dests {
+		dests[i].pending = pending
+	}
+
+	if latency {
+		for i := range dests {
+			dests[i].latency = true
+		}
+	}
+
+	if integrity {
+		for i := range dests {
+			dests[i].marks = lib.NewBatchSequencer()
+		}
+	}
+
+	// Signaled when a write slot is given back, nil when no window is set so
+	// the main loop never selects it.
+	var freechan chan struct{}
+
+	if len(maxInflight) != 0 {
+		var windows map[string]int
+
+		if windows, err = parseInflight(maxInflight, dests); err != nil {
+			log.WithError(err).Fatal("invalid in-flight limits")
+		}
+
+		freechan = make(chan struct{}, 1)
+
+		for i := range dests {
+			if n, ok := windows[dests[i].name]; ok {
+				dests[i].window = make(chan struct{}, n)
+				dests[i].freed = freechan
+			}
+		}
+	}
+
+	if len(costs) != 0 {
+		var prices map[string]float64
+
+		if prices, err = parseCosts(costs, dests); err != nil {
+			log.WithError(err).Fatal("invalid costs")
+		}
+
+		for i := range dests {
+			if price, ok := prices[dests[i].name]; ok {
+				dests[i].cost = lib.NewCostMeter(price)
+			}
+		}
+	}
+
+	opts := readerOptions{
+		hostname:         hostname,
+		provenance:       provenance,
+		encrypter:        encrypter,
+		splitter:         splitter,
+		catchUpThreshold: catchUpThreshold,
+		catchUpRate:      catchUpRate,
+	}
+
+	if len(eventIDs) != 0 {
+		var node = eventIDNode
+
+		if node < 0 {
+			node = nodeID(hostname)
+		}
+
+		if opts.ids, err = lib.NewIDGenerator(eventIDs, node); err != nil {
+			log.WithError(err).Fatal("invalid event IDs")
+		}
+	}
+
+	if graph {
+		if err = writeGraph(os.Stdout, graphFormat, makeGraph(sources, opts.transforms(), dests, quarantineDst, oversizeDivert)); err != nil {
+			log.WithError(err).Fatal("failed to write the pipeline graph")
+		}
+		return
+	}
+
+	if err = outage.openSpools(); err != nil {
+		log.WithError(err).Fatal("failed to open the outage spools")
+	}
+
 	if readers, err = openSources(sources); err != nil {
 		log.WithError(err).Fatal("failed to open log sources readers")
 	}
 
+	if watchdogTimeout != 0 {
+		watchReaders(readers, sources, watchdogTimeout)
+	}
+
+	for i := range readers {
+		if r, ok := readers[i].Reader.(lib.AckReader); ok {
+			readers[i].acks = lib.NewAckTracker(r)
+		}
+	}
+
+	if once {
+		stopAtEnd(readers)
+	}
+
 	join := &sync.WaitGroup{}
 
 	limits := lib.StreamLimits{
@@ -117,13 +445,50 @@ func main() {
 		MaxTime:  flushTimeout,
 	}
 
+	checkDestinations(dests)
+
+	if warm {
+		warmUp(dests)
+	}
+
 	expchan := time.Tick(flushTimeout / 2)
 	msgchan := make(chan lib.Message, len(readers))
 	sigchan := make(chan os.Signal, 1)
 	counter := int32(len(readers))
-	startReaders(readers, msgchan, &counter, hostname)
+	quarantine := newQuarantiner(quarantineDest, hostname, encrypter)
+	opts.quarantine = quarantine
+	startReaders(readers, msgchan, &counter, opts)
 	setupSignals(sigchan)
 
+	dumpchan := make(chan os.Signal, 1)
+	setupDumpSignal(dumpchan)
+
+	debugchan := make(chan os.Signal, 1)
+	setupDebugSignal(debugchan)
+
+	drainchan := make(chan destination)
+	taps := newTapSet(tapDir)
+
+	var costchan <-chan time.Time
+	if len(costs) != 0 {
+		costchan = time.Tick(costReportInterval)
+	}
+
+	if canaryInterval != 0 {
+		go runCanaries(dests, hostname, canaryInterval)
+	}
+
+	var featurechan <-chan time.Time
+	var feats *featureFile
+	if len(featuresFile) != 0 {
+		featurechan = time.Tick(featuresInterval)
+		feats = &featureFile{path: featuresFile}
+	}
+
+	if adminAddr != "" {
+		serveAdmin(adminAddr, dests, drainchan, loglevel, taps)
+	}
+
 	for _, s := range sources {
 		log.WithField("source", s.name).Info("source enabled")
 	}
@@ -132,57 +497,173 @@ func main() {
 		log.WithField("destination", d.name).Info("destination enabled")
 	}
 
+	blocked := false
+	paused := false
+
 	for {
+		in := msgchan
+
+		if b := outage.blocking(); b != blocked {
+			if blocked = b; blocked {
+				log.Warn("all destinations are down, stopped reading the sources")
+			} else {
+				log.Info("reading the sources again")
+			}
+		}
+
+		if p := pending.paused(!paused); p != paused {
+			if paused = p; paused {
+				log.Warn("too many messages are waiting to be written, stopped reading the sources")
+			} else {
+				log.Info("pending messages were written, reading the sources again")
+			}
+		}
+
+		if blocked || paused {
+			in = nil
+		}
+
 		select {
-		case msg, ok := <-msgchan:
+		case msg, ok := <-in:
 			now := time.Now()
 
 			if !ok {
 				log.Info("waiting for all write operations to complete")
 				limits.Force = true
 				flushAll(dests, store, limits, now, join)
-				flushQueue(dests, store, logger.Queue, limits, now, join)
+				flushQueue(dests, store, logger.Queue, limits, now, join, lifecycle)
 				join.Wait()
+				// Messages written to the loopback destination by the last
+				// batches still have to go through the pipeline.
+				flushQueue(dests, store, loopback.Queue, limits, now, join, lifecycle)
+				join.Wait()
+
+				// All the readers returned, nothing else can be quarantined.
+				quarantine.stop()
+
+				// Closing the readers again saves the positions acknowledged
+				// by the last batches.
+				stopReaders(readers)
+
+				if once {
+					exitOnce(dests)
+				}
 				return
 			}
 
-			_, stream := store.Add(msg, now)
+			if !feats.keep(msg) {
+				lib.Metrics.Counter("ecs_logs_discarded_messages_total", "group", msg.Group).Add(1)
+				msg.Ack.Release()
+				continue
+			}
+
+			taps.copy(msg)
+			stream := add(store, msg, now, lifecycle)
 			flush(dests, stream, limits, now, join)
 
 		case <-logger.Queue.C:
 			now := time.Now()
-			flushQueue(dests, store, logger.Queue, limits, now, join)
+
+			if outage.blocking() {
+				// The program's logs, still written to stderr, would only
+				// pile up in the streams until a destination is back, and
+				// report every retry of the batches waiting for it.
+				logger.Queue.Flush()
+				continue
+			}
+
+			flushQueue(dests, store, logger.Queue, limits, now, join, lifecycle)
+
+		case <-pending.wake():
+			// The loop checks whether the sources can be read again.
+
+		case <-freechan:
+			now := time.Now()
+			flushAll(dests, store, limits, now, join)
+
+		case <-loopback.Queue.C:
+			now := time.Now()
+			flushQueue(dests, store, loopback.Queue, limits, now, join, lifecycle)
 
 		case <-expchan:
 			now := time.Now()
+			if heartbeatInterval != 0 {
+				heartbeat(store, hostname, heartbeatInterval, now)
+			}
+			if lifecycle {
+				markIdle(store, hostname, cacheTimeout, now)
+			}
 			flushAll(dests, store, limits, now, join)
 			removeExpired(dests, store, cacheTimeout, now)
 
+		case dest := <-drainchan:
+			now := time.Now()
+			drain(dests, dest, store, limits, now, join)
+
+		case <-costchan:
+			now := time.Now()
+			reportCosts(dests, logger.Queue, hostname, now)
+
+		case now := <-featurechan:
+			feats.update(dests, loglevel, taps, func(dest destination) {
+				drain(dests, dest, store, limits, now, join)
+			}, now)
+
+		case <-dumpchan:
+			now := time.Now()
+			writeStateDump(dumpFile, dests, store, now)
+
+		case <-debugchan:
+			lvl := loglevel.toggleDebug()
+			log.WithField("level", lvl.String()).Info("log level changed")
+
 		case sig := <-sigchan:
 			log.WithFields(log.Fields{"signal": sig.String()}).Info("closing message readers")
+			outage.stop()
 			stopReaders(readers)
 		}
 	}
 }
 
-func getSources(names []string) (sources []source) {
-	for i, src := range lib.GetSources(names...) {
-		sources = append(sources, source{
-			Source: src,
-			name:   names[i],
-		})
-	}
+// getSources returns the sources matching the given specifications, formatted
+// as name[:filter]. The same source can be given multiple times with disjoint
+// filters to be read by concurrent readers.
+func getSources(specs []string) (sources []source) {
+	seen := make(map[string]bool)
 
-	if len(sources) != len(names) {
-	search:
-		for _, name := range names {
-			for _, source := range sources {
-				if name == source.name {
-					continue search
-				}
+	for _, spec := range specs {
+		name, filter := lib.ParseSourceSpec(spec)
+		src := lib.GetSource(name)
+
+		if src == nil {
+			log.WithFields(log.Fields{"source": spec}).Warn("source disabled")
+			continue
+		}
+
+		if seen[spec] {
+			// Reading the same messages twice would duplicate them.
+			log.WithFields(log.Fields{"source": spec}).Warn("duplicate source ignored")
+			continue
+		}
+		seen[spec] = true
+
+		if len(filter) != 0 {
+			filtered, ok := src.(lib.FilteredSource)
+
+			if !ok {
+				log.WithFields(log.Fields{"source": spec}).Warn("source disabled, it doesn't support filters")
+				continue
 			}
-			log.WithFields(log.Fields{"source": name}).Warn("source disabled")
+
+			src = lib.SourceFunc(func() (lib.Reader, error) {
+				return filtered.OpenFilter(filter)
+			})
 		}
+
+		sources = append(sources, source{
+			Source: src,
+			name:   spec,
+		})
 	}
 
 	return
@@ -193,6 +674,8 @@ func getDestinations(names []string) (destinations []destination) {
 		destinations = append(destinations, destination{
 			Destination: dst,
 			name:        names[i],
+			ledger:      lib.NewLedger(),
+			state:       newDestinationState(names[i]),
 		})
 	}
 
@@ -211,6 +694,183 @@ func getDestinations(names []string) (destinations []destination) {
 	return
 }
 
+var errInvalidValue = errors.New("invalid value")
+
+// parsePairs parses a comma separated list of destination:value pairs, calling
+// parse with the value of each of them. what names the values in errors.
+// Destinations that weren't configured with -dst are rejected since their
+// values would be silently ignored.
+func parsePairs(s string, what string, dests []destination, parse func(dest string, value string) error) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		var i = strings.IndexByte(pair, ':')
+
+		if i < 0 {
+			return fmt.Errorf("missing %s: %s", what, pair)
+		}
+
+		if !hasDestination(dests, pair[:i]) {
+			return fmt.Errorf("unknown destination: %s", pair)
+		}
+
+		if err := parse(pair[:i], pair[i+1:]); err != nil {
+			return fmt.Errorf("invalid %s: %s", what, pair)
+		}
+	}
+
+	return nil
+}
+
+func hasDestination(dests []destination, name string) bool {
+	for _, dest := range dests {
+		if dest.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeights parses a comma separated list of destination:weight pairs.
+func parseWeights(s string, dests []destination) (weights map[string]int, err error) {
+	weights = make(map[string]int)
+
+	if len(s) == 0 {
+		return
+	}
+
+	err = parsePairs(s, "weight", dests, func(dest string, value string) error {
+		n, err := strconv.Atoi(value)
+		if err == nil && n <= 0 {
+			err = errInvalidValue
+		}
+		weights[dest] = n
+		return err
+	})
+	return
+}
+
+// parseInflight parses a comma separated list of destination:count pairs.
+func parseInflight(s string, dests []destination) (windows map[string]int, err error) {
+	windows = make(map[string]int)
+
+	err = parsePairs(s, "count", dests, func(dest string, value string) error {
+		n, err := strconv.Atoi(value)
+		if err == nil && n <= 0 {
+			err = errInvalidValue
+		}
+		windows[dest] = n
+		return err
+	})
+	return
+}
+
+// parseLevelRoutes parses a comma separated list of destination:levels pairs,
+// see lib.ParseLevelRange for the syntax of levels.
+func parseLevelRoutes(s string, dests []destination) (routes map[string]lib.LevelRange, err error) {
+	routes = make(map[string]lib.LevelRange)
+
+	err = parsePairs(s, "levels", dests, func(dest string, value string) (err error) {
+		routes[dest], err = lib.ParseLevelRange(value)
+		return
+	})
+	return
+}
+
+// parseOversizePolicies parses a comma separated list of destination:policy
+// pairs, see lib.ParseOversizePolicy for the syntax of policies.
+func parseOversizePolicies(s string, dests []destination) (policies map[string]lib.OversizePolicy, err error) {
+	policies = make(map[string]lib.OversizePolicy)
+
+	err = parsePairs(s, "policy", dests, func(dest string, value string) (err error) {
+		policies[dest], err = lib.ParseOversizePolicy(value)
+		return
+	})
+	return
+}
+
+// stopAtEnd makes the readers stop once they read the messages currently
+// available, readers of sources that don't support it are read until they are
+// closed.
+func stopAtEnd(readers []reader) {
+	for _, r := range readers {
+		if s, ok := r.Reader.(lib.StopAtEndReader); ok {
+			s.StopAtEnd()
+		} else {
+			log.WithField("source", r.name).Warn("the source doesn't support -once, it is read until closed")
+		}
+	}
+}
+
+// checkDestinations reports the destinations that are misconfigured or use
+// insecure settings when the program starts, instead of on the first messages
+// written to them.
+func checkDestinations(dests []destination) {
+	for _, dest := range dests {
+		if err := lib.Check(dest.name); err != nil {
+			log.WithFields(log.Fields{
+				"destination": dest.name,
+				"error":       err,
+			}).Error("invalid destination configuration")
+		}
+	}
+}
+
+// warmUp prepares all destinations concurrently and waits for them to be ready,
+// failures are only reported since writes will try again.
+func warmUp(dests []destination) {
+	join := &sync.WaitGroup{}
+
+	for _, dest := range dests {
+		join.Add(1)
+
+		go func(dest destination) {
+			defer join.Done()
+			start := time.Now()
+
+			if err := lib.WarmUp(dest.name); err != nil {
+				log.WithFields(log.Fields{
+					"destination": dest.name,
+					"error":       err,
+				}).Warn("failed to warm up the destination")
+				return
+			}
+
+			log.WithFields(log.Fields{
+				"destination": dest.name,
+				"duration":    time.Now().Sub(start),
+			}).Info("destination warmed up")
+		}(dest)
+	}
+
+	join.Wait()
+}
+
+// exitOnce terminates the program, with a non-zero status if messages were
+// dropped by any destination.
+func exitOnce(dests []destination) {
+	status := 0
+
+	for _, dest := range dests {
+		if n := dest.droppedCount(); n != 0 {
+			log.WithFields(log.Fields{
+				"destination": dest.name,
+				"count":       n,
+			}).Error("messages were dropped")
+			status = 1
+		}
+	}
+
+	os.Exit(status)
+}
+
+// nodeID derives the node of snowflake IDs from the hostname, different hosts
+// may get the same node.
+func nodeID(hostname string) int {
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	return int(h.Sum32() % (lib.MaxSnowflakeNode + 1))
+}
+
 func openSources(sources []source) (readers []reader, err error) {
 	readers = make([]reader, 0, len(sources))
 
@@ -224,6 +884,7 @@ func openSources(sources []source) (readers []reader, err error) {
 			readers = append(readers, reader{
 				Reader: r,
 				name:   source.name,
+				done:   make(chan struct{}),
 			})
 		}
 	}
@@ -239,14 +900,58 @@ func setupSignals(sigchan chan<- os.Signal) {
 	signal.Notify(sigchan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 }
 
-func startReaders(readers []reader, msgchan chan<- lib.Message, counter *int32, hostname string) {
+// readerOptions are the settings shared by all the readers, describing how the
+// messages they read are completed before being sent to the main loop.
+type readerOptions struct {
+	hostname   string
+	provenance bool
+	quarantine *quarantiner
+	encrypter  *lib.FieldEncrypter
+	splitter   *lib.EventSplitter
+	ids        lib.IDGenerator
+
+	// Each reader gets its own catch-up limiter when the threshold is set.
+	catchUpThreshold time.Duration
+	catchUpRate      int
+}
+
+// transforms returns the names of the steps read applies to the messages, in
+// the order they are applied, to draw the pipeline graph.
+func (opts readerOptions) transforms() (list []string) {
+	for _, t := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"catch-up", opts.catchUpThreshold != 0},
+		{"provenance", opts.provenance},
+		{"split-field", opts.splitter != nil},
+		{"event-ids", opts.ids != nil},
+		{"encrypt-fields", opts.encrypter != nil},
+	} {
+		if t.enabled {
+			list = append(list, t.name)
+		}
+	}
+	return
+}
+
+func startReaders(readers []reader, msgchan chan<- lib.Message, counter *int32, opts readerOptions) {
 	for _, reader := range readers {
-		go read(reader, msgchan, counter, hostname)
+		if opts.catchUpThreshold != 0 {
+			reader.catchUp = lib.NewCatchUpLimiter(opts.catchUpThreshold, opts.catchUpRate)
+		}
+		go read(reader, msgchan, counter, opts)
 	}
 }
 
 func stopReaders(readers []reader) {
 	for _, reader := range readers {
+		// The readers may be stopped more than once, only from the main loop.
+		select {
+		case <-reader.done:
+		default:
+			close(reader.done)
+		}
 		reader.Close()
 	}
 }
@@ -257,13 +962,19 @@ func term(c chan<- lib.Message, counter *int32) {
 	}
 }
 
-func read(r reader, c chan<- lib.Message, counter *int32, hostname string) {
+func read(r reader, c chan<- lib.Message, counter *int32, opts readerOptions) {
+	q := opts.quarantine
 	defer term(c, counter)
 	for {
 		var msg lib.Message
 		var err error
 
 		if msg, err = r.ReadMessage(); err != nil {
+			if e, ok := err.(*lib.ParseError); ok {
+				q.sendInput(r.name, e.Input, e, time.Now())
+				continue
+			}
+
 			if err == io.EOF {
 				log.WithFields(log.Fields{
 					"reader": r.name,
@@ -277,7 +988,13 @@ func read(r reader, c chan<- lib.Message, counter *int32, hostname string) {
 			return
 		}
 
+		msg.IngestTime = time.Now()
+
 		if len(msg.Group) == 0 {
+			if q.dest != nil {
+				q.sendMessage(r.name, msg, errMissingGroup, time.Now())
+				continue
+			}
 			log.WithFields(log.Fields{
 				"reader":  r.name,
 				"missing": "group",
@@ -286,6 +1003,10 @@ func read(r reader, c chan<- lib.Message, counter *int32, hostname string) {
 		}
 
 		if len(msg.Stream) == 0 {
+			if q.dest != nil {
+				q.sendMessage(r.name, msg, errMissingStream, time.Now())
+				continue
+			}
 			log.WithFields(log.Fields{
 				"reader":  r.name,
 				"missing": "stream",
@@ -294,7 +1015,7 @@ func read(r reader, c chan<- lib.Message, counter *int32, hostname string) {
 		}
 
 		if len(msg.Event.Info.Host) == 0 {
-			msg.Event.Info.Host = hostname
+			msg.Event.Info.Host = opts.hostname
 		}
 
 		if msg.Event.Time == (time.Time{}) {
@@ -305,30 +1026,298 @@ func read(r reader, c chan<- lib.Message, counter *int32, hostname string) {
 			msg.Event.Data = ecslogs.EventData{}
 		}
 
-		c <- msg
+		if r.catchUp != nil {
+			// Throttling the reader leaves the live messages of the other
+			// sources the capacity of the destinations.
+			if late, delay := r.catchUp.Delay(msg, time.Now()); late {
+				msg.Event.Data[lib.CatchUpKey] = true
+
+				// The delay is cut short on shutdown, the message is still
+				// forwarded so its position can be acknowledged.
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-r.done:
+					timer.Stop()
+				}
+			}
+		}
+
+		if opts.provenance {
+			msg.Event.Data[lib.ProvenanceKey] = lib.Provenance{
+				Source:     r.name,
+				Host:       opts.hostname,
+				Cursor:     msg.Cursor,
+				IngestTime: msg.IngestTime,
+			}
+		}
+
+		if r.acks != nil {
+			msg.Ack = r.acks.Track(msg.Cursor)
+		}
+
+		msgs := []lib.Message{msg}
+
+		if opts.splitter != nil {
+			// Each of the events is released once it's flushed.
+			msgs = opts.splitter.Split(msg)
+			msg.Ack.Hold(len(msgs) - 1)
+		}
+
+		for _, msg := range msgs {
+			if opts.ids != nil && len(msg.Event.Info.ID) == 0 {
+				msg.Event.Info.ID = opts.ids.NewID(time.Now())
+			}
+
+			if opts.encrypter != nil {
+				if err = opts.encrypter.Encrypt(msg.Event.Data); err != nil {
+					// Sending the message unencrypted would leak the values.
+					log.WithFields(log.Fields{
+						"reader": r.name,
+						"group":  msg.Group,
+						"stream": msg.Stream,
+						"error":  err,
+					}).Error("dropping message because its fields couldn't be encrypted")
+					msg.Ack.Drop()
+					continue
+				}
+			}
+
+			c <- msg
+		}
 	}
 }
 
-func write(dest destination, group, stream string, batch lib.MessageBatch, join *sync.WaitGroup) {
+// writeAttempts is the maximum number of times a batch is submitted to a
+// destination when writes fail because it is throttled or unreachable.
+const writeAttempts = 4
+
+func write(dest destination, group, stream string, batch lib.MessageBatch, pending *pendingBatch, join *sync.WaitGroup) {
 	defer join.Done()
+	defer dest.finished()
+	defer pending.done()
+
+	if dest.window != nil {
+		defer dest.release()
+	}
+
+	if dest.limit != nil {
+		dest.limit.Wait(dest.name, batch.ContentLength())
+	}
+
+	writeBatch(dest, group, stream, batch)
+}
+
+// writeBatch submits batch to dest, the way failed writes are handled depends
+// on the kind of error returned by the destination. The messages are released
+// once they were written, or dropped so the position of their source isn't
+// saved past them.
+func writeBatch(dest destination, group, stream string, batch lib.MessageBatch) {
+	delay := &backoff.Backoff{
+		Factor: 2,
+		Min:    1 * time.Second,
+		Max:    30 * time.Second,
+	}
+	reopened := false
+
+	if s := dest.outage.spoolOf(dest); s != nil && s.Pending() != 0 && s.Push(batch) == nil {
+		// The batch is queued behind the ones spooled during the outage so
+		// messages are written in order.
+		batch.Release()
+		replaySpool(dest, s)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		b := batch
+
+		if dest.latency {
+			// Stamped at each attempt so retried events report when they
+			// were actually sent.
+			b = lib.StampLatency(batch, time.Now())
+		}
+
+		err := writeOnce(dest, group, stream, b)
+
+		if err == nil {
+			dest.succeeded()
+			dest.ledger.Record(group, stream, batch, time.Now())
+			if dest.cost != nil {
+				dest.cost.Record(group, batch)
+			}
+			batch.Release()
+
+			if s := dest.outage.spoolOf(dest); s != nil && s.Pending() != 0 {
+				replaySpool(dest, s)
+			}
+			return
+		}
+
+		dest.failed(err, time.Now())
+
+		if h := lib.HTTPErrorOf(err); h != nil {
+			lib.Metrics.Counter("ecs_logs_http_errors_total", "destination", dest.name, "status", strconv.Itoa(h.StatusCode)).Add(1)
+		}
+
+		switch lib.ErrorKindOf(err) {
+		case lib.ThrottledError, lib.UnreachableError:
+			if dest.outage.retry(dest, attempt) {
+				logRetryBatch(dest.name, group, stream, err, batch)
+				time.Sleep(delay.Duration())
+				continue
+			}
+
+			if dest.outage.spool(dest, batch) {
+				batch.Release()
+				return
+			}
+
+		case lib.OversizedError:
+			if len(batch) > 1 {
+				head, tail := lib.SplitMarkedBatch(batch, len(batch)/2)
+				writeBatch(dest, group, stream, head)
+				writeBatch(dest, group, stream, tail)
+				return
+			}
+
+		case lib.AuthFailureError:
+			// Closing the stream on the destination discards the writer so a
+			// new one is opened with the refreshed credentials.
+			if !reopened {
+				reopened = true
+
+				if err := lib.RefreshCredentials(dest.name, time.Now()); err != nil {
+					log.WithFields(log.Fields{
+						"destination": dest.name,
+						"error":       err,
+					}).Warn("failed to refresh credentials")
+				}
+
+				dest.Close(group, stream)
+				continue
+			}
+
+		case lib.FatalError:
+			log.WithFields(log.Fields{
+				"group":       group,
+				"stream":      stream,
+				"destination": dest.name,
+				"error":       err,
+			}).Fatal("fatal error writing message batch")
+		}
+
+		dest.drop(batch)
+		dest.outage.drop(dest, batch)
+		logDropBatch(dest.name, group, stream, err, batch)
+		batch.Drop()
+		return
+	}
+}
+
+// replaySpool writes the batches spooled during an outage to dest, in the order
+// they were spooled, until one fails.
+func replaySpool(dest destination, s *lib.Spool) {
+	n, err := s.Replay(func(batch lib.MessageBatch) error {
+		if len(batch) == 0 {
+			return nil
+		}
 
+		group, stream, b := batch[0].Group, batch[0].Stream, batch
+
+		if dest.latency {
+			b = lib.StampLatency(batch, time.Now())
+		}
+
+		if err := writeOnce(dest, group, stream, b); err != nil {
+			dest.failed(err, time.Now())
+			return err
+		}
+
+		dest.succeeded()
+		dest.ledger.Record(group, stream, batch, time.Now())
+		return nil
+	})
+
+	if n != 0 || err != nil {
+		log.WithFields(log.Fields{
+			"destination": dest.name,
+			"count":       n,
+			"pending":     s.Pending(),
+			"error":       err,
+		}).Info("replayed spooled message batches")
+	}
+}
+
+func writeOnce(dest destination, group, stream string, batch lib.MessageBatch) (err error) {
 	var writer lib.Writer
-	var err error
 
 	if writer, err = dest.Open(group, stream); err != nil {
-		logDropBatch(dest.name, group, stream, err, batch)
 		return
 	}
 	defer writer.Close()
 
-	if err = writer.WriteMessageBatch(batch); err != nil {
+	return writer.WriteMessageBatch(batch)
+}
+
+// divertOversized sends the events exceeding the size limit of dest to the
+// destination they are diverted to, keeping their group and stream.
+func divertOversized(dest destination, group string, stream string, batch lib.MessageBatch, join *sync.WaitGroup) {
+	defer join.Done()
+
+	w, err := dest.divert.Open(group, stream)
+
+	if err == nil {
+		err = w.WriteMessageBatch(batch)
+		w.Close()
+	}
+
+	if err != nil {
+		dest.drop(batch)
 		logDropBatch(dest.name, group, stream, err, batch)
+		batch.Drop()
 		return
 	}
+
+	batch.Release()
+}
+
+// blocked returns true if all the destinations are down with the block outage
+// policy, new batches aren't flushed then since they would wait in their
+// goroutines until a destination is back.
+func blocked(dests []destination) bool {
+	return len(dests) != 0 && dests[0].outage.blocking()
+}
+
+// windowFull returns true if one of the active destinations has no write slot
+// left. Streams aren't flushed then, their messages stay buffered until a slot
+// is given back, so the main loop never waits for a slow destination.
+func windowFull(dests []destination) bool {
+	for _, dest := range dests {
+		if dest.window != nil && dest.active() && len(dest.window) == cap(dest.window) {
+			return true
+		}
+	}
+	return false
+}
+
+// release gives back the write slot taken for a batch.
+func (d destination) release() {
+	<-d.window
+
+	select {
+	case d.freed <- struct{}{}:
+	default:
+	}
 }
 
 func flush(dests []destination, stream *lib.Stream, limits lib.StreamLimits, now time.Time, join *sync.WaitGroup) {
 	for {
+		// Forced flushes happen on shutdown, where waiting for the slots is
+		// what the main loop does anyway.
+		if !limits.Force && (windowFull(dests) || blocked(dests)) {
+			break
+		}
+
 		batch, reason := stream.Flush(limits, now)
 
 		if len(batch) == 0 {
@@ -352,9 +1341,63 @@ func flush(dests []destination, stream *lib.Stream, limits lib.StreamLimits, now
 			"reason": reason,
 		}).Info("flushing message batch")
 
+		// Messages that aren't sent to a destination because it was drained
+		// aren't delivered, the position of their source isn't saved past them.
+		delivered := true
+
+		// The messages are pending until all the destinations wrote them.
+		var pending *pendingBatch
+
 		for _, dest := range dests {
+			if !dest.active() {
+				delivered = false
+				dest.skip(batch)
+				continue
+			}
+			b := batch
+			if dest.levels != nil {
+				if b = dest.levels.Filter(batch); len(b) == 0 {
+					continue
+				}
+			}
+			if dest.oversize != nil {
+				var diverted lib.MessageBatch
+				if b, diverted = dest.oversize.Apply(b); len(diverted) != 0 {
+					join.Add(1)
+					diverted.Hold()
+					go divertOversized(dest, stream.Group(), stream.Name(), diverted, join)
+				}
+				if len(b) == 0 {
+					continue
+				}
+			}
+			if dest.marks != nil {
+				b = dest.marks.Mark(stream.Group(), stream.Name(), b)
+			}
+			if dest.window != nil {
+				// Taking the slot here instead of in the goroutine keeps
+				// batches in order and doesn't pile up goroutines while the
+				// destination is slow. It never blocks unless the flush is
+				// forced since windowFull was checked before.
+				dest.window <- struct{}{}
+			}
+			if pending == nil {
+				pending = dest.pending.batch(len(batch))
+			}
 			join.Add(1)
-			go write(dest, stream.Group(), stream.Name(), batch, join)
+			dest.started()
+			pending.hold()
+			b.Hold()
+			go write(dest, stream.Group(), stream.Name(), b, pending, join)
+		}
+		pending.done()
+
+		// The messages are delivered once the batches holding them were
+		// written to all the destinations.
+		if delivered {
+			batch.Release()
+		} else {
+			batch.Drop()
 		}
 	}
 }
@@ -367,11 +1410,11 @@ func flushAll(dests []destination, store *lib.Store, limits lib.StreamLimits, no
 	})
 }
 
-func flushQueue(dests []destination, store *lib.Store, queue *lib.MessageQueue, limits lib.StreamLimits, now time.Time, join *sync.WaitGroup) {
+func flushQueue(dests []destination, store *lib.Store, queue *lib.MessageQueue, limits lib.StreamLimits, now time.Time, join *sync.WaitGroup, lifecycle bool) {
 	streams := make(map[string]*lib.Stream)
 
 	for _, msg := range queue.Flush() {
-		_, stream := store.Add(msg, now)
+		stream := add(store, msg, now, lifecycle)
 		key := stream.Group() + ":" + stream.Name()
 
 		if streams[key] == nil {
@@ -384,10 +1427,65 @@ func flushQueue(dests []destination, store *lib.Store, queue *lib.MessageQueue,
 	}
 }
 
+// add stores msg in the stream it belongs to, when lifecycle events are enabled
+// and the stream didn't exist an event is generated to signal it was opened.
+func add(store *lib.Store, msg lib.Message, now time.Time, lifecycle bool) (stream *lib.Stream) {
+	if lifecycle && store.Get(msg.Group, msg.Stream) == nil {
+		store.Add(lifecycleMessage(msg.Group, msg.Stream, msg.Event.Info.Host, "opened", now), now)
+	}
+	_, stream = store.Add(msg, now)
+	return
+}
+
+func markIdle(store *lib.Store, hostname string, timeout time.Duration, now time.Time) {
+	store.ForEach(func(group *lib.Group) {
+		group.ForEach(func(stream *lib.Stream) {
+			// The idle event is added to streams that would otherwise be removed,
+			// they get removed once it has been flushed.
+			if stream.HasExpired(timeout, now) {
+				stream.MarkIdle(lifecycleMessage(stream.Group(), stream.Name(), hostname, "idle", now))
+			}
+		})
+	})
+}
+
+func lifecycleMessage(group string, stream string, hostname string, state string, now time.Time) lib.Message {
+	event := ecslogs.MakeEvent(ecslogs.INFO, "stream "+state)
+	event.Time = now
+	event.Info.Host = hostname
+	event.Data = ecslogs.EventData{"lifecycle": state}
+	return lib.Message{
+		Group:  group,
+		Stream: stream,
+		Event:  event,
+	}
+}
+
+func heartbeat(store *lib.Store, hostname string, interval time.Duration, now time.Time) {
+	store.ForEach(func(group *lib.Group) {
+		group.ForEach(func(stream *lib.Stream) {
+			event := ecslogs.MakeEvent(ecslogs.INFO, "heartbeat")
+			event.Time = now
+			event.Info.Host = hostname
+			event.Data = ecslogs.EventData{"heartbeat": true}
+
+			stream.Heartbeat(lib.Message{
+				Group:  stream.Group(),
+				Stream: stream.Name(),
+				Event:  event,
+			}, interval, now)
+		})
+	})
+}
+
 func removeExpired(dests []destination, store *lib.Store, cacheTimeout time.Duration, now time.Time) {
 	for _, stream := range store.RemoveExpired(cacheTimeout, now) {
 		for _, dest := range dests {
 			dest.Close(stream.Group(), stream.Name())
+			dest.ledger.Expire(stream.Group(), stream.Name())
+			if dest.marks != nil {
+				dest.marks.Remove(stream.Group(), stream.Name())
+			}
 		}
 		log.WithFields(log.Fields{
 			"group":  stream.Group(),
@@ -396,14 +1494,34 @@ func removeExpired(dests []destination, store *lib.Store, cacheTimeout time.Dura
 	}
 }
 
-func logDropBatch(dest string, group string, stream string, err error, batch lib.MessageBatch) {
+func logRetryBatch(dest string, group string, stream string, err error, batch lib.MessageBatch) {
 	log.WithFields(log.Fields{
 		"group":       group,
 		"stream":      stream,
 		"destination": dest,
 		"error":       err,
+		"kind":        lib.ErrorKindOf(err).String(),
 		"count":       len(batch),
-	}).Error("dropping message batch")
+	}).Warn("retrying message batch")
+}
+
+func logDropBatch(dest string, group string, stream string, err error, batch lib.MessageBatch) {
+	fields := log.Fields{
+		"group":       group,
+		"stream":      stream,
+		"destination": dest,
+		"error":       err,
+		"kind":        lib.ErrorKindOf(err).String(),
+		"count":       len(batch),
+	}
+
+	if h := lib.HTTPErrorOf(err); h != nil {
+		fields["status"] = h.StatusCode
+		fields["request_id"] = h.RequestID
+		fields["response"] = h.Body
+	}
+
+	log.WithFields(fields).Error("dropping message batch")
 
 	for _, msg := range batch {
 		log.WithFields(log.Fields{
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestReaderOptionsTransforms(t *testing.T) {
+	if list := (readerOptions{}).transforms(); len(list) != 0 {
+		t.Errorf("no transforms should be listed by default: %v", list)
+	}
+
+	ids, err := lib.NewIDGenerator("ulid", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := readerOptions{
+		provenance:       true,
+		splitter:         lib.NewEventSplitter("records"),
+		ids:              ids,
+		catchUpThreshold: time.Minute,
+	}
+
+	ref := []string{"catch-up", "provenance", "split-field", "event-ids"}
+
+	if list := opts.transforms(); !reflect.DeepEqual(list, ref) {
+		t.Errorf("invalid transforms:\n- expected: %v\n- found:    %v", ref, list)
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	dests := []destination{{name: "syslog"}, {name: "cloudwatchlogs"}}
+
+	weights, err := parseWeights("syslog:3, cloudwatchlogs:1", dests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(weights, map[string]int{"syslog": 3, "cloudwatchlogs": 1}) {
+		t.Errorf("invalid weights: %v", weights)
+	}
+
+	for _, s := range []string{"syslog", "syslog:0", "syslog:x", "file:1"} {
+		if _, err := parseWeights(s, dests); err == nil {
+			t.Errorf("%s: parsing should fail", s)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// Policies applied when all the destinations are down. By default batches are
+// retried a few times then dropped.
+const (
+	// Batches are dropped without being retried, and counted.
+	outageDrop = "drop"
+
+	// Batches are retried until they are written, and the sources aren't read
+	// until a destination is back.
+	outageBlock = "block"
+
+	// The program exits so it can be restarted, and the sources resumed,
+	// once a destination is back.
+	outageCrash = "crash"
+
+	// Batches are written to a directory per destination without being
+	// retried, and replayed in order once the destination is back.
+	outageSpool = "spool"
+)
+
+// outage detects when all the destinations are down and applies the policy
+// configured for this case.
+type outage struct {
+	policy   string
+	dests    []destination
+	dropped  *lib.Counter
+	spooled  *lib.Counter
+	stopping int32
+
+	// Directory and size limit of the spools of the destinations, which are
+	// opened once the destinations are known.
+	spoolDir string
+	spoolMax int64
+	spools   map[string]*lib.Spool
+}
+
+func newOutage(policy string, spoolDir string, spoolMax int64) (*outage, error) {
+	switch policy {
+	case "", outageDrop, outageBlock, outageCrash:
+	case outageSpool:
+		if len(spoolDir) == 0 {
+			return nil, fmt.Errorf("the %s outage policy requires a spool directory", policy)
+		}
+	default:
+		return nil, fmt.Errorf("invalid outage policy: %s", policy)
+	}
+
+	return &outage{
+		policy:   policy,
+		dropped:  lib.Metrics.Counter("ecs_logs_outage_dropped_messages_total"),
+		spooled:  lib.Metrics.Counter("ecs_logs_outage_spooled_messages_total"),
+		spoolDir: spoolDir,
+		spoolMax: spoolMax,
+	}, nil
+}
+
+// openSpools opens the spool of each destination in a subdirectory named
+// after it, when the policy is spool.
+func (o *outage) openSpools() (err error) {
+	if o.policy != outageSpool {
+		return
+	}
+
+	o.spools = make(map[string]*lib.Spool, len(o.dests))
+
+	for _, dest := range o.dests {
+		var s *lib.Spool
+
+		if s, err = lib.OpenSpool(filepath.Join(o.spoolDir, dest.name), o.spoolMax); err != nil {
+			return
+		}
+
+		o.spools[dest.name] = s
+	}
+
+	return
+}
+
+// spoolOf returns the spool of dest, or nil if the policy isn't spool.
+func (o *outage) spoolOf(dest destination) *lib.Spool {
+	return o.spools[dest.name]
+}
+
+// spool writes a batch that failed to be written to dest to its spool, when
+// the policy is spool and all the destinations are down. It returns false if
+// the batch wasn't spooled.
+func (o *outage) spool(dest destination, batch lib.MessageBatch) bool {
+	s := o.spoolOf(dest)
+
+	if s == nil || !o.down() {
+		return false
+	}
+
+	if err := s.Push(batch); err != nil {
+		log.WithFields(log.Fields{
+			"destination": dest.name,
+			"error":       err,
+		}).Warn("failed to spool message batch")
+		return false
+	}
+
+	o.spooled.Add(int64(len(batch)))
+	return true
+}
+
+// down returns whether all the active destinations are failing.
+func (o *outage) down() bool {
+	n := 0
+
+	for _, dest := range o.dests {
+		if !dest.active() {
+			continue
+		}
+		if !dest.failing() {
+			return false
+		}
+		n++
+	}
+
+	return n != 0
+}
+
+// stop is called when the program is shutting down, batches are not retried
+// indefinitely anymore and the sources are read until they are closed.
+func (o *outage) stop() {
+	atomic.StoreInt32(&o.stopping, 1)
+}
+
+func (o *outage) stopped() bool {
+	return atomic.LoadInt32(&o.stopping) != 0
+}
+
+// blocking returns whether the sources must not be read.
+func (o *outage) blocking() bool {
+	return o.policy == outageBlock && !o.stopped() && o.down()
+}
+
+// retry returns whether a batch that failed to be written to dest attempt
+// times must be retried.
+func (o *outage) retry(dest destination, attempt int) bool {
+	switch o.policy {
+	case outageBlock:
+		if dest.active() && !o.stopped() {
+			return true
+		}
+	case outageDrop, outageSpool:
+		if o.down() {
+			return false
+		}
+	}
+	return attempt < writeAttempts
+}
+
+// drop is called when a batch is dropped by dest.
+func (o *outage) drop(dest destination, batch lib.MessageBatch) {
+	if !o.down() {
+		return
+	}
+
+	if o.policy == outageCrash {
+		log.WithField("destination", dest.name).Fatal("all destinations are down")
+	}
+
+	o.dropped.Add(int64(len(batch)))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func TestNewOutage(t *testing.T) {
+	if _, err := newOutage("spool", "", 0); err == nil {
+		t.Error("the spool policy should require a directory")
+	}
+
+	if _, err := newOutage("buffer", "", 0); err == nil {
+		t.Error("unknown policies should be rejected")
+	}
+}
+
+func TestOutageSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, err := newOutage(outageSpool, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := destination{name: "syslog", state: newDestinationState("syslog"), outage: o}
+	o.dests = []destination{dest}
+
+	if err := o.openSpools(); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := lib.MessageBatch{{Group: "abc", Stream: "0"}}
+
+	if o.spool(dest, batch) {
+		t.Error("batches should not be spooled while the destination is up")
+	}
+
+	dest.failed(lib.NewWriterError(lib.UnreachableError, errors.New("connection refused")), time.Now())
+
+	if o.retry(dest, 1) {
+		t.Error("batches should not be retried while the destinations are down")
+	}
+
+	if !o.spool(dest, batch) {
+		t.Error("batches should be spooled while the destinations are down")
+	}
+
+	if n := o.spoolOf(dest).Pending(); n != 1 {
+		t.Errorf("invalid number of spooled batches: %d", n)
+	}
+}
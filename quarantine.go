@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// quarantineGroup is the group of the messages sent to the quarantine
+// destination, their stream is the name of the source the input came from.
+const quarantineGroup = "ecs-logs-quarantine"
+
+// quarantineQueueDepth is the number of quarantined messages waiting to be
+// written after which new ones are dropped, so a slow quarantine destination
+// doesn't block the readers.
+const quarantineQueueDepth = 1000
+
+// quarantiner sends input that couldn't be turned into a valid message to the
+// quarantine destination with the error attached, so parsing rules can be
+// fixed with real samples. The input is dropped if no quarantine destination
+// was configured.
+//
+// When fields are encrypted the input is encrypted too before being sent, the
+// fields of messages missing their group or stream are encrypted as usual, and
+// input that couldn't be parsed is encrypted as a whole since the fields can't
+// be found in it.
+//
+// Messages are written to the quarantine destination by a background
+// goroutine, stop must be called once the readers returned to wait for the
+// pending ones.
+type quarantiner struct {
+	dest      lib.Destination
+	hostname  string
+	encrypter *lib.FieldEncrypter
+	queue     chan lib.Message
+	done      chan struct{}
+}
+
+func newQuarantiner(dest lib.Destination, hostname string, encrypter *lib.FieldEncrypter) *quarantiner {
+	q := &quarantiner{
+		dest:      dest,
+		hostname:  hostname,
+		encrypter: encrypter,
+	}
+
+	if dest != nil {
+		q.queue = make(chan lib.Message, quarantineQueueDepth)
+		q.done = make(chan struct{})
+		go q.run()
+	}
+
+	return q
+}
+
+// stop waits for the quarantined messages to be written, nothing may be
+// quarantined after it was called.
+func (q *quarantiner) stop() {
+	if q.dest != nil {
+		close(q.queue)
+		<-q.done
+	}
+}
+
+// sendInput quarantines input that couldn't be parsed.
+func (q *quarantiner) sendInput(source string, input string, cause error, now time.Time) {
+	if q.dest != nil && q.encrypter != nil {
+		var err error
+
+		if input, err = q.encrypter.EncryptValue(input); err != nil {
+			q.dropped(source, cause, err)
+			return
+		}
+	}
+
+	q.send(source, input, cause, now)
+}
+
+// sendMessage quarantines a message that misses a required field.
+func (q *quarantiner) sendMessage(source string, msg lib.Message, cause error, now time.Time) {
+	if q.dest != nil && q.encrypter != nil && msg.Event.Data != nil {
+		if err := q.encrypter.Encrypt(msg.Event.Data); err != nil {
+			q.dropped(source, cause, err)
+			return
+		}
+	}
+
+	q.send(source, msg.String(), cause, now)
+}
+
+func (q *quarantiner) send(source string, input string, cause error, now time.Time) {
+	if q.dest == nil {
+		log.WithFields(log.Fields{
+			"reader": source,
+			"error":  cause,
+		}).Warn("dropping input that couldn't be parsed")
+		return
+	}
+
+	msg := lib.Message{
+		Group:  quarantineGroup,
+		Stream: source,
+		Event: ecslogs.Event{
+			Level:   ecslogs.WARN,
+			Time:    now,
+			Info:    ecslogs.EventInfo{Host: q.hostname},
+			Data:    ecslogs.EventData{"error": cause.Error()},
+			Message: input,
+		},
+	}
+
+	select {
+	case q.queue <- msg:
+	default:
+		lib.Metrics.Counter("ecs_logs_quarantine_dropped_total", "reader", source).Add(1)
+		log.WithFields(log.Fields{
+			"reader": source,
+			"error":  cause,
+		}).Warn("dropping input that couldn't be parsed because the quarantine is full")
+	}
+}
+
+func (q *quarantiner) run() {
+	defer close(q.done)
+
+	for msg := range q.queue {
+		w, err := q.dest.Open(msg.Group, msg.Stream)
+
+		if err == nil {
+			err = w.WriteMessage(msg)
+			w.Close()
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reader": msg.Stream,
+				"error":  err,
+			}).Error("failed to quarantine input that couldn't be parsed")
+		}
+	}
+}
+
+func (q *quarantiner) dropped(source string, cause error, err error) {
+	log.WithFields(log.Fields{
+		"reader": source,
+		"cause":  cause,
+		"error":  err,
+	}).Error("dropping input that couldn't be parsed because it couldn't be encrypted")
+}
+
+var (
+	errMissingGroup  = errors.New("missing group")
+	errMissingStream = errors.New("missing stream")
+)
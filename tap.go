@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+const (
+	// How long taps stay open when no duration is given, and the longest
+	// duration allowed so a forgotten tap doesn't fill the disk.
+	defaultTapDuration = 5 * time.Minute
+	maxTapDuration     = 1 * time.Hour
+
+	// The size at which a tap is closed, and the number of messages waiting to
+	// be written to a tap after which new ones are dropped, so a busy group
+	// can neither fill the disk nor slow down the main loop.
+	maxTapSize    = 100 * 1024 * 1024
+	tapQueueDepth = 1000
+)
+
+// tap copies the messages of a group, or of a single stream when it is set,
+// to a file until it expires.
+type tap struct {
+	Group  string    `json:"group"`
+	Stream string    `json:"stream,omitempty"`
+	Path   string    `json:"path"`
+	Until  time.Time `json:"until"`
+
+	// Set on the taps opened from the features file, which closes them.
+	Managed bool `json:"managed,omitempty"`
+
+	file  *os.File
+	lines chan []byte
+	done  chan struct{}
+}
+
+// tapSet is the list of open taps, messages are copied by the main loop while
+// taps are opened and closed by the admin endpoints. Each tap is written by
+// its own goroutine.
+type tapSet struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize int64
+	taps    []*tap
+}
+
+func newTapSet(dir string) *tapSet {
+	return &tapSet{dir: dir, maxSize: maxTapSize}
+}
+
+// open starts copying the messages of group and stream to a new file in the
+// directory of the set, for the given duration. Managed taps are the ones
+// opened from the features file.
+func (s *tapSet) open(group string, stream string, duration time.Duration, managed bool, now time.Time) (t *tap, err error) {
+	if len(group) == 0 {
+		err = fmt.Errorf("missing group")
+		return
+	}
+
+	if duration <= 0 || duration > maxTapDuration {
+		err = fmt.Errorf("invalid tap duration, must be positive and at most %s: %s", maxTapDuration, duration)
+		return
+	}
+
+	name := url.PathEscape(group)
+	if len(stream) != 0 {
+		name += "." + url.PathEscape(stream)
+	}
+	name += "." + now.UTC().Format("20060102T150405") + ".log"
+
+	t = &tap{
+		Group:   group,
+		Stream:  stream,
+		Path:    filepath.Join(s.dir, name),
+		Until:   now.Add(duration),
+		Managed: managed,
+		lines:   make(chan []byte, tapQueueDepth),
+		done:    make(chan struct{}),
+	}
+
+	if t.file, err = os.OpenFile(t.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		t = nil
+		return
+	}
+
+	go s.write(t)
+
+	s.mutex.Lock()
+	s.taps = append(s.taps, t)
+	s.mutex.Unlock()
+
+	time.AfterFunc(duration, func() { s.close(t) })
+
+	log.WithFields(log.Fields{
+		"group":  group,
+		"stream": stream,
+		"path":   t.Path,
+		"until":  t.Until,
+	}).Info("tap opened")
+	return
+}
+
+// close stops copying messages to t, it does nothing if t was already closed.
+func (s *tapSet) close(t *tap) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, x := range s.taps {
+		if x == t {
+			s.taps = append(s.taps[:i], s.taps[i+1:]...)
+			close(t.lines)
+			log.WithField("path", t.Path).Info("tap closed")
+			return
+		}
+	}
+}
+
+// closeMatching closes the taps of group and stream, or of all the streams of
+// group when stream is empty.
+func (s *tapSet) closeMatching(group string, stream string) (n int) {
+	for _, t := range s.list() {
+		if t.Group == group && (len(stream) == 0 || t.Stream == stream) {
+			s.close(t)
+			n++
+		}
+	}
+	return
+}
+
+// closeManaged closes the taps of group and stream opened from the features
+// file.
+func (s *tapSet) closeManaged(group string, stream string) {
+	for _, t := range s.list() {
+		if t.Managed && t.Group == group && t.Stream == stream {
+			s.close(t)
+		}
+	}
+}
+
+// hasManaged returns true if a tap of group and stream opened from the
+// features file is still open.
+func (s *tapSet) hasManaged(group string, stream string) bool {
+	for _, t := range s.list() {
+		if t.Managed && t.Group == group && t.Stream == stream {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tapSet) list() []*tap {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*tap{}, s.taps...)
+}
+
+// write writes the lines copied to t until it is closed, which happens when
+// the file reaches the maximum size of the set.
+func (s *tapSet) write(t *tap) {
+	defer close(t.done)
+	defer t.file.Close()
+
+	var size int64
+	var full bool
+
+	for b := range t.lines {
+		if full {
+			continue
+		}
+
+		if size += int64(len(b)); size > s.maxSize {
+			log.WithFields(log.Fields{
+				"path": t.Path,
+				"size": s.maxSize,
+			}).Warn("tap reached its maximum size")
+			full = true
+			go s.close(t)
+			continue
+		}
+
+		if _, err := t.file.Write(b); err != nil {
+			log.WithFields(log.Fields{
+				"path":  t.Path,
+				"error": err,
+			}).Warn("failed to write to tap")
+		}
+	}
+}
+
+// copy queues msg, as a line of JSON, to be written to the taps it matches. It
+// never blocks, the message is dropped when too many are already waiting.
+func (s *tapSet) copy(msg lib.Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.taps) == 0 {
+		return
+	}
+
+	var b []byte
+
+	for _, t := range s.taps {
+		if t.Group != msg.Group || (len(t.Stream) != 0 && t.Stream != msg.Stream) {
+			continue
+		}
+
+		if b == nil {
+			b = append(msg.Bytes(), '\n')
+		}
+
+		select {
+		case t.lines <- b:
+		default:
+			lib.Metrics.Counter("ecs_logs_tap_dropped_messages_total", "group", msg.Group).Add(1)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapralVV/ecs-logs-go"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+func newTestTapSet(t *testing.T) (*tapSet, func()) {
+	dir, err := ioutil.TempDir("", "ecs-logs-taps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTapSet(dir), func() { os.RemoveAll(dir) }
+}
+
+func readTap(t *testing.T, s *tapSet, x *tap) []string {
+	s.close(x)
+	<-x.done
+
+	b, err := ioutil.ReadFile(x.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestTapSetCopy(t *testing.T) {
+	s, cleanup := newTestTapSet(t)
+	defer cleanup()
+
+	group, err := s.open("api", "", time.Minute, false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := s.open("api", "web-1", time.Minute, true, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []lib.Message{
+		{Group: "api", Stream: "web-1", Event: ecslogs.Event{Message: "1"}},
+		{Group: "api", Stream: "web-2", Event: ecslogs.Event{Message: "2"}},
+		{Group: "worker", Stream: "web-1", Event: ecslogs.Event{Message: "3"}},
+	} {
+		s.copy(msg)
+	}
+
+	if lines := readTap(t, s, group); len(lines) != 2 {
+		t.Errorf("invalid number of messages copied to the group tap: %q", lines)
+	}
+
+	if lines := readTap(t, s, stream); len(lines) != 1 {
+		t.Errorf("invalid number of messages copied to the stream tap: %q", lines)
+	}
+
+	if n := len(s.list()); n != 0 {
+		t.Errorf("invalid number of open taps: %d", n)
+	}
+}
+
+func TestTapSetManaged(t *testing.T) {
+	s, cleanup := newTestTapSet(t)
+	defer cleanup()
+
+	if _, err := s.open("api", "web-1", time.Minute, false, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.hasManaged("api", "web-1") {
+		t.Error("a tap opened from the admin endpoint should not be managed")
+	}
+
+	if _, err := s.open("api", "web-1", time.Minute, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.hasManaged("api", "web-1") {
+		t.Error("a tap opened from the features file should be managed")
+	}
+
+	s.closeManaged("api", "web-1")
+
+	if taps := s.list(); len(taps) != 1 || taps[0].Managed {
+		t.Errorf("only the managed tap should have been closed: %+v", taps)
+	}
+
+	if n := s.closeMatching("api", ""); n != 1 {
+		t.Errorf("invalid number of closed taps: %d", n)
+	}
+}
+
+func TestTapSetMaxSize(t *testing.T) {
+	s, cleanup := newTestTapSet(t)
+	defer cleanup()
+
+	msg := lib.Message{Group: "api", Event: ecslogs.Event{Message: "hello"}}
+	s.maxSize = int64(2 * (len(msg.Bytes()) + 1))
+
+	x, err := s.open("api", "", time.Minute, false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i != 3; i++ {
+		s.copy(msg)
+	}
+
+	<-x.done
+
+	if n := len(s.list()); n != 0 {
+		t.Errorf("the tap should have been closed when reaching its maximum size: %d open", n)
+	}
+
+	if lines := readTap(t, s, x); len(lines) != 2 {
+		t.Errorf("invalid number of messages copied to the tap: %q", lines)
+	}
+}
+
+func TestTapSetOpenInvalid(t *testing.T) {
+	s, cleanup := newTestTapSet(t)
+	defer cleanup()
+
+	if _, err := s.open("", "", time.Minute, false, time.Now()); err == nil {
+		t.Error("opening a tap without a group should fail")
+	}
+
+	if _, err := s.open("api", "", 2*maxTapDuration, false, time.Now()); err == nil {
+		t.Error("opening a tap for longer than the maximum duration should fail")
+	}
+}
+
+func TestTapsHandler(t *testing.T) {
+	s, cleanup := newTestTapSet(t)
+	defer cleanup()
+
+	server := httptest.NewServer(tapsHandler(s))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"?group=api&stream=web-1&duration=10m", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opened tap
+	json.NewDecoder(res.Body).Decode(&opened)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated || opened.Group != "api" || opened.Stream != "web-1" || len(opened.Path) == 0 {
+		t.Errorf("invalid response to opening a tap: %d %+v", res.StatusCode, opened)
+	}
+
+	if res, err = http.Post(server.URL+"?group=api&duration=forever", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid status code for an invalid duration: %d", res.StatusCode)
+	}
+
+	if res, err = http.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []tap
+	json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+
+	if len(list) != 1 || list[0].Path != opened.Path {
+		t.Errorf("invalid list of taps: %+v", list)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		req, _ := http.NewRequest("DELETE", server.URL+"?group=api", nil)
+
+		if res, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != status {
+			t.Errorf("invalid status code for closing a tap: %d != %d", res.StatusCode, status)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kapralVV/ecs-logs/lib"
+)
+
+// How long to wait before opening a source again when it failed to open.
+const watchdogRetryDelay = 5 * time.Second
+
+// watchedReader reads a source with a reader that reports its polls, and
+// replaces the reader with a new one opened from the source when it fails or
+// when it's stuck: it was asked for a message but didn't poll the source for
+// longer than the timeout. A stuck reader is abandoned, so a wedged journal
+// handle doesn't stop the source from being read.
+type watchedReader struct {
+	source   source
+	timeout  time.Duration
+	restarts *lib.Counter
+
+	mutex     sync.Mutex
+	pump      *pump
+	stopAtEnd bool
+	closed    bool
+
+	// Receives the pumps found stuck by the watchdog.
+	stuck chan *pump
+
+	// Closed when the reader is closed.
+	closing chan struct{}
+}
+
+// watchReaders replaces the readers that report their polls with watched
+// readers.
+func watchReaders(readers []reader, sources []source, timeout time.Duration) {
+	for i, r := range readers {
+		if _, ok := r.Reader.(lib.PollingReader); !ok {
+			log.WithField("source", r.name).Warn("the source doesn't report its polls, it isn't watched")
+			continue
+		}
+
+		for _, src := range sources {
+			if src.name == r.name {
+				readers[i].Reader = newWatchedReader(src, r.Reader, timeout)
+				break
+			}
+		}
+	}
+}
+
+func newWatchedReader(src source, r lib.Reader, timeout time.Duration) *watchedReader {
+	w := &watchedReader{
+		source:   src,
+		timeout:  timeout,
+		restarts: lib.Metrics.Counter("ecs_logs_source_restarts_total", "source", src.name),
+		pump:     startPump(r, 0),
+		stuck:    make(chan *pump, 1),
+		closing:  make(chan struct{}),
+	}
+	go w.watch()
+	return w
+}
+
+func (w *watchedReader) ReadMessage() (msg lib.Message, err error) {
+	for {
+		w.mutex.Lock()
+		p := w.pump
+		w.mutex.Unlock()
+
+		select {
+		case res := <-p.results:
+			if len(res.msg.Cursor) != 0 {
+				res.msg.Cursor = strconv.FormatUint(p.gen, 10) + ":" + res.msg.Cursor
+			}
+
+			if res.err == nil || res.err == io.EOF {
+				return res.msg, res.err
+			}
+
+			if _, ok := res.err.(*lib.ParseError); ok {
+				return res.msg, res.err
+			}
+
+			log.WithFields(log.Fields{
+				"source": w.source.name,
+				"error":  res.err,
+			}).Error("the message reader failed, opening the source again")
+			w.restart(p)
+
+		case s := <-w.stuck:
+			if s != p {
+				continue
+			}
+
+			log.WithFields(log.Fields{
+				"source":  w.source.name,
+				"timeout": w.timeout,
+			}).Error("the message reader is stuck, opening the source again")
+			w.restart(p)
+
+		case <-w.closing:
+			err = io.EOF
+			return
+		}
+	}
+}
+
+// restart abandons the pump and starts a new one on a reader opened from the
+// source, retrying until it succeeds or the reader is closed.
+func (w *watchedReader) restart(p *pump) {
+	p.stop()
+	w.restarts.Add(1)
+
+	for {
+		r, err := w.source.Open()
+
+		if err == nil {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			if w.closed {
+				r.Close()
+				return
+			}
+
+			if s, ok := r.(lib.StopAtEndReader); ok && w.stopAtEnd {
+				s.StopAtEnd()
+			}
+
+			w.pump = startPump(r, p.gen+1)
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"source": w.source.name,
+			"error":  err,
+		}).Error("failed to open log source")
+
+		select {
+		case <-time.After(watchdogRetryDelay):
+		case <-w.closing:
+			return
+		}
+	}
+}
+
+// watch checks periodically whether the current pump is stuck.
+func (w *watchedReader) watch() {
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			w.mutex.Lock()
+			p := w.pump
+			w.mutex.Unlock()
+
+			if p.stuck(now, w.timeout) {
+				select {
+				case w.stuck <- p:
+				default:
+				}
+			}
+
+		case <-w.closing:
+			return
+		}
+	}
+}
+
+func (w *watchedReader) StopAtEnd() {
+	w.mutex.Lock()
+	w.stopAtEnd = true
+
+	if s, ok := w.pump.reader.(lib.StopAtEndReader); ok {
+		s.StopAtEnd()
+	}
+
+	w.mutex.Unlock()
+}
+
+// Ack forwards the cursor to the current reader if it saves its position.
+// The cursors are prefixed with the generation of the pump the message was
+// read from, the cursors of abandoned readers are ignored since they may have
+// no meaning to the reader that replaced them.
+func (w *watchedReader) Ack(cursor string) {
+	i := strings.IndexByte(cursor, ':')
+	if i < 0 {
+		return
+	}
+
+	gen, err := strconv.ParseUint(cursor[:i], 10, 64)
+	if err != nil {
+		return
+	}
+
+	w.mutex.Lock()
+	p := w.pump
+	w.mutex.Unlock()
+
+	if p.gen != gen {
+		return
+	}
+
+	if a, ok := p.reader.(lib.AckReader); ok {
+		a.Ack(cursor[i+1:])
+	}
+}
+
+func (w *watchedReader) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.closing)
+		w.pump.stop()
+	}
+
+	return nil
+}
+
+// pump reads messages from a reader in its own goroutine, so the reader can be
+// abandoned while it's blocked.
+type pump struct {
+	// Time at which the ongoing call to ReadMessage started, zero when the
+	// reader isn't being read.
+	reading int64
+
+	// Number of pumps started before this one by the watched reader.
+	gen uint64
+
+	reader  lib.Reader
+	results chan pumpResult
+	done    chan struct{}
+	once    sync.Once
+}
+
+type pumpResult struct {
+	msg lib.Message
+	err error
+}
+
+func startPump(r lib.Reader, gen uint64) *pump {
+	p := &pump{
+		gen:     gen,
+		reader:  r,
+		results: make(chan pumpResult),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *pump) run() {
+	for {
+		atomic.StoreInt64(&p.reading, time.Now().UnixNano())
+		msg, err := p.reader.ReadMessage()
+		atomic.StoreInt64(&p.reading, 0)
+
+		select {
+		case p.results <- pumpResult{msg, err}:
+		case <-p.done:
+			return
+		}
+
+		if err != nil {
+			if _, ok := err.(*lib.ParseError); !ok {
+				return
+			}
+		}
+	}
+}
+
+// stuck returns whether the reader was asked for a message and neither
+// returned one nor polled its source for longer than timeout.
+func (p *pump) stuck(now time.Time, timeout time.Duration) bool {
+	start := atomic.LoadInt64(&p.reading)
+
+	if start == 0 {
+		return false
+	}
+
+	last := time.Unix(0, start)
+
+	if r, ok := p.reader.(lib.PollingReader); ok {
+		if t := r.LastPoll(); t.After(last) {
+			last = t
+		}
+	}
+
+	return now.Sub(last) > timeout
+}
+
+func (p *pump) stop() {
+	p.once.Do(func() {
+		close(p.done)
+		p.reader.Close()
+	})
+}